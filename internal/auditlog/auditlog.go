@@ -3,6 +3,7 @@ package auditlog
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	audit "github.com/soulteary/audit-kit"
@@ -13,6 +14,20 @@ import (
 
 var log *logger.Logger
 
+// Herald event types not defined by audit-kit
+const (
+	EventRecoveryCodesGenerated audit.EventType = "recovery_codes_generated"
+	EventRecoveryCodeUsed       audit.EventType = "recovery_code_used"
+	EventRecoveryCodeFailed     audit.EventType = "recovery_code_failed"
+	EventWebAuthnRegistered     audit.EventType = "webauthn_registered"
+	EventWebAuthnVerified       audit.EventType = "webauthn_verified"
+	EventWebAuthnFailed         audit.EventType = "webauthn_failed"
+	EventTOTPEnrolled           audit.EventType = "totp_enrolled"
+	EventTOTPVerified           audit.EventType = "totp_verified"
+	EventTOTPFailed             audit.EventType = "totp_failed"
+	EventTOTPRevoked            audit.EventType = "totp_revoked"
+)
+
 // SetLogger sets the logger instance for the audit package
 func SetLogger(l *logger.Logger) {
 	log = l
@@ -95,52 +110,86 @@ func Stop() error {
 	return nil
 }
 
-// LogChallengeCreated records a challenge creation event
-func LogChallengeCreated(ctx context.Context, challengeID, userID, channel, destination, purpose, ip string) {
+// LogChallengeCreated records a challenge creation event; extra options (e.g. RiskOptions) are appended
+func LogChallengeCreated(ctx context.Context, challengeID, userID, channel, destination, purpose, ip string, extra ...audit.RecordOption) {
 	l := GetLogger()
 	if l == nil {
 		return
 	}
 
-	l.LogChallenge(ctx, audit.EventChallengeCreated, challengeID, userID, audit.ResultSuccess,
+	opts := []audit.RecordOption{
 		audit.WithRecordChannel(channel),
 		audit.WithRecordDestination(destination),
 		audit.WithRecordPurpose(purpose),
 		audit.WithRecordIP(ip),
-	)
+	}
+	l.LogChallenge(ctx, audit.EventChallengeCreated, challengeID, userID, audit.ResultSuccess, append(opts, extra...)...)
 }
 
-// LogSendSuccess records a successful send event
-func LogSendSuccess(ctx context.Context, challengeID, userID, channel, destination, purpose, provider, messageID, ip string) {
+// RiskOptions returns record options carrying a risk decision (score, action, reasons)
+func RiskOptions(score int, action string, reasons []string) []audit.RecordOption {
+	return []audit.RecordOption{
+		audit.WithRecordMetadata("risk_score", score),
+		audit.WithRecordMetadata("risk_action", action),
+		audit.WithRecordMetadata("risk_reasons", reasons),
+	}
+}
+
+// LogRiskDenied records a challenge creation rejected by the risk engine
+func LogRiskDenied(ctx context.Context, userID, channel, destination, purpose, ip string, score int, action string, reasons []string) {
 	l := GetLogger()
 	if l == nil {
 		return
 	}
 
-	l.LogChallenge(ctx, audit.EventSendSuccess, challengeID, userID, audit.ResultSuccess,
+	opts := []audit.RecordOption{
+		audit.WithRecordChannel(channel),
+		audit.WithRecordDestination(destination),
+		audit.WithRecordPurpose(purpose),
+		audit.WithRecordIP(ip),
+		audit.WithRecordReason("risk_" + action),
+	}
+	l.LogAuth(ctx, audit.EventAccessDenied, userID, audit.ResultFailure, append(opts, RiskOptions(score, action, reasons)...)...)
+}
+
+// CountryOption returns a record option carrying the request's country (empty when unknown)
+func CountryOption(country string) audit.RecordOption {
+	return audit.WithRecordMetadata("country", country)
+}
+
+// LogSendSuccess records a successful send event; extra options (e.g. CountryOption) are appended
+func LogSendSuccess(ctx context.Context, challengeID, userID, channel, destination, purpose, provider, messageID, ip string, extra ...audit.RecordOption) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	opts := []audit.RecordOption{
 		audit.WithRecordChannel(channel),
 		audit.WithRecordDestination(destination),
 		audit.WithRecordPurpose(purpose),
 		audit.WithRecordProvider(provider, messageID),
 		audit.WithRecordIP(ip),
-	)
+	}
+	l.LogChallenge(ctx, audit.EventSendSuccess, challengeID, userID, audit.ResultSuccess, append(opts, extra...)...)
 }
 
-// LogSendFailed records a failed send event
-func LogSendFailed(ctx context.Context, challengeID, userID, channel, destination, purpose, provider, reason, ip string) {
+// LogSendFailed records a failed send event; extra options (e.g. CountryOption) are appended
+func LogSendFailed(ctx context.Context, challengeID, userID, channel, destination, purpose, provider, reason, ip string, extra ...audit.RecordOption) {
 	l := GetLogger()
 	if l == nil {
 		return
 	}
 
-	l.LogChallenge(ctx, audit.EventSendFailed, challengeID, userID, audit.ResultFailure,
+	opts := []audit.RecordOption{
 		audit.WithRecordChannel(channel),
 		audit.WithRecordDestination(destination),
 		audit.WithRecordPurpose(purpose),
 		audit.WithRecordProvider(provider, ""),
 		audit.WithRecordReason(reason),
 		audit.WithRecordIP(ip),
-	)
+	}
+	l.LogChallenge(ctx, audit.EventSendFailed, challengeID, userID, audit.ResultFailure, append(opts, extra...)...)
 }
 
 // LogVerificationSuccess records a successful verification event
@@ -183,6 +232,161 @@ func LogChallengeRevoked(ctx context.Context, challengeID, ip string) {
 	)
 }
 
+// LogUserLocked records a user lockout event
+func LogUserLocked(ctx context.Context, userID, reason string, level int, expiresAt time.Time, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, audit.EventUserLocked, userID, audit.ResultSuccess,
+		audit.WithRecordReason(reason),
+		audit.WithRecordIP(ip),
+		audit.WithRecordMetadata("level", level),
+		audit.WithRecordMetadata("expires_at", expiresAt.Unix()),
+	)
+}
+
+// LogUserUnlocked records an administrative unlock event
+func LogUserUnlocked(ctx context.Context, userID, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, audit.EventUserUnlocked, userID, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogRecoveryCodesGenerated records the creation of a new recovery code set (old codes invalidated)
+func LogRecoveryCodesGenerated(ctx context.Context, userID string, count int, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventRecoveryCodesGenerated, userID, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+		audit.WithRecordMetadata("count", count),
+	)
+}
+
+// LogRecoveryCodeUsed records a consumed recovery code
+func LogRecoveryCodeUsed(ctx context.Context, userID string, remaining int, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventRecoveryCodeUsed, userID, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+		audit.WithRecordMetadata("remaining", remaining),
+	)
+}
+
+// LogRecoveryCodeFailed records a rejected recovery code attempt
+func LogRecoveryCodeFailed(ctx context.Context, userID, reason, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventRecoveryCodeFailed, userID, audit.ResultFailure,
+		audit.WithRecordReason(reason),
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogWebAuthnRegistered records a newly registered WebAuthn credential
+func LogWebAuthnRegistered(ctx context.Context, userID, credentialID, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventWebAuthnRegistered, userID, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+		audit.WithRecordMetadata("credential_id", credentialID),
+	)
+}
+
+// LogWebAuthnVerified records a successful WebAuthn assertion
+func LogWebAuthnVerified(ctx context.Context, userID, credentialID, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventWebAuthnVerified, userID, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+		audit.WithRecordMetadata("credential_id", credentialID),
+	)
+}
+
+// LogWebAuthnFailed records a rejected WebAuthn registration or assertion.
+// userID is empty when a discoverable assertion fails before the user is known.
+func LogWebAuthnFailed(ctx context.Context, userID, reason, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventWebAuthnFailed, userID, audit.ResultFailure,
+		audit.WithRecordReason(reason),
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogTOTPEnrolled records a confirmed TOTP enrollment (replacing any previous authenticator)
+func LogTOTPEnrolled(ctx context.Context, subject, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventTOTPEnrolled, subject, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogTOTPVerified records an accepted TOTP code
+func LogTOTPVerified(ctx context.Context, subject, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventTOTPVerified, subject, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogTOTPFailed records a rejected TOTP code or a rate-limited attempt
+func LogTOTPFailed(ctx context.Context, subject, reason, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventTOTPFailed, subject, audit.ResultFailure,
+		audit.WithRecordReason(reason),
+		audit.WithRecordIP(ip),
+	)
+}
+
+// LogTOTPRevoked records a revoked TOTP authenticator
+func LogTOTPRevoked(ctx context.Context, subject, ip string) {
+	l := GetLogger()
+	if l == nil {
+		return
+	}
+
+	l.LogAuth(ctx, EventTOTPRevoked, subject, audit.ResultSuccess,
+		audit.WithRecordIP(ip),
+	)
+}
+
 // Query queries audit records
 func Query(ctx context.Context, filter *audit.QueryFilter) ([]*audit.Record, error) {
 	l := GetLogger()
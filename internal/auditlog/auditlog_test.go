@@ -4,6 +4,7 @@ import (
 	"context"
 	"sync"
 	"testing"
+	"time"
 
 	audit "github.com/soulteary/audit-kit"
 	logger "github.com/soulteary/logger-kit"
@@ -54,6 +55,35 @@ func TestAuditLogFunctions(t *testing.T) {
 		LogChallengeRevoked(ctx, "ch_123", "127.0.0.1")
 	})
 
+	t.Run("LogUserLocked", func(t *testing.T) {
+		LogUserLocked(ctx, "user1", "max_attempts", 2, time.Now().Add(20*time.Minute), "127.0.0.1")
+	})
+
+	t.Run("LogChallengeCreatedWithRisk", func(t *testing.T) {
+		LogChallengeCreated(ctx, "ch_123", "user1", "sms", "+8613800138000", "login", "127.0.0.1",
+			RiskOptions(30, "captcha", []string{"new_device", "new_destination"})...)
+	})
+
+	t.Run("LogRiskDenied", func(t *testing.T) {
+		LogRiskDenied(ctx, "user1", "sms", "+8613800138000", "login", "127.0.0.1", 90, "block", []string{"ip_velocity"})
+	})
+
+	t.Run("LogUserUnlocked", func(t *testing.T) {
+		LogUserUnlocked(ctx, "user1", "127.0.0.1")
+	})
+
+	t.Run("LogSendWithCountry", func(t *testing.T) {
+		LogSendSuccess(ctx, "ch_123", "user1", "sms", "+8613800138000", "login", "aliyun", "msg_1", "127.0.0.1", CountryOption("CN"))
+		LogSendFailed(ctx, "ch_123", "user1", "sms", "+8613800138000", "login", "aliyun", "timeout", "127.0.0.1", CountryOption("CN"))
+	})
+
+	t.Run("LogTOTPEvents", func(t *testing.T) {
+		LogTOTPEnrolled(ctx, "user1", "127.0.0.1")
+		LogTOTPVerified(ctx, "user1", "127.0.0.1")
+		LogTOTPFailed(ctx, "user1", "invalid", "127.0.0.1")
+		LogTOTPRevoked(ctx, "user1", "127.0.0.1")
+	})
+
 	// Test Stop
 	err := Stop()
 	assert.NoError(t, err)
@@ -0,0 +1,184 @@
+// Package captcha verifies human-presence tokens sent with challenge creation requests.
+// Verifiers are pluggable: an hCaptcha/Turnstile-compatible HTTP verifier, a built-in
+// hashcash proof-of-work with puzzles issued by Herald, and a stub for tests.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	secure "github.com/soulteary/secure-kit"
+)
+
+// Verifier providers
+const (
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+	ProviderPoW       = "pow"
+	ProviderStub      = "stub"
+)
+
+// Default siteverify endpoints for the HTTP providers
+const (
+	HCaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	TurnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// ErrInvalidToken is returned when the token is malformed, unknown, expired or already used
+var ErrInvalidToken = errors.New("invalid captcha token")
+
+// Verifier verifies a captcha token
+type Verifier interface {
+	// Verify returns nil when the token is valid, ErrInvalidToken when it is rejected,
+	// or another error when the verifier itself is unavailable.
+	Verify(ctx context.Context, token, remoteIP string) error
+	// Provider returns the provider name (for logs and audit)
+	Provider() string
+}
+
+// HTTPVerifier verifies tokens against an hCaptcha/Turnstile-compatible siteverify endpoint
+type HTTPVerifier struct {
+	provider  string
+	verifyURL string
+	secret    string
+	client    *http.Client
+}
+
+// NewHTTPVerifier creates an HTTP verifier; verifyURL defaults to the provider's public endpoint
+func NewHTTPVerifier(provider, verifyURL, secret string, timeout time.Duration) (*HTTPVerifier, error) {
+	if secret == "" {
+		return nil, errors.New("captcha secret is required")
+	}
+	if verifyURL == "" {
+		switch provider {
+		case ProviderHCaptcha:
+			verifyURL = HCaptchaVerifyURL
+		case ProviderTurnstile:
+			verifyURL = TurnstileVerifyURL
+		default:
+			return nil, fmt.Errorf("verify URL is required for captcha provider %q", provider)
+		}
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &HTTPVerifier{
+		provider:  provider,
+		verifyURL: verifyURL,
+		secret:    secret,
+		client:    &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// siteverifyResponse is the common subset of hCaptcha and Turnstile responses
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// Provider returns the provider name
+func (v *HTTPVerifier) Provider() string {
+	return v.provider
+}
+
+// Verify posts the token to the siteverify endpoint
+func (v *HTTPVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrInvalidToken
+	}
+
+	form := url.Values{}
+	form.Set("secret", v.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha verify endpoint returned status %d", resp.StatusCode)
+	}
+
+	var result siteverifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, strings.Join(result.ErrorCodes, ","))
+	}
+	return nil
+}
+
+// StubVerifier accepts a single fixed token. Intended for tests and local development only.
+type StubVerifier struct {
+	token string
+}
+
+// NewStubVerifier creates a stub verifier accepting token
+func NewStubVerifier(token string) *StubVerifier {
+	return &StubVerifier{token: token}
+}
+
+// Provider returns the provider name
+func (v *StubVerifier) Provider() string {
+	return ProviderStub
+}
+
+// Verify accepts only the configured token
+func (v *StubVerifier) Verify(_ context.Context, token, _ string) error {
+	if v.token == "" || !secure.ConstantTimeEqual(token, v.token) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// Config selects and configures a verifier
+type Config struct {
+	Provider      string
+	Secret        string
+	VerifyURL     string
+	Timeout       time.Duration
+	PoWDifficulty int
+	PoWTTL        time.Duration
+	StubToken     string
+}
+
+// NewVerifier creates the verifier for cfg.Provider, or returns nil when no provider is configured
+func NewVerifier(cfg Config, redisClient *redis.Client) (Verifier, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case ProviderHCaptcha, ProviderTurnstile:
+		v, err := NewHTTPVerifier(cfg.Provider, cfg.VerifyURL, cfg.Secret, cfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case ProviderPoW:
+		return NewPoWVerifier(redisClient, cfg.PoWDifficulty, cfg.PoWTTL), nil
+	case ProviderStub:
+		if cfg.StubToken == "" {
+			return nil, errors.New("stub captcha verifier requires a token")
+		}
+		return NewStubVerifier(cfg.StubToken), nil
+	}
+	return nil, fmt.Errorf("unknown captcha provider %q", cfg.Provider)
+}
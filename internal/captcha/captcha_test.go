@@ -0,0 +1,160 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+func TestNewVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		want    string
+		wantErr bool
+	}{
+		{"disabled", Config{}, "", false},
+		{"hcaptcha", Config{Provider: ProviderHCaptcha, Secret: "s"}, ProviderHCaptcha, false},
+		{"turnstile without secret", Config{Provider: ProviderTurnstile}, "", true},
+		{"pow", Config{Provider: ProviderPoW}, ProviderPoW, false},
+		{"stub", Config{Provider: ProviderStub, StubToken: "ok"}, ProviderStub, false},
+		{"stub without token", Config{Provider: ProviderStub}, "", true},
+		{"unknown", Config{Provider: "recaptcha"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewVerifier(tt.cfg, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.want == "" {
+				if v != nil {
+					t.Errorf("NewVerifier() = %v, want nil", v)
+				}
+				return
+			}
+			if v == nil || v.Provider() != tt.want {
+				t.Errorf("NewVerifier() provider = %v, want %s", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("secret") != "site-secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") == "good" {
+			_, _ = w.Write([]byte(`{"success":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+	}))
+	defer server.Close()
+
+	v, err := NewHTTPVerifier(ProviderTurnstile, server.URL, "site-secret", time.Second)
+	if err != nil {
+		t.Fatalf("NewHTTPVerifier() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := v.Verify(ctx, "good", "192.0.2.1"); err != nil {
+		t.Errorf("Verify(good) error = %v", err)
+	}
+	if err := v.Verify(ctx, "bad", ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(bad) error = %v, want ErrInvalidToken", err)
+	}
+
+	broken, _ := NewHTTPVerifier(ProviderTurnstile, server.URL, "wrong", time.Second)
+	if err := broken.Verify(ctx, "good", ""); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with rejected secret error = %v, want unavailable error", err)
+	}
+}
+
+func TestStubVerifier(t *testing.T) {
+	v := NewStubVerifier("let-me-in")
+	if err := v.Verify(context.Background(), "let-me-in", ""); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	if err := v.Verify(context.Background(), "nope", ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(nope) error = %v, want ErrInvalidToken", err)
+	}
+}
+
+// solve brute-forces a nonce for the puzzle
+func solve(t *testing.T, p *Puzzle) string {
+	t.Helper()
+	for i := 0; i < 1<<24; i++ {
+		nonce := strconv.Itoa(i)
+		if Solves(p.Challenge, nonce, p.Difficulty) {
+			return nonce
+		}
+	}
+	t.Fatal("no nonce found")
+	return ""
+}
+
+func TestPoWVerifier(t *testing.T) {
+	redisClient, _ := testutil.NewTestRedisClient()
+	defer func() { _ = redisClient.Close() }()
+
+	v := NewPoWVerifier(redisClient, 8, time.Minute)
+	ctx := context.Background()
+
+	puzzle, err := v.Issue(ctx)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if puzzle.Difficulty != 8 || puzzle.ExpiresIn != 60 {
+		t.Errorf("Issue() = %+v", puzzle)
+	}
+
+	nonce := solve(t, puzzle)
+	token := puzzle.ID + ":" + nonce
+
+	wrong := "x"
+	for Solves(puzzle.Challenge, wrong, puzzle.Difficulty) {
+		wrong += "x"
+	}
+	if err := v.Verify(ctx, puzzle.ID+":"+wrong, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(wrong nonce) error = %v, want ErrInvalidToken", err)
+	}
+	if err := v.Verify(ctx, token, ""); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if err := v.Verify(ctx, token, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() replay error = %v, want ErrInvalidToken", err)
+	}
+	for _, bad := range []string{"", "no-separator", ":nonce", "unknown:1"} {
+		if err := v.Verify(ctx, bad, ""); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Verify(%q) error = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x10}, 11},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.in); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package captcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskitcache "github.com/soulteary/redis-kit/cache"
+	secure "github.com/soulteary/secure-kit"
+)
+
+// powKeyPrefix is the Redis key prefix for issued puzzles
+const powKeyPrefix = "otp:pow:"
+
+// Puzzle is a hashcash proof-of-work puzzle.
+// The client must find a nonce such that SHA-256("{challenge}:{nonce}") starts with
+// at least Difficulty zero bits, then send "{id}:{nonce}" as the captcha token.
+type Puzzle struct {
+	ID         string `json:"id"`
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// PoWVerifier issues and verifies proof-of-work puzzles stored in Redis.
+// Each puzzle can be redeemed once.
+type PoWVerifier struct {
+	client     *redis.Client
+	puzzles    rediskitcache.Cache
+	difficulty int
+	ttl        time.Duration
+}
+
+// NewPoWVerifier creates a proof-of-work verifier
+func NewPoWVerifier(redisClient *redis.Client, difficulty int, ttl time.Duration) *PoWVerifier {
+	if difficulty <= 0 {
+		difficulty = 20
+	}
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return &PoWVerifier{
+		client:     redisClient,
+		puzzles:    rediskitcache.NewCache(redisClient, powKeyPrefix),
+		difficulty: difficulty,
+		ttl:        ttl,
+	}
+}
+
+// Provider returns the provider name
+func (v *PoWVerifier) Provider() string {
+	return ProviderPoW
+}
+
+// Issue creates and stores a new puzzle
+func (v *PoWVerifier) Issue(ctx context.Context) (*Puzzle, error) {
+	id, err := secure.RandomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate puzzle id: %w", err)
+	}
+	challenge, err := secure.RandomHex(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate puzzle: %w", err)
+	}
+	puzzle := &Puzzle{
+		ID:         id,
+		Challenge:  challenge,
+		Difficulty: v.difficulty,
+		ExpiresIn:  int(v.ttl.Seconds()),
+	}
+	if err := v.puzzles.Set(ctx, id, puzzle, v.ttl); err != nil {
+		return nil, fmt.Errorf("failed to store puzzle: %w", err)
+	}
+	return puzzle, nil
+}
+
+// Verify checks a "{id}:{nonce}" token against its issued puzzle and consumes the puzzle
+func (v *PoWVerifier) Verify(ctx context.Context, token, _ string) error {
+	id, nonce, ok := strings.Cut(token, ":")
+	if !ok || id == "" || nonce == "" {
+		return ErrInvalidToken
+	}
+
+	data, err := v.client.Get(ctx, powKeyPrefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load puzzle: %w", err)
+	}
+	var puzzle Puzzle
+	if err := json.Unmarshal(data, &puzzle); err != nil {
+		return fmt.Errorf("failed to decode puzzle: %w", err)
+	}
+
+	if !Solves(puzzle.Challenge, nonce, puzzle.Difficulty) {
+		return ErrInvalidToken
+	}
+
+	// Redeem once: only the caller that actually deletes the puzzle wins
+	deleted, err := v.client.Del(ctx, powKeyPrefix+id).Result()
+	if err != nil {
+		return fmt.Errorf("failed to redeem puzzle: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("%w: puzzle already redeemed", ErrInvalidToken)
+	}
+	return nil
+}
+
+// Solves reports whether nonce solves the puzzle challenge at the given difficulty
+func Solves(challenge, nonce string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	return leadingZeroBits(sum[:]) >= difficulty
+}
+
+// leadingZeroBits counts the leading zero bits of b
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
@@ -0,0 +1,162 @@
+// Package channels is the set of OTP channels Herald accepts. The built-in channels are
+// sms, email, dingtalk, voice, webhook and push; chat-app channels (telegram, whatsapp, slack,
+// feishu, wecom, ...) are registered from config and delivered by an HTTP sidecar, following
+// the herald-dingtalk pattern (Herald holds no chat-app credentials).
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultTimeout applies to chat sidecars without a timeout
+const defaultTimeout = 10 * time.Second
+
+// Channel describes an accepted channel
+type Channel struct {
+	Name string
+	// AMR is the authentication method reference added after "otp" on successful verification
+	AMR string
+	// Chat is set for chat-app channels delivered by an HTTP sidecar
+	Chat *Chat
+}
+
+// Chat configures the HTTP sidecar of a chat-app channel. The sidecar serves the same
+// POST /v1/send API as herald-dingtalk.
+type Chat struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	Timeout time.Duration
+	// AMR defaults to the channel name
+	AMR string
+}
+
+// builtIn are always accepted; their providers are configured separately (SMS_*, SMTP_*, ...)
+var builtIn = []Channel{
+	{Name: "sms", AMR: "sms"},
+	{Name: "email", AMR: "email"},
+	{Name: "dingtalk", AMR: "dingtalk"},
+	{Name: "voice", AMR: "tel"}, // RFC 8176: confirmation by telephone call
+	{Name: "webhook", AMR: "webhook"},
+	{Name: "push", AMR: "swk"}, // RFC 8176: proof of possession of the device key
+}
+
+// chatName matches chat channel names (also used as metric labels and template keys)
+var chatName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// chatJSON is the JSON representation of a Chat (timeout as a duration string)
+type chatJSON struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+	APIKey  string `json:"api_key"`
+	Timeout string `json:"timeout"`
+	AMR     string `json:"amr"`
+}
+
+// ParseChats parses chat-app channels from a JSON array, e.g.
+// [{"name":"telegram","base_url":"http://herald-telegram:8084","api_key":"..."}]
+func ParseChats(data string) ([]Chat, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var raw []chatJSON
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse chat channels JSON: %w", err)
+	}
+
+	chats := make([]Chat, 0, len(raw))
+	seen := make(map[string]bool)
+	for i, c := range raw {
+		name := strings.ToLower(strings.TrimSpace(c.Name))
+		if !chatName.MatchString(name) {
+			return nil, fmt.Errorf("chat channel %d: invalid name %q", i, c.Name)
+		}
+		if _, ok := lookupBuiltIn(name); ok || seen[name] {
+			return nil, fmt.Errorf("chat channel %d: duplicate name %q", i, name)
+		}
+		if c.BaseURL == "" {
+			return nil, fmt.Errorf("chat channel %s: base_url required", name)
+		}
+		timeout := defaultTimeout
+		if c.Timeout != "" {
+			d, err := time.ParseDuration(c.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("chat channel %s: invalid timeout %q", name, c.Timeout)
+			}
+			timeout = d
+		}
+		amr := strings.TrimSpace(c.AMR)
+		if amr == "" {
+			amr = name
+		}
+		seen[name] = true
+		chats = append(chats, Chat{
+			Name:    name,
+			BaseURL: c.BaseURL,
+			APIKey:  c.APIKey,
+			Timeout: timeout,
+			AMR:     amr,
+		})
+	}
+	return chats, nil
+}
+
+// Registry holds the accepted channels
+type Registry struct {
+	byName map[string]Channel
+}
+
+// NewRegistry returns the built-in channels plus chats
+func NewRegistry(chats []Chat) *Registry {
+	r := &Registry{byName: make(map[string]Channel, len(builtIn)+len(chats))}
+	for _, ch := range builtIn {
+		r.byName[ch.Name] = ch
+	}
+	for i := range chats {
+		chat := chats[i]
+		r.byName[chat.Name] = Channel{Name: chat.Name, AMR: chat.AMR, Chat: &chat}
+	}
+	return r
+}
+
+// Get returns the channel named name
+func (r *Registry) Get(name string) (Channel, bool) {
+	ch, ok := r.byName[name]
+	return ch, ok
+}
+
+// Names returns the accepted channel names, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AMR returns the authentication methods for a verified challenge on channel:
+// "otp" followed by the channel's AMR value. Unknown channels (e.g. removed from config
+// after the challenge was created) only report "otp".
+func (r *Registry) AMR(name string) []string {
+	amr := []string{"otp"}
+	if ch, ok := r.byName[name]; ok && ch.AMR != "" {
+		amr = append(amr, ch.AMR)
+	}
+	return amr
+}
+
+func lookupBuiltIn(name string) (Channel, bool) {
+	for _, ch := range builtIn {
+		if ch.Name == name {
+			return ch, true
+		}
+	}
+	return Channel{}, false
+}
@@ -0,0 +1,76 @@
+package channels
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseChats(t *testing.T) {
+	chats, err := ParseChats(`[
+		{"name":"Telegram","base_url":"http://herald-telegram:8084","api_key":"k","timeout":"5s"},
+		{"name":"feishu","base_url":"http://herald-feishu:8085","amr":"lark"}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseChats() error = %v", err)
+	}
+	want := []Chat{
+		{Name: "telegram", BaseURL: "http://herald-telegram:8084", APIKey: "k", Timeout: 5 * time.Second, AMR: "telegram"},
+		{Name: "feishu", BaseURL: "http://herald-feishu:8085", Timeout: defaultTimeout, AMR: "lark"},
+	}
+	if !reflect.DeepEqual(chats, want) {
+		t.Errorf("ParseChats() = %+v, want %+v", chats, want)
+	}
+
+	if chats, err := ParseChats("  "); err != nil || chats != nil {
+		t.Errorf("ParseChats(empty) = %v, %v; want nil, nil", chats, err)
+	}
+}
+
+func TestParseChats_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`[{"name":"","base_url":"http://x"}]`,
+		`[{"name":"tele gram","base_url":"http://x"}]`,
+		`[{"name":"sms","base_url":"http://x"}]`,
+		`[{"name":"slack","base_url":"http://x"},{"name":"slack","base_url":"http://y"}]`,
+		`[{"name":"slack"}]`,
+		`[{"name":"slack","base_url":"http://x","timeout":"soon"}]`,
+	} {
+		if _, err := ParseChats(data); err == nil {
+			t.Errorf("ParseChats(%s) should fail", data)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry([]Chat{{Name: "slack", BaseURL: "http://herald-slack:8086", AMR: "slack"}})
+
+	wantNames := []string{"dingtalk", "email", "push", "slack", "sms", "voice", "webhook"}
+	if got := r.Names(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("Names() = %v, want %v", got, wantNames)
+	}
+
+	ch, ok := r.Get("slack")
+	if !ok || ch.Chat == nil || ch.Chat.BaseURL != "http://herald-slack:8086" {
+		t.Errorf("Get(slack) = %+v, %v", ch, ok)
+	}
+	if ch, ok := r.Get("sms"); !ok || ch.Chat != nil {
+		t.Errorf("Get(sms) = %+v, %v; want built-in", ch, ok)
+	}
+	if _, ok := r.Get("telegram"); ok {
+		t.Error("Get(telegram) should fail when not configured")
+	}
+
+	tests := map[string][]string{
+		"sms":      {"otp", "sms"},
+		"voice":    {"otp", "tel"},
+		"slack":    {"otp", "slack"},
+		"telegram": {"otp"},
+	}
+	for name, want := range tests {
+		if got := r.AMR(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("AMR(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Package completion tells waiting clients when a challenge reaches a final state (verified,
+// locked, revoked, approved or denied). The final event is stored for late subscribers and
+// published on Redis pub/sub; waiters subscribe first, then read the stored event, so no
+// completion is missed. When pub/sub is unavailable, waiters fall back to polling.
+package completion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Statuses
+const (
+	StatusPending  = "pending"
+	StatusVerified = "verified"
+	StatusLocked   = "locked"
+	StatusRevoked  = "revoked"
+	StatusApproved = "approved" // Push challenges
+	StatusDenied   = "denied"   // Push challenges
+	StatusExpired  = "expired"  // Reported when the challenge disappears without an event
+)
+
+// Redis keys
+const (
+	eventKeyPrefix = "otp:done:"
+	channelPrefix  = "otp:done:events:"
+)
+
+// pollInterval is how often waiters re-read the stored event (the only signal without pub/sub)
+const pollInterval = time.Second
+
+// Event is the final state of a challenge
+type Event struct {
+	ChallengeID string   `json:"challenge_id"`
+	Status      string   `json:"status"`
+	UserID      string   `json:"user_id,omitempty"`
+	Channel     string   `json:"channel,omitempty"`
+	AMR         []string `json:"amr,omitempty"`
+	Reason      string   `json:"reason,omitempty"`
+	Timestamp   int64    `json:"timestamp"`
+}
+
+// Notifier publishes and waits for challenge completions
+type Notifier struct {
+	redis        *redis.Client
+	ttl          time.Duration
+	pollInterval time.Duration
+}
+
+// New creates a notifier keeping final events for ttl
+func New(redisClient *redis.Client, ttl time.Duration) *Notifier {
+	return &Notifier{redis: redisClient, ttl: ttl, pollInterval: pollInterval}
+}
+
+// Publish records ev as the final state of its challenge and notifies waiters.
+// Only the first event of a challenge is kept; later ones (e.g. a revoke after the
+// verification) are ignored.
+func (n *Notifier) Publish(ctx context.Context, ev Event) error {
+	if ev.Timestamp == 0 {
+		ev.Timestamp = time.Now().Unix()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ok, err := n.redis.SetNX(ctx, eventKeyPrefix+ev.ChallengeID, data, n.ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to store completion: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	if err := n.redis.Publish(ctx, channelPrefix+ev.ChallengeID, data).Err(); err != nil {
+		return fmt.Errorf("failed to publish completion: %w", err)
+	}
+	return nil
+}
+
+// Last returns the final event of a challenge, or nil while none was published
+func (n *Notifier) Last(ctx context.Context, challengeID string) (*Event, error) {
+	data, err := n.redis.Get(ctx, eventKeyPrefix+challengeID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read completion: %w", err)
+	}
+	var ev Event
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// Wait blocks until the challenge completes, timeout passes or ctx is done.
+// It returns nil (and no error) when the challenge did not complete in time.
+func (n *Notifier) Wait(ctx context.Context, challengeID string, timeout time.Duration) (*Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Subscribe before reading the stored event so a completion in between is not lost
+	sub := n.redis.Subscribe(ctx, channelPrefix+challengeID)
+	defer func() { _ = sub.Close() }()
+	var messages <-chan *redis.Message
+	if _, err := sub.Receive(ctx); err == nil {
+		messages = sub.Channel()
+	}
+
+	ticker := time.NewTicker(n.pollInterval)
+	defer ticker.Stop()
+	for {
+		ev, err := n.Last(ctx, challengeID)
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		if ev != nil || err != nil {
+			return ev, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal([]byte(msg.Payload), &ev); err == nil {
+				return &ev, nil
+			}
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package completion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+func TestNotifier_PublishLast(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	n := New(client, time.Minute)
+	ctx := context.Background()
+
+	if ev, err := n.Last(ctx, "ch_1"); ev != nil || err != nil {
+		t.Fatalf("Last() before publish = %+v, %v; want nil, nil", ev, err)
+	}
+
+	// The mock has no PUBLISH; the event is stored before publishing
+	_ = n.Publish(ctx, Event{ChallengeID: "ch_1", Status: StatusVerified, UserID: "u1"})
+	_ = n.Publish(ctx, Event{ChallengeID: "ch_1", Status: StatusRevoked})
+
+	ev, err := n.Last(ctx, "ch_1")
+	if err != nil || ev == nil || ev.Status != StatusVerified || ev.UserID != "u1" || ev.Timestamp == 0 {
+		t.Errorf("Last() = %+v, %v; want the first (verified) event", ev, err)
+	}
+}
+
+func TestNotifier_Wait(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	n := New(client, time.Minute)
+	n.pollInterval = 20 * time.Millisecond
+	ctx := context.Background()
+
+	start := time.Now()
+	if ev, err := n.Wait(ctx, "ch_1", 100*time.Millisecond); ev != nil || err != nil {
+		t.Fatalf("Wait() without event = %+v, %v; want nil, nil", ev, err)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("Wait() returned before the timeout")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = n.Publish(context.Background(), Event{ChallengeID: "ch_1", Status: StatusRevoked})
+	}()
+	ev, err := n.Wait(ctx, "ch_1", 5*time.Second)
+	if err != nil || ev == nil || ev.Status != StatusRevoked {
+		t.Errorf("Wait() = %+v, %v; want revoked", ev, err)
+	}
+}
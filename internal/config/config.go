@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -40,10 +41,78 @@ var (
 	IdempotencyKeyTTL = env.GetDuration("IDEMPOTENCY_KEY_TTL", 0)                      // 0 means use ChallengeExpiry
 	AllowedPurposes   = env.GetStringSlice("ALLOWED_PURPOSES", []string{"login"}, ",") // Comma-separated list: "login,reset,bind,stepup"
 
+	// Challenge completion events (GET /v1/otp/challenges/{id}/events): SSE or long-poll, fed by Redis pub/sub
+	ChallengeEventsTTL         = env.GetDuration("CHALLENGE_EVENTS_TTL", 10*time.Minute)           // How long the final status stays readable for late subscribers
+	ChallengeEventsLongPollMax = env.GetDuration("CHALLENGE_EVENTS_LONG_POLL_MAX", 30*time.Second) // Maximum ?wait= of the long-poll variant
+	ChallengeEventsStreamMax   = env.GetDuration("CHALLENGE_EVENTS_STREAM_MAX", 5*time.Minute)     // Maximum lifetime of an SSE stream
+	ChallengeEventsKeepalive   = env.GetDuration("CHALLENGE_EVENTS_KEEPALIVE", 15*time.Second)     // SSE keepalive comment interval
+
+	// Destination normalization
+	DestinationDefaultRegion = env.Get("DESTINATION_DEFAULT_REGION", "")      // ISO country for phone numbers without "+", e.g. "CN"; empty = keep them in national format
+	DestinationStrictEmail   = env.GetBool("DESTINATION_STRICT_EMAIL", false) // Reject email domains that cannot receive mail (reserved TLDs, single labels) without DNS lookups
+
+	// Disposable / role email policy (list files: one entry per line, "#" comments, reloaded on change)
+	EmailDisposableDomainsFile = env.Get("EMAIL_DISPOSABLE_DOMAINS_FILE", "") // Domains rejected for EMAIL_DISPOSABLE_PURPOSES (subdomains included)
+	EmailRoleAccountsFile      = env.Get("EMAIL_ROLE_ACCOUNTS_FILE", "")      // Local parts (e.g. "noreply") rejected for EMAIL_ROLE_PURPOSES
+	EmailDisposablePurposes    = env.GetStringSlice("EMAIL_DISPOSABLE_PURPOSES", []string{"signup"}, ",")
+	EmailRolePurposes          = env.GetStringSlice("EMAIL_ROLE_PURPOSES", []string{"signup"}, ",")
+	EmailPolicyReloadInterval  = env.GetDuration("EMAIL_POLICY_RELOAD_INTERVAL", 30*time.Second) // How often list files are checked for changes; 0 = never
+
+	// Progressive resend cooldown per user+destination (reset by a successful verification)
+	ResendCooldownSteps      = env.GetStringSlice("RESEND_COOLDOWN_STEPS", nil, ",")       // e.g. "30s,60s,120s,5m"; empty = always RESEND_COOLDOWN
+	ResendCooldownResetAfter = env.GetDuration("RESEND_COOLDOWN_RESET_AFTER", 1*time.Hour) // Step counter resets after this long without sends
+
+	// Escalating lockout: each lockout within the window doubles LOCKOUT_DURATION, up to the max
+	LockoutMaxDuration      = env.GetDuration("LOCKOUT_MAX_DURATION", 24*time.Hour)
+	LockoutEscalationWindow = env.GetDuration("LOCKOUT_ESCALATION_WINDOW", 24*time.Hour)
+
+	// Security event webhook (user_locked, user_unlocked); payloads signed like service HMAC auth
+	EventWebhookURL     = env.Get("HERALD_EVENT_WEBHOOK_URL", "")
+	EventWebhookSecret  = env.Get("HERALD_EVENT_WEBHOOK_SECRET", "")
+	EventWebhookTimeout = env.GetDuration("HERALD_EVENT_WEBHOOK_TIMEOUT", 5*time.Second)
+
 	// Rate limiting config
-	RateLimitPerUser        = env.GetInt("RATE_LIMIT_PER_USER", 10)        // per hour
-	RateLimitPerIP          = env.GetInt("RATE_LIMIT_PER_IP", 5)           // per minute
-	RateLimitPerDestination = env.GetInt("RATE_LIMIT_PER_DESTINATION", 10) // per hour
+	RateLimitPerUser        = env.GetInt("RATE_LIMIT_PER_USER", 10)                  // per hour
+	RateLimitPerIP          = env.GetInt("RATE_LIMIT_PER_IP", 5)                     // per minute
+	RateLimitPerDestination = env.GetInt("RATE_LIMIT_PER_DESTINATION", 10)           // per hour
+	RateLimitPerCountry     = env.GetStringSlice("RATE_LIMIT_PER_COUNTRY", nil, ",") // per hour, all destinations in a country, e.g. "NG=100,ID=200"
+
+	// Behaviour when Redis is unavailable: "open" (allow), "closed" (deny) or "local" (in-process limiter)
+	RateLimitFailurePolicy   = env.Get("RATE_LIMIT_FAILURE_POLICY", "")                    // Applies to every scope; empty = per-scope defaults
+	RateLimitFailurePolicies = env.GetStringSlice("RATE_LIMIT_FAILURE_POLICIES", nil, ",") // Per-scope overrides, e.g. "user=local,ip=local,quota=open"
+
+	// Geo-aware routing (offline lookups only)
+	GeoIPDBPath   = env.Get("GEOIP_DB_PATH", "")     // MaxMind-format .mmdb file for IP countries; empty = IP country unknown
+	SMSRoutesJSON = env.Get("HERALD_SMS_ROUTES", "") // SMS provider per destination country (JSON array), e.g.
+	// [{"countries":["CN","HK"],"provider":"aliyun","base_url":"http://sms-aliyun:8080","api_key":"...","timeout":"10s"}]
+
+	// Global send budgets (JSON array), e.g.
+	// [{"name":"sms-daily","channel":"sms","limit":50000,"window":"24h","warn_at":0.8},{"channel":"sms","country":"+234","limit":500,"window":"1h"}]
+	SendQuotasJSON = env.Get("HERALD_SEND_QUOTAS", "")
+
+	// CAPTCHA / proof-of-work gate for challenge creation
+	CaptchaProvider         = env.Get("CAPTCHA_PROVIDER", "")                           // "hcaptcha", "turnstile", "pow", "stub" (tests only); empty = disabled
+	CaptchaSecret           = env.Get("CAPTCHA_SECRET", "")                             // Site secret for hcaptcha/turnstile
+	CaptchaVerifyURL        = env.Get("CAPTCHA_VERIFY_URL", "")                         // Override siteverify endpoint (defaults per provider)
+	CaptchaTimeout          = env.GetDuration("CAPTCHA_TIMEOUT", 5*time.Second)         // Siteverify request timeout
+	CaptchaRequiredPurposes = env.GetStringSlice("CAPTCHA_REQUIRED_PURPOSES", nil, ",") // Purposes that always require a token, e.g. "signup"
+	CaptchaIPThreshold      = env.GetInt("CAPTCHA_IP_THRESHOLD", 0)                     // Require a token once an IP exceeds this many challenges per hour; 0 = off
+	CaptchaPoWDifficulty    = env.GetInt("CAPTCHA_POW_DIFFICULTY", 20)                  // Leading zero bits required by the built-in proof-of-work
+	CaptchaPoWTTL           = env.GetDuration("CAPTCHA_POW_TTL", 5*time.Minute)         // Lifetime of issued proof-of-work puzzles
+	CaptchaStubToken        = env.Get("CAPTCHA_STUB_TOKEN", "")                         // Token accepted by the stub verifier
+
+	// Risk scoring for challenge creation
+	RiskEnabled           = env.GetBool("RISK_ENABLED", false)
+	RiskCaptchaScore      = env.GetInt("RISK_CAPTCHA_SCORE", 30) // Score requiring a captcha token; 0 = never
+	RiskStepUpScore       = env.GetInt("RISK_STEPUP_SCORE", 50)  // Score requiring a channel from RISK_STRONG_CHANNELS; 0 = never
+	RiskBlockScore        = env.GetInt("RISK_BLOCK_SCORE", 80)   // Score rejecting the request; 0 = never
+	RiskStrongChannels    = env.GetStringSlice("RISK_STRONG_CHANNELS", []string{"email", "dingtalk"}, ",")
+	RiskWeights           = env.GetStringSlice("RISK_WEIGHTS", nil, ",") // Per-signal points, e.g. "new_device=20,country_mismatch=0"
+	RiskIPVelocityLimit   = env.GetInt("RISK_IP_VELOCITY_LIMIT", 10)     // Challenges per IP before ip_velocity fires
+	RiskIPVelocityWindow  = env.GetDuration("RISK_IP_VELOCITY_WINDOW", 10*time.Minute)
+	RiskDestinationMinAge = env.GetDuration("RISK_DESTINATION_MIN_AGE", 24*time.Hour) // new_destination fires until a destination has been verified this long
+	RiskFailureThreshold  = env.GetInt("RISK_FAILURE_THRESHOLD", 3)                   // Verification failures before recent_failures fires
+	RiskFailureWindow     = env.GetDuration("RISK_FAILURE_WINDOW", 1*time.Hour)
 
 	// Provider config
 	SMTPHost              = env.Get("SMTP_HOST", "")
@@ -51,23 +120,97 @@ var (
 	SMTPUser              = env.Get("SMTP_USER", "")
 	SMTPPassword          = env.Get("SMTP_PASSWORD", "")
 	SMTPFrom              = env.Get("SMTP_FROM", "")
-	ProviderFailurePolicy = env.Get("PROVIDER_FAILURE_POLICY", "soft") // "strict" | "soft"
+	SMTPTLS               = env.Get("SMTP_TLS", "")                         // "starttls" | "tls" (implicit); empty = tls on port 465, else starttls
+	SMTPTimeout           = env.GetDuration("SMTP_TIMEOUT", 10*time.Second) // Connect and delivery timeout
+	ProviderFailurePolicy = env.Get("PROVIDER_FAILURE_POLICY", "soft")      // "strict" | "soft"
 
 	// SMS Provider config (HTTP API mode - recommended)
 	SMSProvider   = env.Get("SMS_PROVIDER", "")     // Provider name (e.g., "aliyun", "tencent", "http")
 	SMSAPIBaseURL = env.Get("SMS_API_BASE_URL", "") // HTTP API base URL for SMS provider
 	SMSAPIKey     = env.Get("SMS_API_KEY", "")      // HTTP API key for SMS provider
 
+	// Voice call provider config (HTTP API mode; the gateway places a TTS call reading the body)
+	VoiceProvider   = env.Get("VOICE_PROVIDER", "")     // Provider name (e.g., "twilio", "aliyun-voice")
+	VoiceAPIBaseURL = env.Get("VOICE_API_BASE_URL", "") // HTTP API base URL for voice provider
+	VoiceAPIKey     = env.Get("VOICE_API_KEY", "")      // HTTP API key for voice provider
+
+	// Push approval channel: the push provider (HTTP API) notifies the device, which approves or denies
+	// with an assertion signed by its registered key
+	PushProvider         = env.Get("PUSH_PROVIDER", "")                            // Provider name (e.g., "fcm-gateway")
+	PushAPIBaseURL       = env.Get("PUSH_API_BASE_URL", "")                        // HTTP API base URL for push provider
+	PushAPIKey           = env.Get("PUSH_API_KEY", "")                             // HTTP API key for push provider
+	PushNumberLength     = env.GetInt("PUSH_NUMBER_LENGTH", 2)                     // Digits of the number the user types on the device
+	PushAssertionMaxSkew = env.GetDuration("PUSH_ASSERTION_MAX_SKEW", time.Minute) // Allowed clock skew of device assertions
+	PushResultTTL        = env.GetDuration("PUSH_RESULT_TTL", 5*time.Minute)       // How long the outcome stays readable after expiry
+
+	// Recovery codes (native, Argon2id hashes in Redis)
+	RecoveryCodeCount    = env.GetInt("RECOVERY_CODE_COUNT", 10)                     // Codes per generated set
+	RecoveryArgon2Time   = env.GetInt("RECOVERY_ARGON2_TIME", 2)                     // Argon2id iterations
+	RecoveryArgon2Memory = env.GetInt("RECOVERY_ARGON2_MEMORY", 19456)               // Argon2id memory in KiB
+	RecoveryVerifyLimit  = env.GetInt("RECOVERY_VERIFY_LIMIT", 5)                    // Verify attempts per user per window
+	RecoveryVerifyWindow = env.GetDuration("RECOVERY_VERIFY_WINDOW", 15*time.Minute) // Window of RECOVERY_VERIFY_LIMIT
+
+	// Step-up policies (POST /v1/policy/evaluate): JSON file, see docs; empty disables the endpoint
+	PolicyFile = env.Get("POLICY_FILE", "")
+
+	// Factor listing (GET /v1/users/{id}/factors): recently verified OTP destinations, stored masked
+	FactorsHistoryMax = env.GetInt("FACTORS_HISTORY_MAX", 5)                    // Destinations remembered per user; 0 disables
+	FactorsHistoryTTL = env.GetDuration("FACTORS_HISTORY_TTL", 90*24*time.Hour) // Destinations not verified for this long are forgotten
+
+	// WebAuthn (passkeys / security keys): disabled unless WEBAUTHN_RP_ID is set
+	WebAuthnRPID             = env.Get("WEBAUTHN_RP_ID", "")                      // Relying party ID, e.g. "example.com"
+	WebAuthnRPName           = env.Get("WEBAUTHN_RP_NAME", "Herald")              // Name shown by the authenticator
+	WebAuthnOrigins          = env.GetStringSlice("WEBAUTHN_ORIGINS", nil, ",")   // Allowed origins; empty = https://{WEBAUTHN_RP_ID}
+	WebAuthnTimeout          = env.GetDuration("WEBAUTHN_TIMEOUT", 5*time.Minute) // Ceremony timeout (challenge lifetime)
+	WebAuthnUserVerification = env.Get("WEBAUTHN_USER_VERIFICATION", "preferred") // required, preferred or discouraged
+
 	// TOTP (herald-totp): Herald proxies TOTP to herald-totp service when enabled
 	TOTPEnabled    = env.GetBool("HERALD_TOTP_ENABLED", false)
 	TOTPBaseURL    = env.Get("HERALD_TOTP_BASE_URL", "") // Base URL of herald-totp service
 	TOTPAPIKey     = env.Get("HERALD_TOTP_API_KEY", "")  // Optional API key for Herald to call herald-totp
 	TOTPHMACSecret = env.Get("HERALD_TOTP_HMAC_SECRET", "")
 
+	// herald-totp proxy resilience
+	TOTPTimeout          = env.GetDuration("HERALD_TOTP_TIMEOUT", 10*time.Second)           // Per-attempt timeout
+	TOTPMaxRetries       = env.GetInt("HERALD_TOTP_MAX_RETRIES", 2)                         // Extra attempts for status (the only idempotent call)
+	TOTPRetryDelay       = env.GetDuration("HERALD_TOTP_RETRY_DELAY", 100*time.Millisecond) // First retry delay, doubled per retry
+	TOTPBreakerThreshold = env.GetInt("HERALD_TOTP_BREAKER_THRESHOLD", 5)                   // Consecutive failures that open the circuit; 0 disables
+	TOTPBreakerCooldown  = env.GetDuration("HERALD_TOTP_BREAKER_COOLDOWN", 30*time.Second)  // Open circuit duration before a trial call
+
+	// TOTP verify limits (both backends): attempts per subject and per client IP
+	TOTPVerifyLimitPerSubject = env.GetInt("HERALD_TOTP_VERIFY_LIMIT_PER_SUBJECT", 5)
+	TOTPVerifyLimitPerIP      = env.GetInt("HERALD_TOTP_VERIFY_LIMIT_PER_IP", 20)
+	TOTPVerifyWindow          = env.GetDuration("HERALD_TOTP_VERIFY_WINDOW", 5*time.Minute)
+
+	// TOTP revoke and re-enrollment (enroll/start while enrolled) require a challenge_id of the same
+	// user with purpose "stepup", verified within this age; 0 disables the requirement
+	TOTPStepUpMaxAge = env.GetDuration("HERALD_TOTP_STEPUP_MAX_AGE", 0)
+
+	// TOTP backend: "proxy" forwards to herald-totp (above), "native" uses the embedded engine
+	TOTPMode          = env.Get("HERALD_TOTP_MODE", "proxy")
+	TOTPEncryptionKey = env.Get("HERALD_TOTP_ENCRYPTION_KEY", "")                 // Native: 32 bytes, hex or base64 (required)
+	TOTPIssuer        = env.Get("HERALD_TOTP_ISSUER", "Herald")                   // Native: issuer shown by authenticator apps
+	TOTPDigits        = env.GetInt("HERALD_TOTP_DIGITS", 6)                       // Native: code length, 6 or 8
+	TOTPPeriod        = env.GetDuration("HERALD_TOTP_PERIOD", 30*time.Second)     // Native: time step
+	TOTPSkew          = env.GetInt("HERALD_TOTP_SKEW", 1)                         // Native: steps of clock drift accepted either way
+	TOTPEnrollTTL     = env.GetDuration("HERALD_TOTP_ENROLL_TTL", 10*time.Minute) // Native: how long a started enrollment can be confirmed
+	TOTPQRSize        = env.GetInt("HERALD_TOTP_QR_SIZE", 256)                    // Size in pixels of the enrollment QR PNG; 0 omits it
+
 	// DingTalk channel: Herald calls herald-dingtalk via HTTP (no DingTalk credentials in Herald)
 	HeraldDingtalkAPIURL = env.Get("HERALD_DINGTALK_API_URL", "") // Base URL of herald-dingtalk service
 	HeraldDingtalkAPIKey = env.Get("HERALD_DINGTALK_API_KEY", "") // Optional API key for herald-dingtalk
 
+	// Chat-app channels (telegram, whatsapp, slack, feishu, wecom, ...): each is served by an HTTP sidecar
+	// with the herald-dingtalk API. JSON array, e.g. [{"name":"telegram","base_url":"http://herald-telegram:8084"}]
+	ChatChannelsJSON = env.Get("HERALD_CHAT_CHANNELS", "")
+
+	// Webhook channel: signed JSON POSTed to endpoints registered here; the challenge destination is the endpoint id.
+	// JSON array, e.g. [{"id":"inapp","url":"https://push.internal/herald","secret":"..."}]
+	WebhookEndpointsJSON = env.Get("HERALD_WEBHOOK_ENDPOINTS", "")
+	WebhookTimeout       = env.GetDuration("HERALD_WEBHOOK_TIMEOUT", 5*time.Second)            // Per delivery attempt
+	WebhookMaxRetries    = env.GetInt("HERALD_WEBHOOK_MAX_RETRIES", 3)                         // Retries after network errors, 5xx and 429
+	WebhookRetryDelay    = env.GetDuration("HERALD_WEBHOOK_RETRY_DELAY", 200*time.Millisecond) // Initial backoff delay, grows exponentially
+
 	// Email channel via herald-smtp: Herald calls herald-smtp via HTTP (no SMTP credentials in Herald when set)
 	HeraldSMTPAPIURL = env.Get("HERALD_SMTP_API_URL", "") // Base URL of herald-smtp service; when set, built-in SMTP is not used
 	HeraldSMTPAPIKey = env.Get("HERALD_SMTP_API_KEY", "") // Optional API key for herald-smtp
@@ -109,7 +252,11 @@ var (
 	AuditWriterWorkers   = env.GetInt("AUDIT_WRITER_WORKERS", 2)
 
 	// Template config
-	TemplateDir = env.Get("TEMPLATE_DIR", "") // Optional: path to template directory
+	TemplateDir            = env.Get("TEMPLATE_DIR", "")                                 // Optional: path to template directory
+	TemplateAppName        = env.Get("TEMPLATE_APP_NAME", "Herald")                      // {{.AppName}} in templates
+	TemplateSupportURL     = env.Get("TEMPLATE_SUPPORT_URL", "")                         // {{.SupportURL}} in templates
+	TemplateVarsAllowlist  = env.Get("TEMPLATE_VARS_ALLOWLIST", "")                      // JSON: {"channel:purpose": ["var", ...]}; "*" matches any
+	TemplateReloadInterval = env.GetDuration("TEMPLATE_RELOAD_INTERVAL", 30*time.Second) // How often TEMPLATE_DIR is checked for changes; 0 disables reloading
 
 	// OpenTelemetry config
 	OTLPEnabled  = env.GetBool("OTLP_ENABLED", false)
@@ -154,6 +301,10 @@ func Initialize(l *logger.Logger) error {
 		TLSCACertFile = TLSClientCAFile
 	}
 
+	// Parse list settings once, reporting invalid entries at startup
+	GetResendCooldownSteps()
+	GetCountryRateLimits()
+
 	// Set default IdempotencyKeyTTL if not set
 	if IdempotencyKeyTTL == 0 {
 		IdempotencyKeyTTL = ChallengeExpiry
@@ -174,6 +325,104 @@ func Initialize(l *logger.Logger) error {
 	return nil
 }
 
+// parsedSetting caches the value parsed from a list setting, so that it is parsed (and
+// invalid entries are reported) once rather than on every request. It is parsed again only
+// when the setting changes.
+type parsedSetting[T any] struct {
+	mu    sync.Mutex
+	input string
+	value T
+	ok    bool
+}
+
+// get returns the value parsed from input (the raw setting), parsing it when it changed
+func (p *parsedSetting[T]) get(input string, parse func() T) T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.ok || p.input != input {
+		p.input, p.value, p.ok = input, parse(), true
+	}
+	return p.value
+}
+
+var resendCooldownSteps parsedSetting[[]time.Duration]
+
+// GetResendCooldownSteps returns the parsed progressive resend cooldown steps; callers must
+// not modify the slice. Invalid entries are skipped; when none are configured, ResendCooldown
+// is the single step.
+func GetResendCooldownSteps() []time.Duration {
+	input := strings.Join(ResendCooldownSteps, ",") + ";" + ResendCooldown.String()
+	return resendCooldownSteps.get(input, parseResendCooldownSteps)
+}
+
+func parseResendCooldownSteps() []time.Duration {
+	steps := make([]time.Duration, 0, len(ResendCooldownSteps))
+	for _, s := range ResendCooldownSteps {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil || d <= 0 {
+			if log != nil {
+				log.Warn().Str("step", s).Msg("Invalid RESEND_COOLDOWN_STEPS entry, skipping")
+			}
+			continue
+		}
+		steps = append(steps, d)
+	}
+	if len(steps) == 0 {
+		return []time.Duration{ResendCooldown}
+	}
+	return steps
+}
+
+// GetRateLimitFailurePolicies returns the failure policy name per rate limit scope
+// (user, ip, destination, country, cooldown, quota, captcha, recovery, totp). Rate limits and cooldowns fail closed and
+// send budgets fail open unless RATE_LIMIT_FAILURE_POLICY or RATE_LIMIT_FAILURE_POLICIES override them.
+func GetRateLimitFailurePolicies() map[string]string {
+	policies := map[string]string{
+		"user":        "closed",
+		"ip":          "closed",
+		"destination": "closed",
+		"country":     "closed",
+		"cooldown":    "closed",
+		"quota":       "open",
+		"captcha":     "closed",
+		"recovery":    "closed",
+		"totp":        "closed",
+	}
+	if p := strings.TrimSpace(RateLimitFailurePolicy); p != "" {
+		for scope := range policies {
+			policies[scope] = p
+		}
+	}
+	for _, entry := range RateLimitFailurePolicies {
+		scope, p, ok := strings.Cut(entry, "=")
+		if !ok {
+			if log != nil {
+				log.Warn().Str("entry", entry).Msg("Invalid RATE_LIMIT_FAILURE_POLICIES entry, skipping")
+			}
+			continue
+		}
+		policies[strings.TrimSpace(scope)] = strings.TrimSpace(p)
+	}
+	return policies
+}
+
+// GetRiskWeights returns the per-signal weight overrides from RISK_WEIGHTS ("signal=points")
+func GetRiskWeights() map[string]int {
+	weights := make(map[string]int, len(RiskWeights))
+	for _, entry := range RiskWeights {
+		name, value, ok := strings.Cut(entry, "=")
+		points, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || points < 0 {
+			if log != nil {
+				log.Warn().Str("entry", entry).Msg("Invalid RISK_WEIGHTS entry, skipping")
+			}
+			continue
+		}
+		weights[strings.TrimSpace(name)] = points
+	}
+	return weights
+}
+
 // GetPort returns the server port
 func GetPort() string {
 	if !strings.HasPrefix(Port, ":") {
@@ -257,3 +506,27 @@ func GetHMACSecret(keyID string) string {
 func HasHMACKeys() bool {
 	return len(hmacKeysMap) > 0
 }
+
+var countryRateLimits parsedSetting[map[string]int]
+
+// GetCountryRateLimits returns the per-country hourly limits from RATE_LIMIT_PER_COUNTRY ("CC=limit"),
+// keyed by upper-case country code; callers must not modify the map
+func GetCountryRateLimits() map[string]int {
+	return countryRateLimits.get(strings.Join(RateLimitPerCountry, ","), parseCountryRateLimits)
+}
+
+func parseCountryRateLimits() map[string]int {
+	limits := make(map[string]int, len(RateLimitPerCountry))
+	for _, entry := range RateLimitPerCountry {
+		country, value, ok := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || err != nil || limit <= 0 {
+			if log != nil {
+				log.Warn().Str("entry", entry).Msg("Invalid RATE_LIMIT_PER_COUNTRY entry, skipping")
+			}
+			continue
+		}
+		limits[strings.ToUpper(strings.TrimSpace(country))] = limit
+	}
+	return limits
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -240,3 +241,88 @@ func TestInitialize_IdempotencyKeyTTLDefault(t *testing.T) {
 		t.Errorf("Initialize() should set IdempotencyKeyTTL to ChallengeExpiry when 0, got %v", IdempotencyKeyTTL)
 	}
 }
+
+func TestGetResendCooldownSteps(t *testing.T) {
+	originalSteps := ResendCooldownSteps
+	originalCooldown := ResendCooldown
+	defer func() {
+		ResendCooldownSteps = originalSteps
+		ResendCooldown = originalCooldown
+	}()
+
+	ResendCooldown = 45 * time.Second
+	ResendCooldownSteps = nil
+	steps := GetResendCooldownSteps()
+	if len(steps) != 1 || steps[0] != 45*time.Second {
+		t.Errorf("GetResendCooldownSteps() = %v, want [45s]", steps)
+	}
+
+	ResendCooldownSteps = []string{"30s", "bogus", " 60s", "5m"}
+	steps = GetResendCooldownSteps()
+	want := []time.Duration{30 * time.Second, 60 * time.Second, 5 * time.Minute}
+	if len(steps) != len(want) {
+		t.Fatalf("GetResendCooldownSteps() = %v, want %v", steps, want)
+	}
+	for i := range want {
+		if steps[i] != want[i] {
+			t.Errorf("GetResendCooldownSteps()[%d] = %v, want %v", i, steps[i], want[i])
+		}
+	}
+	// Parsed once: later calls reuse the result until the setting changes
+	if again := GetResendCooldownSteps(); &again[0] != &steps[0] {
+		t.Error("GetResendCooldownSteps() parsed the unchanged setting again")
+	}
+}
+
+func TestGetRateLimitFailurePolicies(t *testing.T) {
+	originalPolicy := RateLimitFailurePolicy
+	originalPolicies := RateLimitFailurePolicies
+	defer func() {
+		RateLimitFailurePolicy = originalPolicy
+		RateLimitFailurePolicies = originalPolicies
+	}()
+
+	RateLimitFailurePolicy = ""
+	RateLimitFailurePolicies = nil
+	policies := GetRateLimitFailurePolicies()
+	if policies["user"] != "closed" || policies["quota"] != "open" || policies["captcha"] != "closed" || policies["recovery"] != "closed" || policies["totp"] != "closed" {
+		t.Errorf("GetRateLimitFailurePolicies() defaults = %v", policies)
+	}
+
+	RateLimitFailurePolicy = "local"
+	RateLimitFailurePolicies = []string{"ip=open", "bogus"}
+	policies = GetRateLimitFailurePolicies()
+	if policies["user"] != "local" || policies["quota"] != "local" || policies["ip"] != "open" {
+		t.Errorf("GetRateLimitFailurePolicies() with overrides = %v", policies)
+	}
+}
+
+func TestGetRiskWeights(t *testing.T) {
+	original := RiskWeights
+	defer func() { RiskWeights = original }()
+
+	RiskWeights = []string{"new_device=20", " country_mismatch = 0 ", "bogus", "ip_velocity=-1"}
+	weights := GetRiskWeights()
+	if len(weights) != 2 || weights["new_device"] != 20 || weights["country_mismatch"] != 0 {
+		t.Errorf("GetRiskWeights() = %v", weights)
+	}
+}
+
+func TestGetCountryRateLimits(t *testing.T) {
+	original := RateLimitPerCountry
+	defer func() { RateLimitPerCountry = original }()
+
+	RateLimitPerCountry = []string{"ng=100", " ID = 200 ", "bogus", "CN=0", "US=x"}
+	limits := GetCountryRateLimits()
+	if len(limits) != 2 || limits["NG"] != 100 || limits["ID"] != 200 {
+		t.Errorf("GetCountryRateLimits() = %v", limits)
+	}
+	// Parsed once: later calls reuse the result until the setting changes
+	if again := GetCountryRateLimits(); reflect.ValueOf(again).Pointer() != reflect.ValueOf(limits).Pointer() {
+		t.Error("GetCountryRateLimits() parsed the unchanged setting again")
+	}
+	RateLimitPerCountry = []string{"NG=50"}
+	if limits := GetCountryRateLimits(); len(limits) != 1 || limits["NG"] != 50 {
+		t.Errorf("GetCountryRateLimits() after change = %v", limits)
+	}
+}
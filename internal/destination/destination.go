@@ -0,0 +1,187 @@
+// Package destination validates and canonicalizes challenge destinations per channel, so the
+// same phone number or mailbox written differently maps to one rate-limit, storage and audit key.
+package destination
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/soulteary/herald/internal/geo"
+)
+
+var (
+	// ErrInvalidPhone is returned for numbers that cannot be parsed into E.164
+	ErrInvalidPhone = errors.New("invalid phone number")
+	// ErrInvalidEmail is returned for malformed email addresses
+	ErrInvalidEmail = errors.New("invalid email address")
+	// ErrInvalidDingTalkUserID is returned for malformed DingTalk userids
+	ErrInvalidDingTalkUserID = errors.New("invalid dingtalk userid")
+	// ErrInvalidChatID is returned for malformed chat-app recipient IDs
+	ErrInvalidChatID = errors.New("invalid chat recipient id")
+)
+
+// Options controls normalization
+type Options struct {
+	// DefaultRegion is the ISO country used for phone numbers written without a "+" or "00"
+	// prefix (e.g. "CN"); when empty such numbers are rejected
+	DefaultRegion string
+	// StrictEmailDomain rejects domains that cannot receive mail without looking up MX records:
+	// single-label names, IP literals, numeric TLDs and reserved TLDs (.test, .invalid, ...)
+	StrictEmailDomain bool
+}
+
+// Normalize validates dest for channel and returns its canonical form.
+// Channels without specific rules are only trimmed.
+func Normalize(channel, dest string, opts Options) (string, error) {
+	dest = strings.TrimSpace(dest)
+	switch channel {
+	case "sms", "voice":
+		return NormalizePhone(dest, opts.DefaultRegion)
+	case "email":
+		return NormalizeEmail(dest, opts.StrictEmailDomain)
+	case "dingtalk":
+		return NormalizeDingTalk(dest)
+	case "whatsapp":
+		// WhatsApp recipients are phone numbers
+		return NormalizePhone(dest, opts.DefaultRegion)
+	case "telegram", "slack", "feishu", "wecom":
+		return NormalizeChat(channel, dest)
+	}
+	return dest, nil
+}
+
+// E.164 limits on the total number of digits (calling code + national number)
+const (
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+// NormalizePhone returns the E.164 form ("+8613800138000") of phone. Spaces, dashes, dots and
+// parentheses are ignored. A number without "+" or "00" is a national number of defaultRegion:
+// a leading trunk "0" is dropped and the region's calling code is prepended ("13800138000"
+// becomes "+8613800138000" for CN, "09123456789" becomes "+919123456789" for IN). Without
+// defaultRegion such a number is kept in national format, digits only. International numbers
+// are accepted even when their calling code maps to no country (e.g. non-geographic +882).
+func NormalizePhone(phone, defaultRegion string) (string, error) {
+	international := false
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		international = true
+		phone = phone[1:]
+	case strings.HasPrefix(phone, "00"):
+		international = true
+		phone = phone[2:]
+	}
+
+	digits := make([]byte, 0, len(phone))
+	for i := 0; i < len(phone); i++ {
+		c := phone[i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := string(digits)
+
+	if !international {
+		code := geo.CallingCode(defaultRegion)
+		switch {
+		case code == "":
+			// No region to read it with: pass the national number on to the SMS gateway as before
+			if len(number) < minPhoneDigits || len(number) > maxPhoneDigits {
+				return "", ErrInvalidPhone
+			}
+			return number, nil
+		default:
+			number = code + strings.TrimPrefix(number, "0")
+		}
+	}
+
+	if len(number) < minPhoneDigits || len(number) > maxPhoneDigits || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// reservedTLDs cannot receive mail on the public internet (RFC 2606, RFC 6761)
+var reservedTLDs = map[string]bool{
+	"test": true, "example": true, "invalid": true, "localhost": true, "local": true,
+}
+
+// NormalizeEmail validates the syntax of email and returns it lowercased with the domain in
+// ASCII (punycode) form, so "User@Bücher.Example" becomes "user@xn--bcher-kva.example".
+func NormalizeEmail(email string, strictDomain bool) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalidEmail
+	}
+	local, domain := email[:at], email[at+1:]
+	if len(local) > 64 {
+		return "", ErrInvalidEmail
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || asciiDomain == "" {
+		return "", ErrInvalidEmail
+	}
+	normalized := strings.ToLower(local + "@" + asciiDomain)
+
+	// net/mail checks the local part; reject display names and comments
+	addr, err := mail.ParseAddress(normalized)
+	if err != nil || addr.Address != normalized || addr.Name != "" || len(normalized) > 254 {
+		return "", ErrInvalidEmail
+	}
+
+	if strictDomain {
+		labels := strings.Split(asciiDomain, ".")
+		tld := strings.ToLower(labels[len(labels)-1])
+		if len(labels) < 2 || reservedTLDs[tld] || strings.Trim(tld, "0123456789") == "" {
+			return "", ErrInvalidEmail
+		}
+	}
+	return normalized, nil
+}
+
+// dingTalkUserID matches DingTalk userids (letters, digits, "-" and "_")
+var dingTalkUserID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// NormalizeDingTalk validates a DingTalk userid (or mobile number in herald-dingtalk's
+// mobile lookup mode). Userids are case-sensitive and returned unchanged.
+func NormalizeDingTalk(userID string) (string, error) {
+	if !dingTalkUserID.MatchString(userID) {
+		return "", ErrInvalidDingTalkUserID
+	}
+	return userID, nil
+}
+
+// Chat-app recipient IDs
+var (
+	// telegramChatID matches numeric chat ids (negative for groups) and public @usernames
+	telegramChatID = regexp.MustCompile(`^(-?[0-9]{1,20}|@[A-Za-z][A-Za-z0-9_]{4,31})$`)
+	// slackUserID matches Slack member ids ("U024BE7LH", "W012A3CDE")
+	slackUserID = regexp.MustCompile(`^[UW][A-Z0-9]{2,20}$`)
+	// chatUserID matches Feishu open_id/user_id and WeCom userids
+	chatUserID = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,64}$`)
+)
+
+// NormalizeChat validates the recipient id of a chat-app channel. IDs are returned unchanged.
+func NormalizeChat(app, id string) (string, error) {
+	pattern := chatUserID
+	switch app {
+	case "telegram":
+		pattern = telegramChatID
+	case "slack":
+		pattern = slackUserID
+	}
+	if !pattern.MatchString(id) {
+		return "", ErrInvalidChatID
+	}
+	return id, nil
+}
@@ -0,0 +1,141 @@
+package destination
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone   string
+		region  string
+		want    string
+		wantErr bool
+	}{
+		{"+8613800138000", "", "+8613800138000", false},
+		{"+86 138-0013-8000", "", "+8613800138000", false},
+		{"0086 13800138000", "", "+8613800138000", false},
+		{"13800138000", "CN", "+8613800138000", false},
+		{"9123456789", "IN", "+919123456789", false},
+		{"09123456789", "IN", "+919123456789", false},
+		{"+356 2123 4567", "", "+35621234567", false},
+		{"+88216123456", "", "+88216123456", false},
+		{"(415) 555-0123", "US", "+14155550123", false},
+		{"07946 095800", "GB", "+447946095800", false},
+		{"13800138000", "", "13800138000", false},
+		{"020 7946-0958", "", "02079460958", false},
+		{"1380", "", "", true},
+		{"+86abc", "", "", true},
+		{"+861", "", "", true},
+		{"+8613800138000123456", "", "", true},
+		{"+0123456789", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.phone, tt.region)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizePhone(%q, %q) error = %v, wantErr %v", tt.phone, tt.region, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizePhone(%q, %q) = %q, want %q", tt.phone, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{"User@Example.COM", false, "user@example.com", false},
+		{"user@bücher.example", false, "user@xn--bcher-kva.example", false},
+		{"user+tag@example.com.", false, "user+tag@example.com", false},
+		{"user@localhost", false, "user@localhost", false},
+		{"user@localhost", true, "", true},
+		{"user@mail.test", true, "", true},
+		{"user@10.0.0.1", true, "", true},
+		{"user@example.com", true, "user@example.com", false},
+		{"no-at-sign", false, "", true},
+		{"@example.com", false, "", true},
+		{"user@", false, "", true},
+		{"Name <user@example.com>", false, "", true},
+		{"us er@example.com", false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.email, tt.strict)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeEmail(%q, %v) error = %v, wantErr %v", tt.email, tt.strict, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeEmail(%q, %v) = %q, want %q", tt.email, tt.strict, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeDingTalk(t *testing.T) {
+	for _, id := range []string{"manager4521", "a_b-C", "13800138000"} {
+		if got, err := NormalizeDingTalk(id); err != nil || got != id {
+			t.Errorf("NormalizeDingTalk(%q) = %q, %v", id, got, err)
+		}
+	}
+	for _, id := range []string{"user id", "user@corp", "用户"} {
+		if _, err := NormalizeDingTalk(id); !errors.Is(err, ErrInvalidDingTalkUserID) {
+			t.Errorf("NormalizeDingTalk(%q) error = %v, want ErrInvalidDingTalkUserID", id, err)
+		}
+	}
+}
+
+func TestNormalizeChat(t *testing.T) {
+	tests := []struct {
+		app     string
+		id      string
+		wantErr bool
+	}{
+		{"telegram", "123456789", false},
+		{"telegram", "-1001234567890", false},
+		{"telegram", "@herald_bot", false},
+		{"telegram", "@abc", true},
+		{"telegram", "user name", true},
+		{"slack", "U024BE7LH", false},
+		{"slack", "u024be7lh", true},
+		{"slack", "C024BE7LH", true},
+		{"feishu", "ou_7d8a6e6df7621556ce0d21922b676706", false},
+		{"wecom", "zhang.san", false},
+		{"wecom", "张三", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeChat(tt.app, tt.id)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidChatID) {
+				t.Errorf("NormalizeChat(%q, %q) error = %v, want ErrInvalidChatID", tt.app, tt.id, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.id {
+			t.Errorf("NormalizeChat(%q, %q) = %q, %v", tt.app, tt.id, got, err)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	got, err := Normalize("sms", "  +86 138 0013 8000 ", Options{})
+	if err != nil || got != "+8613800138000" {
+		t.Errorf("Normalize(sms) = %q, %v", got, err)
+	}
+	if got, err := Normalize("voice", "13800138000", Options{DefaultRegion: "CN"}); err != nil || got != "+8613800138000" {
+		t.Errorf("Normalize(voice) = %q, %v", got, err)
+	}
+	if got, err := Normalize("whatsapp", "+44 7946 095800", Options{}); err != nil || got != "+447946095800" {
+		t.Errorf("Normalize(whatsapp) = %q, %v", got, err)
+	}
+	if _, err := Normalize("email", "bad", Options{}); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("Normalize(email) error = %v, want ErrInvalidEmail", err)
+	}
+	// Unknown channels are only trimmed
+	if got, err := Normalize("other", " x ", Options{}); err != nil || got != "x" {
+		t.Errorf("Normalize(other) = %q, %v", got, err)
+	}
+}
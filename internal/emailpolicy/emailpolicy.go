@@ -0,0 +1,196 @@
+// Package emailpolicy rejects email destinations on disposable domains or role addresses
+// (noreply@, admin@, ...). Lists are plain text files, one entry per line with "#" comments,
+// and are reloaded when their modification time changes.
+package emailpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soulteary/herald/internal/metrics"
+)
+
+// List names, reported as the rejection reason and used as metric labels
+const (
+	ListDisposable = "disposable"
+	ListRole       = "role"
+)
+
+// Config configures the policy
+type Config struct {
+	DisposableDomainsFile string
+	RoleAccountsFile      string
+	// DisposablePurposes and RolePurposes select the purposes each list applies to
+	DisposablePurposes []string
+	RolePurposes       []string
+	// ReloadInterval is how often list files are checked for changes; 0 disables reloading
+	ReloadInterval time.Duration
+}
+
+// list is a set loaded from a file
+type list struct {
+	path    string
+	modTime time.Time
+	entries map[string]struct{}
+}
+
+// Policy checks email addresses against the configured lists. It is safe for concurrent use.
+type Policy struct {
+	cfg Config
+
+	mu         sync.RWMutex
+	disposable *list
+	role       *list
+	lastCheck  time.Time
+}
+
+// New loads the configured lists. It returns nil when no list file is configured.
+func New(cfg Config) (*Policy, error) {
+	if cfg.DisposableDomainsFile == "" && cfg.RoleAccountsFile == "" {
+		return nil, nil
+	}
+	p := &Policy{
+		cfg:        cfg,
+		disposable: &list{path: cfg.DisposableDomainsFile},
+		role:       &list{path: cfg.RoleAccountsFile},
+		lastCheck:  time.Now(),
+	}
+	for name, l := range map[string]*list{ListDisposable: p.disposable, ListRole: p.role} {
+		if _, err := l.reload(name); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Check returns the list that rejects email for purpose ("disposable" or "role"), or "" when allowed.
+// email must already be normalized (lowercase, ASCII domain).
+func (p *Policy) Check(email, purpose string) string {
+	if p == nil {
+		return ""
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	local, domain := email[:at], email[at+1:]
+	// Sub-addressing ("noreply+tag@") does not change the mailbox role
+	if i := strings.IndexByte(local, '+'); i >= 0 {
+		local = local[:i]
+	}
+
+	p.maybeReload()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if contains(p.cfg.DisposablePurposes, purpose) && p.disposable.matchDomain(domain) {
+		metrics.RecordEmailPolicyRejection(ListDisposable, purpose)
+		return ListDisposable
+	}
+	if contains(p.cfg.RolePurposes, purpose) && p.role.has(local) {
+		metrics.RecordEmailPolicyRejection(ListRole, purpose)
+		return ListRole
+	}
+	return ""
+}
+
+// Reload re-reads list files whose modification time changed; it reports whether any list was reloaded
+func (p *Policy) Reload() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastCheck = time.Now()
+
+	reloadedDisposable, err := p.disposable.reload(ListDisposable)
+	if err != nil {
+		return reloadedDisposable, err
+	}
+	reloadedRole, err := p.role.reload(ListRole)
+	return reloadedDisposable || reloadedRole, err
+}
+
+// maybeReload reloads the lists at most once per ReloadInterval. On error the previous lists stay in use.
+func (p *Policy) maybeReload() {
+	if p.cfg.ReloadInterval <= 0 {
+		return
+	}
+	p.mu.RLock()
+	due := time.Since(p.lastCheck) >= p.cfg.ReloadInterval
+	p.mu.RUnlock()
+	if due {
+		_, _ = p.Reload()
+	}
+}
+
+// reload reads the file if it changed since the last load
+func (l *list) reload(name string) (bool, error) {
+	if l.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s list: %w", name, err)
+	}
+	if l.entries != nil && info.ModTime().Equal(l.modTime) {
+		return false, nil
+	}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s list: %w", name, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	entries := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" {
+			entries[line] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read %s list: %w", name, err)
+	}
+
+	l.entries = entries
+	l.modTime = info.ModTime()
+	metrics.SetEmailPolicyEntries(name, len(entries))
+	return true, nil
+}
+
+func (l *list) has(entry string) bool {
+	_, ok := l.entries[entry]
+	return ok
+}
+
+// matchDomain matches the domain or any of its parent domains ("a.mailinator.com" matches "mailinator.com")
+func (l *list) matchDomain(domain string) bool {
+	for domain != "" {
+		if l.has(domain) {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package emailpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeList(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+}
+
+func TestNew_NoFiles(t *testing.T) {
+	p, err := New(Config{DisposablePurposes: []string{"signup"}})
+	if err != nil || p != nil {
+		t.Errorf("New() = %v, %v; want nil policy", p, err)
+	}
+	// A nil policy allows everything
+	if got := p.Check("user@mailinator.com", "signup"); got != "" {
+		t.Errorf("nil Policy.Check() = %q, want allowed", got)
+	}
+}
+
+func TestNew_MissingFile(t *testing.T) {
+	if _, err := New(Config{DisposableDomainsFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("New() with missing file should fail")
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	dir := t.TempDir()
+	disposable := filepath.Join(dir, "disposable.txt")
+	role := filepath.Join(dir, "role.txt")
+	now := time.Now()
+	writeList(t, disposable, "# disposable providers\nmailinator.com\nGuerrillaMail.com  # mixed case\n\n", now)
+	writeList(t, role, "noreply\nadmin\n", now)
+
+	p, err := New(Config{
+		DisposableDomainsFile: disposable,
+		RoleAccountsFile:      role,
+		DisposablePurposes:    []string{"signup", "bind"},
+		RolePurposes:          []string{"signup"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		email   string
+		purpose string
+		want    string
+	}{
+		{"user@mailinator.com", "signup", ListDisposable},
+		{"user@inbox.mailinator.com", "signup", ListDisposable},
+		{"user@guerrillamail.com", "bind", ListDisposable},
+		{"user@mailinator.com", "login", ""},
+		{"user@notmailinator.com", "signup", ""},
+		{"noreply@example.com", "signup", ListRole},
+		{"noreply+news@example.com", "signup", ListRole},
+		{"noreply@example.com", "bind", ""},
+		{"user@example.com", "signup", ""},
+	}
+	for _, tt := range tests {
+		if got := p.Check(tt.email, tt.purpose); got != tt.want {
+			t.Errorf("Check(%q, %q) = %q, want %q", tt.email, tt.purpose, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Reload(t *testing.T) {
+	dir := t.TempDir()
+	disposable := filepath.Join(dir, "disposable.txt")
+	past := time.Now().Add(-time.Hour)
+	writeList(t, disposable, "mailinator.com\n", past)
+
+	p, err := New(Config{
+		DisposableDomainsFile: disposable,
+		DisposablePurposes:    []string{"signup"},
+		ReloadInterval:        time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := p.Check("user@yopmail.com", "signup"); got != "" {
+		t.Fatalf("Check() before reload = %q, want allowed", got)
+	}
+
+	// Unchanged files are not re-read
+	if reloaded, err := p.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() unchanged = %v, %v; want false, nil", reloaded, err)
+	}
+
+	writeList(t, disposable, "mailinator.com\nyopmail.com\n", time.Now())
+	if got := p.Check("user@yopmail.com", "signup"); got != ListDisposable {
+		t.Errorf("Check() after file change = %q, want %q", got, ListDisposable)
+	}
+
+	// A broken file keeps the previous list
+	if err := os.Remove(disposable); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := p.Reload(); err == nil {
+		t.Error("Reload() with missing file should fail")
+	}
+	if got := p.Check("user@yopmail.com", "signup"); got != ListDisposable {
+		t.Errorf("Check() after failed reload = %q, want previous list kept", got)
+	}
+}
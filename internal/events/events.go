@@ -0,0 +1,111 @@
+// Package events delivers security events (e.g. user locked) to an external webhook.
+// Payloads are JSON and signed with the same scheme Herald accepts for service
+// authentication: HMAC-SHA256 over "timestamp:service:body", hex encoded.
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger "github.com/soulteary/logger-kit"
+	secure "github.com/soulteary/secure-kit"
+)
+
+// Event types
+const (
+	TypeUserLocked   = "user_locked"
+	TypeUserUnlocked = "user_unlocked"
+)
+
+// ServiceName is sent in the X-Service header and included in the signature
+const ServiceName = "herald"
+
+// Event is the webhook payload
+type Event struct {
+	Type      string                 `json:"type"`
+	UserID    string                 `json:"user_id,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Notifier posts events to a webhook URL. A nil Notifier discards events.
+type Notifier struct {
+	url    string
+	secret string
+	client *http.Client
+	log    *logger.Logger
+}
+
+// NewNotifier creates a notifier, or returns nil when url is empty
+func NewNotifier(url, secret string, timeout time.Duration, log *logger.Logger) *Notifier {
+	if url == "" {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &Notifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+		log:    log,
+	}
+}
+
+// Notify delivers the event asynchronously; failures are logged and otherwise ignored
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), n.client.Timeout)
+		defer cancel()
+		if err := n.Send(ctx, event); err != nil && n.log != nil {
+			n.log.Warn().Err(err).Str("event", event.Type).Msg("Failed to deliver event webhook")
+		}
+	}()
+}
+
+// Send delivers the event synchronously
+func (n *Notifier) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Service", ServiceName)
+		req.Header.Set("X-Signature", Sign(n.secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign computes the signature of an event body for the given timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	return secure.ComputeHMACSHA256([]byte(fmt.Sprintf("%s:%s:%s", timestamp, ServiceName, body)), secret)
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewNotifier_EmptyURL(t *testing.T) {
+	n := NewNotifier("", "secret", 0, nil)
+	if n != nil {
+		t.Fatal("NewNotifier() with empty URL should return nil")
+	}
+	// Nil notifier discards events without panicking
+	n.Notify(Event{Type: TypeUserLocked})
+}
+
+func TestNotifier_Send_Signed(t *testing.T) {
+	received := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-Service") != ServiceName {
+			t.Errorf("X-Service = %q, want %q", r.Header.Get("X-Service"), ServiceName)
+		}
+		if want := Sign("secret", r.Header.Get("X-Timestamp"), body); r.Header.Get("X-Signature") != want {
+			t.Errorf("X-Signature = %q, want %q", r.Header.Get("X-Signature"), want)
+		}
+		var e Event
+		_ = json.Unmarshal(body, &e)
+		received <- e
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(server.URL, "secret", time.Second, nil)
+	err := n.Send(context.Background(), Event{Type: TypeUserLocked, UserID: "user1", Data: map[string]interface{}{"level": 2}})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	e := <-received
+	if e.Type != TypeUserLocked || e.UserID != "user1" || e.Data["level"] != float64(2) {
+		t.Errorf("received event = %+v", e)
+	}
+}
+
+func TestNotifier_Send_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(server.URL, "", time.Second, nil)
+	if err := n.Send(context.Background(), Event{Type: TypeUserUnlocked}); err == nil {
+		t.Error("Send() expected error for non-2xx status")
+	}
+}
@@ -0,0 +1,111 @@
+// Package factors remembers which OTP destinations a user has verified, so the factor listing
+// can offer them again. Only masked destinations are stored, next to a hash that tells apart
+// destinations with the same mask.
+package factors
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// historyKeyPrefix is the Redis key prefix of a user's verified destinations
+const historyKeyPrefix = "otp:factors:dest:"
+
+// Destination is a recently verified OTP destination
+type Destination struct {
+	Channel        string `json:"channel"`
+	Destination    string `json:"destination"` // Masked
+	LastVerifiedAt int64  `json:"last_verified_at"`
+}
+
+// entry is the stored form of a Destination
+type entry struct {
+	Destination
+	Hash string `json:"hash"`
+}
+
+// History records verified destinations per user
+type History struct {
+	redis *redis.Client
+	max   int           // Destinations kept per user, most recent first
+	ttl   time.Duration // Destinations not verified for this long are dropped
+}
+
+// NewHistory creates a history keeping max destinations per user for ttl
+func NewHistory(redisClient *redis.Client, max int, ttl time.Duration) *History {
+	return &History{redis: redisClient, max: max, ttl: ttl}
+}
+
+// Record marks destination (shown as masked) as verified now for userID
+func (h *History) Record(ctx context.Context, userID, channel, destination, masked string) error {
+	if h.max <= 0 {
+		return nil
+	}
+	entries, err := h.load(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(channel + ":" + strings.ToLower(strings.TrimSpace(destination))))
+	hash := hex.EncodeToString(sum[:16])
+	kept := []entry{{
+		Destination: Destination{Channel: channel, Destination: masked, LastVerifiedAt: time.Now().Unix()},
+		Hash:        hash,
+	}}
+	for _, e := range entries {
+		if e.Hash != hash && len(kept) < h.max {
+			kept = append(kept, e)
+		}
+	}
+
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	if err := h.redis.Set(ctx, historyKeyPrefix+userID, data, h.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store verified destinations: %w", err)
+	}
+	return nil
+}
+
+// Recent returns the verified destinations of userID, most recent first
+func (h *History) Recent(ctx context.Context, userID string) ([]Destination, error) {
+	entries, err := h.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-h.ttl).Unix()
+	out := make([]Destination, 0, len(entries))
+	for _, e := range entries {
+		if h.ttl > 0 && e.LastVerifiedAt < cutoff {
+			continue
+		}
+		out = append(out, e.Destination)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastVerifiedAt > out[j].LastVerifiedAt })
+	return out, nil
+}
+
+func (h *History) load(ctx context.Context, userID string) ([]entry, error) {
+	data, err := h.redis.Get(ctx, historyKeyPrefix+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verified destinations: %w", err)
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
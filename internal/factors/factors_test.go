@@ -0,0 +1,51 @@
+package factors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+func TestHistory_RecordAndRecent(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	h := NewHistory(client, 2, time.Hour)
+	ctx := context.Background()
+
+	if got, err := h.Recent(ctx, "u1"); err != nil || len(got) != 0 {
+		t.Fatalf("Recent() without history = %v, %v", got, err)
+	}
+
+	for _, r := range []struct{ channel, dest, masked string }{
+		{"sms", "+15550001111", "+15*******111"},
+		{"email", "Alice@example.com", "al***@example.com"},
+		{"sms", "+15550001111", "+15*******111"}, // Verified again: moves to the front
+		{"email", "alice@example.com", "al***@example.com"},
+	} {
+		if err := h.Record(ctx, "u1", r.channel, r.dest, r.masked); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	got, err := h.Recent(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Recent() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Channel != "email" || got[1].Channel != "sms" {
+		t.Fatalf("Recent() = %+v, want email then sms", got)
+	}
+	if got[1].Destination != "+15*******111" {
+		t.Errorf("Destination = %q, want the masked form", got[1].Destination)
+	}
+
+	// Only max destinations are kept
+	if err := h.Record(ctx, "u1", "sms", "+15550002222", "+15*******222"); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	got, _ = h.Recent(ctx, "u1")
+	if len(got) != 2 || got[0].Destination != "+15*******222" || got[1].Channel != "email" {
+		t.Errorf("Recent() after overflow = %+v", got)
+	}
+}
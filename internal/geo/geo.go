@@ -0,0 +1,129 @@
+// Package geo resolves countries for phone numbers (by calling code) and IP addresses.
+// Countries are ISO 3166-1 alpha-2 codes; an empty string means unknown.
+package geo
+
+import (
+	"strings"
+)
+
+// IPResolver resolves the country of an IP address
+type IPResolver interface {
+	CountryForIP(ip string) string
+}
+
+// NoopIPResolver resolves nothing; used when no IP database is configured
+type NoopIPResolver struct{}
+
+// CountryForIP always returns "" (unknown)
+func (NoopIPResolver) CountryForIP(string) string {
+	return ""
+}
+
+// callingCodes maps every assigned country calling code (ITU-T E.164) to the country it is
+// most commonly associated with. Shared codes (e.g. +1, +7) resolve to the largest country.
+// Non-geographic codes (+800, +870, +881-+883, ...) have no country and are not listed.
+var callingCodes = map[string]string{
+	"1": "US", "7": "RU", "20": "EG", "27": "ZA", "30": "GR", "31": "NL", "32": "BE", "33": "FR",
+	"34": "ES", "36": "HU", "39": "IT", "40": "RO", "41": "CH", "43": "AT", "44": "GB", "45": "DK",
+	"46": "SE", "47": "NO", "48": "PL", "49": "DE", "51": "PE", "52": "MX", "53": "CU", "54": "AR",
+	"55": "BR", "56": "CL", "57": "CO", "58": "VE", "60": "MY", "61": "AU", "62": "ID", "63": "PH",
+	"64": "NZ", "65": "SG", "66": "TH", "81": "JP", "82": "KR", "84": "VN", "86": "CN", "90": "TR",
+	"91": "IN", "92": "PK", "93": "AF", "94": "LK", "95": "MM", "98": "IR", "211": "SS", "212": "MA",
+	"213": "DZ", "216": "TN", "218": "LY", "220": "GM", "221": "SN", "222": "MR", "223": "ML",
+	"224": "GN", "225": "CI", "226": "BF", "227": "NE", "228": "TG", "229": "BJ", "230": "MU",
+	"231": "LR", "232": "SL", "233": "GH", "234": "NG", "235": "TD", "236": "CF", "237": "CM",
+	"238": "CV", "239": "ST", "240": "GQ", "241": "GA", "242": "CG", "243": "CD", "244": "AO",
+	"245": "GW", "246": "IO", "247": "AC", "248": "SC", "249": "SD", "250": "RW", "251": "ET",
+	"252": "SO", "253": "DJ", "254": "KE", "255": "TZ", "256": "UG", "257": "BI", "258": "MZ",
+	"260": "ZM", "261": "MG", "262": "RE", "263": "ZW", "264": "NA", "265": "MW", "266": "LS",
+	"267": "BW", "268": "SZ", "269": "KM", "290": "SH", "291": "ER", "297": "AW", "298": "FO",
+	"299": "GL", "350": "GI", "351": "PT", "352": "LU", "353": "IE", "354": "IS", "355": "AL",
+	"356": "MT", "357": "CY", "358": "FI", "359": "BG", "370": "LT", "371": "LV", "372": "EE",
+	"373": "MD", "374": "AM", "375": "BY", "376": "AD", "377": "MC", "378": "SM", "380": "UA",
+	"381": "RS", "382": "ME", "383": "XK", "385": "HR", "386": "SI", "387": "BA", "389": "MK",
+	"420": "CZ", "421": "SK", "423": "LI", "500": "FK", "501": "BZ", "502": "GT", "503": "SV",
+	"504": "HN", "505": "NI", "506": "CR", "507": "PA", "508": "PM", "509": "HT", "590": "GP",
+	"591": "BO", "592": "GY", "593": "EC", "594": "GF", "595": "PY", "596": "MQ", "597": "SR",
+	"598": "UY", "599": "CW", "670": "TL", "672": "NF", "673": "BN", "674": "NR", "675": "PG",
+	"676": "TO", "677": "SB", "678": "VU", "679": "FJ", "680": "PW", "681": "WF", "682": "CK",
+	"683": "NU", "685": "WS", "686": "KI", "687": "NC", "688": "TV", "689": "PF", "690": "TK",
+	"691": "FM", "692": "MH", "850": "KP", "852": "HK", "853": "MO", "855": "KH", "856": "LA",
+	"880": "BD", "886": "TW", "960": "MV", "961": "LB", "962": "JO", "963": "SY", "964": "IQ",
+	"965": "KW", "966": "SA", "967": "YE", "968": "OM", "970": "PS", "971": "AE", "972": "IL",
+	"973": "BH", "974": "QA", "975": "BT", "976": "MN", "977": "NP", "992": "TJ", "993": "TM",
+	"994": "AZ", "995": "GE", "996": "KG", "998": "UZ",
+}
+
+// regionCallingCodes maps countries to their calling code; built from callingCodes plus the
+// countries that share a code with the one listed there
+var regionCallingCodes = func() map[string]string {
+	m := map[string]string{
+		"CA": "1", "AG": "1", "AI": "1", "AS": "1", "BB": "1", "BM": "1", "BS": "1", "DM": "1",
+		"DO": "1", "GD": "1", "GU": "1", "JM": "1", "KN": "1", "KY": "1", "LC": "1", "MP": "1",
+		"MS": "1", "PR": "1", "SX": "1", "TC": "1", "TT": "1", "VC": "1", "VG": "1", "VI": "1",
+		"KZ": "7", "GG": "44", "IM": "44", "JE": "44", "SJ": "47", "CC": "61", "CX": "61", "EH": "212",
+		"YT": "262", "AX": "358", "VA": "39", "BL": "590", "MF": "590", "BQ": "599",
+	}
+	for code, country := range callingCodes {
+		m[country] = code
+	}
+	return m
+}()
+
+// CallingCode returns the international calling code for a country ("CN" -> "86"), or "" if unknown
+func CallingCode(country string) string {
+	return regionCallingCodes[strings.ToUpper(country)]
+}
+
+// sharedCodePrefixes resolves numbers within shared calling codes (+1 NANP, +7) to countries
+// other than the default in callingCodes, by calling code plus area code
+var sharedCodePrefixes = map[string]string{
+	// Canada
+	"1204": "CA", "1226": "CA", "1236": "CA", "1249": "CA", "1250": "CA", "1263": "CA", "1289": "CA",
+	"1306": "CA", "1343": "CA", "1354": "CA", "1365": "CA", "1367": "CA", "1368": "CA", "1382": "CA",
+	"1387": "CA", "1403": "CA", "1416": "CA", "1418": "CA", "1428": "CA", "1431": "CA", "1437": "CA",
+	"1438": "CA", "1450": "CA", "1468": "CA", "1474": "CA", "1506": "CA", "1514": "CA", "1519": "CA",
+	"1548": "CA", "1579": "CA", "1581": "CA", "1584": "CA", "1587": "CA", "1604": "CA", "1613": "CA",
+	"1639": "CA", "1647": "CA", "1672": "CA", "1683": "CA", "1705": "CA", "1709": "CA", "1742": "CA",
+	"1753": "CA", "1778": "CA", "1780": "CA", "1782": "CA", "1807": "CA", "1819": "CA", "1825": "CA",
+	"1867": "CA", "1873": "CA", "1879": "CA", "1902": "CA", "1905": "CA",
+	// Caribbean NANP members
+	"1787": "PR", "1939": "PR", "1876": "JM", "1868": "TT", "1809": "DO", "1829": "DO", "1849": "DO",
+	"1242": "BS", "1246": "BB",
+	// Kazakhstan
+	"76": "KZ", "77": "KZ",
+}
+
+// maxSharedPrefix is the longest key in sharedCodePrefixes
+const maxSharedPrefix = 4
+
+// CountryForPhone returns the country for an international phone number ("+8613800138000",
+// "+86 138-0013-8000"), or "" when the number has no "+" prefix or an unknown calling code.
+// All data is bundled; no network lookups are made.
+func CountryForPhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	if !strings.HasPrefix(phone, "+") {
+		return ""
+	}
+	digits := make([]byte, 0, maxSharedPrefix)
+	for i := 1; i < len(phone) && len(digits) < maxSharedPrefix; i++ {
+		c := phone[i]
+		if c >= '0' && c <= '9' {
+			digits = append(digits, c)
+		} else if c != ' ' && c != '-' && c != '(' && c != ')' && c != '.' {
+			return ""
+		}
+	}
+	for n := len(digits); n >= 2; n-- {
+		if country, ok := sharedCodePrefixes[string(digits[:n])]; ok {
+			return country
+		}
+	}
+	// Calling codes are prefix-free, so the first match is the only match
+	for n := 1; n <= len(digits) && n <= 3; n++ {
+		if country, ok := callingCodes[string(digits[:n])]; ok {
+			return country
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package geo
+
+import "testing"
+
+func TestCountryForPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"+8613800138000", "CN"},
+		{"+86 138-0013-8000", "CN"},
+		{"+14155550123", "US"},
+		{"+2348012345678", "NG"},
+		{"+44 (20) 7946 0958", "GB"},
+		{"+1 416 555 0123", "CA"},
+		{"+17875550123", "PR"},
+		{"+77012345678", "KZ"},
+		{"+79123456789", "RU"},
+		{"+35621234567", "MT"},
+		{"+59899123456", "UY"},
+		{"+67971234567", "FJ"},
+		{"+919123456789", "IN"},
+		{"13800138000", ""},
+		{"+", ""},
+		{"+999123", ""},
+		{"+86abc", ""},
+	}
+	for _, tt := range tests {
+		if got := CountryForPhone(tt.phone); got != tt.want {
+			t.Errorf("CountryForPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestNoopIPResolver(t *testing.T) {
+	if got := (NoopIPResolver{}).CountryForIP("8.8.8.8"); got != "" {
+		t.Errorf("CountryForIP() = %q, want empty", got)
+	}
+}
+
+func TestCallingCode(t *testing.T) {
+	tests := map[string]string{"CN": "86", "cn": "86", "US": "1", "CA": "1", "GB": "44", "MT": "356", "JE": "44", "XX": ""}
+	for country, want := range tests {
+		if got := CallingCode(country); got != want {
+			t.Errorf("CallingCode(%q) = %q, want %q", country, got, want)
+		}
+	}
+}
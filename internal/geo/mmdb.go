@@ -0,0 +1,55 @@
+package geo
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDBResolver resolves IP countries from a local MaxMind-format database
+// (GeoLite2-Country, GeoIP2-Country/City, DB-IP and compatible files)
+type MMDBResolver struct {
+	reader *maxminddb.Reader
+}
+
+// mmdbRecord is the subset of a country/city record Herald reads
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// OpenMMDB opens the database at path
+func OpenMMDB(path string) (*MMDBResolver, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open IP database: %w", err)
+	}
+	return &MMDBResolver{reader: reader}, nil
+}
+
+// CountryForIP returns the country of ip, falling back to the registered country;
+// "" when ip is invalid or not in the database
+func (r *MMDBResolver) CountryForIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	var record mmdbRecord
+	if err := r.reader.Lookup(parsed, &record); err != nil {
+		return ""
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+	return record.RegisteredCountry.ISOCode
+}
+
+// Close releases the database
+func (r *MMDBResolver) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,84 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestMMDB writes a minimal IPv4 database with one search tree node:
+// 0.0.0.0/1 resolves to country US, 128.0.0.0/1 is not in the database.
+func writeTestMMDB(t *testing.T) string {
+	t.Helper()
+
+	str := func(s string) []byte { return append([]byte{0x40 | byte(len(s))}, s...) }
+	u32 := func(v uint32) []byte {
+		b := []byte{0xC0 | 4, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], v)
+		return b
+	}
+	mapOf := func(n int) []byte { return []byte{0xE0 | byte(n)} }
+
+	var buf bytes.Buffer
+	// Search tree: 1 node, 24-bit records; left -> data offset 0 (nodeCount + 16), right -> empty (nodeCount)
+	buf.Write([]byte{0, 0, 17, 0, 0, 1})
+	buf.Write(make([]byte, 16))
+	// Data section: {"country": {"iso_code": "US"}}
+	buf.Write(mapOf(1))
+	buf.Write(str("country"))
+	buf.Write(mapOf(1))
+	buf.Write(str("iso_code"))
+	buf.Write(str("US"))
+	// Metadata
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	buf.Write(mapOf(8))
+	buf.Write(str("binary_format_major_version"))
+	buf.Write(u32(2))
+	buf.Write(str("binary_format_minor_version"))
+	buf.Write(u32(0))
+	buf.Write(str("build_epoch"))
+	buf.Write(u32(1700000000))
+	buf.Write(str("database_type"))
+	buf.Write(str("Test-Country"))
+	buf.Write(str("ip_version"))
+	buf.Write(u32(4))
+	buf.Write(str("node_count"))
+	buf.Write(u32(1))
+	buf.Write(str("record_size"))
+	buf.Write(u32(24))
+	buf.Write(str("languages"))
+	buf.Write([]byte{0x00, 0x04}) // empty array (extended type 11)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestMMDBResolver(t *testing.T) {
+	r, err := OpenMMDB(writeTestMMDB(t))
+	if err != nil {
+		t.Fatalf("OpenMMDB() error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+
+	tests := map[string]string{
+		"1.2.3.4":   "US",
+		"200.1.1.1": "",
+		"not-an-ip": "",
+	}
+	for ip, want := range tests {
+		if got := r.CountryForIP(ip); got != want {
+			t.Errorf("CountryForIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestOpenMMDB_Missing(t *testing.T) {
+	if _, err := OpenMMDB(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("OpenMMDB() with missing file should fail")
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/captcha"
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/ratelimit"
+)
+
+// captchaRequired reports whether a challenge creation must carry a captcha token:
+// always for CAPTCHA_REQUIRED_PURPOSES, otherwise once the client IP passes CAPTCHA_IP_THRESHOLD per hour.
+func (h *Handlers) captchaRequired(ctx context.Context, purpose, clientIP string) bool {
+	if h.captchaVerifier == nil {
+		return false
+	}
+	for _, p := range config.CaptchaRequiredPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	if config.CaptchaIPThreshold <= 0 {
+		return false
+	}
+	// Without Redis the captcha scope's failure policy decides: by default a captcha is required
+	allowed, _, _, err := h.rateLimitManager.CheckScopedRateLimit(ctx, ratelimit.ScopeCaptcha, "ip:"+clientIP, config.CaptchaIPThreshold, time.Hour)
+	if err != nil {
+		h.log.Warn().Err(err).Msg("Captcha threshold check failed")
+	}
+	return !allowed
+}
+
+// verifyCaptcha checks token and returns the HTTP status and reason to reject with, or an empty reason when valid
+func (h *Handlers) verifyCaptcha(ctx context.Context, token, clientIP string) (int, string) {
+	provider := h.captchaVerifier.Provider()
+	if token == "" {
+		metrics.RecordCaptchaVerification(provider, "missing")
+		return fiber.StatusForbidden, "captcha_required"
+	}
+	if err := h.captchaVerifier.Verify(ctx, token, clientIP); err != nil {
+		if errors.Is(err, captcha.ErrInvalidToken) {
+			metrics.RecordCaptchaVerification(provider, "invalid")
+			return fiber.StatusForbidden, "captcha_invalid"
+		}
+		metrics.RecordCaptchaVerification(provider, "error")
+		h.log.Warn().Err(err).Str("provider", provider).Msg("Captcha verification failed")
+		return fiber.StatusServiceUnavailable, "captcha_unavailable"
+	}
+	metrics.RecordCaptchaVerification(provider, "success")
+	return fiber.StatusOK, ""
+}
+
+// IssueCaptchaPuzzle handles POST /v1/captcha/puzzles and issues a proof-of-work puzzle
+// when CAPTCHA_PROVIDER=pow.
+func (h *Handlers) IssueCaptchaPuzzle(c *fiber.Ctx) error {
+	pow, ok := h.captchaVerifier.(*captcha.PoWVerifier)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "pow_not_enabled",
+		})
+	}
+
+	puzzle, err := pow.Issue(requestContext(c))
+	if err != nil {
+		h.log.Warn().Err(err).Msg("Failed to issue proof-of-work puzzle")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"id":         puzzle.ID,
+		"challenge":  puzzle.Challenge,
+		"difficulty": puzzle.Difficulty,
+		"expires_in": puzzle.ExpiresIn,
+	})
+}
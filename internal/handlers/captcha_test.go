@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_CreateChallenge_CaptchaGate(t *testing.T) {
+	originalProvider := config.CaptchaProvider
+	originalStubToken := config.CaptchaStubToken
+	originalRequiredPurposes := config.CaptchaRequiredPurposes
+	originalAllowedPurposes := config.AllowedPurposes
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	defer func() {
+		config.CaptchaProvider = originalProvider
+		config.CaptchaStubToken = originalStubToken
+		config.CaptchaRequiredPurposes = originalRequiredPurposes
+		config.AllowedPurposes = originalAllowedPurposes
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+	}()
+
+	config.CaptchaProvider = "stub"
+	config.CaptchaStubToken = "human"
+	config.CaptchaRequiredPurposes = []string{"signup"}
+	config.AllowedPurposes = []string{"login", "signup"}
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(userID, purpose, token string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:       userID,
+			Channel:      "email",
+			Destination:  userID + "@example.com",
+			Purpose:      purpose,
+			ClientIP:     "127.0.0.1",
+			CaptchaToken: token,
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	status, result := send("anon1", "signup", "")
+	if status != fiber.StatusForbidden || result["reason"] != "captcha_required" {
+		t.Errorf("missing token: status=%d, body=%v; want 403 captcha_required", status, result)
+	}
+
+	status, result = send("anon2", "signup", "robot")
+	if status != fiber.StatusForbidden || result["reason"] != "captcha_invalid" {
+		t.Errorf("invalid token: status=%d, body=%v; want 403 captcha_invalid", status, result)
+	}
+
+	status, result = send("anon3", "signup", "human")
+	if status != fiber.StatusOK {
+		t.Errorf("valid token: status=%d, body=%v; want 200", status, result)
+	}
+
+	// Purposes outside CAPTCHA_REQUIRED_PURPOSES are not gated
+	status, result = send("user4", "login", "")
+	if status != fiber.StatusOK {
+		t.Errorf("login without token: status=%d, body=%v; want 200", status, result)
+	}
+}
+
+func TestHandlers_CreateChallenge_CaptchaIPThreshold(t *testing.T) {
+	originalProvider := config.CaptchaProvider
+	originalStubToken := config.CaptchaStubToken
+	originalThreshold := config.CaptchaIPThreshold
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	defer func() {
+		config.CaptchaProvider = originalProvider
+		config.CaptchaStubToken = originalStubToken
+		config.CaptchaIPThreshold = originalThreshold
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+	}()
+
+	config.CaptchaProvider = "stub"
+	config.CaptchaStubToken = "human"
+	config.CaptchaIPThreshold = 1
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	if handlers.captchaRequired(t.Context(), "login", "198.51.100.7") {
+		t.Error("first request from an IP should not require a captcha")
+	}
+	if !handlers.captchaRequired(t.Context(), "login", "198.51.100.7") {
+		t.Error("requests over CAPTCHA_IP_THRESHOLD should require a captcha")
+	}
+	if handlers.captchaRequired(t.Context(), "login", "198.51.100.8") {
+		t.Error("threshold should be tracked per IP")
+	}
+}
+
+func TestHandlers_IssueCaptchaPuzzle(t *testing.T) {
+	originalProvider := config.CaptchaProvider
+	originalDifficulty := config.CaptchaPoWDifficulty
+	defer func() {
+		config.CaptchaProvider = originalProvider
+		config.CaptchaPoWDifficulty = originalDifficulty
+	}()
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	// Not available unless the proof-of-work provider is selected
+	config.CaptchaProvider = ""
+	app := fiber.New()
+	app.Post("/puzzles", NewHandlers(redisClient, nil, testLogger()).IssueCaptchaPuzzle)
+	resp, err := app.Test(httptest.NewRequest("POST", "/puzzles", nil))
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("IssueCaptchaPuzzle() without pow status = %d, want 404", resp.StatusCode)
+	}
+
+	config.CaptchaProvider = "pow"
+	config.CaptchaPoWDifficulty = 12
+	app = fiber.New()
+	app.Post("/puzzles", NewHandlers(redisClient, nil, testLogger()).IssueCaptchaPuzzle)
+	resp, err = app.Test(httptest.NewRequest("POST", "/puzzles", nil))
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK || result["id"] == "" || result["difficulty"] != float64(12) {
+		t.Errorf("IssueCaptchaPuzzle() status=%d, body=%v", resp.StatusCode, result)
+	}
+}
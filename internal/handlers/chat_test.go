@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_CreateChallenge_ChatChannel(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		channels []string
+		dests    []string
+		apiKeys  []string
+	)
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Channel string `json:"channel"`
+			To      string `json:"to"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		channels = append(channels, body.Channel)
+		dests = append(dests, body.To)
+		apiKeys = append(apiKeys, r.Header.Get("X-API-Key"))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"message_id":"tg1"}`))
+	}))
+	defer sidecar.Close()
+
+	originalChatChannels := config.ChatChannelsJSON
+	defer func() { config.ChatChannelsJSON = originalChatChannels }()
+	config.ChatChannelsJSON = `[{"name":"telegram","base_url":"` + sidecar.URL + `","api_key":"tg-key"}]`
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(channel, destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      "user123",
+			Channel:     channel,
+			Destination: destination,
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	if status, result := send("telegram", "123456789"); status != fiber.StatusOK {
+		t.Fatalf("telegram challenge: status=%d, body=%v; want 200", status, result)
+	}
+	mu.Lock()
+	if len(dests) != 1 || dests[0] != "123456789" || channels[0] != "telegram" || apiKeys[0] != "tg-key" {
+		t.Errorf("sidecar calls: channels=%v dests=%v keys=%v", channels, dests, apiKeys)
+	}
+	mu.Unlock()
+
+	if status, result := send("telegram", "not a chat id"); status != fiber.StatusBadRequest || result["reason"] != "invalid_destination" {
+		t.Errorf("invalid telegram destination: status=%d, body=%v; want 400 invalid_destination", status, result)
+	}
+	// Chat apps that are not configured are rejected
+	if status, result := send("slack", "U024BE7LH"); status != fiber.StatusBadRequest || result["reason"] != "invalid_channel" {
+		t.Errorf("unconfigured slack: status=%d, body=%v; want 400 invalid_channel", status, result)
+	}
+}
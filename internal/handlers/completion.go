@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/completion"
+	"github.com/soulteary/herald/internal/config"
+)
+
+// challengeEventResponse is the long-poll response: the event fields plus "ok"
+type challengeEventResponse struct {
+	OK bool `json:"ok"`
+	*completion.Event
+}
+
+// publishCompletion records the final state of a challenge; failures only delay waiters
+func (h *Handlers) publishCompletion(ctx context.Context, ev completion.Event) {
+	if err := h.completions.Publish(ctx, ev); err != nil {
+		h.log.Warn().Err(err).Str("challenge_id", ev.ChallengeID).Msg("Failed to publish challenge completion")
+	}
+}
+
+// challengeState returns the final event of a challenge, a pending event while the challenge
+// exists, or nil for unknown (or expired) challenges
+func (h *Handlers) challengeState(ctx context.Context, challengeID string) (*completion.Event, error) {
+	ev, err := h.completions.Last(ctx, challengeID)
+	if ev != nil || err != nil {
+		return ev, err
+	}
+	ch, err := h.challengeManager.Get(ctx, challengeID)
+	if err != nil {
+		return nil, nil
+	}
+	return &completion.Event{
+		ChallengeID: ch.ID,
+		Status:      completion.StatusPending,
+		UserID:      ch.UserID,
+		Channel:     string(ch.Channel),
+		Timestamp:   time.Now().Unix(),
+	}, nil
+}
+
+// ChallengeEvents handles GET /v1/otp/challenges/:id/events. With "Accept: text/event-stream"
+// it streams Server-Sent Events until the challenge completes; otherwise it long-polls
+// (?wait=<seconds>, up to CHALLENGE_EVENTS_LONG_POLL_MAX) and returns the status as JSON.
+func (h *Handlers) ChallengeEvents(c *fiber.Ctx) error {
+	challengeID := c.Params("id")
+
+	ev, err := h.challengeState(c.Context(), challengeID)
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to read challenge completion")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	if ev == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "challenge_not_found",
+		})
+	}
+
+	if strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream") {
+		return h.streamChallengeEvents(c, ev)
+	}
+
+	wait := time.Duration(0)
+	if v := c.Query("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "invalid_wait",
+			})
+		}
+		wait = min(time.Duration(seconds)*time.Second, config.ChallengeEventsLongPollMax)
+	}
+
+	if ev.Status == completion.StatusPending && wait > 0 {
+		done, err := h.completions.Wait(c.Context(), challengeID, wait)
+		if err != nil {
+			h.log.Error().Err(err).Msg("Failed to wait for challenge completion")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "internal_error",
+			})
+		}
+		if done != nil {
+			ev = done
+		} else if current, _ := h.challengeState(c.Context(), challengeID); current != nil {
+			ev = current
+		} else {
+			ev = expiredEvent(ev)
+		}
+	}
+
+	return c.JSON(challengeEventResponse{OK: true, Event: ev})
+}
+
+// streamChallengeEvents sends the current state, then the final one, as "status" events.
+// Comments keep idle connections alive; the stream ends after CHALLENGE_EVENTS_STREAM_MAX.
+func (h *Handlers) streamChallengeEvents(c *fiber.Ctx, ev *completion.Event) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The handler has returned: the stream has its own deadline
+		ctx, cancel := context.WithTimeout(context.Background(), config.ChallengeEventsStreamMax)
+		defer cancel()
+
+		if err := writeSSE(w, ev); err != nil || ev.Status != completion.StatusPending {
+			return
+		}
+		for {
+			done, err := h.completions.Wait(ctx, ev.ChallengeID, config.ChallengeEventsKeepalive)
+			if err != nil {
+				h.log.Warn().Err(err).Msg("Failed to wait for challenge completion")
+				return
+			}
+			if done != nil {
+				_ = writeSSE(w, done)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			// Expired challenges never publish an event
+			if _, err := h.challengeManager.Get(ctx, ev.ChallengeID); err != nil {
+				_ = writeSSE(w, expiredEvent(ev))
+				return
+			}
+			if _, err := w.WriteString(": keepalive\n\n"); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return // Client went away
+			}
+		}
+	})
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, ev *completion.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func expiredEvent(pending *completion.Event) *completion.Event {
+	return &completion.Event{
+		ChallengeID: pending.ChallengeID,
+		Status:      completion.StatusExpired,
+		UserID:      pending.UserID,
+		Channel:     pending.Channel,
+		Timestamp:   time.Now().Unix(),
+	}
+}
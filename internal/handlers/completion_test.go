@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	challengekit "github.com/soulteary/challenge-kit"
+)
+
+func TestHandlers_ChallengeEvents(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+	challengeMgr := testChallengeManager(t, redisClient)
+
+	app := fiber.New()
+	app.Post("/verify", handlers.VerifyChallenge)
+	app.Post("/challenges/:id/revoke", handlers.RevokeChallenge)
+	app.Get("/challenges/:id/events", handlers.ChallengeEvents)
+
+	ctx := context.Background()
+	create := func() (string, string) {
+		t.Helper()
+		ch, code, err := challengeMgr.Create(ctx, challengekit.CreateRequest{
+			UserID:      "user123",
+			Channel:     challengekit.ChannelEmail,
+			Destination: "test@example.com",
+			Purpose:     "login",
+			ClientIP:    "127.0.0.1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create challenge: %v", err)
+		}
+		return ch.ID, code
+	}
+	get := func(path, accept string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Long-poll: the verification on another device completes the wait
+	id, code := create()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		bodyBytes, _ := json.Marshal(VerifyChallengeRequest{ChallengeID: id, Code: code, ClientIP: "127.0.0.1"})
+		req := httptest.NewRequest("POST", "/verify", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		_, _ = app.Test(req, -1)
+	}()
+	status, body := get("/challenges/"+id+"/events?wait=10", "")
+	var result map[string]interface{}
+	_ = json.Unmarshal([]byte(body), &result)
+	if status != fiber.StatusOK || result["status"] != "verified" || result["user_id"] != "user123" {
+		t.Fatalf("long-poll: status=%d, body=%s; want verified", status, body)
+	}
+	if amr, _ := json.Marshal(result["amr"]); string(amr) != `["otp","email"]` {
+		t.Errorf("long-poll amr = %s", amr)
+	}
+
+	// Completed challenges answer at once, also as SSE
+	status, body = get("/challenges/"+id+"/events", "text/event-stream")
+	if status != fiber.StatusOK || !strings.HasPrefix(body, "event: status\ndata: {") || !strings.Contains(body, `"status":"verified"`) {
+		t.Errorf("SSE after verification: status=%d, body=%q", status, body)
+	}
+
+	// SSE: pending first, then the revocation
+	id, _ = create()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = app.Test(httptest.NewRequest("POST", "/challenges/"+id+"/revoke", nil), -1)
+	}()
+	status, body = get("/challenges/"+id+"/events", "text/event-stream")
+	pending := strings.Index(body, `"status":"pending"`)
+	revoked := strings.Index(body, `"status":"revoked"`)
+	if status != fiber.StatusOK || pending < 0 || revoked < pending {
+		t.Errorf("SSE stream: status=%d, body=%q; want pending then revoked", status, body)
+	}
+
+	// Revoking unknown or finished challenges publishes nothing
+	_, _ = app.Test(httptest.NewRequest("POST", "/challenges/ch_missing/revoke", nil), -1)
+	if status, body := get("/challenges/ch_missing/events", ""); status != fiber.StatusNotFound || !strings.Contains(body, "challenge_not_found") {
+		t.Errorf("unknown challenge: status=%d, body=%s; want 404", status, body)
+	}
+	if status, _ := get("/challenges/"+id+"/events?wait=soon", ""); status != fiber.StatusBadRequest {
+		t.Errorf("invalid wait: status=%d, want 400", status)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/push"
+	"github.com/soulteary/herald/internal/recovery"
+)
+
+// Factor types of GET /v1/users/{id}/factors
+const (
+	FactorOTP           = "otp"            // A recently verified OTP destination
+	FactorPush          = "push"           // A registered push approval device
+	FactorTOTP          = "totp"           // Authenticator app (herald-totp or native)
+	FactorWebAuthn      = "webauthn"       // A passkey or security key
+	FactorRecoveryCodes = "recovery_codes" // Recovery codes
+)
+
+// GetUserFactors handles GET /v1/users/:id/factors. It lists every factor the user can verify
+// with, each with the AMR values a successful verification returns. Sources that cannot be
+// reached (e.g. herald-totp) are named in "unavailable" instead of failing the request.
+func (h *Handlers) GetUserFactors(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	ctx := requestContext(c)
+	factors := []fiber.Map{}
+	unavailable := []string{}
+
+	destinations, err := h.factorHistory.Recent(ctx, userID)
+	if err != nil {
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to load verified destinations")
+		unavailable = append(unavailable, FactorOTP)
+	}
+	for _, d := range destinations {
+		if _, ok := h.channels.Get(d.Channel); !ok {
+			continue // Channel no longer configured
+		}
+		factors = append(factors, fiber.Map{
+			"type":             FactorOTP,
+			"channel":          d.Channel,
+			"destination":      d.Destination,
+			"last_verified_at": d.LastVerifiedAt,
+			"amr":              h.channels.AMR(d.Channel),
+		})
+	}
+
+	devices, err := h.pushStore.Devices(ctx, userID)
+	if err != nil {
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to load push devices")
+		unavailable = append(unavailable, FactorPush)
+	}
+	for _, d := range devices {
+		factors = append(factors, fiber.Map{
+			"type":       FactorPush,
+			"device_id":  d.ID,
+			"name":       d.Name,
+			"created_at": d.CreatedAt,
+			"amr":        h.channels.AMR(string(push.Channel)),
+		})
+	}
+
+	if h.totpClient != nil {
+		status, err := h.totpClient.Status(ctx, userID)
+		if err != nil {
+			h.log.Warn().Err(err).Str("user_id", userID).Msg("TOTP status proxy failed")
+			unavailable = append(unavailable, FactorTOTP)
+		} else if status.TotpEnabled {
+			factors = append(factors, fiber.Map{
+				"type": FactorTOTP,
+				"amr":  []string{"otp"},
+			})
+		}
+	}
+
+	if h.webauthn != nil {
+		creds, err := h.webauthn.Credentials(ctx, userID)
+		if err != nil {
+			h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to load WebAuthn credentials")
+			unavailable = append(unavailable, FactorWebAuthn)
+		}
+		for _, cred := range creds {
+			factor := fiber.Map{
+				"type":          FactorWebAuthn,
+				"credential_id": cred.ID,
+				"name":          cred.Name,
+				"created_at":    cred.CreatedAt,
+				"amr":           []string{"hwk"},
+			}
+			if cred.LastUsedAt > 0 {
+				factor["last_used_at"] = cred.LastUsedAt
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	status, err := h.recoveryCodes.Status(ctx, userID)
+	switch {
+	case errors.Is(err, recovery.ErrNotFound):
+	case err != nil:
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to read recovery codes")
+		unavailable = append(unavailable, FactorRecoveryCodes)
+	case status.Remaining > 0:
+		factors = append(factors, fiber.Map{
+			"type":      FactorRecoveryCodes,
+			"remaining": status.Remaining,
+			"total":     status.Total,
+			"amr":       []string{"otp"},
+		})
+	}
+
+	response := fiber.Map{
+		"ok":      true,
+		"user_id": userID,
+		"factors": factors,
+	}
+	if len(unavailable) > 0 {
+		response["unavailable"] = unavailable
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	challengekit "github.com/soulteary/challenge-kit"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_GetUserFactors(t *testing.T) {
+	originalMemory := config.RecoveryArgon2Memory
+	defer func() { config.RecoveryArgon2Memory = originalMemory }()
+	config.RecoveryArgon2Memory = 64
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+	challengeMgr := testChallengeManager(t, redisClient)
+
+	app := fiber.New()
+	app.Post("/verify", handlers.VerifyChallenge)
+	app.Post("/recovery/codes", handlers.GenerateRecoveryCodes)
+	app.Get("/users/:id/factors", handlers.GetUserFactors)
+
+	post := func(path string, payload interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil || resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("POST %s failed: %v, %v", path, resp, err)
+		}
+	}
+	factors := func() (string, []map[string]interface{}) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/users/user123/factors", nil), -1)
+		if err != nil || resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("GET factors failed: %v, %v", resp, err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result struct {
+			Factors []map[string]interface{} `json:"factors"`
+		}
+		_ = json.Unmarshal(raw, &result)
+		return string(raw), result.Factors
+	}
+
+	if raw, list := factors(); len(list) != 0 {
+		t.Fatalf("factors of a new user = %s, want none", raw)
+	}
+
+	ch, code, err := challengeMgr.Create(context.Background(), challengekit.CreateRequest{
+		UserID:      "user123",
+		Channel:     challengekit.ChannelEmail,
+		Destination: "alice@example.com",
+		Purpose:     "login",
+		ClientIP:    "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	post("/verify", VerifyChallengeRequest{ChallengeID: ch.ID, Code: code})
+	post("/recovery/codes", RecoveryCodesRequest{UserID: "user123"})
+
+	raw, list := factors()
+	if len(list) != 2 {
+		t.Fatalf("factors = %s, want an OTP destination and recovery codes", raw)
+	}
+	if list[0]["type"] != FactorOTP || list[0]["channel"] != "email" || list[0]["last_verified_at"] == nil {
+		t.Errorf("OTP factor = %v", list[0])
+	}
+	if dest, _ := list[0]["destination"].(string); dest == "alice@example.com" || !strings.HasSuffix(dest, "@example.com") {
+		t.Errorf("destination = %q, want masked", dest)
+	}
+	if amr, _ := json.Marshal(list[0]["amr"]); string(amr) != `["otp","email"]` {
+		t.Errorf("OTP factor amr = %s", amr)
+	}
+	if list[1]["type"] != FactorRecoveryCodes || list[1]["remaining"] != float64(config.RecoveryCodeCount) {
+		t.Errorf("recovery factor = %v", list[1])
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_CreateChallenge_CountryRouting(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+	sms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			To string `json:"to"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sent = append(sent, body.To)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"message_id":"m1"}`))
+	}))
+	defer sms.Close()
+
+	originalRoutes := config.SMSRoutesJSON
+	originalPerCountry := config.RateLimitPerCountry
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	defer func() {
+		config.SMSRoutesJSON = originalRoutes
+		config.RateLimitPerCountry = originalPerCountry
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+	}()
+
+	config.SMSRoutesJSON = `[{"countries":["CN"],"provider":"cn-sms","base_url":"` + sms.URL + `"}]`
+	config.RateLimitPerCountry = []string{"CN=2"}
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(userID, destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      userID,
+			Channel:     "sms",
+			Destination: destination,
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	// Chinese numbers go through the CN route
+	if status, result := send("user1", "+8613800138000"); status != fiber.StatusOK {
+		t.Fatalf("CN destination: status=%d, body=%v; want 200", status, result)
+	}
+	// Other countries do not
+	if status, result := send("user2", "+14155550123"); status != fiber.StatusOK {
+		t.Fatalf("US destination: status=%d, body=%v; want 200", status, result)
+	}
+	mu.Lock()
+	if len(sent) != 1 || sent[0] != "+8613800138000" {
+		t.Errorf("routed sends = %v, want only the CN destination", sent)
+	}
+	mu.Unlock()
+
+	// RATE_LIMIT_PER_COUNTRY caps all CN destinations together
+	if status, result := send("user3", "+8613900139000"); status != fiber.StatusOK {
+		t.Fatalf("second CN destination: status=%d, body=%v; want 200", status, result)
+	}
+	status, result := send("user4", "+8613700137000")
+	if status != fiber.StatusTooManyRequests || result["reason"] != "rate_limit_exceeded" {
+		t.Errorf("third CN destination: status=%d, body=%v; want 429 rate_limit_exceeded", status, result)
+	}
+}
+
+func TestHandlers_RequestCountry(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	if got := handlers.requestCountry("+8613800138000", "8.8.8.8"); got != "CN" {
+		t.Errorf("requestCountry(phone) = %q, want CN", got)
+	}
+	// Without GEOIP_DB_PATH the IP country is unknown
+	if got := handlers.requestCountry("user@example.com", "8.8.8.8"); got != "" {
+		t.Errorf("requestCountry(email) = %q, want unknown", got)
+	}
+}
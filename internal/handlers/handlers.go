@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,24 +21,64 @@ import (
 	"github.com/soulteary/tracing-kit"
 
 	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/captcha"
+	"github.com/soulteary/herald/internal/channels"
+	"github.com/soulteary/herald/internal/completion"
 	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/destination"
+	"github.com/soulteary/herald/internal/emailpolicy"
+	"github.com/soulteary/herald/internal/events"
+	"github.com/soulteary/herald/internal/factors"
+	"github.com/soulteary/herald/internal/geo"
+	"github.com/soulteary/herald/internal/lockout"
+	"github.com/soulteary/herald/internal/mail"
 	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/policy"
+	"github.com/soulteary/herald/internal/push"
+	"github.com/soulteary/herald/internal/quota"
 	"github.com/soulteary/herald/internal/ratelimit"
+	"github.com/soulteary/herald/internal/recovery"
+	"github.com/soulteary/herald/internal/risk"
+	"github.com/soulteary/herald/internal/routing"
 	"github.com/soulteary/herald/internal/template"
+	"github.com/soulteary/herald/internal/totp"
+	"github.com/soulteary/herald/internal/webauthn"
+	"github.com/soulteary/herald/internal/webhook"
 	sessionkit "github.com/soulteary/session-kit"
 )
 
+// ChannelVoice is the voice call channel (provider-kit has no built-in constant for it)
+const ChannelVoice provider.Channel = "voice"
+
 // Handlers contains all HTTP handlers
 type Handlers struct {
 	challengeManager challengekit.ManagerInterface
+	pushChallenges   challengekit.ManagerInterface // Same store as challengeManager, PUSH_NUMBER_LENGTH digit codes
+	pushStore        *push.Store
+	completions      *completion.Notifier // Final challenge states for GET /v1/otp/challenges/{id}/events
+	recoveryCodes    *recovery.Manager
+	factorHistory    *factors.History  // Recently verified OTP destinations (masked)
+	policyEngine     *policy.Engine    // Optional: nil when POLICY_FILE is not set
+	webauthn         *webauthn.Manager // Optional: nil when WEBAUTHN_RP_ID is not set
 	rateLimitManager *ratelimit.Manager
+	quotaManager     *quota.Manager
+	lockoutManager   *lockout.Manager
+	eventNotifier    *events.Notifier    // Optional: nil when HERALD_EVENT_WEBHOOK_URL is not set
+	captchaVerifier  captcha.Verifier    // Optional: nil when CAPTCHA_PROVIDER is not set
+	riskEngine       *risk.Engine        // Optional: nil when RISK_ENABLED is false
+	emailPolicy      *emailpolicy.Policy // Optional: nil when no email policy list is configured
+	ipResolver       geo.IPResolver      // Resolves nothing unless GEOIP_DB_PATH is set
+	smsRouter        *routing.Router     // Optional: nil when HERALD_SMS_ROUTES is not set
+	channels         *channels.Registry  // Built-in channels plus HERALD_CHAT_CHANNELS
+	webhooks         *webhook.Provider   // Optional: nil when HERALD_WEBHOOK_ENDPOINTS is not set
 	providerRegistry *provider.Registry
 	templateManager  *template.Manager
+	templateVars     template.VarsAllowlist // template_vars each template may use (TEMPLATE_VARS_ALLOWLIST)
 	redis            *redis.Client
 	testCodeCache    rediskitcache.Cache   // For test mode code storage
 	idempotencyCache rediskitcache.Cache   // For idempotency key storage
 	sessionManager   *sessionkit.KVManager // Optional: nil if session storage is disabled
-	totpClient       *heraldtotp.Client    // Optional: nil when TOTP is not enabled
+	totpClient       totpBackend           // Optional: nil when TOTP is not enabled
 	log              *logger.Logger
 }
 
@@ -57,13 +99,121 @@ func NewHandlers(redisClient *redis.Client, sessionManager *sessionkit.KVManager
 	}
 	challengeMgr := challengekit.NewManager(redisClient, challengeConfig)
 
+	// Push challenges share the challenge store; their code is the short number the user types on the device
+	pushChallengeConfig := challengeConfig
+	pushChallengeConfig.CodeLength = config.PushNumberLength
+	pushChallengeMgr := challengekit.NewManager(redisClient, pushChallengeConfig)
+
 	rateLimitMgr := ratelimit.NewManager(redisClient)
 
+	// Explicit behaviour per scope when Redis is unavailable
+	failurePolicies := make(map[string]ratelimit.FailurePolicy)
+	for scope, name := range config.GetRateLimitFailurePolicies() {
+		policy, err := ratelimit.ParseFailurePolicy(name)
+		if err != nil {
+			log.Warn().Err(err).Str("scope", scope).Msg("Invalid rate limit failure policy, failing closed")
+			policy = ratelimit.FailClosed
+		}
+		failurePolicies[scope] = policy
+	}
+	rateLimitMgr.SetFailurePolicies(failurePolicies)
+
+	// Global send budgets (per channel/provider/country)
+	quotaRules, err := quota.ParseRules(config.SendQuotasJSON)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse HERALD_SEND_QUOTAS, global send budgets disabled")
+	} else if len(quotaRules) > 0 {
+		log.Info().Int("count", len(quotaRules)).Msg("Global send budgets loaded")
+	}
+	quotaMgr := quota.NewManager(redisClient, quotaRules)
+	quotaMgr.SetFailurePolicy(rateLimitMgr.FailurePolicy(ratelimit.ScopeQuota))
+
+	// Escalating lockouts share challenge-kit's lock key so both agree on whether a user is locked
+	lockoutMgr := lockout.NewManager(redisClient, lockout.Config{
+		BaseDuration:        config.LockoutDuration,
+		MaxDuration:         config.LockoutMaxDuration,
+		EscalationWindow:    config.LockoutEscalationWindow,
+		ChallengeLockPrefix: challengeConfig.LockKeyPrefix,
+	})
+	eventNotifier := events.NewNotifier(config.EventWebhookURL, config.EventWebhookSecret, config.EventWebhookTimeout, log)
+
+	// CAPTCHA / proof-of-work gate for challenge creation
+	captchaVerifier, err := captcha.NewVerifier(captcha.Config{
+		Provider:      config.CaptchaProvider,
+		Secret:        config.CaptchaSecret,
+		VerifyURL:     config.CaptchaVerifyURL,
+		Timeout:       config.CaptchaTimeout,
+		PoWDifficulty: config.CaptchaPoWDifficulty,
+		PoWTTL:        config.CaptchaPoWTTL,
+		StubToken:     config.CaptchaStubToken,
+	}, redisClient)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to create captcha verifier, captcha gate disabled")
+	} else if captchaVerifier != nil {
+		log.Info().Str("provider", captchaVerifier.Provider()).Msg("Captcha gate enabled")
+	}
+
+	// Offline IP country lookups
+	var ipResolver geo.IPResolver = geo.NoopIPResolver{}
+	if config.GeoIPDBPath != "" {
+		if r, err := geo.OpenMMDB(config.GeoIPDBPath); err != nil {
+			log.Warn().Err(err).Msg("Failed to open GEOIP_DB_PATH, IP countries will be unknown")
+		} else {
+			ipResolver = r
+			log.Info().Str("path", config.GeoIPDBPath).Msg("IP country database loaded")
+		}
+	}
+
+	// Risk scoring for challenge creation
+	var riskEngine *risk.Engine
+	if config.RiskEnabled {
+		riskEngine = risk.NewEngine(redisClient, risk.Thresholds{
+			Captcha: config.RiskCaptchaScore,
+			StepUp:  config.RiskStepUpScore,
+			Block:   config.RiskBlockScore,
+		}, risk.DefaultSignals(redisClient, risk.SignalConfig{
+			Weights:           config.GetRiskWeights(),
+			IPVelocityLimit:   config.RiskIPVelocityLimit,
+			IPVelocityWindow:  config.RiskIPVelocityWindow,
+			DestinationMinAge: config.RiskDestinationMinAge,
+			FailureThreshold:  config.RiskFailureThreshold,
+			FailureWindow:     config.RiskFailureWindow,
+			IPs:               ipResolver,
+		})...)
+		log.Info().Msg("Risk scoring enabled")
+	}
+
+	// Disposable / role email policy
+	emailPolicy, err := emailpolicy.New(emailpolicy.Config{
+		DisposableDomainsFile: config.EmailDisposableDomainsFile,
+		RoleAccountsFile:      config.EmailRoleAccountsFile,
+		DisposablePurposes:    config.EmailDisposablePurposes,
+		RolePurposes:          config.EmailRolePurposes,
+		ReloadInterval:        config.EmailPolicyReloadInterval,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load email policy lists, email policy disabled")
+	} else if emailPolicy != nil {
+		log.Info().Msg("Email policy enabled")
+	}
+
 	// Initialize audit logger with Redis client
 	auditlog.Init(redisClient)
 
 	// Initialize template manager
 	templateMgr := template.NewManager(config.TemplateDir)
+	templateMgr.Watch(config.TemplateReloadInterval) // Runs for the lifetime of the process
+	if config.TemplateDir != "" {
+		report := templateMgr.Report()
+		for _, e := range report.Invalid {
+			log.Warn().Str("path", e.Path).Str("error", e.Error).Msg("Invalid template, using built-in text")
+		}
+		log.Info().Int("templates", len(report.Templates)).Int("invalid", len(report.Invalid)).Msg("Templates loaded")
+	}
+	templateVars, err := template.ParseVarsAllowlist(config.TemplateVarsAllowlist)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse TEMPLATE_VARS_ALLOWLIST, template vars disabled")
+	}
 
 	// Initialize provider registry (using provider-kit)
 	registry := provider.NewRegistry()
@@ -87,15 +237,15 @@ func NewHandlers(redisClient *redis.Client, sessionManager *sessionkit.KVManager
 		}
 	} else if config.SMTPHost != "" {
 		// Built-in SMTP provider when herald-smtp URL is not set
-		smtpConfig := &provider.SMTPConfig{
-			Host:        config.SMTPHost,
-			Port:        config.SMTPPort,
-			Username:    config.SMTPUser,
-			Password:    config.SMTPPassword,
-			From:        config.SMTPFrom,
-			UseStartTLS: true,
-		}
-		smtpProvider, err := provider.NewSMTPProvider(smtpConfig)
+		smtpProvider, err := mail.New(mail.Config{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUser,
+			Password: config.SMTPPassword,
+			From:     config.SMTPFrom,
+			TLS:      config.SMTPTLS,
+			Timeout:  config.SMTPTimeout,
+		})
 		if err != nil {
 			log.Warn().Err(err).Msg("Failed to create SMTP provider")
 		} else if err := registry.Register(smtpProvider); err != nil {
@@ -124,6 +274,57 @@ func NewHandlers(redisClient *redis.Client, sessionManager *sessionkit.KVManager
 		}
 	}
 
+	// Register HTTP voice provider if configured (the gateway reads the body out via text-to-speech)
+	if config.VoiceProvider != "" {
+		httpConfig := &provider.HTTPConfig{
+			BaseURL:      config.VoiceAPIBaseURL,
+			SendEndpoint: "/v1/send",
+			APIKey:       config.VoiceAPIKey,
+			ChannelType:  ChannelVoice,
+			ProviderName: config.VoiceProvider,
+		}
+		httpProvider, err := provider.NewHTTPProvider(httpConfig)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to create HTTP voice provider")
+		} else if err := registry.Register(httpProvider); err != nil {
+			log.Warn().Err(err).Msg("Failed to register HTTP voice provider")
+		} else {
+			log.Info().Str("provider", config.VoiceProvider).Msg("HTTP voice provider registered")
+		}
+	}
+
+	// Register HTTP push provider if configured (notifies the device of a push approval challenge)
+	if config.PushProvider != "" {
+		httpConfig := &provider.HTTPConfig{
+			BaseURL:      config.PushAPIBaseURL,
+			SendEndpoint: "/v1/send",
+			APIKey:       config.PushAPIKey,
+			APIKeyHeader: "X-API-Key",
+			ChannelType:  push.Channel,
+			ProviderName: config.PushProvider,
+		}
+		httpProvider, err := provider.NewHTTPProvider(httpConfig)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to create HTTP push provider")
+		} else if err := registry.Register(httpProvider); err != nil {
+			log.Warn().Err(err).Msg("Failed to register HTTP push provider")
+		} else {
+			log.Info().Str("provider", config.PushProvider).Msg("HTTP push provider registered")
+		}
+	}
+
+	// SMS providers per destination country; other countries use the default SMS provider
+	var smsRouter *routing.Router
+	if smsRoutes, err := routing.ParseRoutes(config.SMSRoutesJSON); err != nil {
+		log.Warn().Err(err).Msg("Failed to parse HERALD_SMS_ROUTES, country routing disabled")
+	} else if len(smsRoutes) > 0 {
+		if smsRouter, err = routing.NewRouter(smsRoutes); err != nil {
+			log.Warn().Err(err).Msg("Failed to create SMS routes, country routing disabled")
+		} else {
+			log.Info().Int("count", len(smsRoutes)).Msg("SMS country routes loaded")
+		}
+	}
+
 	// Register DingTalk channel via herald-dingtalk HTTP service (no DingTalk credentials in Herald)
 	if config.HeraldDingtalkAPIURL != "" {
 		httpConfig := &provider.HTTPConfig{
@@ -143,35 +344,152 @@ func NewHandlers(redisClient *redis.Client, sessionManager *sessionkit.KVManager
 		}
 	}
 
+	// Register chat-app channels; each is served by its own HTTP sidecar (no chat-app credentials in Herald)
+	chats, err := channels.ParseChats(config.ChatChannelsJSON)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to parse HERALD_CHAT_CHANNELS, chat channels disabled")
+	}
+	for _, chat := range chats {
+		httpConfig := &provider.HTTPConfig{
+			BaseURL:      chat.BaseURL,
+			SendEndpoint: "/v1/send",
+			APIKey:       chat.APIKey,
+			APIKeyHeader: "X-API-Key",
+			Timeout:      chat.Timeout,
+			ChannelType:  provider.Channel(chat.Name),
+			ProviderName: chat.Name,
+		}
+		httpProvider, err := provider.NewHTTPProvider(httpConfig)
+		if err != nil {
+			log.Warn().Err(err).Str("channel", chat.Name).Msg("Failed to create chat HTTP provider")
+		} else if err := registry.Register(httpProvider); err != nil {
+			log.Warn().Err(err).Str("channel", chat.Name).Msg("Failed to register chat HTTP provider")
+		} else {
+			log.Info().Str("channel", chat.Name).Msg("Chat HTTP provider registered")
+		}
+	}
+	channelRegistry := channels.NewRegistry(chats)
+
+	// Register webhook channel: signed JSON to endpoints registered in config, retried with backoff
+	var webhooks *webhook.Provider
+	if endpoints, err := webhook.ParseEndpoints(config.WebhookEndpointsJSON); err != nil {
+		log.Warn().Err(err).Msg("Failed to parse HERALD_WEBHOOK_ENDPOINTS, webhook channel disabled")
+	} else if len(endpoints) > 0 {
+		webhooks = webhook.New(endpoints, config.WebhookTimeout)
+		if err := registry.Register(webhooks.WithRetry(config.WebhookMaxRetries, config.WebhookRetryDelay)); err != nil {
+			log.Warn().Err(err).Msg("Failed to register webhook provider")
+			webhooks = nil
+		} else {
+			log.Info().Int("endpoints", len(endpoints)).Msg("Webhook provider registered")
+		}
+	}
+
 	// Create test code cache for test mode
 	testCodeCache := rediskitcache.NewCache(redisClient, "otp:test:code:")
 
 	// Create idempotency cache
 	idempotencyCache := rediskitcache.NewCache(redisClient, "otp:idem:")
 
-	// TOTP client: when Herald proxies TOTP to herald-totp
-	var totpClient *heraldtotp.Client
-	if config.TOTPEnabled && config.TOTPBaseURL != "" {
+	// TOTP backend: the embedded engine (HERALD_TOTP_MODE=native) or the herald-totp proxy
+	var totpClient totpBackend
+	switch {
+	case !config.TOTPEnabled:
+	case config.TOTPMode == "native":
+		key, err := totp.ParseKey(config.TOTPEncryptionKey)
+		if err != nil {
+			log.Warn().Err(err).Msg("Invalid HERALD_TOTP_ENCRYPTION_KEY, native TOTP will be disabled")
+			break
+		}
+		engine, err := totp.New(redisClient, totp.Config{
+			Issuer:    config.TOTPIssuer,
+			Key:       key,
+			Digits:    config.TOTPDigits,
+			Period:    config.TOTPPeriod,
+			Skew:      config.TOTPSkew,
+			EnrollTTL: config.TOTPEnrollTTL,
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to create native TOTP engine, TOTP will be disabled")
+			break
+		}
+		totpClient = engine
+		log.Info().Msg("TOTP enabled (native)")
+	case config.TOTPBaseURL != "":
 		opts := heraldtotp.DefaultOptions().
 			WithBaseURL(strings.TrimSuffix(config.TOTPBaseURL, "/")).
 			WithAPIKey(config.TOTPAPIKey).
-			WithTimeout(10 * time.Second)
+			WithTimeout(config.TOTPTimeout)
 		if config.TOTPHMACSecret != "" {
 			opts = opts.WithHMACSecret(config.TOTPHMACSecret)
 		}
 		if c, err := heraldtotp.NewClient(opts); err != nil {
 			log.Warn().Err(err).Msg("Failed to create herald-totp client, TOTP proxy will be disabled")
 		} else {
-			totpClient = c
+			totpClient = totp.NewProxy(c, totp.ProxyConfig{
+				MaxRetries:       config.TOTPMaxRetries,
+				RetryDelay:       config.TOTPRetryDelay,
+				BreakerThreshold: config.TOTPBreakerThreshold,
+				BreakerCooldown:  config.TOTPBreakerCooldown,
+			})
 			log.Info().Msg("TOTP proxy enabled (herald-totp)")
 		}
 	}
 
+	// Step-up policies
+	var policyEngine *policy.Engine
+	if config.PolicyFile != "" {
+		if e, err := policy.Load(config.PolicyFile); err != nil {
+			log.Warn().Err(err).Str("path", config.PolicyFile).Msg("Failed to load step-up policies, policy evaluation disabled")
+		} else {
+			policyEngine = e
+			log.Info().Int("count", len(e.Policies())).Msg("Step-up policies loaded")
+		}
+	}
+
+	// WebAuthn (passkeys / security keys)
+	var webauthnMgr *webauthn.Manager
+	if config.WebAuthnRPID != "" {
+		origins := config.WebAuthnOrigins
+		if len(origins) == 0 {
+			origins = []string{"https://" + config.WebAuthnRPID}
+		}
+		webauthnMgr = webauthn.NewManager(redisClient, webauthn.Config{
+			RPID:             config.WebAuthnRPID,
+			RPName:           config.WebAuthnRPName,
+			Origins:          origins,
+			Timeout:          config.WebAuthnTimeout,
+			UserVerification: config.WebAuthnUserVerification,
+		})
+		log.Info().Str("rp_id", config.WebAuthnRPID).Strs("origins", origins).Msg("WebAuthn enabled")
+	}
+
 	return &Handlers{
 		challengeManager: challengeMgr,
+		pushChallenges:   pushChallengeMgr,
+		pushStore:        push.NewStore(redisClient),
+		completions:      completion.New(redisClient, config.ChallengeEventsTTL),
+		recoveryCodes: recovery.NewManager(redisClient, recovery.Config{
+			Count:        config.RecoveryCodeCount,
+			Argon2Time:   uint32(config.RecoveryArgon2Time),
+			Argon2Memory: uint32(config.RecoveryArgon2Memory),
+		}),
+		factorHistory:    factors.NewHistory(redisClient, config.FactorsHistoryMax, config.FactorsHistoryTTL),
+		policyEngine:     policyEngine,
+		webauthn:         webauthnMgr,
 		rateLimitManager: rateLimitMgr,
+		quotaManager:     quotaMgr,
+		lockoutManager:   lockoutMgr,
+		eventNotifier:    eventNotifier,
+		captchaVerifier:  captchaVerifier,
+		riskEngine:       riskEngine,
+		emailPolicy:      emailPolicy,
+		ipResolver:       ipResolver,
+		smsRouter:        smsRouter,
+		channels:         channelRegistry,
+		webhooks:         webhooks,
 		providerRegistry: registry,
 		templateManager:  templateMgr,
+		templateVars:     templateVars,
 		redis:            redisClient,
 		testCodeCache:    testCodeCache,
 		idempotencyCache: idempotencyCache,
@@ -184,12 +502,17 @@ func NewHandlers(redisClient *redis.Client, sessionManager *sessionkit.KVManager
 // CreateChallengeRequest represents the request to create a challenge
 type CreateChallengeRequest struct {
 	UserID      string `json:"user_id"`
-	Channel     string `json:"channel"` // "sms" | "email"
+	Channel     string `json:"channel"` // "sms" | "email" | "dingtalk" | "voice" | a HERALD_CHAT_CHANNELS name
 	Destination string `json:"destination"`
 	Purpose     string `json:"purpose"`
 	Locale      string `json:"locale"`
 	ClientIP    string `json:"client_ip"`
 	UA          string `json:"ua"`
+	// DisplayName and TemplateVars are shown in message templates only
+	DisplayName  string            `json:"display_name"`
+	TemplateVars map[string]string `json:"template_vars"`
+	// CaptchaToken is required when the purpose or the client's request volume calls for a captcha
+	CaptchaToken string `json:"captcha_token"`
 }
 
 // IdempotencyRecord represents a cached idempotency response
@@ -197,6 +520,7 @@ type IdempotencyRecord struct {
 	ChallengeID  string `json:"challenge_id"`
 	ExpiresIn    int    `json:"expires_in"`
 	NextResendIn int    `json:"next_resend_in"`
+	NumberMatch  string `json:"number_match,omitempty"` // Push challenges only
 	CreatedAt    int64  `json:"created_at"`
 }
 
@@ -219,11 +543,15 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		var cachedRecord IdempotencyRecord
 		if err := h.idempotencyCache.Get(spanCtx, idempotencyKey, &cachedRecord); err == nil {
 			// Return cached response
-			return c.JSON(fiber.Map{
+			response := fiber.Map{
 				"challenge_id":   cachedRecord.ChallengeID,
 				"expires_in":     cachedRecord.ExpiresIn,
 				"next_resend_in": cachedRecord.NextResendIn,
-			})
+			}
+			if cachedRecord.NumberMatch != "" {
+				response["number_match"] = cachedRecord.NumberMatch
+			}
+			return c.JSON(response)
 		}
 	}
 
@@ -253,7 +581,8 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Channel != "sms" && req.Channel != "email" && req.Channel != "dingtalk" {
+	channelDef, ok := h.channels.Get(req.Channel)
+	if !ok {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":     false,
 			"reason": "invalid_channel",
@@ -267,6 +596,50 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		})
 	}
 
+	// Canonicalize the destination before it is rate limited, stored or audited
+	normalized, err := destination.Normalize(req.Channel, req.Destination, destination.Options{
+		DefaultRegion:     config.DestinationDefaultRegion,
+		StrictEmailDomain: config.DestinationStrictEmail,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_destination",
+			"error":  err.Error(),
+		})
+	}
+	req.Destination = normalized
+
+	// Webhook destinations must name a registered endpoint
+	if req.Channel == string(webhook.Channel) && !h.webhooks.Has(req.Destination) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_destination",
+			"error":  "unknown webhook endpoint",
+		})
+	}
+
+	// Push destinations must name a device registered for the user
+	if req.Channel == string(push.Channel) {
+		if !push.ValidDeviceID(req.Destination) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "invalid_destination",
+				"error":  "invalid push device id",
+			})
+		}
+		if _, err := h.pushStore.Device(spanCtx, req.UserID, req.Destination); err != nil {
+			if !errors.Is(err, push.ErrNotFound) {
+				h.log.Error().Err(err).Msg("Failed to load push device")
+			}
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "invalid_destination",
+				"error":  "unknown push device",
+			})
+		}
+	}
+
 	// Validate purpose
 	if req.Purpose == "" {
 		req.Purpose = "login" // Default purpose
@@ -286,13 +659,72 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		})
 	}
 
+	if len(req.DisplayName) > template.MaxVarValueLen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_template_vars",
+			"error":  fmt.Sprintf("display_name exceeds %d bytes", template.MaxVarValueLen),
+		})
+	}
+	if err := template.ValidateVars(req.TemplateVars); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_template_vars",
+			"error":  err.Error(),
+		})
+	}
+
+	// Disposable domains and role addresses may be rejected per purpose
+	if req.Channel == "email" {
+		if list := h.emailPolicy.Check(req.Destination, req.Purpose); list != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "destination_not_allowed",
+				"error":  fmt.Sprintf("%s email addresses are not allowed for purpose %s", list, req.Purpose),
+			})
+		}
+	}
+
 	// Get client IP
 	clientIP := req.ClientIP
 	if clientIP == "" {
 		clientIP = c.IP()
 	}
 
-	// Check rate limits
+	// Destination country (phone prefix), or the client IP's country for other destinations
+	country := h.requestCountry(req.Destination, clientIP)
+	span.SetAttributes(attribute.String("country", country))
+
+	// Risk scoring: block, require a stronger channel, or force the captcha gate
+	riskInput := risk.Input{
+		UserID:      req.UserID,
+		Channel:     req.Channel,
+		Destination: limitedDestination(req.Channel, req.UserID, req.Destination),
+		Purpose:     req.Purpose,
+		ClientIP:    clientIP,
+		UA:          req.UA,
+	}
+	decision := h.evaluateRisk(spanCtx, riskInput)
+	span.SetAttributes(attribute.Int("risk_score", decision.Score), attribute.String("risk_action", string(decision.Action)))
+	if rejection := riskRejection(decision, req.Channel); rejection != nil {
+		auditlog.LogRiskDenied(spanCtx, req.UserID, req.Channel, req.Destination, req.Purpose, clientIP, decision.Score, string(decision.Action), decision.Reasons)
+		metrics.RecordChallengeCreated(req.Channel, req.Purpose, "risk_denied")
+		return c.Status(fiber.StatusForbidden).JSON(rejection)
+	}
+
+	// CAPTCHA gate (before rate limits so bots do not consume the caller's budgets)
+	riskCaptcha := decision.Action == risk.ActionCaptcha && h.captchaVerifier != nil
+	if riskCaptcha || h.captchaRequired(spanCtx, req.Purpose, clientIP) {
+		if status, reason := h.verifyCaptcha(spanCtx, req.CaptchaToken, clientIP); reason != "" {
+			return c.Status(status).JSON(fiber.Map{
+				"ok":               false,
+				"reason":           reason,
+				"captcha_provider": h.captchaVerifier.Provider(),
+			})
+		}
+	}
+
+	// Check rate limits (on Redis errors the scope's failure policy has already decided `allowed`)
 	// 1. Per user
 	allowed, _, _, err := h.rateLimitManager.CheckUserRateLimit(
 		spanCtx, req.UserID, config.RateLimitPerUser, time.Hour,
@@ -325,7 +757,7 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 
 	// 3. Per destination
 	allowed, _, _, err = h.rateLimitManager.CheckDestinationRateLimit(
-		spanCtx, req.Destination, config.RateLimitPerDestination, time.Hour,
+		spanCtx, limitedDestination(req.Channel, req.UserID, req.Destination), config.RateLimitPerDestination, time.Hour,
 	)
 	if err != nil {
 		h.log.Error().Err(err).Msg("Rate limit check failed")
@@ -338,25 +770,92 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		})
 	}
 
-	// 4. Resend cooldown
-	cooldownKey := fmt.Sprintf("%s:%s", req.UserID, req.Destination)
-	allowed, _, err = h.rateLimitManager.CheckResendCooldown(spanCtx, cooldownKey, config.ResendCooldown)
+	// 4. Per country (aggregate over all destinations in the country)
+	if limit, ok := config.GetCountryRateLimits()[country]; ok {
+		allowed, _, _, err = h.rateLimitManager.CheckCountryRateLimit(spanCtx, country, limit, time.Hour)
+		if err != nil {
+			h.log.Error().Err(err).Msg("Rate limit check failed")
+		}
+		if !allowed {
+			metrics.RecordRateLimitHit("country")
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "rate_limit_exceeded",
+			})
+		}
+	}
+
+	// 5. Resend cooldown (progressive: grows with each resend to the same user+destination)
+	allowed, nextResendIn, err := h.rateLimitManager.CheckProgressiveCooldown(
+		spanCtx, resendCooldownKey(req.UserID, req.Destination), config.GetResendCooldownSteps(), config.ResendCooldownResetAfter,
+	)
 	if err != nil {
 		h.log.Error().Err(err).Msg("Cooldown check failed")
 	}
 	if !allowed {
 		metrics.RecordRateLimitHit("resend_cooldown")
 		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-			"ok":     false,
-			"reason": "resend_cooldown",
+			"ok":             false,
+			"reason":         "resend_cooldown",
+			"next_resend_in": int(nextResendIn.Round(time.Second).Seconds()),
 		})
 	}
 
 	// Check if user is locked
 	if h.challengeManager.IsUserLocked(spanCtx, req.UserID) {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		response := fiber.Map{
 			"ok":     false,
 			"reason": "user_locked",
+		}
+		if lock, err := h.lockoutManager.Get(spanCtx, req.UserID); err == nil && lock != nil {
+			response["locked_until"] = lock.ExpiresAt.Unix()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(response)
+	}
+
+	// Determine provider name for audit and send budgets
+	var (
+		providerName   string
+		routedProvider provider.Provider // SMS provider chosen by country (HERALD_SMS_ROUTES)
+	)
+	switch req.Channel {
+	case "email":
+		providerName = "smtp"
+	case "sms":
+		providerName = config.SMSProvider
+		if p, ok := h.smsRouter.Provider(country); ok {
+			routedProvider = p
+			providerName = p.Name()
+		}
+	case "dingtalk":
+		providerName = "dingtalk"
+	case "voice":
+		providerName = config.VoiceProvider
+	case "push":
+		providerName = config.PushProvider
+	default:
+		providerName = req.Channel
+	}
+
+	// Check global send budgets before anything is created or sent
+	quotaDecision, err := h.quotaManager.Check(spanCtx, quota.Target{
+		Channel:     req.Channel,
+		Provider:    providerName,
+		Destination: req.Destination,
+		Country:     country,
+	})
+	if err != nil {
+		h.log.Error().Err(err).Msg("Send budget check failed")
+	}
+	if len(quotaDecision.Warnings) > 0 {
+		h.log.Warn().Strs("rules", quotaDecision.Warnings).Str("channel", req.Channel).Msg("Send budget warning threshold reached")
+	}
+	if !quotaDecision.Allowed {
+		metrics.RecordRateLimitHit("quota")
+		h.log.Warn().Str("rule", quotaDecision.Rule).Str("channel", req.Channel).Msg("Send budget exceeded")
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "quota_exceeded",
 		})
 	}
 
@@ -368,10 +867,15 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		Purpose:     req.Purpose,
 		ClientIP:    clientIP,
 	}
-	ch, code, err := h.challengeManager.Create(spanCtx, createReq)
+	challengeMgr := h.challengeManager
+	if req.Channel == string(push.Channel) {
+		challengeMgr = h.pushChallenges
+	}
+	ch, code, err := challengeMgr.Create(spanCtx, createReq)
 	if err != nil {
 		tracing.RecordError(span, err)
 		h.log.Error().Err(err).Msg("Failed to create challenge")
+		h.refundQuota(spanCtx, quotaDecision)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"ok":     false,
 			"reason": "internal_error",
@@ -381,11 +885,41 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 	// Update span with challenge ID
 	span.SetAttributes(attribute.String("challenge_id", ch.ID))
 
+	// Push: track the approval outcome; it stays readable for PUSH_RESULT_TTL after expiry
+	if req.Channel == string(push.Channel) {
+		state := &push.State{
+			ChallengeID: ch.ID,
+			UserID:      req.UserID,
+			DeviceID:    req.Destination,
+			Purpose:     req.Purpose,
+			Status:      push.StatusPending,
+			ExpiresAt:   ch.ExpiresAt.Unix(),
+		}
+		if err := h.pushStore.SaveState(spanCtx, state, config.ChallengeExpiry+config.PushResultTTL); err != nil {
+			tracing.RecordError(span, err)
+			h.log.Error().Err(err).Msg("Failed to store push state")
+			_ = challengeMgr.Revoke(spanCtx, ch.ID)
+			h.refundQuota(spanCtx, quotaDecision)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "internal_error",
+			})
+		}
+	}
+
 	// Update span with result
 	span.SetAttributes(attribute.String("result", "success"))
 
 	// Audit: challenge created
-	auditlog.LogChallengeCreated(spanCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, clientIP)
+	auditlog.LogChallengeCreated(spanCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, clientIP,
+		append(auditlog.RiskOptions(decision.Score, string(decision.Action), decision.Reasons), auditlog.CountryOption(country))...)
+
+	// Remember the request so a successful verification marks its device and destination as known
+	if h.riskEngine != nil {
+		if err := h.riskEngine.Remember(spanCtx, ch.ID, riskInput, config.ChallengeExpiry); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to store risk input")
+		}
+	}
 
 	// Metrics: challenge created
 	metrics.RecordChallengeCreated(req.Channel, req.Purpose, "success")
@@ -402,46 +936,49 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 
 	// Use template manager to format message
 	templateData := template.TemplateData{
-		Code:      code,
-		ExpiresIn: int(config.ChallengeExpiry.Seconds()),
-		Purpose:   req.Purpose,
-		Locale:    req.Locale,
+		Code:            code,
+		ExpiresIn:       int(config.ChallengeExpiry.Seconds()),
+		Purpose:         req.Purpose,
+		Locale:          req.Locale,
+		AppName:         config.TemplateAppName,
+		SupportURL:      config.TemplateSupportURL,
+		UserDisplayName: req.DisplayName,
+		Destination:     maskDestination(req.Destination),
+		ClientIP:        clientIP,
+		Location:        h.ipResolver.CountryForIP(clientIP),
+		Device:          h.templateManager.Device(req.Locale, req.UA),
+		RequestedAt:     time.Now().UTC(),
+		Vars:            h.templateVars.Filter(req.Channel, req.Purpose, req.TemplateVars),
 	}
 
 	// Build message using provider-kit fluent API
 	msg := provider.NewMessage(req.Destination).
-		WithCode(code).
 		WithLocale(req.Locale).
 		WithIdempotencyKey(ch.ID) // Use challenge ID as idempotency key
-
-	if channel == provider.ChannelEmail {
-		subject, body, err := h.templateManager.RenderEmail(req.Locale, req.Purpose, templateData)
-		if err != nil {
-			// Fallback to built-in formatting from provider-kit
-			subject, body = provider.FormatVerificationEmail(code, req.Locale)
-		}
-		msg.WithSubject(subject).WithBody(body)
-	} else {
-		// SMS and DingTalk: body only (DingTalk via herald-dingtalk receives body)
-		body, err := h.templateManager.RenderSMS(req.Locale, req.Purpose, templateData)
-		if err != nil {
-			// Fallback to built-in formatting from provider-kit
-			body = provider.FormatVerificationSMS(code, req.Locale)
-		}
-		msg.WithBody(body)
+	if channel != push.Channel {
+		// Push never carries the number: the user reads it from the verifier's screen
+		msg.WithCode(code)
+	}
+	if channel == webhook.Channel {
+		msg.WithParam(webhook.ParamUserID, req.UserID).
+			WithParam(webhook.ParamPurpose, req.Purpose).
+			WithParam(webhook.ParamExpiresIn, strconv.Itoa(templateData.ExpiresIn))
 	}
 
-	// Determine provider name for audit
-	var providerName string
-	switch req.Channel {
-	case "email":
-		providerName = "smtp"
-	case "sms":
-		providerName = config.SMSProvider
-	case "dingtalk":
-		providerName = "dingtalk"
-	default:
-		providerName = req.Channel
+	rendered := h.renderMessage(req.Channel, channelDef.Chat != nil, req.Locale, req.Purpose, templateData)
+	msg.WithBody(rendered.Body)
+	if rendered.Subject != "" {
+		msg.WithSubject(rendered.Subject)
+	}
+	if rendered.HTML != "" {
+		// HTML part: sent as multipart/alternative by the built-in SMTP provider, passed in params to herald-smtp
+		msg.WithParam(mail.ParamHTML, rendered.HTML)
+	}
+	if channel == push.Channel {
+		msg.WithParam("challenge_id", ch.ID).
+			WithParam("purpose", req.Purpose).
+			WithParam("client_ip", clientIP).
+			WithParam("expires_at", strconv.FormatInt(ch.ExpiresAt.Unix(), 10))
 	}
 
 	// Record send duration
@@ -454,8 +991,13 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		attribute.String("provider", providerName),
 	)
 
-	// Send using provider-kit Registry (returns *SendResult, error)
-	sendResult, err := h.providerRegistry.Send(providerCtx, channel, msg)
+	// Send using the country route or the provider-kit Registry (returns *SendResult, error)
+	var sendResult *provider.SendResult
+	if routedProvider != nil {
+		sendResult, err = routedProvider.Send(providerCtx, msg)
+	} else {
+		sendResult, err = h.providerRegistry.Send(providerCtx, channel, msg)
+	}
 	sendDuration := time.Since(sendStart)
 
 	if err != nil || (sendResult != nil && !sendResult.OK) {
@@ -470,10 +1012,13 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		}
 
 		// Metrics: send failed
-		metrics.RecordOTPSend(req.Channel, providerName, "failure", sendDuration)
+		metrics.RecordOTPSend(req.Channel, providerName, country, "failure", sendDuration)
+
+		// Nothing was sent: give the send budget back
+		h.refundQuota(spanCtx, quotaDecision)
 
 		// Audit: send failed
-		auditlog.LogSendFailed(providerCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, providerName, errorReason, clientIP)
+		auditlog.LogSendFailed(providerCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, providerName, errorReason, clientIP, auditlog.CountryOption(country))
 
 		// Handle provider failure based on policy
 		if config.ProviderFailurePolicy == "strict" {
@@ -499,32 +1044,38 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 		providerSpan.End()
 
 		// Metrics: send success
-		metrics.RecordOTPSend(req.Channel, providerName, "success", sendDuration)
+		metrics.RecordOTPSend(req.Channel, providerName, country, "success", sendDuration)
 
 		// Audit: send success (now includes messageID from provider-kit)
 		messageID := ""
 		if sendResult != nil {
 			messageID = sendResult.MessageID
 		}
-		auditlog.LogSendSuccess(providerCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, providerName, messageID, clientIP)
+		auditlog.LogSendSuccess(providerCtx, ch.ID, req.UserID, req.Channel, req.Destination, req.Purpose, providerName, messageID, clientIP, auditlog.CountryOption(country))
 	}
 
 	// Prepare response
 	response := fiber.Map{
 		"challenge_id":   ch.ID,
 		"expires_in":     int(config.ChallengeExpiry.Seconds()),
-		"next_resend_in": int(config.ResendCooldown.Seconds()),
+		"next_resend_in": int(nextResendIn.Seconds()),
 	}
 	if config.TestMode {
 		response["debug_code"] = code
 	}
+	numberMatch := ""
+	if req.Channel == string(push.Channel) {
+		numberMatch = code
+		response["number_match"] = numberMatch
+	}
 
 	// Store idempotency record if idempotency key is provided
 	if idempotencyKey != "" {
 		idempotencyRecord := IdempotencyRecord{
 			ChallengeID:  ch.ID,
 			ExpiresIn:    int(config.ChallengeExpiry.Seconds()),
-			NextResendIn: int(config.ResendCooldown.Seconds()),
+			NextResendIn: int(nextResendIn.Seconds()),
+			NumberMatch:  numberMatch,
 			CreatedAt:    time.Now().Unix(),
 		}
 		if err := h.idempotencyCache.Set(spanCtx, idempotencyKey, idempotencyRecord, config.IdempotencyKeyTTL); err != nil {
@@ -536,6 +1087,20 @@ func (h *Handlers) CreateChallenge(c *fiber.Ctx) error {
 	return c.JSON(response)
 }
 
+// requestCountry returns the country of a phone destination by its calling code, otherwise
+// the client IP's country; "" when neither is known
+func (h *Handlers) requestCountry(destination, clientIP string) string {
+	if country := geo.CountryForPhone(destination); country != "" {
+		return country
+	}
+	return h.ipResolver.CountryForIP(clientIP)
+}
+
+// resendCooldownKey returns the key used for the progressive resend cooldown of a user+destination
+func resendCooldownKey(userID, destination string) string {
+	return fmt.Sprintf("%s:%s", userID, destination)
+}
+
 // maskDestination masks sensitive destination information for tracing
 func maskDestination(dest string) string {
 	if len(dest) == 0 {
@@ -554,6 +1119,7 @@ type VerifyChallengeRequest struct {
 	ChallengeID string `json:"challenge_id"`
 	Code        string `json:"code"`
 	ClientIP    string `json:"client_ip"`
+	SessionID   string `json:"session_id"` // Optional: record the verification in session storage
 }
 
 // VerifyChallenge handles challenge verification
@@ -582,6 +1148,14 @@ func (h *Handlers) VerifyChallenge(c *fiber.Ctx) error {
 		})
 	}
 
+	// Push challenges are decided by the device (approve/deny), never by code
+	if ch, err := h.challengeManager.Get(ctx, req.ChallengeID); err == nil && string(ch.Channel) == string(push.Channel) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "push_approval_required",
+		})
+	}
+
 	// Validate code format
 	if !challengekit.ValidateCodeFormat(req.Code, config.CodeLength) {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -635,6 +1209,30 @@ func (h *Handlers) VerifyChallenge(c *fiber.Ctx) error {
 		// Audit: verification failed
 		auditlog.LogVerificationFailed(verifyCtx, req.ChallengeID, reason, req.ClientIP)
 
+		if reason == "locked" || h.riskEngine != nil {
+			if ch, err := h.challengeManager.Get(verifyCtx, req.ChallengeID); err == nil {
+				// Too many attempts: escalate the lockout for the challenge's user
+				if reason == "locked" {
+					h.lockUser(verifyCtx, ch.UserID, lockout.ReasonMaxAttempts, req.ClientIP)
+					// The challenge is used up: revoke it so retrying it after an unlock cannot lock the user again
+					if err := h.challengeManager.Revoke(verifyCtx, ch.ID); err != nil {
+						h.log.Warn().Err(err).Msg("Failed to revoke locked challenge")
+					}
+					h.publishCompletion(verifyCtx, completion.Event{
+						ChallengeID: ch.ID,
+						Status:      completion.StatusLocked,
+						UserID:      ch.UserID,
+						Channel:     string(ch.Channel),
+					})
+				}
+				if h.riskEngine != nil {
+					if err := h.riskEngine.RecordFailure(verifyCtx, ch.UserID); err != nil {
+						h.log.Warn().Err(err).Msg("Failed to record risk failure")
+					}
+				}
+			}
+		}
+
 		response := fiber.Map{
 			"ok":     false,
 			"reason": reason,
@@ -658,19 +1256,41 @@ func (h *Handlers) VerifyChallenge(c *fiber.Ctx) error {
 	// Metrics: verification success
 	metrics.RecordVerification("success", "")
 
+	// Successful verification resets the progressive resend cooldown for this user+destination
+	if err := h.rateLimitManager.ResetProgressiveCooldown(verifyCtx, resendCooldownKey(ch.UserID, ch.Destination)); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to reset resend cooldown")
+	}
+
+	if h.riskEngine != nil {
+		if err := h.riskEngine.Confirm(verifyCtx, ch.ID); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to learn from verified challenge")
+		}
+	}
+
+	// Remember the destination for the factor listing
+	if err := h.factorHistory.Record(verifyCtx, ch.UserID, string(ch.Channel), ch.Destination, maskDestination(ch.Destination)); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to record verified destination")
+	}
+
+	// A verified step-up challenge can authorize a TOTP revoke or re-enrollment
+	h.recordStepUp(verifyCtx, ch)
+
 	// Audit: challenge verified
 	auditlog.LogVerificationSuccess(verifyCtx, ch.ID, ch.UserID, string(ch.Channel), ch.Destination, ch.Purpose, req.ClientIP)
 
-	// Generate AMR based on channel (use string to avoid depending on challengekit.ChannelDingTalk in v1.0.0)
-	amr := []string{"otp"}
-	switch string(ch.Channel) {
-	case "sms":
-		amr = append(amr, "sms")
-	case "email":
-		amr = append(amr, "email")
-	case "dingtalk":
-		amr = append(amr, "dingtalk")
-	}
+	// AMR: "otp" plus the channel's method (e.g. "sms", "tel" for voice)
+	amr := h.channels.AMR(string(ch.Channel))
+
+	// Wake up pages waiting on GET /v1/otp/challenges/{id}/events
+	h.publishCompletion(verifyCtx, completion.Event{
+		ChallengeID: ch.ID,
+		Status:      completion.StatusVerified,
+		UserID:      ch.UserID,
+		Channel:     string(ch.Channel),
+		AMR:         amr,
+	})
+
+	h.recordSessionVerification(verifyCtx, req.SessionID, ch.UserID, amr)
 
 	// Success
 	return c.JSON(fiber.Map{
@@ -690,7 +1310,9 @@ func (h *Handlers) RevokeChallenge(c *fiber.Ctx) error {
 	}
 	spanCtx := traceCtx.(context.Context)
 
-	challengeID := c.Params("id")
+	// Copied: Params share fiber's request buffer, which is reused after the handler returns,
+	// while audit records are written asynchronously
+	challengeID := strings.Clone(c.Params("id"))
 
 	if challengeID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -699,6 +1321,9 @@ func (h *Handlers) RevokeChallenge(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only a live challenge completes as revoked; unknown, expired and finished ones keep their state
+	ch, getErr := h.challengeManager.Get(spanCtx, challengeID)
+
 	if err := h.challengeManager.Revoke(spanCtx, challengeID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"ok":     false,
@@ -709,6 +1334,15 @@ func (h *Handlers) RevokeChallenge(c *fiber.Ctx) error {
 	// Audit: challenge revoked
 	auditlog.LogChallengeRevoked(spanCtx, challengeID, c.IP())
 
+	if getErr == nil {
+		h.publishCompletion(spanCtx, completion.Event{
+			ChallengeID: challengeID,
+			Status:      completion.StatusRevoked,
+			UserID:      ch.UserID,
+			Channel:     string(ch.Channel),
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"ok": true,
 	})
@@ -748,6 +1382,23 @@ func (h *Handlers) GetTestCode(c *fiber.Ctx) error {
 	})
 }
 
+// limitedDestination returns the destination that per-destination rate limits and risk signals
+// count against. A webhook destination is an endpoint shared by all users, so each user gets
+// their own bucket on it.
+func limitedDestination(channel, userID, destination string) string {
+	if channel == string(webhook.Channel) {
+		return "webhook:" + destination + ":" + userID
+	}
+	return destination
+}
+
+// refundQuota returns the send budget taken by a challenge that was not sent
+func (h *Handlers) refundQuota(ctx context.Context, d quota.Decision) {
+	if err := h.quotaManager.Refund(ctx, d); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to refund send budget")
+	}
+}
+
 // Helper function
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
@@ -6,7 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 
 	challengekit "github.com/soulteary/challenge-kit"
 	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/template"
 	"github.com/soulteary/herald/internal/testutil"
 	sessionkit "github.com/soulteary/session-kit"
 )
@@ -571,17 +576,20 @@ func TestHandlers_VerifyChallenge_AMR_ByChannel(t *testing.T) {
 	originalMaxAttempts := config.MaxAttempts
 	originalLockoutDuration := config.LockoutDuration
 	originalChallengeExpiry := config.ChallengeExpiry
+	originalChatChannels := config.ChatChannelsJSON
 	defer func() {
 		config.CodeLength = originalCodeLength
 		config.MaxAttempts = originalMaxAttempts
 		config.LockoutDuration = originalLockoutDuration
 		config.ChallengeExpiry = originalChallengeExpiry
+		config.ChatChannelsJSON = originalChatChannels
 	}()
 
 	config.CodeLength = 6
 	config.MaxAttempts = 5
 	config.LockoutDuration = 10 * time.Minute
 	config.ChallengeExpiry = 5 * time.Minute
+	config.ChatChannelsJSON = `[{"name":"telegram","base_url":"http://herald-telegram:8084"},{"name":"feishu","base_url":"http://herald-feishu:8085","amr":"lark"}]`
 
 	tests := []struct {
 		name        string
@@ -601,6 +609,24 @@ func TestHandlers_VerifyChallenge_AMR_ByChannel(t *testing.T) {
 			destination: "+8613800138000",
 			expectedAMR: []string{"otp", "sms"},
 		},
+		{
+			name:        "voice channel",
+			channel:     "voice",
+			destination: "+8613800138000",
+			expectedAMR: []string{"otp", "tel"},
+		},
+		{
+			name:        "chat channel",
+			channel:     "telegram",
+			destination: "123456789",
+			expectedAMR: []string{"otp", "telegram"},
+		},
+		{
+			name:        "chat channel with amr override",
+			channel:     "feishu",
+			destination: "ou_7d8a6e6df7621556ce0d21922b676706",
+			expectedAMR: []string{"otp", "lark"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -622,15 +648,9 @@ func TestHandlers_VerifyChallenge_AMR_ByChannel(t *testing.T) {
 			challengeMgr := challengekit.NewManager(redisClient, challengeConfig)
 
 			ctx := context.Background()
-			var channel challengekit.Channel
-			if tt.channel == "sms" {
-				channel = challengekit.ChannelSMS
-			} else {
-				channel = challengekit.ChannelEmail
-			}
 			createReq := challengekit.CreateRequest{
 				UserID:      "user123",
-				Channel:     channel,
+				Channel:     challengekit.Channel(tt.channel),
 				Destination: tt.destination,
 				Purpose:     "login",
 				ClientIP:    "127.0.0.1",
@@ -1381,6 +1401,44 @@ func TestHandlers_CreateChallenge_InvalidPurpose(t *testing.T) {
 	}
 }
 
+func TestHandlers_CreateChallenge_InvalidTemplateVars(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() {
+		_ = redisClient.Close()
+	}()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	for _, reqBody := range []CreateChallengeRequest{
+		{TemplateVars: map[string]string{"bad-name": "x"}},
+		{TemplateVars: map[string]string{"plan": strings.Repeat("x", template.MaxVarValueLen+1)}},
+		{DisplayName: strings.Repeat("x", template.MaxVarValueLen+1)},
+	} {
+		reqBody.UserID = "user123"
+		reqBody.Channel = "email"
+		reqBody.Destination = "test@example.com"
+		reqBody.ClientIP = "127.0.0.1"
+
+		bodyBytes, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		if resp.StatusCode != fiber.StatusBadRequest || result["reason"] != "invalid_template_vars" {
+			t.Errorf("status=%d, body=%s, want 400 invalid_template_vars", resp.StatusCode, string(body))
+		}
+	}
+}
+
 func TestHandlers_CreateChallenge_UserLocked(t *testing.T) {
 	// Save original config
 	originalRateLimitPerUser := config.RateLimitPerUser
@@ -2034,3 +2092,349 @@ func TestMaskDestination(t *testing.T) {
 		}
 	})
 }
+
+func TestHandlers_CreateChallenge_QuotaExceeded(t *testing.T) {
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	originalRateLimitPerDestination := config.RateLimitPerDestination
+	originalResendCooldown := config.ResendCooldown
+	originalSendQuotasJSON := config.SendQuotasJSON
+	originalSMTPAPIURL := config.HeraldSMTPAPIURL
+	defer func() {
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+		config.RateLimitPerDestination = originalRateLimitPerDestination
+		config.ResendCooldown = originalResendCooldown
+		config.SendQuotasJSON = originalSendQuotasJSON
+		config.HeraldSMTPAPIURL = originalSMTPAPIURL
+	}()
+
+	smtp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"message_id":"m1"}`))
+	}))
+	defer smtp.Close()
+
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+	config.RateLimitPerDestination = 100
+	config.ResendCooldown = 1 * time.Millisecond
+	config.SendQuotasJSON = `[{"name":"email-hourly","channel":"email","limit":1,"window":"1h"}]`
+	config.HeraldSMTPAPIURL = smtp.URL
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(dest string) (int, map[string]interface{}) {
+		reqBody := CreateChallengeRequest{
+			UserID:      "user_quota",
+			Channel:     "email",
+			Destination: dest,
+			Purpose:     "login",
+			ClientIP:    "127.0.0.1",
+		}
+		bodyBytes, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	if status, result := send("first@example.com"); status != fiber.StatusOK {
+		t.Fatalf("First request: status=%d, body=%v", status, result)
+	}
+
+	status, result := send("second@example.com")
+	if status != fiber.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got status=%d, body=%v", status, result)
+	}
+	if result["reason"] != "quota_exceeded" {
+		t.Errorf("Expected reason=quota_exceeded, got %v", result["reason"])
+	}
+}
+
+func TestHandlers_CreateChallenge_QuotaRefundedOnSendFailure(t *testing.T) {
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	originalRateLimitPerDestination := config.RateLimitPerDestination
+	originalResendCooldown := config.ResendCooldown
+	originalSendQuotasJSON := config.SendQuotasJSON
+	defer func() {
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+		config.RateLimitPerDestination = originalRateLimitPerDestination
+		config.ResendCooldown = originalResendCooldown
+		config.SendQuotasJSON = originalSendQuotasJSON
+	}()
+
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+	config.RateLimitPerDestination = 100
+	config.ResendCooldown = 1 * time.Millisecond
+	config.SendQuotasJSON = `[{"name":"email-hourly","channel":"email","limit":1,"window":"1h"}]`
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(dest string) (int, map[string]interface{}) {
+		reqBody := CreateChallengeRequest{
+			UserID:      "user_quota",
+			Channel:     "email",
+			Destination: dest,
+			Purpose:     "login",
+			ClientIP:    "127.0.0.1",
+		}
+		bodyBytes, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	// No email provider is registered: the sends fail and their budget is given back
+	for _, dest := range []string{"first@example.com", "second@example.com"} {
+		if status, result := send(dest); status != fiber.StatusOK {
+			t.Fatalf("%s: status=%d, body=%v", dest, status, result)
+		}
+	}
+}
+
+func TestHandlers_CreateChallenge_ProgressiveResendCooldown(t *testing.T) {
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	originalRateLimitPerDestination := config.RateLimitPerDestination
+	originalResendCooldownSteps := config.ResendCooldownSteps
+	defer func() {
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+		config.RateLimitPerDestination = originalRateLimitPerDestination
+		config.ResendCooldownSteps = originalResendCooldownSteps
+	}()
+
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+	config.RateLimitPerDestination = 100
+	config.ResendCooldownSteps = []string{"30s", "60s"}
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	reqBody := CreateChallengeRequest{
+		UserID:      "user_backoff",
+		Channel:     "email",
+		Destination: "backoff@example.com",
+		Purpose:     "login",
+		ClientIP:    "127.0.0.1",
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req1 := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+	req1.Header.Set("Content-Type", "application/json")
+	resp1, err := app.Test(req1)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	body1, _ := io.ReadAll(resp1.Body)
+	if resp1.StatusCode != fiber.StatusOK {
+		t.Fatalf("First request failed: status=%d, body=%s", resp1.StatusCode, string(body1))
+	}
+	var result1 map[string]interface{}
+	if err := json.Unmarshal(body1, &result1); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if result1["next_resend_in"] != float64(30) {
+		t.Errorf("next_resend_in = %v, want 30 (first step)", result1["next_resend_in"])
+	}
+
+	req2 := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+	req2.Header.Set("Content-Type", "application/json")
+	resp2, err := app.Test(req2)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	body2, _ := io.ReadAll(resp2.Body)
+	if resp2.StatusCode != fiber.StatusTooManyRequests {
+		t.Fatalf("Expected cooldown, got status=%d, body=%s", resp2.StatusCode, string(body2))
+	}
+	var result2 map[string]interface{}
+	if err := json.Unmarshal(body2, &result2); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	remaining, ok := result2["next_resend_in"].(float64)
+	if !ok || remaining <= 0 || remaining > 30 {
+		t.Errorf("next_resend_in on cooldown = %v, want within (0, 30]", result2["next_resend_in"])
+	}
+}
+
+func TestHandlers_CreateChallenge_NormalizedDestination(t *testing.T) {
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	originalRateLimitPerDestination := config.RateLimitPerDestination
+	originalDefaultRegion := config.DestinationDefaultRegion
+	defer func() {
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+		config.RateLimitPerDestination = originalRateLimitPerDestination
+		config.DestinationDefaultRegion = originalDefaultRegion
+	}()
+
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+	config.RateLimitPerDestination = 100
+	config.DestinationDefaultRegion = "CN"
+
+	redisClient := testRedisClient(t)
+	defer func() {
+		_ = redisClient.Close()
+	}()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(channel, destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      "user123",
+			Channel:     channel,
+			Destination: destination,
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	status, result := send("email", "not-an-email")
+	if status != fiber.StatusBadRequest || result["reason"] != "invalid_destination" {
+		t.Errorf("invalid email: status=%d, body=%v; want 400 invalid_destination", status, result)
+	}
+
+	// Differently written forms of one number share the resend cooldown
+	status, result = send("sms", "+86 138-0013-8000")
+	if status != fiber.StatusOK {
+		t.Fatalf("first request: status=%d, body=%v; want 200", status, result)
+	}
+	status, result = send("sms", "13800138000")
+	if status != fiber.StatusTooManyRequests || result["reason"] != "resend_cooldown" {
+		t.Errorf("same number, national form: status=%d, body=%v; want 429 resend_cooldown", status, result)
+	}
+}
+
+func TestHandlers_CreateChallenge_EmailPolicy(t *testing.T) {
+	originalDisposableFile := config.EmailDisposableDomainsFile
+	originalRoleFile := config.EmailRoleAccountsFile
+	originalDisposablePurposes := config.EmailDisposablePurposes
+	originalRolePurposes := config.EmailRolePurposes
+	originalAllowedPurposes := config.AllowedPurposes
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	defer func() {
+		config.EmailDisposableDomainsFile = originalDisposableFile
+		config.EmailRoleAccountsFile = originalRoleFile
+		config.EmailDisposablePurposes = originalDisposablePurposes
+		config.EmailRolePurposes = originalRolePurposes
+		config.AllowedPurposes = originalAllowedPurposes
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+	}()
+
+	dir := t.TempDir()
+	config.EmailDisposableDomainsFile = filepath.Join(dir, "disposable.txt")
+	config.EmailRoleAccountsFile = filepath.Join(dir, "role.txt")
+	if err := os.WriteFile(config.EmailDisposableDomainsFile, []byte("mailinator.com\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(config.EmailRoleAccountsFile, []byte("noreply\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	config.EmailDisposablePurposes = []string{"signup"}
+	config.EmailRolePurposes = []string{"signup"}
+	config.AllowedPurposes = []string{"login", "signup"}
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+
+	redisClient := testRedisClient(t)
+	defer func() {
+		_ = redisClient.Close()
+	}()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	tests := []struct {
+		userID      string
+		destination string
+		purpose     string
+		wantStatus  int
+	}{
+		{"user1", "User@Mailinator.com", "signup", fiber.StatusBadRequest},
+		{"user2", "noreply@example.com", "signup", fiber.StatusBadRequest},
+		{"user3", "user3@mailinator.com", "login", fiber.StatusOK},
+		{"user4", "user4@example.com", "signup", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      tt.userID,
+			Channel:     "email",
+			Destination: tt.destination,
+			Purpose:     tt.purpose,
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s (%s): status=%d, body=%s; want %d", tt.destination, tt.purpose, resp.StatusCode, body, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus == fiber.StatusBadRequest {
+			var result map[string]interface{}
+			_ = json.Unmarshal(body, &result)
+			if result["reason"] != "destination_not_allowed" {
+				t.Errorf("%s: reason = %v, want destination_not_allowed", tt.destination, result["reason"])
+			}
+		}
+	}
+}
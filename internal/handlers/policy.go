@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/policy"
+)
+
+// Session storage fields written on successful verification and read by policy evaluation
+const (
+	sessionUserID         = "user_id"
+	sessionLastVerifiedAt = "last_verified_at"
+	sessionAMR            = "amr"
+)
+
+// PolicyEvaluateRequest asks whether an action needs step-up authentication
+type PolicyEvaluateRequest struct {
+	UserID    string   `json:"user_id"`
+	Action    string   `json:"action"`
+	Purpose   string   `json:"purpose"` // Used when action is empty
+	RiskScore int      `json:"risk_score"`
+	Signals   []string `json:"signals"`
+	// SessionID reads the last verification from session storage (HERALD_SESSION_STORAGE_ENABLED);
+	// otherwise LastVerifiedAt and AMR describe it
+	SessionID      string   `json:"session_id"`
+	LastVerifiedAt int64    `json:"last_verified_at"`
+	AMR            []string `json:"amr"`
+}
+
+// PolicyEvaluate handles POST /v1/policy/evaluate
+func (h *Handlers) PolicyEvaluate(c *fiber.Ctx) error {
+	if h.policyEngine == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "policy_not_configured",
+		})
+	}
+	var req PolicyEvaluateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+	action := req.Action
+	if action == "" {
+		action = req.Purpose
+	}
+	if action == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "action_required",
+		})
+	}
+
+	in := policy.Input{
+		UserID:    req.UserID,
+		Action:    action,
+		RiskScore: req.RiskScore,
+		Signals:   req.Signals,
+		AMR:       req.AMR,
+	}
+	if req.LastVerifiedAt > 0 {
+		in.LastVerifiedAt = time.Unix(req.LastVerifiedAt, 0)
+	}
+	if req.SessionID != "" {
+		if h.sessionManager == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "session_storage_disabled",
+			})
+		}
+		rec, err := h.sessionManager.Get(requestContext(c), req.SessionID)
+		if err != nil {
+			h.log.Error().Err(err).Msg("Failed to read session")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "internal_error",
+			})
+		}
+		// A missing or expired session means no known verification
+		in.LastVerifiedAt, in.AMR = time.Time{}, nil
+		if rec != nil {
+			if owner, _ := rec.Data[sessionUserID].(string); owner != "" && owner != req.UserID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"ok":     false,
+					"reason": "session_user_mismatch",
+				})
+			}
+			in.LastVerifiedAt, in.AMR = sessionVerification(rec.Data)
+		}
+	}
+
+	d := h.policyEngine.Evaluate(in, time.Now())
+	response := fiber.Map{
+		"ok":              true,
+		"user_id":         req.UserID,
+		"action":          action,
+		"stepup_required": d.StepUpRequired,
+		"reason":          d.Reason,
+	}
+	if d.Policy != "" {
+		response["policy"] = d.Policy
+		response["required_factors"] = d.RequiredFactors
+		response["acceptable_amr"] = d.AcceptableAMR
+		response["max_age"] = int64(d.MaxAge.Seconds())
+	}
+	if !in.LastVerifiedAt.IsZero() {
+		response["last_verified_at"] = in.LastVerifiedAt.Unix()
+	}
+	return c.JSON(response)
+}
+
+// sessionVerification reads the fields written by recordSessionVerification. Values read back
+// from Redis are JSON-decoded (float64, []interface{}).
+func sessionVerification(data map[string]interface{}) (time.Time, []string) {
+	var at time.Time
+	switch ts := data[sessionLastVerifiedAt].(type) {
+	case float64:
+		if ts > 0 {
+			at = time.Unix(int64(ts), 0)
+		}
+	case int64:
+		if ts > 0 {
+			at = time.Unix(ts, 0)
+		}
+	}
+	var amr []string
+	switch values := data[sessionAMR].(type) {
+	case []string:
+		amr = values
+	case []interface{}:
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				amr = append(amr, s)
+			}
+		}
+	}
+	return at, amr
+}
+
+// recordSessionVerification stores a successful verification in the caller's session, so
+// policy evaluation can tell how recently and how the user verified. It is a no-op without
+// session storage or session ID.
+func (h *Handlers) recordSessionVerification(ctx context.Context, sessionID, userID string, amr []string) {
+	if h.sessionManager == nil || sessionID == "" {
+		return
+	}
+	data := map[string]interface{}{}
+	rec, err := h.sessionManager.Get(ctx, sessionID)
+	if err != nil {
+		h.log.Warn().Err(err).Msg("Failed to read session")
+		return
+	}
+	if rec != nil && rec.Data != nil {
+		if owner, _ := rec.Data[sessionUserID].(string); owner != "" && owner != userID {
+			h.log.Warn().Str("user_id", userID).Msg("Session belongs to another user, verification not recorded")
+			return
+		}
+		data = rec.Data
+	}
+	data[sessionUserID] = userID
+	data[sessionLastVerifiedAt] = time.Now().Unix()
+	data[sessionAMR] = amr
+	if err := h.sessionManager.Set(ctx, sessionID, data, 0); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to record verification in session")
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	challengekit "github.com/soulteary/challenge-kit"
+	sessionkit "github.com/soulteary/session-kit"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_PolicyEvaluate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(`{"policies": [
+		{"name": "payments", "actions": ["payment"], "max_age": "5m", "factors": ["webauthn"]},
+		{"name": "settings", "actions": ["change_email"], "max_age": "10m", "factors": ["otp", "totp"]}
+	]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	originalPolicyFile := config.PolicyFile
+	defer func() { config.PolicyFile = originalPolicyFile }()
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	sessions := sessionkit.NewKVManager(sessionkit.NewRedisStore(redisClient, "session:"), time.Hour)
+
+	config.PolicyFile = ""
+	disabled := NewHandlers(redisClient, sessions, testLogger())
+	config.PolicyFile = path
+	handlers := NewHandlers(redisClient, sessions, testLogger())
+	challengeMgr := testChallengeManager(t, redisClient)
+
+	app := fiber.New()
+	app.Post("/disabled/evaluate", disabled.PolicyEvaluate)
+	app.Post("/evaluate", handlers.PolicyEvaluate)
+	app.Post("/verify", handlers.VerifyChallenge)
+
+	do := func(path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+
+	if status, result := do("/disabled/evaluate", PolicyEvaluateRequest{UserID: "user123", Action: "payment"}); status != fiber.StatusServiceUnavailable || result["reason"] != "policy_not_configured" {
+		t.Errorf("disabled: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/evaluate", PolicyEvaluateRequest{UserID: "user123"}); status != fiber.StatusBadRequest || result["reason"] != "action_required" {
+		t.Errorf("missing action: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/evaluate", PolicyEvaluateRequest{UserID: "user123", Action: "login"}); status != fiber.StatusOK || result["stepup_required"] != false || result["reason"] != "no_policy" {
+		t.Errorf("no policy: status=%d, body=%v", status, result)
+	}
+
+	// Explicit last verification
+	status, result := do("/evaluate", PolicyEvaluateRequest{UserID: "user123", Action: "payment", LastVerifiedAt: time.Now().Unix(), AMR: []string{"otp", "sms"}})
+	if status != fiber.StatusOK || result["stepup_required"] != true || result["reason"] != "insufficient_amr" || result["policy"] != "payments" {
+		t.Errorf("payment with sms: status=%d, body=%v", status, result)
+	}
+	if amr, _ := json.Marshal(result["acceptable_amr"]); string(amr) != `["hwk"]` {
+		t.Errorf("acceptable_amr = %s", amr)
+	}
+
+	// The verification is recorded in the session and read back from it
+	if status, result := do("/evaluate", PolicyEvaluateRequest{UserID: "user123", Action: "change_email", SessionID: "sess_1"}); result["stepup_required"] != true || result["reason"] != "no_recent_verification" {
+		t.Errorf("before verification: status=%d, body=%v", status, result)
+	}
+	ch, code, err := challengeMgr.Create(context.Background(), challengekit.CreateRequest{
+		UserID:      "user123",
+		Channel:     challengekit.ChannelEmail,
+		Destination: "test@example.com",
+		Purpose:     "stepup",
+		ClientIP:    "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	if status, result := do("/verify", VerifyChallengeRequest{ChallengeID: ch.ID, Code: code, SessionID: "sess_1"}); status != fiber.StatusOK {
+		t.Fatalf("verify: status=%d, body=%v", status, result)
+	}
+	status, result = do("/evaluate", PolicyEvaluateRequest{UserID: "user123", Action: "change_email", SessionID: "sess_1"})
+	if status != fiber.StatusOK || result["stepup_required"] != false || result["reason"] != "recently_verified" || result["last_verified_at"] == nil {
+		t.Errorf("after verification: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/evaluate", PolicyEvaluateRequest{UserID: "other", Action: "change_email", SessionID: "sess_1"}); status != fiber.StatusBadRequest || result["reason"] != "session_user_mismatch" {
+		t.Errorf("other user's session: status=%d, body=%v", status, result)
+	}
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/completion"
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/lockout"
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/push"
+)
+
+// RegisterPushDeviceRequest registers a device for push approvals
+type RegisterPushDeviceRequest struct {
+	DeviceID string `json:"device_id"`
+	// PublicKey is the base64 DER (PKIX) Ed25519 or ECDSA P-256 key the device signs assertions with
+	PublicKey string `json:"public_key"`
+	Name      string `json:"name"`
+}
+
+// PushDecisionRequest is the device assertion approving or denying a push challenge.
+// Signature covers push.AssertionMessage(challenge_id, action, device_id, number, timestamp).
+type PushDecisionRequest struct {
+	DeviceID  string `json:"device_id"`
+	Number    string `json:"number"` // Approve only: the number shown by the verifier
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+	SessionID string `json:"session_id"` // Approve only, optional: record the verification in session storage
+}
+
+// RegisterPushDevice handles POST /v1/users/:id/push-devices
+func (h *Handlers) RegisterPushDevice(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	var req RegisterPushDeviceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if !push.ValidDeviceID(req.DeviceID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_device_id",
+		})
+	}
+
+	err := h.pushStore.RegisterDevice(requestContext(c), push.Device{
+		ID:        req.DeviceID,
+		UserID:    userID,
+		PublicKey: req.PublicKey,
+		Name:      req.Name,
+	})
+	if errors.Is(err, push.ErrInvalidPublicKey) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_public_key",
+		})
+	}
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to register push device")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":        true,
+		"user_id":   userID,
+		"device_id": req.DeviceID,
+	})
+}
+
+// RevokePushDevice handles POST /v1/users/:id/push-devices/:device_id/revoke
+func (h *Handlers) RevokePushDevice(c *fiber.Ctx) error {
+	err := h.pushStore.RemoveDevice(requestContext(c), c.Params("id"), c.Params("device_id"))
+	if errors.Is(err, push.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "device_not_found",
+		})
+	}
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to revoke push device")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// ApproveChallenge handles POST /v1/otp/challenges/:id/approve (called by the device)
+func (h *Handlers) ApproveChallenge(c *fiber.Ctx) error {
+	return h.decidePush(c, push.ActionApprove)
+}
+
+// DenyChallenge handles POST /v1/otp/challenges/:id/deny (called by the device)
+func (h *Handlers) DenyChallenge(c *fiber.Ctx) error {
+	return h.decidePush(c, push.ActionDeny)
+}
+
+// decidePush checks the device assertion and records the decision
+func (h *Handlers) decidePush(c *fiber.Ctx, action string) error {
+	ctx := requestContext(c)
+	// Copied: the audit record and event notification outlive fiber's request buffer
+	challengeID := strings.Clone(c.Params("id"))
+	clientIP := c.IP()
+
+	var req PushDecisionRequest
+	if err := c.BodyParser(&req); err != nil || req.DeviceID == "" || req.Signature == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if action == push.ActionApprove && req.Number == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "number_required",
+		})
+	}
+	if action == push.ActionDeny {
+		req.Number = ""
+	}
+
+	state, err := h.pushStore.State(ctx, challengeID)
+	if errors.Is(err, push.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "challenge_not_found",
+		})
+	}
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to load push state")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	switch state.CurrentStatus(time.Now()) {
+	case push.StatusPending:
+	case push.StatusExpired:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "expired",
+		})
+	default:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "already_decided",
+		})
+	}
+
+	// The assertion must come from the device the challenge was sent to
+	if err := h.checkPushAssertion(ctx, state, action, req); err != nil {
+		h.log.Debug().Err(err).Str("challenge_id", challengeID).Msg("Push assertion rejected")
+		metrics.RecordVerification("failure", "invalid_assertion")
+		auditlog.LogVerificationFailed(ctx, challengeID, "invalid_assertion", clientIP)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_assertion",
+		})
+	}
+
+	if action == push.ActionDeny {
+		return h.denyPush(c, state, clientIP)
+	}
+	return h.approvePush(c, state, req.Number, req.SessionID, clientIP)
+}
+
+func (h *Handlers) checkPushAssertion(ctx context.Context, state *push.State, action string, req PushDecisionRequest) error {
+	if req.DeviceID != state.DeviceID {
+		return errors.New("assertion from another device")
+	}
+	device, err := h.pushStore.Device(ctx, state.UserID, req.DeviceID)
+	if err != nil {
+		return err
+	}
+	if err := push.CheckTimestamp(req.Timestamp, time.Now(), config.PushAssertionMaxSkew); err != nil {
+		return err
+	}
+	message := push.AssertionMessage(state.ChallengeID, action, req.DeviceID, req.Number, req.Timestamp)
+	return push.VerifyAssertion(device.PublicKey, message, req.Signature)
+}
+
+func (h *Handlers) approvePush(c *fiber.Ctx, state *push.State, number, sessionID, clientIP string) error {
+	ctx := requestContext(c)
+
+	// The typed number is the challenge code: attempts and lockout work as for codes
+	result, err := h.pushChallenges.Verify(ctx, state.ChallengeID, number, clientIP)
+	if err != nil || !result.OK {
+		reason := "verification_failed"
+		if result != nil && result.Reason != "" {
+			reason = result.Reason
+		}
+		metrics.RecordVerification("failure", reason)
+		auditlog.LogVerificationFailed(ctx, state.ChallengeID, reason, clientIP)
+
+		if reason == "locked" {
+			h.lockUser(ctx, state.UserID, lockout.ReasonMaxAttempts, clientIP)
+			if err := h.pushStore.Decide(ctx, state, push.StatusDenied, reason); err != nil && !errors.Is(err, push.ErrAlreadyDecided) {
+				h.log.Warn().Err(err).Msg("Failed to record push decision")
+			}
+			h.publishCompletion(ctx, completion.Event{
+				ChallengeID: state.ChallengeID,
+				Status:      completion.StatusDenied,
+				UserID:      state.UserID,
+				Channel:     string(push.Channel),
+				Reason:      reason,
+			})
+		}
+		if h.riskEngine != nil {
+			if err := h.riskEngine.RecordFailure(ctx, state.UserID); err != nil {
+				h.log.Warn().Err(err).Msg("Failed to record risk failure")
+			}
+		}
+
+		response := fiber.Map{
+			"ok":     false,
+			"reason": reason,
+		}
+		if result != nil && result.RemainingAttempts != nil {
+			response["remaining_attempts"] = *result.RemainingAttempts
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(response)
+	}
+
+	if err := h.pushStore.Decide(ctx, state, push.StatusApproved, ""); err != nil {
+		if errors.Is(err, push.ErrAlreadyDecided) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "already_decided",
+			})
+		}
+		h.log.Error().Err(err).Msg("Failed to record push decision")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	ch := result.Challenge
+	metrics.RecordVerification("success", "")
+	if err := h.rateLimitManager.ResetProgressiveCooldown(ctx, resendCooldownKey(ch.UserID, ch.Destination)); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to reset resend cooldown")
+	}
+	if h.riskEngine != nil {
+		if err := h.riskEngine.Confirm(ctx, ch.ID); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to learn from verified challenge")
+		}
+	}
+	auditlog.LogVerificationSuccess(ctx, ch.ID, ch.UserID, string(ch.Channel), ch.Destination, ch.Purpose, clientIP)
+	amr := h.channels.AMR(string(ch.Channel))
+	h.publishCompletion(ctx, completion.Event{
+		ChallengeID: ch.ID,
+		Status:      completion.StatusApproved,
+		UserID:      ch.UserID,
+		Channel:     string(ch.Channel),
+		AMR:         amr,
+	})
+	h.recordSessionVerification(ctx, sessionID, ch.UserID, amr)
+
+	return c.JSON(fiber.Map{
+		"ok":     true,
+		"status": push.StatusApproved,
+	})
+}
+
+func (h *Handlers) denyPush(c *fiber.Ctx, state *push.State, clientIP string) error {
+	ctx := requestContext(c)
+
+	if err := h.pushStore.Decide(ctx, state, push.StatusDenied, "user_denied"); err != nil {
+		if errors.Is(err, push.ErrAlreadyDecided) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "already_decided",
+			})
+		}
+		h.log.Error().Err(err).Msg("Failed to record push decision")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	if err := h.challengeManager.Revoke(ctx, state.ChallengeID); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to revoke denied push challenge")
+	}
+	h.publishCompletion(ctx, completion.Event{
+		ChallengeID: state.ChallengeID,
+		Status:      completion.StatusDenied,
+		UserID:      state.UserID,
+		Channel:     string(push.Channel),
+		Reason:      "user_denied",
+	})
+
+	// A denied push may be an attacker holding the first factor
+	metrics.RecordVerification("failure", "push_denied")
+	auditlog.LogVerificationFailed(ctx, state.ChallengeID, "push_denied", clientIP)
+	if h.riskEngine != nil {
+		if err := h.riskEngine.RecordFailure(ctx, state.UserID); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to record risk failure")
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":     true,
+		"status": push.StatusDenied,
+	})
+}
+
+// GetChallenge handles GET /v1/otp/challenges/:id. For push challenges it reports the approval
+// outcome; ?wait=<seconds> long-polls while the challenge is pending (up to
+// CHALLENGE_EVENTS_LONG_POLL_MAX), woken by the challenge's completion event.
+func (h *Handlers) GetChallenge(c *fiber.Ctx) error {
+	ctx := requestContext(c)
+	challengeID := c.Params("id")
+
+	wait := time.Duration(0)
+	if v := c.Query("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "invalid_wait",
+			})
+		}
+		wait = min(time.Duration(seconds)*time.Second, config.ChallengeEventsLongPollMax)
+	}
+
+	state, err := h.pushStore.State(ctx, challengeID)
+	if errors.Is(err, push.ErrNotFound) {
+		return h.challengeStatus(c, challengeID)
+	}
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to load push state")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	// Approvals and denials publish a completion after storing the decision; stop waiting
+	// when the challenge expires, which publishes nothing
+	if state.CurrentStatus(time.Now()) == push.StatusPending && wait > 0 {
+		wait = min(wait, time.Until(time.Unix(state.ExpiresAt, 0)))
+		if _, err := h.completions.Wait(ctx, challengeID, wait); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to wait for challenge completion")
+		}
+		if current, err := h.pushStore.State(ctx, challengeID); err == nil {
+			state = current
+		}
+	}
+
+	return c.JSON(h.pushStatusResponse(state, state.CurrentStatus(time.Now())))
+}
+
+// challengeStatus reports a non-push challenge: pending while it exists in the store
+func (h *Handlers) challengeStatus(c *fiber.Ctx, challengeID string) error {
+	ch, err := h.challengeManager.Get(requestContext(c), challengeID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "challenge_not_found",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"ok":           true,
+		"challenge_id": ch.ID,
+		"channel":      string(ch.Channel),
+		"status":       push.StatusPending,
+		"expires_at":   ch.ExpiresAt.Unix(),
+	})
+}
+
+func (h *Handlers) pushStatusResponse(state *push.State, status string) fiber.Map {
+	response := fiber.Map{
+		"ok":           true,
+		"challenge_id": state.ChallengeID,
+		"channel":      string(push.Channel),
+		"status":       status,
+		"user_id":      state.UserID,
+		"expires_at":   state.ExpiresAt,
+	}
+	if state.DecidedAt != 0 {
+		response["decided_at"] = state.DecidedAt
+	}
+	switch status {
+	case push.StatusApproved:
+		response["amr"] = h.channels.AMR(string(push.Channel))
+	case push.StatusDenied:
+		response["reason"] = state.Reason
+	}
+	return response
+}
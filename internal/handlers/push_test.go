@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	sessionkit "github.com/soulteary/session-kit"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/push"
+)
+
+func TestHandlers_Push_ApproveDeny(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(raw))
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"message_id":"push1"}`))
+	}))
+	defer gateway.Close()
+
+	originalProvider := config.PushProvider
+	originalBaseURL := config.PushAPIBaseURL
+	defer func() {
+		config.PushProvider = originalProvider
+		config.PushAPIBaseURL = originalBaseURL
+	}()
+	config.PushProvider = "test-push"
+	config.PushAPIBaseURL = gateway.URL
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	sessions := sessionkit.NewKVManager(sessionkit.NewRedisStore(redisClient, "session:"), time.Hour)
+	handlers := NewHandlers(redisClient, sessions, testLogger())
+
+	app := fiber.New()
+	app.Post("/users/:id/push-devices", handlers.RegisterPushDevice)
+	app.Post("/users/:id/push-devices/:device_id/revoke", handlers.RevokePushDevice)
+	app.Post("/challenge", handlers.CreateChallenge)
+	app.Post("/verify", handlers.VerifyChallenge)
+	app.Get("/challenges/:id", handlers.GetChallenge)
+	app.Post("/challenges/:id/approve", handlers.ApproveChallenge)
+	app.Post("/challenges/:id/deny", handlers.DenyChallenge)
+
+	do := func(method, path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			bodyBytes, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(bodyBytes)
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	status, result := do("POST", "/users/user123/push-devices", RegisterPushDeviceRequest{
+		DeviceID:  "phone-1",
+		PublicKey: base64.StdEncoding.EncodeToString(der),
+		Name:      "Pixel",
+	})
+	if status != fiber.StatusOK {
+		t.Fatalf("register device: status=%d, body=%v", status, result)
+	}
+	if status, result := do("POST", "/users/user123/push-devices", RegisterPushDeviceRequest{DeviceID: "phone-2", PublicKey: "bad"}); status != fiber.StatusBadRequest || result["reason"] != "invalid_public_key" {
+		t.Errorf("register bad key: status=%d, body=%v; want 400 invalid_public_key", status, result)
+	}
+
+	create := func() (string, string) {
+		t.Helper()
+		status, result := do("POST", "/challenge", CreateChallengeRequest{
+			UserID:      "user123",
+			Channel:     "push",
+			Destination: "phone-1",
+			Purpose:     "login",
+			ClientIP:    "127.0.0.1",
+		})
+		if status != fiber.StatusOK {
+			t.Fatalf("push challenge: status=%d, body=%v; want 200", status, result)
+		}
+		number, _ := result["number_match"].(string)
+		if len(number) != config.PushNumberLength {
+			t.Fatalf("number_match = %q, want %d digits", number, config.PushNumberLength)
+		}
+		return result["challenge_id"].(string), number
+	}
+	assertion := func(id, action, number string) PushDecisionRequest {
+		ts := time.Now().Unix()
+		sig := ed25519.Sign(priv, push.AssertionMessage(id, action, "phone-1", number, ts))
+		return PushDecisionRequest{DeviceID: "phone-1", Number: number, Timestamp: ts, Signature: base64.StdEncoding.EncodeToString(sig)}
+	}
+
+	if status, result := do("POST", "/challenge", CreateChallengeRequest{UserID: "user123", Channel: "push", Destination: "phone-9"}); status != fiber.StatusBadRequest || result["reason"] != "invalid_destination" {
+		t.Errorf("unregistered device: status=%d, body=%v; want 400 invalid_destination", status, result)
+	}
+
+	// Approve
+	id, number := create()
+	mu.Lock()
+	if len(bodies) != 1 || strings.Contains(bodies[0], `"code"`) || !strings.Contains(bodies[0], id) {
+		t.Errorf("push payload = %v, want challenge id and no code", bodies)
+	}
+	mu.Unlock()
+
+	if status, result := do("POST", "/verify", VerifyChallengeRequest{ChallengeID: id, Code: number}); status != fiber.StatusBadRequest || result["reason"] != "push_approval_required" {
+		t.Errorf("verify push by code: status=%d, body=%v; want 400 push_approval_required", status, result)
+	}
+	if status, result := do("GET", "/challenges/"+id, nil); status != fiber.StatusOK || result["status"] != push.StatusPending {
+		t.Errorf("poll pending: status=%d, body=%v", status, result)
+	}
+
+	forged := assertion(id, push.ActionApprove, number)
+	forged.Signature = base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize))
+	if status, result := do("POST", "/challenges/"+id+"/approve", forged); status != fiber.StatusUnauthorized || result["reason"] != "invalid_assertion" {
+		t.Errorf("forged approve: status=%d, body=%v; want 401 invalid_assertion", status, result)
+	}
+	approve := assertion(id, push.ActionApprove, number)
+	approve.SessionID = "sess_push"
+	if status, result := do("POST", "/challenges/"+id+"/approve", approve); status != fiber.StatusOK || result["status"] != push.StatusApproved {
+		t.Fatalf("approve: status=%d, body=%v", status, result)
+	}
+	rec, err := sessions.Get(context.Background(), "sess_push")
+	if err != nil || rec == nil {
+		t.Fatalf("session after approve: %v, %v", rec, err)
+	}
+	if amr, _ := json.Marshal(rec.Data[sessionAMR]); rec.Data[sessionUserID] != "user123" || string(amr) != `["otp","swk"]` {
+		t.Errorf("session after approve = %v", rec.Data)
+	}
+	if status, result := do("POST", "/challenges/"+id+"/deny", assertion(id, push.ActionDeny, "")); status != fiber.StatusConflict {
+		t.Errorf("deny after approve: status=%d, body=%v; want 409", status, result)
+	}
+
+	status, result = do("GET", "/challenges/"+id+"?wait=1", nil)
+	if status != fiber.StatusOK || result["status"] != push.StatusApproved || result["user_id"] != "user123" {
+		t.Fatalf("poll approved: status=%d, body=%v", status, result)
+	}
+	amr, _ := json.Marshal(result["amr"])
+	if string(amr) != `["otp","swk"]` {
+		t.Errorf("amr = %s, want [\"otp\",\"swk\"]", amr)
+	}
+
+	// Long-poll: the decision on the device completes the wait
+	id, number = create()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		do("POST", "/challenges/"+id+"/approve", assertion(id, push.ActionApprove, number))
+	}()
+	started := time.Now()
+	if status, result := do("GET", "/challenges/"+id+"?wait=10", nil); result["status"] != push.StatusApproved || time.Since(started) > 5*time.Second {
+		t.Errorf("long-poll approved: status=%d, body=%v after %s", status, result, time.Since(started))
+	}
+
+	// Deny
+	id, _ = create()
+	if status, result := do("POST", "/challenges/"+id+"/deny", assertion(id, push.ActionDeny, "")); status != fiber.StatusOK || result["status"] != push.StatusDenied {
+		t.Fatalf("deny: status=%d, body=%v", status, result)
+	}
+	if status, result := do("GET", "/challenges/"+id, nil); result["status"] != push.StatusDenied || result["reason"] != "user_denied" {
+		t.Errorf("poll denied: status=%d, body=%v", status, result)
+	}
+
+	// Revoked devices can no longer be targeted
+	if status, result := do("POST", "/users/user123/push-devices/phone-1/revoke", nil); status != fiber.StatusOK {
+		t.Fatalf("revoke device: status=%d, body=%v", status, result)
+	}
+	if status, _ := do("POST", "/users/user123/push-devices/phone-1/revoke", nil); status != fiber.StatusNotFound {
+		t.Errorf("revoke device again: status=%d, want 404", status)
+	}
+	if status, result := do("GET", "/challenges/ch_missing", nil); status != fiber.StatusNotFound || result["reason"] != "challenge_not_found" {
+		t.Errorf("poll missing: status=%d, body=%v", status, result)
+	}
+}
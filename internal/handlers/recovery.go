@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/ratelimit"
+	"github.com/soulteary/herald/internal/recovery"
+)
+
+// RecoveryCodesRequest generates a new set of recovery codes
+type RecoveryCodesRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// RecoveryVerifyRequest consumes a recovery code
+type RecoveryVerifyRequest struct {
+	UserID    string `json:"user_id"`
+	Code      string `json:"code"`
+	ClientIP  string `json:"client_ip"`
+	SessionID string `json:"session_id"` // Optional: record the verification in session storage
+}
+
+// GenerateRecoveryCodes handles POST /v1/recovery/codes. It replaces any previous set; the
+// plaintext codes are only returned here.
+func (h *Handlers) GenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req RecoveryCodesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	ctx := requestContext(c)
+	codes, err := h.recoveryCodes.Generate(ctx, req.UserID)
+	if err != nil {
+		h.log.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to generate recovery codes")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	auditlog.LogRecoveryCodesGenerated(ctx, req.UserID, len(codes), c.IP())
+
+	return c.JSON(fiber.Map{
+		"ok":        true,
+		"user_id":   req.UserID,
+		"codes":     codes,
+		"remaining": len(codes),
+	})
+}
+
+// GetRecoveryCodes handles GET /v1/recovery/codes?user_id=... and reports how many codes are left
+func (h *Handlers) GetRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Query("user_id")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	status, err := h.recoveryCodes.Status(requestContext(c), userID)
+	if errors.Is(err, recovery.ErrNotFound) {
+		return c.JSON(fiber.Map{
+			"ok":        true,
+			"user_id":   userID,
+			"enabled":   false,
+			"remaining": 0,
+		})
+	}
+	if err != nil {
+		h.log.Error().Err(err).Str("user_id", userID).Msg("Failed to read recovery codes")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"user_id":    userID,
+		"enabled":    true,
+		"total":      status.Total,
+		"remaining":  status.Remaining,
+		"created_at": status.CreatedAt.Unix(),
+	})
+}
+
+// VerifyRecoveryCode handles POST /v1/recovery/verify. A matching code is consumed; the
+// response has the same shape as a successful challenge verification.
+func (h *Handlers) VerifyRecoveryCode(c *fiber.Ctx) error {
+	var req RecoveryVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "code_required",
+		})
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = c.IP()
+	}
+
+	ctx := requestContext(c)
+
+	// Same lock as the challenge verify path: set by too many failures, escalated by lockout
+	if h.challengeManager.IsUserLocked(ctx, req.UserID) {
+		response := fiber.Map{
+			"ok":     false,
+			"reason": "user_locked",
+		}
+		if lock, err := h.lockoutManager.Get(ctx, req.UserID); err == nil && lock != nil {
+			response["locked_until"] = lock.ExpiresAt.Unix()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(response)
+	}
+
+	// Each attempt hashes with Argon2: limit attempts per user
+	allowed, _, _, err := h.rateLimitManager.CheckScopedRateLimit(ctx, ratelimit.ScopeRecovery, req.UserID, config.RecoveryVerifyLimit, config.RecoveryVerifyWindow)
+	if err != nil {
+		h.log.Error().Err(err).Msg("Rate limit check failed")
+	}
+	if !allowed {
+		metrics.RecordRateLimitHit("recovery")
+		auditlog.LogRecoveryCodeFailed(ctx, req.UserID, "rate_limit_exceeded", clientIP)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "rate_limit_exceeded",
+		})
+	}
+
+	remaining, err := h.recoveryCodes.Consume(ctx, req.UserID, req.Code)
+	if err != nil {
+		reason := "invalid"
+		status := fiber.StatusUnauthorized
+		switch {
+		case errors.Is(err, recovery.ErrNotFound):
+			reason = "recovery_not_enabled"
+		case !errors.Is(err, recovery.ErrInvalidCode):
+			h.log.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to verify recovery code")
+			reason = "internal_error"
+			status = fiber.StatusInternalServerError
+		}
+		metrics.RecordVerification("failure", reason)
+		auditlog.LogRecoveryCodeFailed(ctx, req.UserID, reason, clientIP)
+		if reason == "invalid" && h.riskEngine != nil {
+			if err := h.riskEngine.RecordFailure(ctx, req.UserID); err != nil {
+				h.log.Warn().Err(err).Msg("Failed to record risk failure")
+			}
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"ok":     false,
+			"reason": reason,
+		})
+	}
+
+	metrics.RecordVerification("success", "")
+	auditlog.LogRecoveryCodeUsed(ctx, req.UserID, remaining, clientIP)
+
+	amr := []string{"otp"} // RFC 8176: recovery codes are one-time passwords
+	h.recordSessionVerification(ctx, req.SessionID, req.UserID, amr)
+
+	return c.JSON(fiber.Map{
+		"ok":        true,
+		"user_id":   req.UserID,
+		"amr":       amr,
+		"issued_at": time.Now().Unix(),
+		"remaining": remaining,
+	})
+}
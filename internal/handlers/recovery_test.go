@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_RecoveryCodes(t *testing.T) {
+	originalCount := config.RecoveryCodeCount
+	originalMemory := config.RecoveryArgon2Memory
+	originalLimit := config.RecoveryVerifyLimit
+	defer func() {
+		config.RecoveryCodeCount = originalCount
+		config.RecoveryArgon2Memory = originalMemory
+		config.RecoveryVerifyLimit = originalLimit
+	}()
+	config.RecoveryCodeCount = 4
+	config.RecoveryArgon2Memory = 64
+	config.RecoveryVerifyLimit = 4
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/recovery/codes", handlers.GenerateRecoveryCodes)
+	app.Get("/recovery/codes", handlers.GetRecoveryCodes)
+	app.Post("/recovery/verify", handlers.VerifyRecoveryCode)
+
+	do := func(method, path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		var body io.Reader
+		if payload != nil {
+			bodyBytes, _ := json.Marshal(payload)
+			body = bytes.NewBuffer(bodyBytes)
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+
+	if status, result := do("GET", "/recovery/codes?user_id=user123", nil); status != fiber.StatusOK || result["enabled"] != false {
+		t.Errorf("status before generate: status=%d, body=%v", status, result)
+	}
+	if status, result := do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user123", Code: "abcde-fghjk"}); status != fiber.StatusUnauthorized || result["reason"] != "recovery_not_enabled" {
+		t.Errorf("verify before generate: status=%d, body=%v", status, result)
+	}
+
+	status, result := do("POST", "/recovery/codes", RecoveryCodesRequest{UserID: "user123"})
+	codes, _ := result["codes"].([]interface{})
+	if status != fiber.StatusOK || len(codes) != 4 {
+		t.Fatalf("generate: status=%d, body=%v", status, result)
+	}
+	code := codes[0].(string)
+
+	status, result = do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user123", Code: code})
+	if status != fiber.StatusOK || result["user_id"] != "user123" || result["remaining"] != float64(3) {
+		t.Fatalf("verify: status=%d, body=%v", status, result)
+	}
+	if amr, _ := json.Marshal(result["amr"]); string(amr) != `["otp"]` {
+		t.Errorf("amr = %s, want [\"otp\"]", amr)
+	}
+	if status, result := do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user123", Code: code}); status != fiber.StatusUnauthorized || result["reason"] != "invalid" {
+		t.Errorf("reuse: status=%d, body=%v; want 401 invalid", status, result)
+	}
+	if status, result := do("GET", "/recovery/codes?user_id=user123", nil); status != fiber.StatusOK || result["remaining"] != float64(3) || result["total"] != float64(4) {
+		t.Errorf("status: status=%d, body=%v", status, result)
+	}
+
+	// Regenerating invalidates the old codes
+	_, _ = do("POST", "/recovery/codes", RecoveryCodesRequest{UserID: "user123"})
+	if status, result := do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user123", Code: codes[1].(string)}); status != fiber.StatusUnauthorized {
+		t.Errorf("old code after regenerate: status=%d, body=%v; want 401", status, result)
+	}
+
+	// RECOVERY_VERIFY_LIMIT attempts per window
+	if status, result := do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user123", Code: "22222-22222"}); status != fiber.StatusTooManyRequests || result["reason"] != "rate_limit_exceeded" {
+		t.Errorf("over limit: status=%d, body=%v; want 429", status, result)
+	}
+	// Users locked by failed challenge verifications cannot fall back to recovery codes
+	_, result = do("POST", "/recovery/codes", RecoveryCodesRequest{UserID: "user456"})
+	codes, _ = result["codes"].([]interface{})
+	if len(codes) == 0 {
+		t.Fatalf("generate user456: body=%v", result)
+	}
+	if err := redisClient.Set(context.Background(), "otp:lock:user456", "1", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if status, result := do("POST", "/recovery/verify", RecoveryVerifyRequest{UserID: "user456", Code: codes[0].(string)}); status != fiber.StatusForbidden || result["reason"] != "user_locked" {
+		t.Errorf("locked user: status=%d, body=%v; want 403 user_locked", status, result)
+	}
+}
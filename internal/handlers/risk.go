@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/risk"
+)
+
+// evaluateRisk scores a challenge creation. Without a risk engine every request is allowed;
+// signal errors are logged and the partial score is used.
+func (h *Handlers) evaluateRisk(ctx context.Context, in risk.Input) risk.Decision {
+	if h.riskEngine == nil {
+		return risk.Decision{Action: risk.ActionAllow}
+	}
+	decision, err := h.riskEngine.Evaluate(ctx, in)
+	if err != nil {
+		h.log.Warn().Err(err).Msg("Risk evaluation incomplete")
+	}
+	if decision.Action == risk.ActionCaptcha && h.captchaVerifier == nil {
+		h.log.Warn().Int("score", decision.Score).Msg("Risk engine asked for a captcha but CAPTCHA_PROVIDER is not set")
+	}
+	return decision
+}
+
+// riskRejection returns the response for a decision that rejects the request, or nil when
+// the request may proceed. A step-up decision only rejects channels outside RISK_STRONG_CHANNELS.
+func riskRejection(decision risk.Decision, channel string) fiber.Map {
+	switch decision.Action {
+	case risk.ActionBlock:
+		return fiber.Map{
+			"ok":     false,
+			"reason": "risk_blocked",
+		}
+	case risk.ActionStepUp:
+		for _, strong := range config.RiskStrongChannels {
+			if strong == channel {
+				return nil
+			}
+		}
+		return fiber.Map{
+			"ok":               false,
+			"reason":           "stronger_channel_required",
+			"allowed_channels": config.RiskStrongChannels,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_CreateChallenge_Risk(t *testing.T) {
+	originalEnabled := config.RiskEnabled
+	originalCaptcha := config.RiskCaptchaScore
+	originalStepUp := config.RiskStepUpScore
+	originalBlock := config.RiskBlockScore
+	originalStrong := config.RiskStrongChannels
+	originalWeights := config.RiskWeights
+	originalVelocity := config.RiskIPVelocityLimit
+	originalRateLimitPerUser := config.RateLimitPerUser
+	originalRateLimitPerIP := config.RateLimitPerIP
+	defer func() {
+		config.RiskEnabled = originalEnabled
+		config.RiskCaptchaScore = originalCaptcha
+		config.RiskStepUpScore = originalStepUp
+		config.RiskBlockScore = originalBlock
+		config.RiskStrongChannels = originalStrong
+		config.RiskWeights = originalWeights
+		config.RiskIPVelocityLimit = originalVelocity
+		config.RateLimitPerUser = originalRateLimitPerUser
+		config.RateLimitPerIP = originalRateLimitPerIP
+	}()
+
+	// Only the new device (20) and ip velocity (40) signals score
+	config.RiskEnabled = true
+	config.RiskCaptchaScore = 0
+	config.RiskStepUpScore = 20
+	config.RiskBlockScore = 60
+	config.RiskStrongChannels = []string{"email"}
+	config.RiskWeights = []string{"new_device=20", "ip_velocity=40", "new_destination=0", "country_mismatch=0", "recent_failures=0"}
+	config.RiskIPVelocityLimit = 3
+	config.RateLimitPerUser = 100
+	config.RateLimitPerIP = 100
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(userID, channel, destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      userID,
+			Channel:     channel,
+			Destination: destination,
+			ClientIP:    "203.0.113.9",
+			UA:          "Mozilla/5.0",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	// New device: a weak channel must be upgraded
+	status, result := send("user1", "sms", "+8613800138000")
+	if status != fiber.StatusForbidden || result["reason"] != "stronger_channel_required" {
+		t.Errorf("sms from new device: status=%d, body=%v; want 403 stronger_channel_required", status, result)
+	}
+	if channels, _ := result["allowed_channels"].([]interface{}); len(channels) != 1 || channels[0] != "email" {
+		t.Errorf("allowed_channels = %v, want [email]", result["allowed_channels"])
+	}
+
+	// A strong channel passes the step-up
+	status, result = send("user1", "email", "user1@example.com")
+	if status != fiber.StatusOK {
+		t.Errorf("email from new device: status=%d, body=%v; want 200", status, result)
+	}
+
+	// Third request from the IP is within the limit; the fourth trips ip_velocity and is blocked
+	_, _ = send("user2", "email", "user2@example.com")
+	status, result = send("user3", "email", "user3@example.com")
+	if status != fiber.StatusForbidden || result["reason"] != "risk_blocked" {
+		t.Errorf("over ip velocity: status=%d, body=%v; want 403 risk_blocked", status, result)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	challengekit "github.com/soulteary/challenge-kit"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+// stepUpPurpose is the challenge purpose that proves a fresh OTP before sensitive TOTP changes
+const stepUpPurpose = "stepup"
+
+// verifiedStepUpKeyPrefix keeps verified step-up challenges, which the challenge store
+// ("otp:ch:") deletes once they are verified
+const verifiedStepUpKeyPrefix = "otp:stepup:"
+
+// Step-up check failures
+const (
+	reasonStepUpRequired = "stepup_required" // No challenge_id given
+	reasonStepUpInvalid  = "stepup_invalid"  // Unknown, expired, already used or another user's challenge
+)
+
+// verifiedStepUp is a verified step-up challenge, usable once within HERALD_TOTP_STEPUP_MAX_AGE
+type verifiedStepUp struct {
+	UserID     string `json:"user_id"`
+	VerifiedAt int64  `json:"verified_at"`
+}
+
+// recordStepUp remembers a verified step-up challenge when TOTP changes require one
+func (h *Handlers) recordStepUp(ctx context.Context, ch *challengekit.Challenge) {
+	if config.TOTPStepUpMaxAge <= 0 || ch.Purpose != stepUpPurpose {
+		return
+	}
+	data, err := json.Marshal(verifiedStepUp{UserID: ch.UserID, VerifiedAt: time.Now().Unix()})
+	if err != nil {
+		return
+	}
+	if err := h.redis.Set(ctx, verifiedStepUpKeyPrefix+ch.ID, data, config.TOTPStepUpMaxAge).Err(); err != nil {
+		h.log.Warn().Err(err).Msg("Failed to record verified step-up challenge")
+	}
+}
+
+// claimStepUp returns "" when challengeID is a step-up challenge userID verified within
+// HERALD_TOTP_STEPUP_MAX_AGE, otherwise the failure reason. A valid challenge is claimed
+// (deleted) before returning, so concurrent requests cannot spend it twice; call restore when
+// the change it allowed fails, to make it usable again for the rest of its lifetime.
+func (h *Handlers) claimStepUp(ctx context.Context, challengeID, userID string) (reason string, restore func(), err error) {
+	if challengeID == "" {
+		return reasonStepUpRequired, nil, nil
+	}
+	key := verifiedStepUpKeyPrefix + challengeID
+	data, err := h.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return reasonStepUpInvalid, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var v verifiedStepUp
+	if err := json.Unmarshal(data, &v); err != nil {
+		return reasonStepUpInvalid, nil, nil
+	}
+	if v.UserID != userID || time.Since(time.Unix(v.VerifiedAt, 0)) > config.TOTPStepUpMaxAge {
+		return reasonStepUpInvalid, nil, nil
+	}
+	// Only the request whose delete removed the key may use the challenge
+	n, err := h.redis.Del(ctx, key).Result()
+	if err != nil {
+		return "", nil, err
+	}
+	if n == 0 {
+		return reasonStepUpInvalid, nil, nil
+	}
+	restore = func() {
+		ttl := config.TOTPStepUpMaxAge - time.Since(time.Unix(v.VerifiedAt, 0))
+		if ttl <= 0 {
+			return
+		}
+		if err := h.redis.Set(context.WithoutCancel(ctx), key, data, ttl).Err(); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to restore step-up challenge")
+		}
+	}
+	return "", restore, nil
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	provider "github.com/soulteary/provider-kit"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/push"
+	"github.com/soulteary/herald/internal/template"
+)
+
+// renderedMessage is the text sent on a channel
+type renderedMessage struct {
+	Subject  string
+	Body     string
+	HTML     string // Email only, when the purpose has an HTML template
+	Template string // Key of the template file used; "" for built-in text
+	data     template.TemplateData
+}
+
+// renderMessage renders the message for channel; chat is set for HERALD_CHAT_CHANNELS channels
+func (h *Handlers) renderMessage(channel string, chat bool, locale, purpose string, data template.TemplateData) renderedMessage {
+	key := func(channel, purpose string) string {
+		return fmt.Sprintf("%s:%s:%s", locale, channel, purpose)
+	}
+	var m renderedMessage
+	switch {
+	case channel == string(push.Channel):
+		// Push text never contains the code
+		data = template.TemplateData{Purpose: purpose, Locale: locale}
+		body, err := h.templateManager.Render(locale, channel, purpose, data)
+		if err != nil {
+			h.log.Warn().Err(err).Msg("Failed to render push text")
+		}
+		m.Body = body
+		m.Template = h.templateManager.Lookup(key(channel, purpose), key(channel, "*"))
+	case channel == string(provider.ChannelEmail):
+		email, err := h.templateManager.RenderEmailParts(locale, purpose, data)
+		if err != nil {
+			// Fallback to built-in formatting from provider-kit
+			email.Subject, email.Text = provider.FormatVerificationEmail(data.Code, locale)
+		}
+		m.Subject, m.Body, m.HTML = email.Subject, email.Text, email.HTML
+		m.Template = h.templateManager.Lookup(key(channel, purpose))
+	case channel == string(ChannelVoice):
+		// Voice: text read out by the gateway's text-to-speech
+		data.SpokenCode = h.templateManager.SpokenCode(locale, data.Code)
+		body, err := h.templateManager.RenderVoice(locale, purpose, data)
+		if err != nil {
+			body = data.SpokenCode
+		}
+		m.Body = body
+		m.Template = h.templateManager.Lookup(key(channel, purpose))
+	case chat:
+		// Chat apps: locale:<channel>:purpose template, else the SMS text
+		body, err := h.templateManager.Render(locale, channel, purpose, data)
+		if err != nil {
+			body, _ = h.templateManager.RenderSMS(locale, purpose, data)
+		}
+		m.Body = body
+		m.Template = h.templateManager.Lookup(key(channel, purpose), key(channel, "*"), key("sms", purpose))
+	default:
+		// SMS, DingTalk and webhook: body only (DingTalk via herald-dingtalk receives body)
+		body, err := h.templateManager.RenderSMS(locale, purpose, data)
+		if err != nil {
+			// Fallback to built-in formatting from provider-kit
+			body = provider.FormatVerificationSMS(data.Code, locale)
+		}
+		m.Body = body
+		m.Template = h.templateManager.Lookup(key("sms", purpose))
+	}
+	m.data = data
+	return m
+}
+
+// ListTemplates handles GET /v1/templates: the template files loaded from TEMPLATE_DIR and the
+// files that failed validation
+func (h *Handlers) ListTemplates(c *fiber.Ctx) error {
+	report := h.templateManager.Report()
+	return c.JSON(fiber.Map{
+		"ok":        true,
+		"templates": report.Templates,
+		"invalid":   report.Invalid,
+		"loaded_at": report.LoadedAt,
+	})
+}
+
+// TemplatePreviewRequest represents the request to preview a message
+type TemplatePreviewRequest struct {
+	Channel string `json:"channel"`
+	Purpose string `json:"purpose"`
+	Locale  string `json:"locale"`
+	// Optional overrides of the sample data
+	Code         string            `json:"code"`
+	DisplayName  string            `json:"display_name"`
+	UA           string            `json:"ua"`
+	TemplateVars map[string]string `json:"template_vars"`
+}
+
+// PreviewTemplate handles POST /v1/templates/preview: renders the message a challenge would send,
+// with sample data, without sending anything
+func (h *Handlers) PreviewTemplate(c *fiber.Ctx) error {
+	var req TemplatePreviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+
+	channelDef, ok := h.channels.Get(req.Channel)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_channel",
+		})
+	}
+	if req.Purpose == "" {
+		req.Purpose = "login"
+	}
+	purposeValid := false
+	for _, allowed := range config.AllowedPurposes {
+		if allowed == req.Purpose {
+			purposeValid = true
+			break
+		}
+	}
+	if !purposeValid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_purpose",
+			"error":  fmt.Sprintf("Purpose must be one of: %s", strings.Join(config.AllowedPurposes, ", ")),
+		})
+	}
+	if len(req.DisplayName) > template.MaxVarValueLen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_template_vars",
+			"error":  fmt.Sprintf("display_name exceeds %d bytes", template.MaxVarValueLen),
+		})
+	}
+	if err := template.ValidateVars(req.TemplateVars); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_template_vars",
+			"error":  err.Error(),
+		})
+	}
+
+	data := h.templateManager.SampleData(req.Locale)
+	data.Purpose = req.Purpose
+	data.ExpiresIn = int(config.ChallengeExpiry.Seconds())
+	data.AppName = config.TemplateAppName
+	data.SupportURL = config.TemplateSupportURL
+	data.Vars = h.templateVars.Filter(req.Channel, req.Purpose, req.TemplateVars)
+	if req.Code != "" {
+		data.Code = req.Code
+	}
+	if req.DisplayName != "" {
+		data.UserDisplayName = req.DisplayName
+	}
+	if req.UA != "" {
+		data.Device = h.templateManager.Device(req.Locale, req.UA)
+	}
+
+	m := h.renderMessage(req.Channel, channelDef.Chat != nil, req.Locale, req.Purpose, data)
+	// Sending falls back to built-in text when a template fails; the preview reports the failure
+	if m.Template != "" {
+		if err := h.templateManager.Check(m.Template, m.data); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"ok":       false,
+				"reason":   "template_error",
+				"error":    err.Error(),
+				"template": m.Template,
+			})
+		}
+	}
+
+	response := fiber.Map{
+		"ok":       true,
+		"template": m.Template,
+		"body":     m.Body,
+	}
+	if m.Subject != "" {
+		response["subject"] = m.Subject
+	}
+	if m.HTML != "" {
+		response["html"] = m.HTML
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+// newTemplateTestApp serves the template endpoints with templates loaded from files
+func newTemplateTestApp(t *testing.T, files map[string]string) *fiber.App {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+
+	originalTemplateDir := config.TemplateDir
+	originalAppName := config.TemplateAppName
+	t.Cleanup(func() {
+		config.TemplateDir = originalTemplateDir
+		config.TemplateAppName = originalAppName
+	})
+	config.TemplateDir = dir
+	config.TemplateAppName = "Acme"
+
+	redisClient := testRedisClient(t)
+	t.Cleanup(func() {
+		_ = redisClient.Close()
+	})
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Get("/templates", handlers.ListTemplates)
+	app.Post("/templates/preview", handlers.PreviewTemplate)
+	return app
+}
+
+func doTemplateRequest(t *testing.T, app *fiber.App, method, path string, reqBody any) (int, map[string]interface{}) {
+	t.Helper()
+	var body io.Reader
+	if reqBody != nil {
+		bodyBytes, _ := json.Marshal(reqBody)
+		body = bytes.NewBuffer(bodyBytes)
+	}
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("Test request failed: %v", err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	var result map[string]interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", respBody, err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestHandlers_ListTemplates(t *testing.T) {
+	app := newTemplateTestApp(t, map[string]string{
+		"en/sms/login.txt":   "{{.AppName}} code {{.Code}}",
+		"en/email/login.txt": "Sign in\nCode {{.Code",
+	})
+
+	status, result := doTemplateRequest(t, app, "GET", "/templates", nil)
+	if status != fiber.StatusOK || result["ok"] != true {
+		t.Fatalf("status=%d, result=%v", status, result)
+	}
+	templates, _ := result["templates"].([]interface{})
+	if len(templates) != 1 || templates[0].(map[string]interface{})["key"] != "en:sms:login" {
+		t.Errorf("templates = %v, want en:sms:login", result["templates"])
+	}
+	invalid, _ := result["invalid"].([]interface{})
+	if len(invalid) != 1 || invalid[0].(map[string]interface{})["path"] != "en/email/login.txt" {
+		t.Errorf("invalid = %v, want en/email/login.txt", result["invalid"])
+	}
+}
+
+func TestHandlers_PreviewTemplate(t *testing.T) {
+	app := newTemplateTestApp(t, map[string]string{
+		"en/sms/login.txt": "{{.AppName}} code {{.Code}}{{if eq .Code \"000000\"}}{{.Code.Broken}}{{end}}",
+		"en/email/login.html": `{{define "subject"}}Sign in to {{.AppName}}{{end}}` +
+			`<html><head><style>.code { font-weight: bold }</style></head>` +
+			`<body><p>Hi {{.UserDisplayName}}</p><p class="code">{{.Code}}</p></body></html>`,
+	})
+
+	t.Run("sms", func(t *testing.T) {
+		status, result := doTemplateRequest(t, app, "POST", "/templates/preview", TemplatePreviewRequest{
+			Channel: "sms", Locale: "en", Code: "424242",
+		})
+		if status != fiber.StatusOK || result["template"] != "en:sms:login" || result["body"] != "Acme code 424242" {
+			t.Errorf("status=%d, result=%v", status, result)
+		}
+	})
+
+	t.Run("html email", func(t *testing.T) {
+		status, result := doTemplateRequest(t, app, "POST", "/templates/preview", TemplatePreviewRequest{
+			Channel: "email", Locale: "en", DisplayName: "Bob",
+		})
+		if status != fiber.StatusOK || result["template"] != "en:email:login" || result["subject"] != "Sign in to Acme" {
+			t.Fatalf("status=%d, result=%v", status, result)
+		}
+		html, _ := result["html"].(string)
+		if !strings.Contains(html, `style="font-weight: bold"`) || !strings.Contains(html, "Hi Bob") {
+			t.Errorf("html = %q", html)
+		}
+		if body, _ := result["body"].(string); !strings.Contains(body, "123456") {
+			t.Errorf("body = %q, want sample code", body)
+		}
+	})
+
+	t.Run("built-in text", func(t *testing.T) {
+		status, result := doTemplateRequest(t, app, "POST", "/templates/preview", TemplatePreviewRequest{
+			Channel: "sms", Locale: "zh-CN",
+		})
+		if status != fiber.StatusOK || result["template"] != "" || !strings.Contains(result["body"].(string), "123456") {
+			t.Errorf("status=%d, result=%v", status, result)
+		}
+	})
+
+	t.Run("template error", func(t *testing.T) {
+		status, result := doTemplateRequest(t, app, "POST", "/templates/preview", TemplatePreviewRequest{
+			Channel: "sms", Locale: "en", Code: "000000",
+		})
+		if status != fiber.StatusUnprocessableEntity || result["reason"] != "template_error" || result["template"] != "en:sms:login" {
+			t.Errorf("status=%d, result=%v, want 422 template_error", status, result)
+		}
+	})
+
+	for _, tt := range []struct {
+		name   string
+		req    TemplatePreviewRequest
+		reason string
+	}{
+		{"invalid channel", TemplatePreviewRequest{Channel: "fax"}, "invalid_channel"},
+		{"invalid purpose", TemplatePreviewRequest{Channel: "sms", Purpose: "nope"}, "invalid_purpose"},
+		{"invalid vars", TemplatePreviewRequest{Channel: "sms", TemplateVars: map[string]string{"bad-name": "x"}}, "invalid_template_vars"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			status, result := doTemplateRequest(t, app, "POST", "/templates/preview", tt.req)
+			if status != fiber.StatusBadRequest || result["reason"] != tt.reason {
+				t.Errorf("status=%d, result=%v, want 400 %s", status, result, tt.reason)
+			}
+		})
+	}
+}
@@ -2,13 +2,66 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 
 	"github.com/gofiber/fiber/v2"
+	qrcode "github.com/skip2/go-qrcode"
 
 	"github.com/soulteary/herald-totp/pkg/heraldtotp"
+
+	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/ratelimit"
+	"github.com/soulteary/herald/internal/totp"
 )
 
-// TOTPStatus proxies GET /v1/totp/status to herald-totp.
+// totpBackend serves the TOTP routes: the herald-totp client or the native engine
+// (internal/totp), selected by HERALD_TOTP_MODE
+type totpBackend interface {
+	Status(ctx context.Context, subject string) (*heraldtotp.StatusResponse, error)
+	Verify(ctx context.Context, req *heraldtotp.VerifyRequest) (*heraldtotp.VerifyResponse, error)
+	EnrollStart(ctx context.Context, req *heraldtotp.EnrollStartRequest) (*heraldtotp.EnrollStartResponse, error)
+	EnrollConfirm(ctx context.Context, req *heraldtotp.EnrollConfirmRequest) (*heraldtotp.EnrollConfirmResponse, error)
+	Revoke(ctx context.Context, subject string) (*heraldtotp.RevokeResponse, error)
+}
+
+// TOTPVerifyRequest is the herald-totp verify request plus the end user's IP
+type TOTPVerifyRequest struct {
+	heraldtotp.VerifyRequest
+	ClientIP  string `json:"client_ip"`  // Used for the per-IP limit and audit; defaults to the caller's IP
+	SessionID string `json:"session_id"` // Optional: record the verification in session storage
+}
+
+// TOTPEnrollConfirmRequest is the herald-totp enroll/confirm request plus the end user's IP
+type TOTPEnrollConfirmRequest struct {
+	heraldtotp.EnrollConfirmRequest
+	ClientIP string `json:"client_ip"`
+}
+
+// TOTPEnrollStartRequest is the herald-totp enroll/start request plus the step-up challenge
+type TOTPEnrollStartRequest struct {
+	heraldtotp.EnrollStartRequest
+	// ChallengeID is a verified "stepup" challenge of the subject, required to replace an
+	// enrolled authenticator when HERALD_TOTP_STEPUP_MAX_AGE is set
+	ChallengeID string `json:"challenge_id"`
+}
+
+// TOTPRevokeRequest revokes a subject's TOTP
+type TOTPRevokeRequest struct {
+	Subject     string `json:"subject"`
+	ChallengeID string `json:"challenge_id"` // Verified "stepup" challenge, required when HERALD_TOTP_STEPUP_MAX_AGE is set
+	ClientIP    string `json:"client_ip"`
+}
+
+// TOTPEnrollStartResponse adds the otpauth URI as a QR code PNG (base64) to the backend's response
+type TOTPEnrollStartResponse struct {
+	heraldtotp.EnrollStartResponse
+	QRPNG string `json:"qr_png,omitempty"`
+}
+
+// TOTPStatus handles GET /v1/totp/status (herald-totp proxy or native engine).
 func (h *Handlers) TOTPStatus(c *fiber.Ctx) error {
 	if h.totpClient == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -24,24 +77,16 @@ func (h *Handlers) TOTPStatus(c *fiber.Ctx) error {
 			"error":  "subject required",
 		})
 	}
-	ctx := c.UserContext()
-	if v := c.Locals("trace_context"); v != nil {
-		if cc, ok := v.(context.Context); ok {
-			ctx = cc
-		}
-	}
+	ctx := requestContext(c)
 	resp, err := h.totpClient.Status(ctx, subject)
 	if err != nil {
-		h.log.Warn().Err(err).Str("subject", subject).Msg("TOTP status proxy failed")
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"ok":     false,
-			"reason": "proxy_failed",
-		})
+		h.log.Warn().Err(err).Str("subject", subject).Msg("TOTP status failed")
+		return h.totpError(c, err)
 	}
 	return c.JSON(resp)
 }
 
-// TOTPVerify proxies POST /v1/totp/verify to herald-totp.
+// TOTPVerify handles POST /v1/totp/verify (herald-totp proxy or native engine).
 func (h *Handlers) TOTPVerify(c *fiber.Ctx) error {
 	if h.totpClient == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -49,7 +94,7 @@ func (h *Handlers) TOTPVerify(c *fiber.Ctx) error {
 			"reason": "totp_not_configured",
 		})
 	}
-	var req heraldtotp.VerifyRequest
+	var req TOTPVerifyRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":     false,
@@ -64,28 +109,54 @@ func (h *Handlers) TOTPVerify(c *fiber.Ctx) error {
 			"error":  "subject and code required",
 		})
 	}
-	ctx := c.UserContext()
-	if v := c.Locals("trace_context"); v != nil {
-		if cc, ok := v.(context.Context); ok {
-			ctx = cc
+	ctx := requestContext(c)
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = c.IP()
+	}
+
+	// Limit guessing per subject and per client IP
+	for _, limit := range []struct {
+		key   string
+		limit int
+	}{
+		{"subject:" + req.Subject, config.TOTPVerifyLimitPerSubject},
+		{"ip:" + clientIP, config.TOTPVerifyLimitPerIP},
+	} {
+		allowed, _, _, err := h.rateLimitManager.CheckScopedRateLimit(ctx, ratelimit.ScopeTOTP, limit.key, limit.limit, config.TOTPVerifyWindow)
+		if err != nil {
+			h.log.Error().Err(err).Msg("Rate limit check failed")
+		}
+		if !allowed {
+			metrics.RecordRateLimitHit("totp")
+			auditlog.LogTOTPFailed(ctx, req.Subject, "rate_limit_exceeded", clientIP)
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "rate_limit_exceeded",
+			})
 		}
 	}
-	resp, err := h.totpClient.Verify(ctx, &req)
+
+	resp, err := h.totpClient.Verify(ctx, &req.VerifyRequest)
 	if err != nil {
-		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP verify proxy failed")
-		// Return 200 with ok:false when verify fails (same as herald-totp)
-		if resp != nil {
+		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP verify failed")
+		// Return 200 with ok:false when the code is rejected (reason from the backend)
+		if resp != nil && !totpUnavailable(err) {
+			auditlog.LogTOTPFailed(ctx, req.Subject, resp.Reason, clientIP)
 			return c.JSON(resp)
 		}
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"ok":     false,
-			"reason": "proxy_failed",
-		})
+		return h.totpError(c, err)
+	}
+	if resp.OK {
+		auditlog.LogTOTPVerified(ctx, req.Subject, clientIP)
+		h.recordSessionVerification(ctx, req.SessionID, req.Subject, []string{"otp"}) // RFC 8176: TOTP is a one-time password
+	} else {
+		auditlog.LogTOTPFailed(ctx, req.Subject, resp.Reason, clientIP)
 	}
 	return c.JSON(resp)
 }
 
-// TOTPEnrollStart proxies POST /v1/totp/enroll/start to herald-totp.
+// TOTPEnrollStart handles POST /v1/totp/enroll/start (herald-totp proxy or native engine).
 func (h *Handlers) TOTPEnrollStart(c *fiber.Ctx) error {
 	if h.totpClient == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -93,7 +164,7 @@ func (h *Handlers) TOTPEnrollStart(c *fiber.Ctx) error {
 			"reason": "totp_not_configured",
 		})
 	}
-	var req heraldtotp.EnrollStartRequest
+	var req TOTPEnrollStartRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":     false,
@@ -108,24 +179,41 @@ func (h *Handlers) TOTPEnrollStart(c *fiber.Ctx) error {
 			"error":  "subject required",
 		})
 	}
-	ctx := c.UserContext()
-	if v := c.Locals("trace_context"); v != nil {
-		if cc, ok := v.(context.Context); ok {
-			ctx = cc
+	ctx := requestContext(c)
+	// Replacing an enrolled authenticator requires a fresh step-up OTP
+	restoreStepUp := func() {}
+	if config.TOTPStepUpMaxAge > 0 {
+		status, err := h.totpClient.Status(ctx, req.Subject)
+		if err != nil {
+			h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP status failed")
+			return h.totpError(c, err)
+		}
+		if status.TotpEnabled {
+			restore, ok, err := h.requireTOTPStepUp(ctx, c, req.ChallengeID, req.Subject)
+			if !ok {
+				return err
+			}
+			restoreStepUp = restore
 		}
 	}
-	resp, err := h.totpClient.EnrollStart(ctx, &req)
+	resp, err := h.totpClient.EnrollStart(ctx, &req.EnrollStartRequest)
 	if err != nil {
-		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP enroll/start proxy failed")
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
-			"ok":     false,
-			"reason": "proxy_failed",
-		})
+		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP enroll/start failed")
+		restoreStepUp()
+		return h.totpError(c, err)
 	}
-	return c.JSON(resp)
+	out := TOTPEnrollStartResponse{EnrollStartResponse: *resp}
+	if config.TOTPQRSize > 0 && resp.OtpauthURI != "" {
+		if png, err := qrcode.Encode(resp.OtpauthURI, qrcode.Medium, config.TOTPQRSize); err != nil {
+			h.log.Warn().Err(err).Msg("Failed to render TOTP enrollment QR code")
+		} else {
+			out.QRPNG = base64.StdEncoding.EncodeToString(png)
+		}
+	}
+	return c.JSON(out)
 }
 
-// TOTPEnrollConfirm proxies POST /v1/totp/enroll/confirm to herald-totp.
+// TOTPEnrollConfirm handles POST /v1/totp/enroll/confirm (herald-totp proxy or native engine).
 func (h *Handlers) TOTPEnrollConfirm(c *fiber.Ctx) error {
 	if h.totpClient == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -133,7 +221,7 @@ func (h *Handlers) TOTPEnrollConfirm(c *fiber.Ctx) error {
 			"reason": "totp_not_configured",
 		})
 	}
-	var req heraldtotp.EnrollConfirmRequest
+	var req TOTPEnrollConfirmRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":     false,
@@ -148,25 +236,23 @@ func (h *Handlers) TOTPEnrollConfirm(c *fiber.Ctx) error {
 			"error":  "enroll_id and code required",
 		})
 	}
-	ctx := c.UserContext()
-	if v := c.Locals("trace_context"); v != nil {
-		if cc, ok := v.(context.Context); ok {
-			ctx = cc
-		}
-	}
-	resp, err := h.totpClient.EnrollConfirm(ctx, &req)
+	ctx := requestContext(c)
+	resp, err := h.totpClient.EnrollConfirm(ctx, &req.EnrollConfirmRequest)
 	if err != nil {
-		h.log.Warn().Err(err).Str("enroll_id", req.EnrollID).Msg("TOTP enroll/confirm proxy failed")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"ok":     false,
-			"reason": "invalid",
-			"error":  err.Error(),
-		})
+		h.log.Warn().Err(err).Str("enroll_id", req.EnrollID).Msg("TOTP enroll/confirm failed")
+		return h.totpError(c, err)
+	}
+	if resp.TotpEnabled {
+		clientIP := req.ClientIP
+		if clientIP == "" {
+			clientIP = c.IP()
+		}
+		auditlog.LogTOTPEnrolled(ctx, resp.Subject, clientIP)
 	}
 	return c.JSON(resp)
 }
 
-// TOTPRevoke proxies POST /v1/totp/revoke to herald-totp.
+// TOTPRevoke handles POST /v1/totp/revoke (herald-totp proxy or native engine).
 func (h *Handlers) TOTPRevoke(c *fiber.Ctx) error {
 	if h.totpClient == nil {
 		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -174,9 +260,7 @@ func (h *Handlers) TOTPRevoke(c *fiber.Ctx) error {
 			"reason": "totp_not_configured",
 		})
 	}
-	var req struct {
-		Subject string `json:"subject"`
-	}
+	var req TOTPRevokeRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"ok":     false,
@@ -191,19 +275,80 @@ func (h *Handlers) TOTPRevoke(c *fiber.Ctx) error {
 			"error":  "subject required",
 		})
 	}
-	ctx := c.UserContext()
-	if v := c.Locals("trace_context"); v != nil {
-		if cc, ok := v.(context.Context); ok {
-			ctx = cc
+	ctx := requestContext(c)
+	restoreStepUp := func() {}
+	if config.TOTPStepUpMaxAge > 0 {
+		restore, ok, err := h.requireTOTPStepUp(ctx, c, req.ChallengeID, req.Subject)
+		if !ok {
+			return err
 		}
+		restoreStepUp = restore
 	}
 	resp, err := h.totpClient.Revoke(ctx, req.Subject)
 	if err != nil {
-		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP revoke proxy failed")
-		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+		h.log.Warn().Err(err).Str("subject", req.Subject).Msg("TOTP revoke failed")
+		restoreStepUp()
+		return h.totpError(c, err)
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = c.IP()
+	}
+	auditlog.LogTOTPRevoked(ctx, req.Subject, clientIP)
+	return c.JSON(resp)
+}
+
+// requireTOTPStepUp claims the step-up challenge of a TOTP change and returns the function
+// that makes it usable again if the change fails. When it is missing or not valid, it writes
+// the 403 response and returns false with the write error.
+func (h *Handlers) requireTOTPStepUp(ctx context.Context, c *fiber.Ctx, challengeID, subject string) (func(), bool, error) {
+	reason, restore, err := h.claimStepUp(ctx, challengeID, subject)
+	if err != nil {
+		h.log.Error().Err(err).Msg("Failed to check step-up challenge")
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"ok":     false,
-			"reason": "proxy_failed",
+			"reason": "internal_error",
 		})
 	}
-	return c.JSON(resp)
+	if reason != "" {
+		return nil, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"ok":     false,
+			"reason": reason,
+		})
+	}
+	return restore, true, nil
+}
+
+// totpUnavailable reports whether err means herald-totp could not answer (as opposed to
+// rejecting the request)
+func totpUnavailable(err error) bool {
+	var pe *totp.ProxyError
+	return errors.Is(err, totp.ErrCircuitOpen) || (errors.As(err, &pe) && !pe.Rejected())
+}
+
+// totpError maps a TOTP backend failure to a response. herald-totp rejections (4xx) keep
+// their status and reason code; an open circuit breaker is 503 totp_unavailable and other
+// herald-totp failures 502 proxy_failed.
+func (h *Handlers) totpError(c *fiber.Ctx, err error) error {
+	status, reason := fiber.StatusInternalServerError, "internal_error"
+	var pe *totp.ProxyError
+	switch {
+	case errors.Is(err, totp.ErrCircuitOpen):
+		status, reason = fiber.StatusServiceUnavailable, "totp_unavailable"
+	case errors.As(err, &pe) && pe.Rejected():
+		status, reason = pe.Status, pe.Reason
+		if reason == "" {
+			reason = "invalid_request"
+		}
+	case errors.As(err, &pe):
+		status, reason = fiber.StatusBadGateway, "proxy_failed"
+	case errors.Is(err, totp.ErrInvalidCode), errors.Is(err, totp.ErrEnrollmentNotFound):
+		status, reason = fiber.StatusBadRequest, totp.ReasonInvalid
+	case errors.Is(err, totp.ErrReplay):
+		status, reason = fiber.StatusBadRequest, totp.ReasonReplay
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"ok":     false,
+		"reason": reason,
+	})
 }
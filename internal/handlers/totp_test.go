@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	challengekit "github.com/soulteary/challenge-kit"
+	sessionkit "github.com/soulteary/session-kit"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/totp"
+)
+
+func TestHandlers_TOTPNative(t *testing.T) {
+	originalEnabled, originalMode, originalKey := config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey
+	defer func() {
+		config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey = originalEnabled, originalMode, originalKey
+	}()
+	config.TOTPEnabled = true
+	config.TOTPMode = "native"
+	config.TOTPEncryptionKey = strings.Repeat("ab", 32)
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	sessions := sessionkit.NewKVManager(sessionkit.NewRedisStore(redisClient, "session:"), time.Hour)
+	handlers := NewHandlers(redisClient, sessions, testLogger())
+	engine, ok := handlers.totpClient.(*totp.Engine)
+	if !ok {
+		t.Fatalf("totpClient = %T, want *totp.Engine", handlers.totpClient)
+	}
+
+	app := fiber.New()
+	app.Get("/status", handlers.TOTPStatus)
+	app.Post("/verify", handlers.TOTPVerify)
+	app.Post("/enroll/start", handlers.TOTPEnrollStart)
+	app.Post("/enroll/confirm", handlers.TOTPEnrollConfirm)
+	app.Post("/revoke", handlers.TOTPRevoke)
+
+	do := func(method, path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+
+	status, result := do("POST", "/enroll/start", map[string]string{"subject": "user123", "label": "alice"})
+	if status != fiber.StatusOK || result["enroll_id"] == nil {
+		t.Fatalf("enroll/start: status=%d, body=%v", status, result)
+	}
+	if uri, _ := result["otpauth_uri"].(string); !strings.HasPrefix(uri, "otpauth://totp/Herald:alice?") {
+		t.Errorf("otpauth_uri = %s", uri)
+	}
+	if png, err := base64.StdEncoding.DecodeString(result["qr_png"].(string)); err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Errorf("qr_png is not a PNG: %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(result["secret_base32"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, result := do("POST", "/enroll/confirm", map[string]string{"enroll_id": result["enroll_id"].(string), "code": engine.Code(secret, time.Now())}); status != fiber.StatusOK || result["totp_enabled"] != true {
+		t.Fatalf("enroll/confirm: status=%d, body=%v", status, result)
+	}
+	if status, result := do("GET", "/status?subject=user123", nil); status != fiber.StatusOK || result["totp_enabled"] != true {
+		t.Errorf("status: status=%d, body=%v", status, result)
+	}
+
+	// The confirmation code was used; the next step's code is accepted once
+	if status, result := do("POST", "/verify", map[string]string{"subject": "user123", "code": engine.Code(secret, time.Now())}); status != fiber.StatusOK || result["ok"] != false || result["reason"] != totp.ReasonReplay {
+		t.Errorf("verify replay: status=%d, body=%v", status, result)
+	}
+	next := engine.Code(secret, time.Now().Add(config.TOTPPeriod))
+	if status, result := do("POST", "/verify", map[string]string{"subject": "user123", "code": next, "session_id": "sess_totp"}); status != fiber.StatusOK || result["ok"] != true {
+		t.Errorf("verify: status=%d, body=%v", status, result)
+	}
+	rec, err := sessions.Get(context.Background(), "sess_totp")
+	if err != nil || rec == nil {
+		t.Fatalf("session after verify: %v, %v", rec, err)
+	}
+	if amr, _ := json.Marshal(rec.Data[sessionAMR]); rec.Data[sessionUserID] != "user123" || string(amr) != `["otp"]` {
+		t.Errorf("session after verify = %v", rec.Data)
+	}
+
+	if status, result := do("POST", "/revoke", map[string]string{"subject": "user123"}); status != fiber.StatusOK || result["ok"] != true {
+		t.Errorf("revoke: status=%d, body=%v", status, result)
+	}
+	if status, result := do("GET", "/status?subject=user123", nil); status != fiber.StatusOK || result["totp_enabled"] != false {
+		t.Errorf("status after revoke: status=%d, body=%v", status, result)
+	}
+}
+
+func TestHandlers_TOTPProxyErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/verify":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"ok":false,"reason":"invalid"}`))
+		case "/v1/enroll/start":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"reason":"rate_limited"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"ok":false,"reason":"internal_error"}`))
+		}
+	}))
+	defer srv.Close()
+
+	originalEnabled, originalMode, originalURL := config.TOTPEnabled, config.TOTPMode, config.TOTPBaseURL
+	originalRetries, originalThreshold := config.TOTPMaxRetries, config.TOTPBreakerThreshold
+	defer func() {
+		config.TOTPEnabled, config.TOTPMode, config.TOTPBaseURL = originalEnabled, originalMode, originalURL
+		config.TOTPMaxRetries, config.TOTPBreakerThreshold = originalRetries, originalThreshold
+	}()
+	config.TOTPEnabled = true
+	config.TOTPMode = "proxy"
+	config.TOTPBaseURL = srv.URL
+	config.TOTPMaxRetries = 0
+	config.TOTPBreakerThreshold = 1
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Get("/status", handlers.TOTPStatus)
+	app.Post("/verify", handlers.TOTPVerify)
+	app.Post("/enroll/start", handlers.TOTPEnrollStart)
+	app.Post("/revoke", handlers.TOTPRevoke)
+
+	do := func(method, path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+
+	// A rejected code stays 200 with herald-totp's reason
+	if status, result := do("POST", "/verify", map[string]string{"subject": "user123", "code": "123456"}); status != fiber.StatusOK || result["reason"] != "invalid" {
+		t.Errorf("verify: status=%d, body=%v", status, result)
+	}
+	// Other rejections keep herald-totp's status and reason
+	if status, result := do("POST", "/enroll/start", map[string]string{"subject": "user123"}); status != fiber.StatusTooManyRequests || result["reason"] != "rate_limited" {
+		t.Errorf("enroll/start: status=%d, body=%v", status, result)
+	}
+	// A herald-totp failure opens the circuit (threshold 1)
+	if status, result := do("GET", "/status?subject=user123", nil); status != fiber.StatusBadGateway || result["reason"] != "proxy_failed" {
+		t.Errorf("status: status=%d, body=%v", status, result)
+	}
+	if status, result := do("POST", "/revoke", map[string]string{"subject": "user123"}); status != fiber.StatusServiceUnavailable || result["reason"] != "totp_unavailable" {
+		t.Errorf("revoke with open circuit: status=%d, body=%v", status, result)
+	}
+}
+
+func TestHandlers_TOTPVerifyRateLimit(t *testing.T) {
+	originalEnabled, originalMode, originalKey := config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey
+	originalSubject, originalIP := config.TOTPVerifyLimitPerSubject, config.TOTPVerifyLimitPerIP
+	defer func() {
+		config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey = originalEnabled, originalMode, originalKey
+		config.TOTPVerifyLimitPerSubject, config.TOTPVerifyLimitPerIP = originalSubject, originalIP
+	}()
+	config.TOTPEnabled = true
+	config.TOTPMode = "native"
+	config.TOTPEncryptionKey = strings.Repeat("ab", 32)
+	config.TOTPVerifyLimitPerSubject = 2
+	config.TOTPVerifyLimitPerIP = 3
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/verify", handlers.TOTPVerify)
+
+	verify := func(subject, clientIP string) (int, string) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(map[string]string{"subject": subject, "code": "123456", "client_ip": clientIP})
+		req := httptest.NewRequest("POST", "/verify", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		var result map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		reason, _ := result["reason"].(string)
+		return resp.StatusCode, reason
+	}
+
+	tests := []struct {
+		subject, clientIP string
+		wantStatus        int
+		wantReason        string
+	}{
+		{"user1", "203.0.113.1", fiber.StatusOK, totp.ReasonInvalid},
+		{"user1", "203.0.113.1", fiber.StatusOK, totp.ReasonInvalid},
+		{"user1", "203.0.113.1", fiber.StatusTooManyRequests, "rate_limit_exceeded"}, // Subject limit
+		{"user2", "203.0.113.1", fiber.StatusOK, totp.ReasonInvalid},
+		{"user3", "203.0.113.1", fiber.StatusTooManyRequests, "rate_limit_exceeded"}, // IP limit
+		{"user3", "203.0.113.2", fiber.StatusOK, totp.ReasonInvalid},
+	}
+	for i, tt := range tests {
+		if status, reason := verify(tt.subject, tt.clientIP); status != tt.wantStatus || reason != tt.wantReason {
+			t.Errorf("request %d (%s from %s): status=%d reason=%s, want %d %s", i, tt.subject, tt.clientIP, status, reason, tt.wantStatus, tt.wantReason)
+		}
+	}
+}
+
+func TestHandlers_TOTPStepUp(t *testing.T) {
+	originalEnabled, originalMode, originalKey := config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey
+	originalMaxAge := config.TOTPStepUpMaxAge
+	defer func() {
+		config.TOTPEnabled, config.TOTPMode, config.TOTPEncryptionKey = originalEnabled, originalMode, originalKey
+		config.TOTPStepUpMaxAge = originalMaxAge
+	}()
+	config.TOTPEnabled = true
+	config.TOTPMode = "native"
+	config.TOTPEncryptionKey = strings.Repeat("ab", 32)
+	config.TOTPStepUpMaxAge = 5 * time.Minute
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	handlers := NewHandlers(redisClient, nil, testLogger())
+	engine := handlers.totpClient.(*totp.Engine)
+	challengeMgr := testChallengeManager(t, redisClient)
+
+	app := fiber.New()
+	app.Post("/verify", handlers.VerifyChallenge)
+	app.Post("/enroll/start", handlers.TOTPEnrollStart)
+	app.Post("/enroll/confirm", handlers.TOTPEnrollConfirm)
+	app.Post("/revoke", handlers.TOTPRevoke)
+
+	do := func(path string, payload interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+	// verified creates and verifies a challenge, returning its ID
+	verified := func(userID, purpose string) string {
+		t.Helper()
+		ch, code, err := challengeMgr.Create(context.Background(), challengekit.CreateRequest{
+			UserID:      userID,
+			Channel:     challengekit.ChannelEmail,
+			Destination: "test@example.com",
+			Purpose:     purpose,
+			ClientIP:    "127.0.0.1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create challenge: %v", err)
+		}
+		if status, result := do("/verify", VerifyChallengeRequest{ChallengeID: ch.ID, Code: code}); status != fiber.StatusOK {
+			t.Fatalf("verify: status=%d, body=%v", status, result)
+		}
+		return ch.ID
+	}
+
+	// The first enrollment needs no step-up
+	status, result := do("/enroll/start", map[string]string{"subject": "user123"})
+	if status != fiber.StatusOK {
+		t.Fatalf("first enroll/start: status=%d, body=%v", status, result)
+	}
+	secret, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(result["secret_base32"].(string))
+	if status, result := do("/enroll/confirm", map[string]string{"enroll_id": result["enroll_id"].(string), "code": engine.Code(secret, time.Now())}); status != fiber.StatusOK {
+		t.Fatalf("enroll/confirm: status=%d, body=%v", status, result)
+	}
+
+	if status, result := do("/enroll/start", map[string]string{"subject": "user123"}); status != fiber.StatusForbidden || result["reason"] != reasonStepUpRequired {
+		t.Errorf("re-enroll without step-up: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/revoke", map[string]string{"subject": "user123"}); status != fiber.StatusForbidden || result["reason"] != reasonStepUpRequired {
+		t.Errorf("revoke without step-up: status=%d, body=%v", status, result)
+	}
+	for name, challengeID := range map[string]string{
+		"login purpose": verified("user123", "login"),
+		"other user":    verified("other", stepUpPurpose),
+		"unknown":       "ch_unknown",
+	} {
+		if status, result := do("/revoke", map[string]string{"subject": "user123", "challenge_id": challengeID}); status != fiber.StatusForbidden || result["reason"] != reasonStepUpInvalid {
+			t.Errorf("revoke with %s challenge: status=%d, body=%v", name, status, result)
+		}
+	}
+
+	// A step-up challenge authorizes one change
+	challengeID := verified("user123", stepUpPurpose)
+	if status, result := do("/enroll/start", map[string]string{"subject": "user123", "challenge_id": challengeID}); status != fiber.StatusOK {
+		t.Errorf("re-enroll with step-up: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/revoke", map[string]string{"subject": "user123", "challenge_id": challengeID}); status != fiber.StatusForbidden || result["reason"] != reasonStepUpInvalid {
+		t.Errorf("revoke with used step-up: status=%d, body=%v", status, result)
+	}
+	if status, result := do("/revoke", map[string]string{"subject": "user123", "challenge_id": verified("user123", stepUpPurpose)}); status != fiber.StatusOK || result["ok"] != true {
+		t.Errorf("revoke with step-up: status=%d, body=%v", status, result)
+	}
+}
+
+func TestHandlers_ClaimStepUp(t *testing.T) {
+	originalMaxAge := config.TOTPStepUpMaxAge
+	defer func() { config.TOTPStepUpMaxAge = originalMaxAge }()
+	config.TOTPStepUpMaxAge = 5 * time.Minute
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	handlers := NewHandlers(redisClient, nil, testLogger())
+	ctx := context.Background()
+	handlers.recordStepUp(ctx, &challengekit.Challenge{ID: "ch_1", UserID: "user123", Purpose: stepUpPurpose})
+
+	// Concurrent requests with the same challenge: exactly one claims it
+	var claimed atomic.Int32
+	var restore func()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reason, r, err := handlers.claimStepUp(ctx, "ch_1", "user123")
+			if err == nil && reason == "" {
+				claimed.Add(1)
+				mu.Lock()
+				restore = r
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n := claimed.Load(); n != 1 {
+		t.Fatalf("claimStepUp succeeded %d times, want 1", n)
+	}
+
+	// A failed change gives the challenge back
+	restore()
+	if reason, _, err := handlers.claimStepUp(ctx, "ch_1", "user123"); err != nil || reason != "" {
+		t.Errorf("claimStepUp() after restore = %q, %v", reason, err)
+	}
+	if reason, _, _ := handlers.claimStepUp(ctx, "ch_1", "user123"); reason != reasonStepUpInvalid {
+		t.Errorf("claimStepUp() again = %q, want %q", reason, reasonStepUpInvalid)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/events"
+)
+
+// GetUserLock handles GET /v1/users/:id/lock and reports whether the user is locked, why and until when.
+func (h *Handlers) GetUserLock(c *fiber.Ctx) error {
+	userID := c.Params("id")
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	lock, err := h.lockoutManager.Get(requestContext(c), userID)
+	if err != nil {
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to load user lock")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	if lock == nil {
+		return c.JSON(fiber.Map{
+			"ok":      true,
+			"user_id": userID,
+			"locked":  false,
+		})
+	}
+
+	response := fiber.Map{
+		"ok":         true,
+		"user_id":    userID,
+		"locked":     true,
+		"reason":     lock.Reason,
+		"expires_at": lock.ExpiresAt.Unix(),
+		"expires_in": int(time.Until(lock.ExpiresAt).Round(time.Second).Seconds()),
+	}
+	if lock.Level > 0 {
+		response["level"] = lock.Level
+		response["locked_at"] = lock.LockedAt.Unix()
+	}
+	return c.JSON(response)
+}
+
+// UnlockUser handles POST /v1/users/:id/unlock (administrative unlock).
+// Earlier lockouts still count towards escalation until LOCKOUT_ESCALATION_WINDOW passes.
+func (h *Handlers) UnlockUser(c *fiber.Ctx) error {
+	// Copied: the audit record and event notification outlive fiber's request buffer
+	userID := strings.Clone(c.Params("id"))
+	if userID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	ctx := requestContext(c)
+	if err := h.lockoutManager.Unlock(ctx, userID); err != nil {
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to unlock user")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+
+	h.log.Info().Str("user_id", userID).Msg("User unlocked")
+	auditlog.LogUserUnlocked(ctx, userID, c.IP())
+	h.eventNotifier.Notify(events.Event{
+		Type:   events.TypeUserUnlocked,
+		UserID: userID,
+	})
+
+	return c.JSON(fiber.Map{
+		"ok": true,
+	})
+}
+
+// lockUser applies an escalating lockout and emits the audit record and event webhook for new locks
+func (h *Handlers) lockUser(ctx context.Context, userID, reason, ip string) {
+	lock, created, err := h.lockoutManager.Lock(ctx, userID, reason)
+	if err != nil {
+		h.log.Warn().Err(err).Str("user_id", userID).Msg("Failed to apply escalating lockout")
+	}
+	if lock == nil || !created {
+		return
+	}
+
+	h.log.Warn().
+		Str("user_id", userID).
+		Str("reason", reason).
+		Int("level", lock.Level).
+		Time("expires_at", lock.ExpiresAt).
+		Msg("User locked")
+	auditlog.LogUserLocked(ctx, userID, reason, lock.Level, lock.ExpiresAt, ip)
+	h.eventNotifier.Notify(events.Event{
+		Type:   events.TypeUserLocked,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"reason":     reason,
+			"level":      lock.Level,
+			"expires_at": lock.ExpiresAt.Unix(),
+		},
+	})
+}
+
+// requestContext returns the trace context set by middleware, falling back to the user context
+func requestContext(c *fiber.Ctx) context.Context {
+	if v := c.Locals("trace_context"); v != nil {
+		if cc, ok := v.(context.Context); ok {
+			return cc
+		}
+	}
+	return c.UserContext()
+}
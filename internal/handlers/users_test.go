@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	challengekit "github.com/soulteary/challenge-kit"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_UserLock_EscalatesAndUnlocks(t *testing.T) {
+	originalMaxAttempts := config.MaxAttempts
+	originalLockoutDuration := config.LockoutDuration
+	originalLockoutMaxDuration := config.LockoutMaxDuration
+	defer func() {
+		config.MaxAttempts = originalMaxAttempts
+		config.LockoutDuration = originalLockoutDuration
+		config.LockoutMaxDuration = originalLockoutMaxDuration
+	}()
+
+	config.MaxAttempts = 2
+	config.LockoutDuration = 10 * time.Minute
+	config.LockoutMaxDuration = 24 * time.Hour
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/verify", handlers.VerifyChallenge)
+	app.Get("/users/:id/lock", handlers.GetUserLock)
+	app.Post("/users/:id/unlock", handlers.UnlockUser)
+
+	challengeMgr := challengekit.NewManager(redisClient, challengekit.Config{
+		Expiry:      5 * time.Minute,
+		MaxAttempts: config.MaxAttempts,
+		CodeLength:  6,
+	})
+
+	do := func(method, path string, body interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(b)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatalf("Failed to unmarshal response %s: %v", string(raw), err)
+		}
+		return resp.StatusCode, result
+	}
+
+	exhaust := func() string {
+		t.Helper()
+		ch, _, err := challengeMgr.Create(context.Background(), challengekit.CreateRequest{
+			UserID:      "locked_user",
+			Channel:     challengekit.ChannelEmail,
+			Destination: "locked@example.com",
+			Purpose:     "login",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create challenge: %v", err)
+		}
+		var last map[string]interface{}
+		for i := 0; i < config.MaxAttempts; i++ {
+			_, last = do("POST", "/verify", VerifyChallengeRequest{ChallengeID: ch.ID, Code: "000000"})
+		}
+		if last["reason"] != "locked" {
+			t.Fatalf("Expected reason=locked after max attempts, got %v", last["reason"])
+		}
+		return ch.ID
+	}
+
+	// Not locked yet
+	_, result := do("GET", "/users/locked_user/lock", nil)
+	if result["locked"] != false {
+		t.Fatalf("Expected locked=false, got %v", result)
+	}
+
+	// First lockout uses the base duration
+	exhausted := exhaust()
+	_, result = do("GET", "/users/locked_user/lock", nil)
+	if result["locked"] != true || result["reason"] != "max_attempts" || result["level"] != float64(1) {
+		t.Fatalf("Unexpected first lock: %v", result)
+	}
+	if in, _ := result["expires_in"].(float64); in <= 0 || in > 600 {
+		t.Errorf("First lock expires_in = %v, want within (0, 600]", result["expires_in"])
+	}
+
+	// Admin unlock
+	status, result := do("POST", "/users/locked_user/unlock", nil)
+	if status != fiber.StatusOK || result["ok"] != true {
+		t.Fatalf("Unlock failed: status=%d, body=%v", status, result)
+	}
+	_, result = do("GET", "/users/locked_user/lock", nil)
+	if result["locked"] != false {
+		t.Fatalf("Expected locked=false after unlock, got %v", result)
+	}
+
+	// The exhausted challenge was revoked: retrying it does not lock the user again
+	if _, result = do("POST", "/verify", VerifyChallengeRequest{ChallengeID: exhausted, Code: "000000"}); result["reason"] == "locked" {
+		t.Fatalf("Retrying the exhausted challenge returned %v", result)
+	}
+	_, result = do("GET", "/users/locked_user/lock", nil)
+	if result["locked"] != false {
+		t.Fatalf("Expected locked=false after retrying the exhausted challenge, got %v", result)
+	}
+
+	// Second lockout within the window doubles the duration
+	exhaust()
+	_, result = do("GET", "/users/locked_user/lock", nil)
+	if result["level"] != float64(2) {
+		t.Fatalf("Expected level=2, got %v", result)
+	}
+	if in, _ := result["expires_in"].(float64); in <= 600 || in > 1200 {
+		t.Errorf("Second lock expires_in = %v, want within (600, 1200]", result["expires_in"])
+	}
+}
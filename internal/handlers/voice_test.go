@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+)
+
+func TestHandlers_CreateChallenge_Voice(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		dests  []string
+	)
+	voice := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			To   string `json:"to"`
+			Body string `json:"body"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		dests = append(dests, body.To)
+		bodies = append(bodies, body.Body)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"message_id":"call1"}`))
+	}))
+	defer voice.Close()
+
+	originalProvider := config.VoiceProvider
+	originalBaseURL := config.VoiceAPIBaseURL
+	originalRegion := config.DestinationDefaultRegion
+	defer func() {
+		config.VoiceProvider = originalProvider
+		config.VoiceAPIBaseURL = originalBaseURL
+		config.DestinationDefaultRegion = originalRegion
+	}()
+
+	config.VoiceProvider = "test-voice"
+	config.VoiceAPIBaseURL = voice.URL
+	config.DestinationDefaultRegion = "CN"
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      "user123",
+			Channel:     "voice",
+			Destination: destination,
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	status, result := send("138 0013 8000")
+	if status != fiber.StatusOK {
+		t.Fatalf("voice challenge: status=%d, body=%v; want 200", status, result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 1 {
+		t.Fatalf("voice provider calls = %d, want 1", len(bodies))
+	}
+	if dests[0] != "+8613800138000" {
+		t.Errorf("voice destination = %q, want normalized E.164", dests[0])
+	}
+	// The code is read digit by digit, twice
+	if strings.Count(bodies[0], ", ") < 10 || !strings.Contains(bodies[0], "Once again") {
+		t.Errorf("voice body = %q, want spaced code repeated twice", bodies[0])
+	}
+
+	if status, result := send("not-a-phone"); status != fiber.StatusBadRequest || result["reason"] != "invalid_destination" {
+		t.Errorf("invalid voice destination: status=%d, body=%v; want 400 invalid_destination", status, result)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/auditlog"
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/webauthn"
+)
+
+// WebAuthnRegisterStartRequest starts registering a credential for a user
+type WebAuthnRegisterStartRequest struct {
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name"`    // Shown by the authenticator; defaults to user_id
+	DisplayName string `json:"display_name"` // Defaults to user_name
+	Name        string `json:"name"`         // Label of the credential, e.g. "YubiKey"
+}
+
+// WebAuthnRegisterFinishRequest carries navigator.credentials.create() output (toJSON)
+type WebAuthnRegisterFinishRequest struct {
+	SessionID  string                         `json:"session_id"`
+	Credential *webauthn.RegistrationResponse `json:"credential"`
+	ClientIP   string                         `json:"client_ip"`
+}
+
+// WebAuthnAssertStartRequest starts an assertion; without user_id any passkey may answer
+type WebAuthnAssertStartRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// WebAuthnAssertFinishRequest carries navigator.credentials.get() output (toJSON)
+type WebAuthnAssertFinishRequest struct {
+	SessionID  string                           `json:"session_id"` // From assert/start
+	Credential *webauthn.AuthenticationResponse `json:"credential"`
+	ClientIP   string                           `json:"client_ip"`
+	// LoginSessionID optionally records the verification in session storage
+	LoginSessionID string `json:"login_session_id"`
+}
+
+// WebAuthnRegisterStart handles POST /v1/webauthn/register/start
+func (h *Handlers) WebAuthnRegisterStart(c *fiber.Ctx) error {
+	if h.webauthn == nil {
+		return webauthnNotConfigured(c)
+	}
+	var req WebAuthnRegisterStartRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	if req.UserID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "user_id_required",
+		})
+	}
+
+	sessionID, options, err := h.webauthn.BeginRegistration(requestContext(c), req.UserID, req.UserName, req.DisplayName, req.Name)
+	if err != nil {
+		h.log.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to start WebAuthn registration")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// WebAuthnRegisterFinish handles POST /v1/webauthn/register/finish
+func (h *Handlers) WebAuthnRegisterFinish(c *fiber.Ctx) error {
+	if h.webauthn == nil {
+		return webauthnNotConfigured(c)
+	}
+	var req WebAuthnRegisterFinishRequest
+	if err := c.BodyParser(&req); err != nil || req.Credential == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = c.IP()
+	}
+
+	ctx := requestContext(c)
+	cred, err := h.webauthn.FinishRegistration(ctx, req.SessionID, req.Credential)
+	if err != nil {
+		return h.webauthnFailure(c, err, clientIP)
+	}
+
+	auditlog.LogWebAuthnRegistered(ctx, cred.UserID, cred.ID, clientIP)
+
+	return c.JSON(fiber.Map{
+		"ok":            true,
+		"user_id":       cred.UserID,
+		"credential_id": cred.ID,
+	})
+}
+
+// WebAuthnAssertStart handles POST /v1/webauthn/assert/start
+func (h *Handlers) WebAuthnAssertStart(c *fiber.Ctx) error {
+	if h.webauthn == nil {
+		return webauthnNotConfigured(c)
+	}
+	var req WebAuthnAssertStartRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"ok":     false,
+				"reason": "invalid_request",
+			})
+		}
+	}
+
+	ctx := requestContext(c)
+	if req.UserID != "" && h.lockoutManager.IsLocked(ctx, req.UserID) {
+		return h.webauthnUserLocked(c, req.UserID)
+	}
+
+	sessionID, options, err := h.webauthn.BeginLogin(ctx, req.UserID)
+	if webauthn.ReasonOf(err) == webauthn.ReasonNoCredentials {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"ok":     false,
+			"reason": webauthn.ReasonNoCredentials,
+		})
+	}
+	if err != nil {
+		h.log.Error().Err(err).Str("user_id", req.UserID).Msg("Failed to start WebAuthn assertion")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"ok":         true,
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// WebAuthnAssertFinish handles POST /v1/webauthn/assert/finish. A valid assertion answers like a
+// verified challenge, with amr ["hwk"].
+func (h *Handlers) WebAuthnAssertFinish(c *fiber.Ctx) error {
+	if h.webauthn == nil {
+		return webauthnNotConfigured(c)
+	}
+	var req WebAuthnAssertFinishRequest
+	if err := c.BodyParser(&req); err != nil || req.Credential == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "invalid_request",
+		})
+	}
+	clientIP := req.ClientIP
+	if clientIP == "" {
+		clientIP = c.IP()
+	}
+
+	ctx := requestContext(c)
+	cred, err := h.webauthn.FinishLogin(ctx, req.SessionID, req.Credential)
+	if err != nil {
+		if reason := webauthn.ReasonOf(err); reason != "" {
+			metrics.RecordVerification("failure", reason)
+		}
+		return h.webauthnFailure(c, err, clientIP)
+	}
+	// Discoverable assertions only reveal the user here
+	if h.lockoutManager.IsLocked(ctx, cred.UserID) {
+		metrics.RecordVerification("failure", "user_locked")
+		auditlog.LogWebAuthnFailed(ctx, cred.UserID, "user_locked", clientIP)
+		return h.webauthnUserLocked(c, cred.UserID)
+	}
+
+	metrics.RecordVerification("success", "")
+	auditlog.LogWebAuthnVerified(ctx, cred.UserID, cred.ID, clientIP)
+
+	amr := []string{"hwk"} // RFC 8176: proof of possession of a hardware-secured key
+	h.recordSessionVerification(ctx, req.LoginSessionID, cred.UserID, amr)
+
+	return c.JSON(fiber.Map{
+		"ok":            true,
+		"user_id":       cred.UserID,
+		"amr":           amr,
+		"issued_at":     time.Now().Unix(),
+		"credential_id": cred.ID,
+	})
+}
+
+// webauthnFailure maps a ceremony error to a response. The user is not known yet: a failed
+// ceremony cannot be attributed to the user ID the caller claims.
+func (h *Handlers) webauthnFailure(c *fiber.Ctx, err error, clientIP string) error {
+	reason := webauthn.ReasonOf(err)
+	status := fiber.StatusUnauthorized
+	switch reason {
+	case "":
+		h.log.Error().Err(err).Msg("WebAuthn ceremony failed")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"ok":     false,
+			"reason": "internal_error",
+		})
+	case webauthn.ReasonInvalidSession, webauthn.ReasonInvalidCredential, webauthn.ReasonUnsupportedAlgorithm:
+		status = fiber.StatusBadRequest
+	case webauthn.ReasonCredentialExists:
+		status = fiber.StatusConflict
+	}
+
+	auditlog.LogWebAuthnFailed(requestContext(c), "", reason, clientIP)
+	return c.Status(status).JSON(fiber.Map{
+		"ok":     false,
+		"reason": reason,
+	})
+}
+
+func (h *Handlers) webauthnUserLocked(c *fiber.Ctx, userID string) error {
+	response := fiber.Map{
+		"ok":     false,
+		"reason": "user_locked",
+	}
+	if lock, err := h.lockoutManager.Get(requestContext(c), userID); err == nil && lock != nil {
+		response["locked_until"] = lock.ExpiresAt.Unix()
+	}
+	return c.Status(fiber.StatusForbidden).JSON(response)
+}
+
+func webauthnNotConfigured(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"ok":     false,
+		"reason": "webauthn_not_configured",
+	})
+}
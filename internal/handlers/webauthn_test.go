@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/webauthn/webauthntest"
+)
+
+func TestHandlers_WebAuthn(t *testing.T) {
+	originalRPID := config.WebAuthnRPID
+	defer func() { config.WebAuthnRPID = originalRPID }()
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	config.WebAuthnRPID = ""
+	disabled := NewHandlers(redisClient, nil, testLogger())
+	config.WebAuthnRPID = "example.com"
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/disabled/register/start", disabled.WebAuthnRegisterStart)
+	app.Post("/register/start", handlers.WebAuthnRegisterStart)
+	app.Post("/register/finish", handlers.WebAuthnRegisterFinish)
+	app.Post("/assert/start", handlers.WebAuthnAssertStart)
+	app.Post("/assert/finish", handlers.WebAuthnAssertFinish)
+
+	type response struct {
+		OK           bool            `json:"ok"`
+		Reason       string          `json:"reason"`
+		SessionID    string          `json:"session_id"`
+		Options      json.RawMessage `json:"options"`
+		UserID       string          `json:"user_id"`
+		AMR          []string        `json:"amr"`
+		CredentialID string          `json:"credential_id"`
+	}
+	do := func(path string, payload interface{}) (int, response) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		var result response
+		_ = json.Unmarshal(raw, &result)
+		return resp.StatusCode, result
+	}
+	finish := func(path, sessionID string, credential []byte) (int, response) {
+		t.Helper()
+		return do(path, map[string]interface{}{"session_id": sessionID, "credential": json.RawMessage(credential)})
+	}
+
+	if status, result := do("/disabled/register/start", map[string]string{"user_id": "user123"}); status != fiber.StatusServiceUnavailable || result.Reason != "webauthn_not_configured" {
+		t.Errorf("disabled: status=%d, body=%+v", status, result)
+	}
+	if status, result := do("/assert/start", map[string]string{"user_id": "user123"}); status != fiber.StatusNotFound || result.Reason != "no_credentials" {
+		t.Errorf("assert without credentials: status=%d, body=%+v", status, result)
+	}
+
+	auth := webauthntest.New("https://example.com")
+	status, started := do("/register/start", map[string]string{"user_id": "user123", "name": "YubiKey"})
+	if status != fiber.StatusOK || started.SessionID == "" {
+		t.Fatalf("register start: status=%d, body=%+v", status, started)
+	}
+	credential, err := auth.Register(started.Options)
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if status, result := finish("/register/finish", started.SessionID, credential); status != fiber.StatusOK || result.UserID != "user123" || result.CredentialID == "" {
+		t.Fatalf("register finish: status=%d, body=%+v", status, result)
+	}
+	// The session is single-use
+	if status, result := finish("/register/finish", started.SessionID, credential); status != fiber.StatusBadRequest || result.Reason != "invalid_session" {
+		t.Errorf("register finish replay: status=%d, body=%+v", status, result)
+	}
+
+	// Passkey flow: no user_id, the credential identifies the user
+	status, started = do("/assert/start", map[string]string{})
+	if status != fiber.StatusOK {
+		t.Fatalf("assert start: status=%d, body=%+v", status, started)
+	}
+	credential, err = auth.Assert(started.Options)
+	if err != nil {
+		t.Fatalf("Assert() error = %v", err)
+	}
+	status, result := finish("/assert/finish", started.SessionID, credential)
+	if status != fiber.StatusOK || !result.OK || result.UserID != "user123" || len(result.AMR) != 1 || result.AMR[0] != "hwk" {
+		t.Fatalf("assert finish: status=%d, body=%+v", status, result)
+	}
+
+	// A replayed counter is rejected
+	status, started = do("/assert/start", map[string]string{"user_id": "user123"})
+	if status != fiber.StatusOK {
+		t.Fatalf("assert start: status=%d, body=%+v", status, started)
+	}
+	auth.SignCount = 0
+	credential, _ = auth.Assert(started.Options)
+	if status, result := finish("/assert/finish", started.SessionID, credential); status != fiber.StatusUnauthorized || result.Reason != "sign_count_invalid" {
+		t.Errorf("assert finish with stale counter: status=%d, body=%+v", status, result)
+	}
+
+	if status, result := do("/assert/finish", map[string]string{"session_id": "x"}); status != fiber.StatusBadRequest || result.Reason != "invalid_request" {
+		t.Errorf("assert finish without credential: status=%d, body=%+v", status, result)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/soulteary/herald/internal/config"
+	"github.com/soulteary/herald/internal/events"
+	"github.com/soulteary/herald/internal/webhook"
+)
+
+func TestHandlers_CreateChallenge_Webhook(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		payloads []webhook.Payload
+	)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// The first delivery fails and is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if want := events.Sign("inapp-secret", r.Header.Get("X-Timestamp"), body); r.Header.Get("X-Signature") != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p webhook.Payload
+		_ = json.Unmarshal(body, &p)
+		payloads = append(payloads, p)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer endpoint.Close()
+
+	originalEndpoints := config.WebhookEndpointsJSON
+	originalRetryDelay := config.WebhookRetryDelay
+	originalTestMode := config.TestMode
+	originalRateLimitPerDestination := config.RateLimitPerDestination
+	defer func() {
+		config.WebhookEndpointsJSON = originalEndpoints
+		config.WebhookRetryDelay = originalRetryDelay
+		config.TestMode = originalTestMode
+		config.RateLimitPerDestination = originalRateLimitPerDestination
+	}()
+	config.WebhookEndpointsJSON = `[{"id":"inapp","url":"` + endpoint.URL + `","secret":"inapp-secret"}]`
+	config.WebhookRetryDelay = time.Millisecond
+	config.TestMode = true
+	config.RateLimitPerDestination = 1
+
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	handlers := NewHandlers(redisClient, nil, testLogger())
+
+	app := fiber.New()
+	app.Post("/challenge", handlers.CreateChallenge)
+
+	send := func(userID, destination string) (int, map[string]interface{}) {
+		t.Helper()
+		bodyBytes, _ := json.Marshal(CreateChallengeRequest{
+			UserID:      userID,
+			Channel:     "webhook",
+			Destination: destination,
+			Purpose:     "login",
+			ClientIP:    "127.0.0.1",
+		})
+		req := httptest.NewRequest("POST", "/challenge", bytes.NewBuffer(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("Test request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		var result map[string]interface{}
+		_ = json.Unmarshal(body, &result)
+		return resp.StatusCode, result
+	}
+
+	status, result := send("user123", "inapp")
+	if status != fiber.StatusOK {
+		t.Fatalf("webhook challenge: status=%d, body=%v; want 200", status, result)
+	}
+
+	mu.Lock()
+	if attempts != 2 || len(payloads) != 1 {
+		t.Fatalf("attempts=%d payloads=%d; want 2 attempts, 1 delivered payload", attempts, len(payloads))
+	}
+	p := payloads[0]
+	mu.Unlock()
+	if p.Type != webhook.PayloadType || p.Endpoint != "inapp" || p.ChallengeID != result["challenge_id"] || p.UserID != "user123" ||
+		p.Code != result["debug_code"] || p.Purpose != "login" || p.ExpiresIn != int(config.ChallengeExpiry.Seconds()) {
+		t.Errorf("payload = %+v, response = %v", p, result)
+	}
+
+	// The endpoint is shared: per-destination limits count each user separately
+	if status, result := send("user456", "inapp"); status != fiber.StatusOK {
+		t.Errorf("second user on the endpoint: status=%d, body=%v; want 200", status, result)
+	}
+	if status, result := send("user123", "inapp"); status != fiber.StatusTooManyRequests || result["reason"] != "rate_limit_exceeded" {
+		t.Errorf("same user again: status=%d, body=%v; want 429 rate_limit_exceeded", status, result)
+	}
+
+	if status, result := send("user123", "unknown"); status != fiber.StatusBadRequest || result["reason"] != "invalid_destination" {
+		t.Errorf("unknown endpoint: status=%d, body=%v; want 400 invalid_destination", status, result)
+	}
+}
@@ -21,7 +21,8 @@ type Locker struct {
 // If redisClient is nil, it will only use local locking
 func NewLocker(redisClient *redis.Client) *Locker {
 	return &Locker{
-		Cache: redisClient,
+		Cache:      redisClient,
+		hybridLock: rediskitlock.NewHybridLocker(redisClient),
 	}
 }
 
@@ -0,0 +1,233 @@
+// Package lockout provides escalating user lockouts for Herald.
+// challenge-kit locks a user for a fixed LockoutDuration after MaxAttempts; this package
+// keeps a lock record (reason, level, expiry) and doubles the duration for each
+// subsequent lockout within the escalation window, up to a maximum.
+package lockout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskitcache "github.com/soulteary/redis-kit/cache"
+
+	"github.com/soulteary/herald/internal/metrics"
+)
+
+const (
+	// recordKeyPrefix is the Redis key prefix for lock records
+	recordKeyPrefix = "otp:lockout:"
+	// countKeyPrefix is the Redis key prefix for lockout counters within the escalation window
+	countKeyPrefix = "otp:lockout:count:"
+	// guardKeyPrefix is the Redis key prefix that lets only one caller apply each lockout
+	guardKeyPrefix = "otp:lockout:guard:"
+)
+
+// ReasonMaxAttempts is the lock reason used when a user exceeds the verification attempts limit
+const ReasonMaxAttempts = "max_attempts"
+
+// Lock describes an active user lock
+type Lock struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+	// Level is 1 for the first lockout within the escalation window, 2 for the second, and so on
+	Level     int       `json:"level"`
+	LockedAt  time.Time `json:"locked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Config holds lockout policy configuration
+type Config struct {
+	// BaseDuration is the duration of the first lockout
+	BaseDuration time.Duration
+	// MaxDuration caps escalated lockouts
+	MaxDuration time.Duration
+	// EscalationWindow is how long previous lockouts count towards escalation
+	EscalationWindow time.Duration
+	// ChallengeLockPrefix is challenge-kit's lock key prefix, kept in sync so challenge-kit honours escalated locks
+	ChallengeLockPrefix string
+}
+
+// Manager manages escalating user lockouts
+type Manager struct {
+	client         *redis.Client
+	records        rediskitcache.Cache
+	challengeLocks rediskitcache.Cache
+	config         Config
+}
+
+// NewManager creates a new lockout manager
+func NewManager(redisClient *redis.Client, cfg Config) *Manager {
+	if cfg.BaseDuration <= 0 {
+		cfg.BaseDuration = 10 * time.Minute
+	}
+	if cfg.MaxDuration < cfg.BaseDuration {
+		cfg.MaxDuration = cfg.BaseDuration
+	}
+	if cfg.EscalationWindow <= 0 {
+		cfg.EscalationWindow = 24 * time.Hour
+	}
+	if cfg.ChallengeLockPrefix == "" {
+		cfg.ChallengeLockPrefix = "otp:lock:"
+	}
+	return &Manager{
+		client:         redisClient,
+		records:        rediskitcache.NewCache(redisClient, recordKeyPrefix),
+		challengeLocks: rediskitcache.NewCache(redisClient, cfg.ChallengeLockPrefix),
+		config:         cfg,
+	}
+}
+
+// DurationForLevel returns the lockout duration for the given level (1-based):
+// BaseDuration doubled for each level above 1, capped at MaxDuration.
+func (m *Manager) DurationForLevel(level int) time.Duration {
+	d := m.config.BaseDuration
+	for i := 1; i < level; i++ {
+		d *= 2
+		if d >= m.config.MaxDuration {
+			return m.config.MaxDuration
+		}
+	}
+	return d
+}
+
+// Lock locks the user unless an escalated lock is already active.
+// Returns the active lock and whether a new lock was created by this call.
+// Concurrent calls for the same user escalate once: a guard key taken with SET NX
+// decides which of them counts the lockout and stores the record.
+func (m *Manager) Lock(ctx context.Context, userID, reason string) (*Lock, bool, error) {
+	if existing, err := m.record(ctx, userID); err == nil && existing != nil {
+		m.reassert(ctx, existing)
+		return existing, false, nil
+	}
+
+	start := time.Now()
+	guardKey := guardKeyPrefix + userID
+	acquired, err := m.client.SetNX(ctx, guardKey, "1", m.config.BaseDuration).Result()
+	if err != nil {
+		metrics.RecordRedisFailure("lockout", time.Since(start))
+		return nil, false, fmt.Errorf("failed to guard lockout: %w", err)
+	}
+	if !acquired {
+		// Another verification is applying (or has applied) this lockout
+		existing, err := m.record(ctx, userID)
+		if existing != nil {
+			m.reassert(ctx, existing)
+		}
+		return existing, false, err
+	}
+	// Until the lock record is stored, any failure releases the guard so the next attempt can lock
+	stored := false
+	defer func() {
+		if !stored {
+			_ = m.client.Del(context.WithoutCancel(ctx), guardKey).Err()
+		}
+	}()
+
+	countKey := countKeyPrefix + userID
+	level, err := m.client.Incr(ctx, countKey).Result()
+	if err != nil {
+		metrics.RecordRedisFailure("lockout", time.Since(start))
+		return nil, false, fmt.Errorf("failed to count lockouts: %w", err)
+	}
+	if level == 1 {
+		if err := m.client.Expire(ctx, countKey, m.config.EscalationWindow).Err(); err != nil {
+			metrics.RecordRedisFailure("lockout", time.Since(start))
+			return nil, false, fmt.Errorf("failed to set lockout window: %w", err)
+		}
+	}
+
+	duration := m.DurationForLevel(int(level))
+	now := time.Now()
+	lock := &Lock{
+		UserID:    userID,
+		Reason:    reason,
+		Level:     int(level),
+		LockedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := m.records.Set(ctx, userID, lock, duration); err != nil {
+		metrics.RecordRedisFailure("lockout", time.Since(start))
+		return nil, false, fmt.Errorf("failed to store lock: %w", err)
+	}
+	stored = true
+	// The guard lives as long as the lock, so late callers see the record instead of escalating
+	_ = m.client.Expire(ctx, guardKey, duration).Err()
+	if err := m.challengeLocks.Set(ctx, userID, "1", duration); err != nil {
+		metrics.RecordRedisFailure("lockout", time.Since(start))
+		return lock, true, fmt.Errorf("failed to store challenge lock: %w", err)
+	}
+	metrics.RecordRedisSuccess("lockout", time.Since(start))
+	return lock, true, nil
+}
+
+// reassert re-applies the remaining escalated duration to challenge-kit's lock: challenge-kit
+// resets it to the base duration on every "locked" verification, which would shorten the lock.
+func (m *Manager) reassert(ctx context.Context, lock *Lock) {
+	if remaining := time.Until(lock.ExpiresAt); remaining >= time.Second {
+		_ = m.challengeLocks.Set(ctx, lock.UserID, "1", remaining)
+	}
+}
+
+// Get returns the active lock for the user, or nil when the user is not locked.
+// A lock set directly by challenge-kit (without a record) is reported with reason max_attempts.
+func (m *Manager) Get(ctx context.Context, userID string) (*Lock, error) {
+	lock, err := m.record(ctx, userID)
+	if err != nil || lock != nil {
+		return lock, err
+	}
+
+	exists, err := m.challengeLocks.Exists(ctx, userID)
+	if err != nil || !exists {
+		return nil, err
+	}
+	ttl, err := m.challengeLocks.TTL(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Lock{
+		UserID:    userID,
+		Reason:    ReasonMaxAttempts,
+		ExpiresAt: time.Now().Add(ttl),
+	}, nil
+}
+
+// IsLocked reports whether an escalated lock record is active for the user
+func (m *Manager) IsLocked(ctx context.Context, userID string) bool {
+	lock, err := m.record(ctx, userID)
+	return err == nil && lock != nil
+}
+
+// Unlock removes the active lock (both the record and challenge-kit's lock).
+// Previous lockouts still count towards escalation until the window expires.
+func (m *Manager) Unlock(ctx context.Context, userID string) error {
+	if err := m.records.Del(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete lock: %w", err)
+	}
+	if err := m.challengeLocks.Del(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete challenge lock: %w", err)
+	}
+	if err := m.client.Del(ctx, guardKeyPrefix+userID).Err(); err != nil {
+		return fmt.Errorf("failed to delete lock guard: %w", err)
+	}
+	return nil
+}
+
+// record loads the lock record, returning nil when none exists
+func (m *Manager) record(ctx context.Context, userID string) (*Lock, error) {
+	data, err := m.client.Get(ctx, recordKeyPrefix+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to decode lock: %w", err)
+	}
+	return &lock, nil
+}
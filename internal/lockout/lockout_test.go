@@ -0,0 +1,191 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+// testRedisClient returns a mock Redis client for testing
+func testRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	client, _ := testutil.NewTestRedisClient()
+	return client
+}
+
+func TestManager_DurationForLevel(t *testing.T) {
+	m := NewManager(nil, Config{BaseDuration: 10 * time.Minute, MaxDuration: time.Hour})
+	tests := []struct {
+		level int
+		want  time.Duration
+	}{
+		{1, 10 * time.Minute},
+		{2, 20 * time.Minute},
+		{3, 40 * time.Minute},
+		{4, time.Hour},
+		{10, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := m.DurationForLevel(tt.level); got != tt.want {
+			t.Errorf("DurationForLevel(%d) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestManager_LockEscalates(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, Config{BaseDuration: 10 * time.Minute, MaxDuration: time.Hour})
+	ctx := context.Background()
+
+	lock, created, err := m.Lock(ctx, "user1", ReasonMaxAttempts)
+	if err != nil || !created {
+		t.Fatalf("Lock() = %v, %v, want created", created, err)
+	}
+	if lock.Level != 1 || time.Until(lock.ExpiresAt) > 10*time.Minute {
+		t.Errorf("first Lock() = %+v, want level 1 for 10m", lock)
+	}
+
+	// Locking again while locked is a no-op
+	again, created, err := m.Lock(ctx, "user1", ReasonMaxAttempts)
+	if err != nil || created || again.Level != 1 {
+		t.Errorf("repeat Lock() = %+v, created=%v, err=%v; want existing level 1 lock", again, created, err)
+	}
+
+	// challenge-kit's lock key is kept in sync
+	if exists, _ := redisClient.Exists(ctx, "otp:lock:user1").Result(); exists != 1 {
+		t.Error("Lock() should set challenge-kit lock key")
+	}
+
+	if err := m.Unlock(ctx, "user1"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if got, _ := m.Get(ctx, "user1"); got != nil {
+		t.Errorf("Get() after Unlock() = %+v, want nil", got)
+	}
+
+	lock, created, err = m.Lock(ctx, "user1", ReasonMaxAttempts)
+	if err != nil || !created {
+		t.Fatalf("Lock() after unlock = %v, %v, want created", created, err)
+	}
+	if lock.Level != 2 || time.Until(lock.ExpiresAt) <= 10*time.Minute {
+		t.Errorf("second Lock() = %+v, want level 2 for 20m", lock)
+	}
+}
+
+func TestManager_GetChallengeKitLock(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, Config{BaseDuration: 10 * time.Minute})
+	ctx := context.Background()
+
+	if err := redisClient.Set(ctx, "otp:lock:user2", "1", 5*time.Minute).Err(); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	lock, err := m.Get(ctx, "user2")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if lock == nil || lock.Reason != ReasonMaxAttempts || lock.Level != 0 {
+		t.Fatalf("Get() = %+v, want max_attempts lock without level", lock)
+	}
+	if m.IsLocked(ctx, "user2") {
+		t.Error("IsLocked() should only report escalated lock records")
+	}
+}
+
+func TestManager_LockRedisError(t *testing.T) {
+	redisClient, mock := testutil.NewTestRedisClient()
+	defer func() { _ = redisClient.Close() }()
+	mock.SetShouldFail(true)
+
+	m := NewManager(redisClient, Config{})
+	if _, _, err := m.Lock(context.Background(), "user3", ReasonMaxAttempts); err == nil {
+		t.Error("Lock() expected error when Redis fails")
+	}
+}
+
+// failExpire fails EXPIRE commands, leaving the others to the mock
+type failExpire struct{}
+
+func (failExpire) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (failExpire) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "expire" {
+			err := errors.New("expire failed")
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (failExpire) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error { return next(ctx, cmds) }
+}
+
+func TestManager_LockReleasesGuardOnError(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+	redisClient.AddHook(failExpire{})
+	ctx := context.Background()
+
+	m := NewManager(redisClient, Config{})
+	if _, _, err := m.Lock(ctx, "user4", ReasonMaxAttempts); err == nil {
+		t.Fatal("Lock() expected error when the lockout window cannot be set")
+	}
+	if n, err := redisClient.Exists(ctx, guardKeyPrefix+"user4").Result(); err != nil || n != 0 {
+		t.Errorf("guard key exists = %d, %v; want released", n, err)
+	}
+}
+
+func TestManager_LockConcurrent(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, Config{BaseDuration: 10 * time.Minute, MaxDuration: time.Hour})
+	ctx := context.Background()
+
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, err := m.Lock(ctx, "user1", ReasonMaxAttempts); err == nil && ok {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := created.Load(); n != 1 {
+		t.Fatalf("Lock() created %d locks, want 1", n)
+	}
+	lock, err := m.Get(ctx, "user1")
+	if err != nil || lock == nil || lock.Level != 1 {
+		t.Fatalf("Get() = %+v, %v, want level 1", lock, err)
+	}
+
+	// Concurrent failures counted once: the next lockout is level 2
+	if err := m.Unlock(ctx, "user1"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	lock, ok, err := m.Lock(ctx, "user1", ReasonMaxAttempts)
+	if err != nil || !ok || lock.Level != 2 {
+		t.Errorf("Lock() after Unlock = %+v, %v, %v, want new level 2 lock", lock, ok, err)
+	}
+}
@@ -0,0 +1,259 @@
+// Package mail implements the built-in SMTP email provider. Unlike provider-kit's SMTP provider
+// it sends multipart/alternative messages: the plaintext part is the message body and the HTML
+// part, when present, travels in the ParamHTML message param (which herald-smtp also receives).
+// Connections are always encrypted: STARTTLS is required, or TLS is used from the first byte.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	provider "github.com/soulteary/provider-kit"
+)
+
+// ParamHTML is the message param carrying the HTML part of an email
+const ParamHTML = "html"
+
+// TLS modes
+const (
+	TLSStartTLS = "starttls" // Plain connection upgraded with STARTTLS; fails when the server does not offer it
+	TLSImplicit = "tls"      // TLS from the first byte (SMTPS, usually port 465)
+)
+
+// defaultTimeout bounds a whole delivery when Config.Timeout is not set
+const defaultTimeout = 10 * time.Second
+
+// Config configures the SMTP provider
+type Config struct {
+	Host     string
+	Port     int
+	Username string // Optional: PLAIN auth when set
+	Password string
+	From     string
+	// TLS is TLSStartTLS or TLSImplicit; empty selects TLSImplicit on port 465, else TLSStartTLS
+	TLS     string
+	Timeout time.Duration // Connect and delivery timeout; the request context can shorten it
+}
+
+// tlsConfig returns the TLS configuration for host, replaced in tests
+var tlsConfig = func(host string) *tls.Config {
+	return &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+}
+
+// Provider sends emails over SMTP
+type Provider struct {
+	cfg Config
+}
+
+// New creates an SMTP provider
+func New(cfg Config) (*Provider, error) {
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+		if cfg.Port == 465 {
+			cfg.TLS = TLSImplicit
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	p := &Provider{cfg: cfg}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Send sends msg: plaintext only, or multipart/alternative when msg carries an HTML part
+func (p *Provider) Send(ctx context.Context, msg *provider.Message) (*provider.SendResult, error) {
+	if err := msg.Validate(); err != nil {
+		return p.fail(provider.NormalizeError(err, provider.ChannelEmail, p.Name()))
+	}
+	if err := ctx.Err(); err != nil {
+		return p.fail(provider.ErrSendFailed("send canceled", err))
+	}
+
+	body, err := p.build(msg, time.Now())
+	if err != nil {
+		return p.fail(provider.ErrSendFailed("failed to build email", err))
+	}
+
+	if err := p.deliver(ctx, msg.To, body); err != nil {
+		return p.fail(provider.ErrSendFailed("failed to send email", err))
+	}
+
+	messageID := msg.IdempotencyKey
+	if messageID == "" {
+		messageID = randomToken()
+	}
+	return provider.NewSuccessResult(p.Name(), provider.ChannelEmail, messageID), nil
+}
+
+// deliver sends body to one recipient over an encrypted connection. The connection deadline
+// is the earlier of the configured timeout and the context deadline; canceling ctx aborts it.
+func (p *Provider) deliver(ctx context.Context, to string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.cfg.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial failed: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	tlsCfg := tlsConfig(p.cfg.Host)
+	if p.cfg.TLS == TLSImplicit {
+		conn = tls.Client(conn, tlsCfg)
+	}
+	client, err := smtp.NewClient(conn, p.cfg.Host)
+	if err != nil {
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if p.cfg.TLS == TLSStartTLS {
+		// Never fall back to cleartext: a missing STARTTLS may be stripped by an attacker
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("server does not offer STARTTLS")
+		}
+		if err := client.StartTLS(tlsCfg); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if p.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", p.cfg.Username, p.cfg.Password, p.cfg.Host)); err != nil {
+			return fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(p.cfg.From); err != nil {
+		return fmt.Errorf("MAIL FROM failed: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("RCPT TO failed: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA failed: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("writing message failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+	return client.Quit()
+}
+
+// build renders msg as an RFC 5322 message with quoted-printable UTF-8 parts
+func (p *Provider) build(msg *provider.Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", p.cfg.From)
+	header("To", msg.To)
+	if msg.Subject != "" {
+		header("Subject", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	}
+	header("Date", now.Format(time.RFC1123Z))
+	if msg.IdempotencyKey != "" {
+		header("Message-ID", "<"+msg.IdempotencyKey+"@"+p.cfg.Host+">")
+	}
+	header("MIME-Version", "1.0")
+
+	html := msg.Params[ParamHTML]
+	if html == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writePart(&buf, msg.Body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundary := "herald-" + randomToken()
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	buf.WriteString("\r\n")
+	// Clients show the last part they support, so HTML goes after plaintext
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", msg.Body},
+		{"text/html", html},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		header("Content-Type", part.contentType+"; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writePart(&buf, part.content); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// writePart writes content quoted-printable encoded with CRLF line endings
+func writePart(buf *bytes.Buffer, content string) error {
+	w := quotedprintable.NewWriter(buf)
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if _, err := w.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func randomToken() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (p *Provider) fail(err *provider.ProviderError) (*provider.SendResult, error) {
+	err = err.WithProvider(p.Name(), provider.ChannelEmail)
+	return provider.NewFailureResult(p.Name(), provider.ChannelEmail, err), err
+}
+
+// Channel returns the email channel
+func (p *Provider) Channel() provider.Channel {
+	return provider.ChannelEmail
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return "smtp"
+}
+
+// Validate checks the SMTP configuration
+func (p *Provider) Validate() error {
+	switch {
+	case p.cfg.Host == "":
+		return provider.ErrInvalidConfig("SMTP host is required")
+	case p.cfg.Port <= 0 || p.cfg.Port > 65535:
+		return provider.ErrInvalidConfig("SMTP port is invalid")
+	case p.cfg.From == "":
+		return provider.ErrInvalidConfig("SMTP from address is required")
+	case p.cfg.TLS != TLSStartTLS && p.cfg.TLS != TLSImplicit:
+		return provider.ErrInvalidConfig("SMTP TLS mode must be starttls or tls")
+	}
+	return nil
+}
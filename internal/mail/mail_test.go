@@ -0,0 +1,338 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	provider "github.com/soulteary/provider-kit"
+)
+
+func testProvider(t *testing.T) *Provider {
+	t.Helper()
+	p, err := New(Config{Host: "smtp.example.com", Port: 587, From: "herald@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Port: 587, From: "herald@example.com"},
+		{Host: "smtp.example.com", From: "herald@example.com"},
+		{Host: "smtp.example.com", Port: 587},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) error = nil", cfg)
+		}
+	}
+}
+
+func TestProvider_BuildPlain(t *testing.T) {
+	p := testProvider(t)
+	msg := provider.NewMessage("alice@example.com").WithSubject("验证码").WithBody("Your code is 123456")
+	data, err := p.build(msg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject")); subject != "验证码" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if ct := m.Header.Get("Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(m.Body)
+	if !bytes.Contains(body, []byte("123456")) {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestProvider_BuildMultipart(t *testing.T) {
+	p := testProvider(t)
+	msg := provider.NewMessage("alice@example.com").
+		WithSubject("Verification Code").
+		WithBody("Your code is 123456").
+		WithParam(ParamHTML, `<p style="color:#333">Your code is <b>123456</b></p>`).
+		WithIdempotencyKey("ch_1")
+	data, err := p.build(msg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := m.Header.Get("Message-ID"); id != "<ch_1@smtp.example.com>" {
+		t.Errorf("Message-ID = %q", id)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", m.Header.Get("Content-Type"), err)
+	}
+
+	r := multipart.NewReader(m.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part) // multipart decodes quoted-printable
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	if len(types) != 2 || types[0] != "text/plain; charset=UTF-8" || types[1] != "text/html; charset=UTF-8" {
+		t.Fatalf("parts = %v", types)
+	}
+	if bodies[0] != "Your code is 123456" || bodies[1] != `<p style="color:#333">Your code is <b>123456</b></p>` {
+		t.Errorf("bodies = %q", bodies)
+	}
+}
+
+// smtpServer is a minimal SMTP server accepting one message per connection. The cert is
+// served for STARTTLS, or from the first byte when implicit is set.
+type smtpServer struct {
+	addr     string
+	startTLS bool // Advertise STARTTLS
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newSMTPServer(t *testing.T, startTLS, implicit bool) *smtpServer {
+	t.Helper()
+	cert, pool := testCert(t)
+	orig := tlsConfig
+	t.Cleanup(func() { tlsConfig = orig })
+	tlsConfig = func(host string) *tls.Config {
+		return &tls.Config{ServerName: host, RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	serverTLS := &tls.Config{Certificates: []tls.Certificate{cert}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit {
+		ln = tls.NewListener(ln, serverTLS)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &smtpServer{addr: ln.Addr().String(), startTLS: startTLS}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, serverTLS, implicit)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn, serverTLS *tls.Config, secure bool) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+	reply("220 test ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+		switch cmd {
+		case "EHLO":
+			if s.startTLS && !secure {
+				reply("250-test")
+				reply("250 STARTTLS")
+			} else {
+				reply("250-test")
+				reply("250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, serverTLS)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			reply("235 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) result() ([]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), s.data
+}
+
+// testCert returns a self-signed certificate for 127.0.0.1 and a pool trusting it
+func testCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(crand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func serverProvider(t *testing.T, addr, mode string) *Provider {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	p, err := New(Config{Host: host, Port: portNum, Username: "u", Password: "p", From: "herald@example.com", TLS: mode, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProvider_Send(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		mode     string
+		implicit bool
+	}{
+		{"starttls", TLSStartTLS, false},
+		{"implicit tls", TLSImplicit, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t, !tt.implicit, tt.implicit)
+			p := serverProvider(t, server.addr, tt.mode)
+			result, err := p.Send(context.Background(), provider.NewMessage("alice@example.com").WithSubject("Code").WithBody("hi").WithIdempotencyKey("ch_1"))
+			if err != nil || !result.OK || result.MessageID != "ch_1" {
+				t.Fatalf("Send() = %+v, %v", result, err)
+			}
+			commands, data := server.result()
+			got := strings.Join(commands, ",")
+			want := "EHLO,STARTTLS,EHLO,AUTH,MAIL,RCPT,DATA,QUIT"
+			if tt.implicit {
+				want = "EHLO,AUTH,MAIL,RCPT,DATA,QUIT"
+			}
+			if got != want {
+				t.Errorf("commands = %s, want %s", got, want)
+			}
+			if !strings.Contains(data, "To: alice@example.com\r\n") || !strings.Contains(data, "\r\nhi") {
+				t.Errorf("data = %q", data)
+			}
+		})
+	}
+}
+
+func TestProvider_Send_RequiresStartTLS(t *testing.T) {
+	server := newSMTPServer(t, false, false)
+	p := serverProvider(t, server.addr, TLSStartTLS)
+	if result, err := p.Send(context.Background(), provider.NewMessage("alice@example.com").WithBody("hi")); err == nil || result.OK {
+		t.Fatalf("Send() without STARTTLS = %+v, %v; want failure", result, err)
+	}
+	if commands, data := server.result(); strings.Contains(strings.Join(commands, ","), "MAIL") || data != "" {
+		t.Errorf("commands = %v, data = %q; want nothing sent in cleartext", commands, data)
+	}
+}
+
+func TestProvider_Send_ContextDeadline(t *testing.T) {
+	// A server that accepts but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer func() { _ = conn.Close() }()
+			time.Sleep(2 * time.Second)
+		}
+	}()
+
+	p := serverProvider(t, ln.Addr().String(), TLSStartTLS)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if result, err := p.Send(ctx, provider.NewMessage("alice@example.com").WithBody("hi")); err == nil || result.OK {
+		t.Fatalf("Send() = %+v, %v; want failure", result, err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Send() took %s, want the context deadline to abort it", elapsed)
+	}
+}
+
+func TestNew_TLSMode(t *testing.T) {
+	for _, tt := range []struct {
+		port int
+		mode string
+		want string
+	}{
+		{587, "", TLSStartTLS},
+		{465, "", TLSImplicit},
+		{2525, TLSImplicit, TLSImplicit},
+	} {
+		p, err := New(Config{Host: "smtp.example.com", Port: tt.port, From: "herald@example.com", TLS: tt.mode})
+		if err != nil || p.cfg.TLS != tt.want {
+			t.Errorf("New(port %d, %q) TLS = %v, %v; want %s", tt.port, tt.mode, p, err, tt.want)
+		}
+	}
+	if _, err := New(Config{Host: "smtp.example.com", Port: 25, From: "herald@example.com", TLS: "none"}); err == nil {
+		t.Error("New(TLS none) error = nil, want invalid config")
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	metrics "github.com/soulteary/metrics-kit"
 )
 
@@ -18,6 +19,36 @@ var (
 
 	// Redis holds Redis operation metrics
 	Redis *metrics.RedisMetrics
+
+	// QuotaEvents counts global send budget warnings and hard-limit denials
+	QuotaEvents *prometheus.CounterVec
+
+	// DegradedDecisions counts rate limit decisions taken while Redis was unavailable
+	DegradedDecisions *prometheus.CounterVec
+
+	// CaptchaVerifications counts CAPTCHA / proof-of-work checks on challenge creation
+	CaptchaVerifications *prometheus.CounterVec
+
+	// RiskDecisions counts risk engine decisions on challenge creation
+	RiskDecisions *prometheus.CounterVec
+
+	// EmailPolicyRejections counts email destinations rejected by the disposable/role lists
+	EmailPolicyRejections *prometheus.CounterVec
+
+	// EmailPolicyEntries reports the number of entries loaded per email policy list
+	EmailPolicyEntries *prometheus.GaugeVec
+
+	// Templates reports the number of template files from the last load, valid or invalid
+	Templates *prometheus.GaugeVec
+
+	// TOTPRequests counts calls to herald-totp per operation and result
+	TOTPRequests *prometheus.CounterVec
+
+	// TOTPRequestDuration measures calls to herald-totp per operation, retries included
+	TOTPRequestDuration *prometheus.HistogramVec
+
+	// TOTPCircuitOpen is 1 while the herald-totp circuit breaker rejects calls
+	TOTPCircuitOpen prometheus.Gauge
 )
 
 func init() {
@@ -29,9 +60,83 @@ func Init() {
 	Registry = metrics.NewRegistry("herald")
 	cm := metrics.NewCommonMetrics(Registry)
 
-	OTP = cm.NewOTPMetrics()
+	OTP = newOTPMetrics()
 	RateLimit = cm.NewRateLimitMetrics()
 	Redis = cm.NewRedisMetrics()
+
+	QuotaEvents = Registry.WithSubsystem("quota").Counter("events_total").
+		Help("Total number of global send budget events").
+		Labels("rule", "level").
+		BuildVec()
+
+	DegradedDecisions = Registry.WithSubsystem("ratelimit").Counter("degraded_decisions_total").
+		Help("Total number of rate limit decisions taken in degraded mode (Redis unavailable)").
+		Labels("scope", "policy", "decision").
+		BuildVec()
+
+	CaptchaVerifications = Registry.WithSubsystem("captcha").Counter("verifications_total").
+		Help("Total number of captcha checks on challenge creation").
+		Labels("provider", "result").
+		BuildVec()
+
+	RiskDecisions = Registry.WithSubsystem("risk").Counter("decisions_total").
+		Help("Total number of risk engine decisions").
+		Labels("action").
+		BuildVec()
+
+	EmailPolicyRejections = Registry.WithSubsystem("email_policy").Counter("rejections_total").
+		Help("Total number of email destinations rejected by domain/role policy").
+		Labels("list", "purpose").
+		BuildVec()
+
+	EmailPolicyEntries = Registry.WithSubsystem("email_policy").Gauge("entries").
+		Help("Number of entries loaded per email policy list").
+		Labels("list").
+		BuildVec()
+
+	Templates = Registry.WithSubsystem("templates").Gauge("files").
+		Help("Number of template files from the last load, by status").
+		Labels("status").
+		BuildVec()
+
+	TOTPRequests = Registry.WithSubsystem("totp").Counter("requests_total").
+		Help("Total number of herald-totp calls").
+		Labels("operation", "result").
+		BuildVec()
+
+	TOTPRequestDuration = Registry.WithSubsystem("totp").Histogram("request_duration_seconds").
+		Help("Duration of herald-totp calls in seconds, retries included").
+		Labels("operation").
+		Buckets(metrics.ExternalAPIDurationBuckets()).
+		BuildVec()
+
+	TOTPCircuitOpen = Registry.WithSubsystem("totp").Gauge("circuit_open").
+		Help("1 while the herald-totp circuit breaker is open").
+		Build()
+}
+
+// newOTPMetrics mirrors metrics-kit's OTP metrics, with a country label on sends
+func newOTPMetrics() *metrics.OTPMetrics {
+	r := Registry.WithSubsystem("otp")
+	return &metrics.OTPMetrics{
+		ChallengesTotal: r.Counter("challenges_total").
+			Help("Total number of OTP challenges created").
+			Labels("channel", "purpose", "result").
+			BuildVec(),
+		SendsTotal: r.Counter("sends_total").
+			Help("Total number of OTP sends via providers").
+			Labels("channel", "provider", "country", "result").
+			BuildVec(),
+		SendDuration: r.Histogram("send_duration_seconds").
+			Help("Duration of OTP send operations in seconds").
+			Labels("provider").
+			Buckets(metrics.ExternalAPIDurationBuckets()).
+			BuildVec(),
+		VerificationsTotal: r.Counter("verifications_total").
+			Help("Total number of OTP verifications").
+			Labels("result", "reason").
+			BuildVec(),
+	}
 }
 
 // RecordChallengeCreated records a challenge creation event
@@ -39,9 +144,14 @@ func RecordChallengeCreated(channel, purpose, result string) {
 	OTP.RecordChallengeCreated(channel, purpose, result)
 }
 
-// RecordOTPSend records an OTP send event
-func RecordOTPSend(channel, provider, result string, duration time.Duration) {
-	OTP.RecordSend(channel, provider, result, duration)
+// RecordOTPSend records an OTP send event; country is the ISO code of the destination
+// (or client IP), "unknown" when empty
+func RecordOTPSend(channel, provider, country, result string, duration time.Duration) {
+	if country == "" {
+		country = "unknown"
+	}
+	OTP.SendsTotal.WithLabelValues(channel, provider, country, result).Inc()
+	OTP.SendDuration.WithLabelValues(provider).Observe(duration.Seconds())
 }
 
 // RecordVerification records a verification event
@@ -68,3 +178,55 @@ func RecordRedisSuccess(operation string, duration time.Duration) {
 func RecordRedisFailure(operation string, duration time.Duration) {
 	Redis.RecordFailure(operation, duration)
 }
+
+// RecordQuotaEvent records a global send budget event (level: "warning" or "exceeded")
+func RecordQuotaEvent(rule, level string) {
+	QuotaEvents.WithLabelValues(rule, level).Inc()
+}
+
+// RecordDegradedDecision records a rate limit decision taken without Redis
+// (policy: "open", "closed" or "local"; decision: "allowed" or "denied")
+func RecordDegradedDecision(scope, policy, decision string) {
+	DegradedDecisions.WithLabelValues(scope, policy, decision).Inc()
+}
+
+// RecordCaptchaVerification records a captcha check (result: "success", "missing", "invalid" or "error")
+func RecordCaptchaVerification(provider, result string) {
+	CaptchaVerifications.WithLabelValues(provider, result).Inc()
+}
+
+// RecordRiskDecision records a risk engine decision (action: "allow", "captcha", "step_up" or "block")
+func RecordRiskDecision(action string) {
+	RiskDecisions.WithLabelValues(action).Inc()
+}
+
+// RecordEmailPolicyRejection records an email destination rejected by a policy list ("disposable" or "role")
+func RecordEmailPolicyRejection(list, purpose string) {
+	EmailPolicyRejections.WithLabelValues(list, purpose).Inc()
+}
+
+// SetEmailPolicyEntries reports the size of a loaded email policy list
+func SetEmailPolicyEntries(list string, n int) {
+	EmailPolicyEntries.WithLabelValues(list).Set(float64(n))
+}
+
+// SetTemplates reports the valid and invalid template files of the last load
+func SetTemplates(valid, invalid int) {
+	Templates.WithLabelValues("valid").Set(float64(valid))
+	Templates.WithLabelValues("invalid").Set(float64(invalid))
+}
+
+// RecordTOTPRequest records a herald-totp call (result: "success", "rejected", "error" or "circuit_open")
+func RecordTOTPRequest(operation, result string, duration time.Duration) {
+	TOTPRequests.WithLabelValues(operation, result).Inc()
+	TOTPRequestDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// SetTOTPCircuitOpen reports the herald-totp circuit breaker state
+func SetTOTPCircuitOpen(open bool) {
+	if open {
+		TOTPCircuitOpen.Set(1)
+	} else {
+		TOTPCircuitOpen.Set(0)
+	}
+}
@@ -33,11 +33,11 @@ func TestRecordOTPSend(t *testing.T) {
 	OTP.SendDuration.Reset()
 
 	duration := 100 * time.Millisecond
-	RecordOTPSend("email", "smtp", "success", duration)
+	RecordOTPSend("sms", "aliyun", "CN", "success", duration)
 
 	// Verify send counter was incremented
 	metric := &dto.Metric{}
-	if err := OTP.SendsTotal.WithLabelValues("email", "smtp", "success").Write(metric); err != nil {
+	if err := OTP.SendsTotal.WithLabelValues("sms", "aliyun", "CN", "success").Write(metric); err != nil {
 		t.Fatalf("Failed to write metric: %v", err)
 	}
 
@@ -177,7 +177,7 @@ func TestMetricsFailureCases(t *testing.T) {
 
 	// Test failure cases
 	RecordChallengeCreated("email", "login", "failure")
-	RecordOTPSend("email", "smtp", "failure", 50*time.Millisecond)
+	RecordOTPSend("email", "smtp", "", "failure", 50*time.Millisecond)
 	RecordVerification("failure", "expired")
 
 	// Verify failure metrics
@@ -190,7 +190,7 @@ func TestMetricsFailureCases(t *testing.T) {
 	}
 
 	sendMetric := &dto.Metric{}
-	if err := OTP.SendsTotal.WithLabelValues("email", "smtp", "failure").Write(sendMetric); err != nil {
+	if err := OTP.SendsTotal.WithLabelValues("email", "smtp", "unknown", "failure").Write(sendMetric); err != nil {
 		t.Fatalf("Failed to write metric: %v", err)
 	}
 	if sendMetric.Counter.GetValue() != 1.0 {
@@ -231,3 +231,130 @@ func TestRecordRedisFailure(t *testing.T) {
 	RecordRedisFailure("get", duration)
 	RecordRedisFailure("set", duration)
 }
+
+func TestRecordQuotaEvent(t *testing.T) {
+	QuotaEvents.Reset()
+
+	RecordQuotaEvent("sms-daily", "warning")
+	RecordQuotaEvent("sms-daily", "exceeded")
+	RecordQuotaEvent("sms-daily", "exceeded")
+
+	metric := &dto.Metric{}
+	if err := QuotaEvents.WithLabelValues("sms-daily", "exceeded").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 2.0 {
+		t.Errorf("Counter value = %v, want 2.0", metric.Counter.GetValue())
+	}
+}
+
+func TestRecordDegradedDecision(t *testing.T) {
+	DegradedDecisions.Reset()
+
+	RecordDegradedDecision("user", "local", "allowed")
+	RecordDegradedDecision("user", "local", "denied")
+
+	metric := &dto.Metric{}
+	if err := DegradedDecisions.WithLabelValues("user", "local", "denied").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 1.0 {
+		t.Errorf("Counter value = %v, want 1.0", metric.Counter.GetValue())
+	}
+}
+
+func TestRecordCaptchaVerification(t *testing.T) {
+	CaptchaVerifications.Reset()
+
+	RecordCaptchaVerification("pow", "success")
+	RecordCaptchaVerification("pow", "invalid")
+
+	metric := &dto.Metric{}
+	if err := CaptchaVerifications.WithLabelValues("pow", "invalid").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 1.0 {
+		t.Errorf("Counter value = %v, want 1.0", metric.Counter.GetValue())
+	}
+}
+
+func TestRecordRiskDecision(t *testing.T) {
+	RiskDecisions.Reset()
+
+	RecordRiskDecision("allow")
+	RecordRiskDecision("block")
+	RecordRiskDecision("block")
+
+	metric := &dto.Metric{}
+	if err := RiskDecisions.WithLabelValues("block").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 2.0 {
+		t.Errorf("Counter value = %v, want 2.0", metric.Counter.GetValue())
+	}
+}
+
+func TestRecordEmailPolicy(t *testing.T) {
+	EmailPolicyRejections.Reset()
+	EmailPolicyEntries.Reset()
+
+	RecordEmailPolicyRejection("disposable", "signup")
+	SetEmailPolicyEntries("disposable", 3)
+
+	metric := &dto.Metric{}
+	if err := EmailPolicyRejections.WithLabelValues("disposable", "signup").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 1.0 {
+		t.Errorf("Counter value = %v, want 1.0", metric.Counter.GetValue())
+	}
+
+	metric = &dto.Metric{}
+	if err := EmailPolicyEntries.WithLabelValues("disposable").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Gauge.GetValue() != 3.0 {
+		t.Errorf("Gauge value = %v, want 3.0", metric.Gauge.GetValue())
+	}
+}
+
+func TestRecordTOTPRequest(t *testing.T) {
+	TOTPRequests.Reset()
+	TOTPRequestDuration.Reset()
+
+	RecordTOTPRequest("verify", "rejected", 20*time.Millisecond)
+	SetTOTPCircuitOpen(true)
+
+	metric := &dto.Metric{}
+	if err := TOTPRequests.WithLabelValues("verify", "rejected").Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Counter.GetValue() != 1.0 {
+		t.Errorf("Counter value = %v, want 1.0", metric.Counter.GetValue())
+	}
+
+	metric = &dto.Metric{}
+	if err := TOTPCircuitOpen.Write(metric); err != nil {
+		t.Fatalf("Failed to write metric: %v", err)
+	}
+	if metric.Gauge.GetValue() != 1.0 {
+		t.Errorf("Gauge value = %v, want 1.0", metric.Gauge.GetValue())
+	}
+	SetTOTPCircuitOpen(false)
+}
+
+func TestSetTemplates(t *testing.T) {
+	Templates.Reset()
+
+	SetTemplates(4, 1)
+
+	for status, want := range map[string]float64{"valid": 4, "invalid": 1} {
+		metric := &dto.Metric{}
+		if err := Templates.WithLabelValues(status).Write(metric); err != nil {
+			t.Fatalf("Failed to write metric: %v", err)
+		}
+		if metric.Gauge.GetValue() != want {
+			t.Errorf("Gauge %s value = %v, want %v", status, metric.Gauge.GetValue(), want)
+		}
+	}
+}
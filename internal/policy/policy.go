@@ -0,0 +1,210 @@
+// Package policy decides whether an action needs step-up authentication. Policies are read
+// from a JSON file; the first policy matching the action and the risk signals applies. A
+// step-up is not needed when the user verified recently enough with an acceptable method.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Decision reasons
+const (
+	ReasonNoPolicy             = "no_policy"              // No policy matches: no step-up
+	ReasonRecentlyVerified     = "recently_verified"      // Verified within max_age with an acceptable method
+	ReasonNoRecentVerification = "no_recent_verification" // No verification known
+	ReasonVerificationTooOld   = "verification_too_old"   // Last verification older than max_age
+	ReasonInsufficientAMR      = "insufficient_amr"       // Last verification used no acceptable method
+)
+
+// Wildcard matches any action
+const Wildcard = "*"
+
+// factorAMR are the AMR values each factor type yields, used when acceptable_amr is omitted
+var factorAMR = map[string][]string{
+	"otp":            {"otp"},
+	"push":           {"swk"},
+	"totp":           {"otp"},
+	"webauthn":       {"hwk"},
+	"recovery_codes": {"otp"},
+}
+
+// Policy is one step-up rule
+type Policy struct {
+	Name    string
+	Actions []string // Actions (or purposes) the policy covers; "*" matches all
+	// Conditions (all optional): the policy only applies when the risk score reaches MinRiskScore
+	// or any of Signals is present. Without conditions it always applies.
+	MinRiskScore int
+	Signals      []string
+	// MaxAge is how recent a verification must be to skip the step-up; 0 always requires one
+	MaxAge time.Duration
+	// Factors are the factor types that can satisfy the step-up, in order of preference
+	Factors []string
+	// AcceptableAMR are the AMR values a verification must include one of
+	AcceptableAMR []string
+}
+
+// policyJSON is the JSON representation of a Policy (max_age as a duration string)
+type policyJSON struct {
+	Name          string   `json:"name"`
+	Actions       []string `json:"actions"`
+	MinRiskScore  int      `json:"min_risk_score"`
+	Signals       []string `json:"signals"`
+	MaxAge        string   `json:"max_age"`
+	Factors       []string `json:"factors"`
+	AcceptableAMR []string `json:"acceptable_amr"`
+}
+
+// Input describes the action being attempted
+type Input struct {
+	UserID    string
+	Action    string
+	RiskScore int
+	Signals   []string
+	// LastVerifiedAt and AMR describe the user's last successful verification (zero if unknown)
+	LastVerifiedAt time.Time
+	AMR            []string
+}
+
+// Decision is the outcome of an evaluation
+type Decision struct {
+	StepUpRequired  bool
+	Policy          string // Name of the matching policy; empty with ReasonNoPolicy
+	Reason          string
+	RequiredFactors []string
+	AcceptableAMR   []string
+	MaxAge          time.Duration
+}
+
+// Engine evaluates policies in order
+type Engine struct {
+	policies []Policy
+}
+
+// New creates an engine from already validated policies
+func New(policies []Policy) *Engine {
+	return &Engine{policies: policies}
+}
+
+// Load reads policies from a JSON file
+func Load(path string) (*Engine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	policies, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return New(policies), nil
+}
+
+// Parse parses and validates policies from {"policies": [...]}
+func Parse(data []byte) ([]Policy, error) {
+	var doc struct {
+		Policies []policyJSON `json:"policies"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse policy JSON: %w", err)
+	}
+
+	policies := make([]Policy, 0, len(doc.Policies))
+	seen := make(map[string]bool)
+	for i, p := range doc.Policies {
+		name := strings.TrimSpace(p.Name)
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("policy %d: missing or duplicate name %q", i, p.Name)
+		}
+		if len(p.Actions) == 0 {
+			return nil, fmt.Errorf("policy %s: actions required", name)
+		}
+		var maxAge time.Duration
+		if p.MaxAge != "" {
+			d, err := time.ParseDuration(p.MaxAge)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("policy %s: invalid max_age %q", name, p.MaxAge)
+			}
+			maxAge = d
+		}
+		if len(p.Factors) == 0 {
+			return nil, fmt.Errorf("policy %s: factors required", name)
+		}
+		amr := p.AcceptableAMR
+		for _, f := range p.Factors {
+			values, ok := factorAMR[f]
+			if !ok {
+				return nil, fmt.Errorf("policy %s: unknown factor %q", name, f)
+			}
+			if len(p.AcceptableAMR) == 0 {
+				for _, v := range values {
+					if !slices.Contains(amr, v) {
+						amr = append(amr, v)
+					}
+				}
+			}
+		}
+		seen[name] = true
+		policies = append(policies, Policy{
+			Name:          name,
+			Actions:       p.Actions,
+			MinRiskScore:  p.MinRiskScore,
+			Signals:       p.Signals,
+			MaxAge:        maxAge,
+			Factors:       p.Factors,
+			AcceptableAMR: amr,
+		})
+	}
+	return policies, nil
+}
+
+// Policies returns the loaded policies
+func (e *Engine) Policies() []Policy {
+	return e.policies
+}
+
+// Evaluate applies the first policy matching in
+func (e *Engine) Evaluate(in Input, now time.Time) Decision {
+	for _, p := range e.policies {
+		if !p.matches(in) {
+			continue
+		}
+		d := Decision{
+			StepUpRequired:  true,
+			Policy:          p.Name,
+			RequiredFactors: p.Factors,
+			AcceptableAMR:   p.AcceptableAMR,
+			MaxAge:          p.MaxAge,
+		}
+		switch {
+		case in.LastVerifiedAt.IsZero():
+			d.Reason = ReasonNoRecentVerification
+		case p.MaxAge == 0 || now.Sub(in.LastVerifiedAt) > p.MaxAge:
+			d.Reason = ReasonVerificationTooOld
+		case !slices.ContainsFunc(in.AMR, func(v string) bool { return slices.Contains(p.AcceptableAMR, v) }):
+			d.Reason = ReasonInsufficientAMR
+		default:
+			d.StepUpRequired = false
+			d.Reason = ReasonRecentlyVerified
+		}
+		return d
+	}
+	return Decision{Reason: ReasonNoPolicy}
+}
+
+func (p *Policy) matches(in Input) bool {
+	if !slices.Contains(p.Actions, in.Action) && !slices.Contains(p.Actions, Wildcard) {
+		return false
+	}
+	if p.MinRiskScore == 0 && len(p.Signals) == 0 {
+		return true
+	}
+	if p.MinRiskScore > 0 && in.RiskScore >= p.MinRiskScore {
+		return true
+	}
+	return slices.ContainsFunc(in.Signals, func(s string) bool { return slices.Contains(p.Signals, s) })
+}
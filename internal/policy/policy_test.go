@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPolicies = `{
+  "policies": [
+    {"name": "payments", "actions": ["payment"], "max_age": "5m", "factors": ["webauthn", "push"]},
+    {"name": "risky", "actions": ["*"], "min_risk_score": 50, "signals": ["new_device"], "max_age": "15m", "factors": ["otp"]},
+    {"name": "delete", "actions": ["delete_account"], "factors": ["totp"], "acceptable_amr": ["otp", "hwk"]}
+  ]
+}`
+
+func TestParse_Defaults(t *testing.T) {
+	policies, err := Parse([]byte(testPolicies))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(policies) != 3 {
+		t.Fatalf("Parse() = %d policies, want 3", len(policies))
+	}
+	if got := strings.Join(policies[0].AcceptableAMR, ","); got != "hwk,swk" {
+		t.Errorf("derived acceptable AMR = %s, want hwk,swk", got)
+	}
+	if got := strings.Join(policies[2].AcceptableAMR, ","); got != "otp,hwk" {
+		t.Errorf("explicit acceptable AMR = %s, want otp,hwk", got)
+	}
+	if policies[0].MaxAge != 5*time.Minute || policies[2].MaxAge != 0 {
+		t.Errorf("max ages = %v, %v", policies[0].MaxAge, policies[2].MaxAge)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`{`,
+		`{"policies": [{"actions": ["x"], "factors": ["otp"]}]}`,
+		`{"policies": [{"name": "a", "factors": ["otp"]}]}`,
+		`{"policies": [{"name": "a", "actions": ["x"]}]}`,
+		`{"policies": [{"name": "a", "actions": ["x"], "factors": ["fax"]}]}`,
+		`{"policies": [{"name": "a", "actions": ["x"], "factors": ["otp"], "max_age": "soon"}]}`,
+		`{"policies": [{"name": "a", "actions": ["x"], "factors": ["otp"]}, {"name": "a", "actions": ["y"], "factors": ["otp"]}]}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) error = nil", data)
+		}
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	policies, err := Parse([]byte(testPolicies))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	e := New(policies)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		in         Input
+		wantStepUp bool
+		wantPolicy string
+		wantReason string
+	}{
+		{"no policy", Input{Action: "login"}, false, "", ReasonNoPolicy},
+		{"never verified", Input{Action: "payment"}, true, "payments", ReasonNoRecentVerification},
+		{"recent hwk", Input{Action: "payment", LastVerifiedAt: now.Add(-time.Minute), AMR: []string{"hwk"}}, false, "payments", ReasonRecentlyVerified},
+		{"recent otp only", Input{Action: "payment", LastVerifiedAt: now.Add(-time.Minute), AMR: []string{"otp", "sms"}}, true, "payments", ReasonInsufficientAMR},
+		{"too old", Input{Action: "payment", LastVerifiedAt: now.Add(-10 * time.Minute), AMR: []string{"hwk"}}, true, "payments", ReasonVerificationTooOld},
+		{"risk score", Input{Action: "login", RiskScore: 60}, true, "risky", ReasonNoRecentVerification},
+		{"signal", Input{Action: "login", Signals: []string{"new_device"}, LastVerifiedAt: now, AMR: []string{"otp"}}, false, "risky", ReasonRecentlyVerified},
+		{"low risk", Input{Action: "login", RiskScore: 10, Signals: []string{"country_mismatch"}}, false, "", ReasonNoPolicy},
+		{"max_age 0 always steps up", Input{Action: "delete_account", LastVerifiedAt: now, AMR: []string{"otp"}}, true, "delete", ReasonVerificationTooOld},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := e.Evaluate(tt.in, now)
+			if d.StepUpRequired != tt.wantStepUp || d.Policy != tt.wantPolicy || d.Reason != tt.wantReason {
+				t.Errorf("Evaluate() = %+v, want step-up %v, policy %q, reason %s", d, tt.wantStepUp, tt.wantPolicy, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(testPolicies), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, err := Load(path)
+	if err != nil || len(e.Policies()) != 3 {
+		t.Fatalf("Load() = %v, %v", e, err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load(missing) error = nil")
+	}
+}
@@ -0,0 +1,366 @@
+// Package push implements number-matching push approvals. A user's devices register a public
+// key (Ed25519 or ECDSA P-256); Herald sends a push through the push provider, and the device
+// approves or denies the challenge with an assertion signed by that key. The challenge itself
+// lives in the challenge store; this package keeps the devices and the decision state.
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	provider "github.com/soulteary/provider-kit"
+
+	"github.com/soulteary/herald/internal/lock"
+)
+
+// Channel is the push channel
+const Channel provider.Channel = "push"
+
+// Challenge statuses
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDenied   = "denied"
+	StatusExpired  = "expired"
+)
+
+// Assertion actions
+const (
+	ActionApprove = "approve"
+	ActionDeny    = "deny"
+)
+
+// Redis key prefixes
+const (
+	deviceKeyPrefix   = "otp:push:dev:"
+	devicesKeyPrefix  = "otp:push:devs:"
+	stateKeyPrefix    = "otp:push:state:"
+	decisionKeyPrefix = "otp:push:decision:"
+	listLockKeyPrefix = "otp:push:devlock:"
+)
+
+// listLockWait bounds how long a device list update waits for a concurrent one
+const listLockWait = 2 * time.Second
+
+var (
+	// ErrInvalidPublicKey is returned for keys that are not base64 PKIX Ed25519 or P-256 keys
+	ErrInvalidPublicKey = errors.New("invalid device public key")
+	// ErrInvalidSignature is returned when an assertion signature does not verify
+	ErrInvalidSignature = errors.New("invalid assertion signature")
+	// ErrStaleAssertion is returned when the assertion timestamp is outside the allowed skew
+	ErrStaleAssertion = errors.New("assertion timestamp out of range")
+	// ErrNotFound is returned for unknown devices and challenges
+	ErrNotFound = errors.New("not found")
+	// ErrAlreadyDecided is returned when a challenge was already approved or denied
+	ErrAlreadyDecided = errors.New("challenge already decided")
+)
+
+// deviceID matches device IDs (also the challenge destination)
+var deviceID = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,128}$`)
+
+// ValidDeviceID reports whether id is a well-formed device ID
+func ValidDeviceID(id string) bool {
+	return deviceID.MatchString(id)
+}
+
+// Device is a registered push device
+type Device struct {
+	ID     string `json:"device_id"`
+	UserID string `json:"user_id"`
+	// PublicKey is the base64 DER (PKIX) encoded Ed25519 or ECDSA P-256 public key
+	PublicKey string `json:"public_key"`
+	Name      string `json:"name,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// State is the decision state of a push challenge
+type State struct {
+	ChallengeID string `json:"challenge_id"`
+	UserID      string `json:"user_id"`
+	DeviceID    string `json:"device_id"`
+	Purpose     string `json:"purpose"`
+	Status      string `json:"status"`
+	ExpiresAt   int64  `json:"expires_at"`
+	DecidedAt   int64  `json:"decided_at,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// CurrentStatus returns the status, reporting pending challenges past their expiry as expired
+func (s *State) CurrentStatus(now time.Time) string {
+	if s.Status == StatusPending && now.Unix() >= s.ExpiresAt {
+		return StatusExpired
+	}
+	return s.Status
+}
+
+// ParsePublicKey parses a base64 (standard or URL, padded or not) DER PKIX public key.
+// Only Ed25519 and ECDSA P-256 keys are accepted.
+func ParsePublicKey(encoded string) (interface{}, error) {
+	der, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, ErrInvalidPublicKey
+		}
+		return k, nil
+	default:
+		return nil, ErrInvalidPublicKey
+	}
+}
+
+// AssertionMessage is the byte string a device signs to approve or deny a challenge:
+// "herald-push-v1\n<challenge_id>\n<action>\n<device_id>\n<number>\n<timestamp>"
+// (number is empty for deny)
+func AssertionMessage(challengeID, action, deviceID, number string, timestamp int64) []byte {
+	return []byte("herald-push-v1\n" + challengeID + "\n" + action + "\n" + deviceID + "\n" + number + "\n" + strconv.FormatInt(timestamp, 10))
+}
+
+// VerifyAssertion checks signature (base64) over message with the device public key.
+// ECDSA signatures are ASN.1 DER over the SHA-256 of message.
+func VerifyAssertion(publicKey string, message []byte, signature string) error {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	sig, err := decodeBase64(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, message, sig) {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(message)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// CheckTimestamp rejects assertion timestamps (Unix seconds) further than maxSkew from now
+func CheckTimestamp(timestamp int64, now time.Time, maxSkew time.Duration) error {
+	diff := now.Sub(time.Unix(timestamp, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > maxSkew {
+		return ErrStaleAssertion
+	}
+	return nil
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
+
+// Store keeps devices and challenge states in Redis
+type Store struct {
+	redis  *redis.Client
+	locker *lock.Locker
+}
+
+// NewStore creates a store
+func NewStore(redisClient *redis.Client) *Store {
+	return &Store{redis: redisClient, locker: lock.NewLocker(redisClient)}
+}
+
+// RegisterDevice stores d, replacing a device with the same ID for the same user
+func (s *Store) RegisterDevice(ctx context.Context, d Device) error {
+	if _, err := ParsePublicKey(d.PublicKey); err != nil {
+		return err
+	}
+	if d.CreatedAt == 0 {
+		d.CreatedAt = time.Now().Unix()
+	}
+	if err := s.setJSON(ctx, deviceKeyPrefix+d.UserID+":"+d.ID, d, 0); err != nil {
+		return err
+	}
+
+	return s.updateDeviceIDs(ctx, d.UserID, func(ids []string) []string {
+		for _, id := range ids {
+			if id == d.ID {
+				return ids
+			}
+		}
+		return append(ids, d.ID)
+	})
+}
+
+// Device returns the device deviceID of userID, or ErrNotFound
+func (s *Store) Device(ctx context.Context, userID, deviceID string) (*Device, error) {
+	var d Device
+	if err := s.getJSON(ctx, deviceKeyPrefix+userID+":"+deviceID, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Devices returns the devices of userID
+func (s *Store) Devices(ctx context.Context, userID string) ([]Device, error) {
+	ids, err := s.deviceIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]Device, 0, len(ids))
+	for _, id := range ids {
+		d, err := s.Device(ctx, userID, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, *d)
+	}
+	return devices, nil
+}
+
+// RemoveDevice deletes a device; removing an unknown device returns ErrNotFound
+func (s *Store) RemoveDevice(ctx context.Context, userID, deviceID string) error {
+	n, err := s.redis.Del(ctx, deviceKeyPrefix+userID+":"+deviceID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete push device: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return s.updateDeviceIDs(ctx, userID, func(ids []string) []string {
+		kept := ids[:0]
+		for _, id := range ids {
+			if id != deviceID {
+				kept = append(kept, id)
+			}
+		}
+		return kept
+	})
+}
+
+// updateDeviceIDs rewrites the device list of userID under a per-user lock, so concurrent
+// registrations and removals do not overwrite each other's changes
+func (s *Store) updateDeviceIDs(ctx context.Context, userID string, update func([]string) []string) error {
+	key := listLockKeyPrefix + userID
+	ctx, cancel := context.WithTimeout(ctx, listLockWait)
+	defer cancel()
+	for {
+		ok, err := s.locker.Lock(key)
+		if err != nil {
+			return fmt.Errorf("failed to lock push device list: %w", err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to lock push device list: %w", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer func() { _ = s.locker.Unlock(key) }()
+
+	ids, err := s.deviceIDs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ids = update(ids)
+	if len(ids) == 0 {
+		return s.redis.Del(ctx, devicesKeyPrefix+userID).Err()
+	}
+	return s.setJSON(ctx, devicesKeyPrefix+userID, ids, 0)
+}
+
+func (s *Store) deviceIDs(ctx context.Context, userID string) ([]string, error) {
+	var ids []string
+	if err := s.getJSON(ctx, devicesKeyPrefix+userID, &ids); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// SaveState stores the state of a push challenge for ttl
+func (s *Store) SaveState(ctx context.Context, state *State, ttl time.Duration) error {
+	return s.setJSON(ctx, stateKeyPrefix+state.ChallengeID, state, ttl)
+}
+
+// State returns the state of a push challenge, or ErrNotFound
+func (s *Store) State(ctx context.Context, challengeID string) (*State, error) {
+	var state State
+	if err := s.getJSON(ctx, stateKeyPrefix+challengeID, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Decide records the final status of a push challenge. Only the first decision wins;
+// later ones return ErrAlreadyDecided.
+func (s *Store) Decide(ctx context.Context, state *State, status, reason string) error {
+	ttl, err := s.redis.TTL(ctx, stateKeyPrefix+state.ChallengeID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read push state ttl: %w", err)
+	}
+	if ttl <= 0 {
+		return ErrNotFound
+	}
+	ok, err := s.redis.SetNX(ctx, decisionKeyPrefix+state.ChallengeID, status, ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record push decision: %w", err)
+	}
+	if !ok {
+		return ErrAlreadyDecided
+	}
+	state.Status = status
+	state.Reason = reason
+	state.DecidedAt = time.Now().Unix()
+	return s.SaveState(ctx, state, ttl)
+}
+
+func (s *Store) setJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.redis.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *Store) getJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := s.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,183 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+func encodeKey(t *testing.T, pub interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() error = %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestVerifyAssertion_Ed25519(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	key := encodeKey(t, pub)
+	msg := AssertionMessage("ch_1", ActionApprove, "phone-1", "42", 1730000000)
+	sig := base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, msg))
+
+	if err := VerifyAssertion(key, msg, sig); err != nil {
+		t.Errorf("VerifyAssertion() error = %v", err)
+	}
+	other := AssertionMessage("ch_1", ActionApprove, "phone-1", "43", 1730000000)
+	if err := VerifyAssertion(key, other, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifyAssertion(other message) error = %v, want ErrInvalidSignature", err)
+	}
+	if err := VerifyAssertion(key, msg, "not base64!"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifyAssertion(bad signature) error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyAssertion_P256(t *testing.T) {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key := encodeKey(t, &priv.PublicKey)
+	msg := AssertionMessage("ch_1", ActionDeny, "phone-1", "", 1730000000)
+	digest := sha256.Sum256(msg)
+	der, _ := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+
+	if err := VerifyAssertion(key, msg, base64.StdEncoding.EncodeToString(der)); err != nil {
+		t.Errorf("VerifyAssertion() error = %v", err)
+	}
+}
+
+func TestParsePublicKey_Rejected(t *testing.T) {
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	for name, key := range map[string]string{
+		"not base64": "%%%",
+		"not DER":    base64.StdEncoding.EncodeToString([]byte("hello")),
+		"P-384":      encodeKey(t, &p384.PublicKey),
+	} {
+		if _, err := ParsePublicKey(key); !errors.Is(err, ErrInvalidPublicKey) {
+			t.Errorf("ParsePublicKey(%s) error = %v, want ErrInvalidPublicKey", name, err)
+		}
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Unix(1730000000, 0)
+	if err := CheckTimestamp(now.Unix()-30, now, time.Minute); err != nil {
+		t.Errorf("CheckTimestamp(-30s) error = %v", err)
+	}
+	if err := CheckTimestamp(now.Unix()+120, now, time.Minute); !errors.Is(err, ErrStaleAssertion) {
+		t.Errorf("CheckTimestamp(+120s) error = %v, want ErrStaleAssertion", err)
+	}
+}
+
+func TestStore_Devices(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	store := NewStore(client)
+	ctx := context.Background()
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key := encodeKey(t, pub)
+
+	if err := store.RegisterDevice(ctx, Device{ID: "phone-1", UserID: "u1", PublicKey: "bad"}); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("RegisterDevice(bad key) error = %v, want ErrInvalidPublicKey", err)
+	}
+	for _, id := range []string{"phone-1", "tablet", "phone-1"} {
+		if err := store.RegisterDevice(ctx, Device{ID: id, UserID: "u1", PublicKey: key}); err != nil {
+			t.Fatalf("RegisterDevice(%s) error = %v", id, err)
+		}
+	}
+
+	devices, err := store.Devices(ctx, "u1")
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("Devices() = %+v, %v; want 2 devices", devices, err)
+	}
+	if _, err := store.Device(ctx, "u2", "phone-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Device(other user) error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.RemoveDevice(ctx, "u1", "phone-1"); err != nil {
+		t.Fatalf("RemoveDevice() error = %v", err)
+	}
+	if err := store.RemoveDevice(ctx, "u1", "phone-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RemoveDevice(again) error = %v, want ErrNotFound", err)
+	}
+	if devices, _ := store.Devices(ctx, "u1"); len(devices) != 1 || devices[0].ID != "tablet" {
+		t.Errorf("Devices() after remove = %+v", devices)
+	}
+}
+
+func TestStore_RegisterDeviceConcurrent(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	store := NewStore(client)
+	ctx := context.Background()
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key := encodeKey(t, pub)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := store.RegisterDevice(ctx, Device{ID: fmt.Sprintf("phone-%d", i), UserID: "u1", PublicKey: key}); err != nil {
+				t.Errorf("RegisterDevice(phone-%d) error = %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if devices, err := store.Devices(ctx, "u1"); err != nil || len(devices) != 50 {
+		t.Errorf("Devices() = %d devices, %v; want 50", len(devices), err)
+	}
+}
+
+func TestStore_Decide(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	store := NewStore(client)
+	ctx := context.Background()
+
+	state := &State{ChallengeID: "ch_1", UserID: "u1", DeviceID: "phone-1", Status: StatusPending, ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	if err := store.SaveState(ctx, state, time.Minute); err != nil {
+		t.Fatalf("SaveState() error = %v", err)
+	}
+
+	if err := store.Decide(ctx, state, StatusDenied, "user_denied"); err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if err := store.Decide(ctx, state, StatusApproved, ""); !errors.Is(err, ErrAlreadyDecided) {
+		t.Errorf("second Decide() error = %v, want ErrAlreadyDecided", err)
+	}
+
+	got, err := store.State(ctx, "ch_1")
+	if err != nil || got.Status != StatusDenied || got.Reason != "user_denied" || got.DecidedAt == 0 {
+		t.Errorf("State() = %+v, %v", got, err)
+	}
+	if _, err := store.State(ctx, "ch_missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("State(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestState_CurrentStatus(t *testing.T) {
+	now := time.Unix(1730000000, 0)
+	s := &State{Status: StatusPending, ExpiresAt: now.Unix() - 1}
+	if got := s.CurrentStatus(now); got != StatusExpired {
+		t.Errorf("CurrentStatus() = %q, want expired", got)
+	}
+	s = &State{Status: StatusApproved, ExpiresAt: now.Unix() - 1}
+	if got := s.CurrentStatus(now); got != StatusApproved {
+		t.Errorf("CurrentStatus() = %q, want approved", got)
+	}
+}
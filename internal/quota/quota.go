@@ -0,0 +1,278 @@
+// Package quota provides global send budgets for Herald.
+// Budgets cap the total number of sends per channel, provider and/or country
+// over a time window (e.g. "no more than 50k SMS per day"), independent of
+// the per-user, per-IP and per-destination rate limits.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/metrics"
+	"github.com/soulteary/herald/internal/ratelimit"
+)
+
+// KeyPrefix is the Redis key prefix for quota counters
+const KeyPrefix = "otp:quota:"
+
+// Rule describes a single send budget.
+// Empty Channel, Provider or Country match any value.
+type Rule struct {
+	Name     string
+	Channel  string
+	Provider string
+	// Country is either a calling code prefix (e.g. "+234"), matched against the
+	// destination, or an ISO 3166-1 alpha-2 code (e.g. "NG"), matched against Target.Country.
+	Country string
+	Limit   int
+	Window  time.Duration
+	// WarnAt is the fraction of Limit (0-1) at which a soft warning is emitted; 0 disables warnings
+	WarnAt float64
+}
+
+// ruleJSON is the JSON representation of a Rule (window as a duration string)
+type ruleJSON struct {
+	Name     string  `json:"name"`
+	Channel  string  `json:"channel"`
+	Provider string  `json:"provider"`
+	Country  string  `json:"country"`
+	Limit    int     `json:"limit"`
+	Window   string  `json:"window"`
+	WarnAt   float64 `json:"warn_at"`
+}
+
+// Target identifies the send being checked against the budgets
+type Target struct {
+	Channel     string
+	Provider    string
+	Destination string
+	Country     string
+}
+
+// Decision is the result of checking a Target against all matching rules
+type Decision struct {
+	Allowed bool
+	// Rule is the name of the rule that denied the send (empty when allowed)
+	Rule string
+	// Warnings lists rules whose soft threshold has been reached
+	Warnings []string
+	// reserved holds the units taken from each rule, returned by Refund
+	reserved []reservation
+}
+
+// reservation is one unit taken from a rule's current window
+type reservation struct {
+	rule   string
+	window int64
+	ttl    time.Duration
+}
+
+// ParseRules parses rules from a JSON array, e.g.
+// [{"name":"sms-daily","channel":"sms","limit":50000,"window":"24h","warn_at":0.8}]
+func ParseRules(data string) ([]Rule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var raw []ruleJSON
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse quota rules JSON: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(raw))
+	for i, r := range raw {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("quota rule %d: invalid window %q", i, r.Window)
+		}
+		if r.Limit <= 0 {
+			return nil, fmt.Errorf("quota rule %d: limit must be positive", i)
+		}
+		if r.WarnAt < 0 || r.WarnAt > 1 {
+			return nil, fmt.Errorf("quota rule %d: warn_at must be between 0 and 1", i)
+		}
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("%s:%s:%s:%s", r.Channel, r.Provider, r.Country, window)
+		}
+		rules = append(rules, Rule{
+			Name:     name,
+			Channel:  r.Channel,
+			Provider: r.Provider,
+			Country:  r.Country,
+			Limit:    r.Limit,
+			Window:   window,
+			WarnAt:   r.WarnAt,
+		})
+	}
+	return rules, nil
+}
+
+// Matches reports whether the rule applies to the target
+func (r Rule) Matches(t Target) bool {
+	if r.Channel != "" && r.Channel != t.Channel {
+		return false
+	}
+	if r.Provider != "" && r.Provider != t.Provider {
+		return false
+	}
+	if r.Country == "" {
+		return true
+	}
+	if strings.HasPrefix(r.Country, "+") {
+		return strings.HasPrefix(normalizePhone(t.Destination), normalizePhone(r.Country))
+	}
+	return strings.EqualFold(r.Country, t.Country)
+}
+
+// normalizePhone strips formatting characters so "+234 80-1234" and "+234801234" compare equal
+func normalizePhone(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c == '+' || (c >= '0' && c <= '9') {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Manager checks sends against global budgets stored in Redis.
+// Every rule counts units in a fixed window: otp:quota:<rule>:<window start> is incremented per send,
+// otp:quota:refund:<rule>:<window start> per unit given back; usage is the difference of the two.
+type Manager struct {
+	redis  *redis.Client
+	rules  []Rule
+	policy ratelimit.FailurePolicy
+	local  *ratelimit.LocalLimiter
+}
+
+// NewManager creates a new quota manager. Budgets fail open until SetFailurePolicy is called.
+func NewManager(redisClient *redis.Client, rules []Rule) *Manager {
+	return &Manager{
+		redis:  redisClient,
+		rules:  rules,
+		policy: ratelimit.FailOpen,
+		local:  ratelimit.NewLocalLimiter(),
+	}
+}
+
+// SetFailurePolicy sets how rules are decided while Redis is unavailable
+func (m *Manager) SetFailurePolicy(policy ratelimit.FailurePolicy) {
+	m.policy = policy
+}
+
+// Rules returns the configured rules
+func (m *Manager) Rules() []Rule {
+	return m.rules
+}
+
+// Check takes one unit from every rule matching the target. A send is allowed only when all of
+// them have budget left; when one denies, the units already taken from the others are given back.
+// Soft thresholds are reported as warnings and recorded in metrics.
+// On Redis errors the affected rule is decided by the failure policy and the error is returned alongside the decision.
+func (m *Manager) Check(ctx context.Context, t Target) (Decision, error) {
+	decision := Decision{Allowed: true}
+	var firstErr error
+	var warnings []string
+
+	deny := func(rule string) (Decision, error) {
+		if err := m.Refund(ctx, decision); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return Decision{Rule: rule}, firstErr
+	}
+
+	for _, rule := range m.rules {
+		if !rule.Matches(t) {
+			continue
+		}
+
+		start := time.Now()
+		res, used, err := m.reserve(ctx, rule, start)
+		if res.rule != "" {
+			decision.reserved = append(decision.reserved, res)
+		}
+		if err != nil {
+			metrics.RecordRedisFailure("quota", time.Since(start))
+			if firstErr == nil {
+				firstErr = fmt.Errorf("quota rule %s: %w", rule.Name, err)
+			}
+			if allowed, _, _ := ratelimit.DegradedCheckLimit(m.local, m.policy, ratelimit.ScopeQuota, rule.Name, rule.Limit, rule.Window); !allowed {
+				return deny(rule.Name)
+			}
+			continue
+		}
+		metrics.RecordRedisSuccess("quota", time.Since(start))
+
+		if used > rule.Limit {
+			metrics.RecordQuotaEvent(rule.Name, "exceeded")
+			return deny(rule.Name)
+		}
+
+		if rule.WarnAt > 0 && float64(used) >= rule.WarnAt*float64(rule.Limit) {
+			warnings = append(warnings, rule.Name)
+		}
+	}
+
+	// Warnings only count for sends that go out
+	for _, name := range warnings {
+		metrics.RecordQuotaEvent(name, "warning")
+	}
+	decision.Warnings = warnings
+	return decision, firstErr
+}
+
+// Refund gives back the units an allowed decision took, e.g. when the send failed
+func (m *Manager) Refund(ctx context.Context, d Decision) error {
+	var firstErr error
+	for _, res := range d.reserved {
+		key := m.refundKey(res.rule, res.window)
+		if err := m.redis.Incr(ctx, key).Err(); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("quota rule %s: refund: %w", res.rule, err)
+			}
+			continue
+		}
+		_ = m.redis.Expire(ctx, key, res.ttl).Err()
+	}
+	return firstErr
+}
+
+// reserve takes one unit from the rule's current window and returns the window's usage including it.
+// The reservation is empty when no unit was taken.
+func (m *Manager) reserve(ctx context.Context, rule Rule, now time.Time) (reservation, int, error) {
+	window := now.UnixNano() / int64(rule.Window)
+	windowEnd := time.Unix(0, (window+1)*int64(rule.Window))
+
+	usedKey := m.usedKey(rule.Name, window)
+	used, err := m.redis.Incr(ctx, usedKey).Result()
+	if err != nil {
+		return reservation{}, 0, err
+	}
+	// Keys outlive the window slightly so a late refund still finds its counter
+	res := reservation{rule: rule.Name, window: window, ttl: time.Until(windowEnd) + time.Minute}
+	if used == 1 {
+		if err := m.redis.Expire(ctx, usedKey, res.ttl).Err(); err != nil {
+			return res, 0, err
+		}
+	}
+	refunded, err := m.redis.Get(ctx, m.refundKey(rule.Name, window)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return res, 0, err
+	}
+	return res, int(used - refunded), nil
+}
+
+func (m *Manager) usedKey(rule string, window int64) string {
+	return fmt.Sprintf("%s%s:%d", KeyPrefix, rule, window)
+}
+
+func (m *Manager) refundKey(rule string, window int64) string {
+	return fmt.Sprintf("%srefund:%s:%d", KeyPrefix, rule, window)
+}
@@ -0,0 +1,226 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/ratelimit"
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+// testRedisClient returns a mock Redis client for testing
+func testRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	client, _ := testutil.NewTestRedisClient()
+	return client
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`[{"name":"sms-daily","channel":"sms","limit":50000,"window":"24h","warn_at":0.8},{"channel":"sms","country":"+234","limit":500,"window":"1h"}]`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("ParseRules() returned %d rules, want 2", len(rules))
+	}
+	if rules[0].Name != "sms-daily" || rules[0].Limit != 50000 || rules[0].Window != 24*time.Hour || rules[0].WarnAt != 0.8 {
+		t.Errorf("ParseRules() rule[0] = %+v", rules[0])
+	}
+	if rules[1].Name == "" {
+		t.Error("ParseRules() should derive a name for unnamed rules")
+	}
+}
+
+func TestParseRules_Empty(t *testing.T) {
+	rules, err := ParseRules("")
+	if err != nil {
+		t.Fatalf("ParseRules(\"\") error = %v", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("ParseRules(\"\") returned %d rules, want 0", len(rules))
+	}
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"invalid json", `{`},
+		{"missing window", `[{"channel":"sms","limit":10}]`},
+		{"zero limit", `[{"channel":"sms","limit":0,"window":"1h"}]`},
+		{"warn_at out of range", `[{"channel":"sms","limit":10,"window":"1h","warn_at":1.5}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRules(tt.data); err == nil {
+				t.Errorf("ParseRules(%q) expected error", tt.data)
+			}
+		})
+	}
+}
+
+func TestRule_Matches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		target Target
+		want   bool
+	}{
+		{"any", Rule{}, Target{Channel: "sms"}, true},
+		{"channel match", Rule{Channel: "sms"}, Target{Channel: "sms"}, true},
+		{"channel mismatch", Rule{Channel: "sms"}, Target{Channel: "email"}, false},
+		{"provider mismatch", Rule{Provider: "aliyun"}, Target{Provider: "tencent"}, false},
+		{"calling code match", Rule{Country: "+234"}, Target{Destination: "+234 801-234-5678"}, true},
+		{"calling code mismatch", Rule{Country: "+234"}, Target{Destination: "+8613800138000"}, false},
+		{"iso country match", Rule{Country: "ng"}, Target{Country: "NG"}, true},
+		{"iso country unknown", Rule{Country: "NG"}, Target{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.target); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_Check_HardLimit(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, []Rule{
+		{Name: "ng-hourly", Channel: "sms", Country: "+234", Limit: 2, Window: time.Hour},
+	})
+	ctx := context.Background()
+	target := Target{Channel: "sms", Destination: "+2348012345678"}
+
+	for i := 0; i < 2; i++ {
+		d, err := m.Check(ctx, target)
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+		if !d.Allowed {
+			t.Fatalf("Check() #%d should be allowed", i+1)
+		}
+	}
+
+	d, err := m.Check(ctx, target)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if d.Allowed {
+		t.Fatal("Check() should deny once the budget is exhausted")
+	}
+	if d.Rule != "ng-hourly" {
+		t.Errorf("Check() rule = %q, want ng-hourly", d.Rule)
+	}
+
+	// Other countries are not affected
+	d, _ = m.Check(ctx, Target{Channel: "sms", Destination: "+8613800138000"})
+	if !d.Allowed {
+		t.Error("Check() should allow destinations outside the rule")
+	}
+}
+
+func TestManager_Check_SoftWarning(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, []Rule{
+		{Name: "email-daily", Channel: "email", Limit: 4, Window: 24 * time.Hour, WarnAt: 0.5},
+	})
+	ctx := context.Background()
+	target := Target{Channel: "email", Destination: "a@example.com"}
+
+	d, _ := m.Check(ctx, target)
+	if len(d.Warnings) != 0 {
+		t.Errorf("Check() #1 warnings = %v, want none", d.Warnings)
+	}
+	d, _ = m.Check(ctx, target)
+	if !d.Allowed || len(d.Warnings) != 1 || d.Warnings[0] != "email-daily" {
+		t.Errorf("Check() #2 = %+v, want allowed with warning", d)
+	}
+}
+
+func TestManager_Check_DeniedSendTakesNoBudget(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, []Rule{
+		{Name: "sms-daily", Channel: "sms", Limit: 2, Window: 24 * time.Hour},
+		{Name: "ng-hourly", Channel: "sms", Country: "+234", Limit: 1, Window: time.Hour},
+	})
+	ctx := context.Background()
+	ng := Target{Channel: "sms", Destination: "+2348012345678"}
+
+	if d, _ := m.Check(ctx, ng); !d.Allowed {
+		t.Fatal("Check() #1 should be allowed")
+	}
+	// Denied by ng-hourly: the sms-daily unit is given back
+	for i := 0; i < 3; i++ {
+		if d, _ := m.Check(ctx, ng); d.Allowed || d.Rule != "ng-hourly" {
+			t.Fatalf("Check() = %+v, want denied by ng-hourly", d)
+		}
+	}
+	if d, _ := m.Check(ctx, Target{Channel: "sms", Destination: "+8613800138000"}); !d.Allowed {
+		t.Error("Check() should allow: denied sends must not spend sms-daily")
+	}
+}
+
+func TestManager_Refund(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	m := NewManager(redisClient, []Rule{{Name: "r", Limit: 1, Window: time.Hour, WarnAt: 1}})
+	ctx := context.Background()
+	target := Target{Channel: "sms"}
+
+	d, _ := m.Check(ctx, target)
+	if !d.Allowed || len(d.Warnings) != 1 {
+		t.Fatalf("Check() = %+v, want allowed with warning", d)
+	}
+	if d, _ := m.Check(ctx, target); d.Allowed {
+		t.Fatal("Check() should deny once the budget is exhausted")
+	}
+	if err := m.Refund(ctx, d); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if d, _ := m.Check(ctx, target); !d.Allowed {
+		t.Error("Check() should allow after the failed send was refunded")
+	}
+}
+
+func TestManager_Check_RedisError(t *testing.T) {
+	redisClient, mock := testutil.NewTestRedisClient()
+	defer func() { _ = redisClient.Close() }()
+	mock.SetShouldFail(true)
+
+	m := NewManager(redisClient, []Rule{{Name: "r", Limit: 1, Window: time.Hour}})
+	d, err := m.Check(context.Background(), Target{Channel: "sms"})
+	if err == nil {
+		t.Error("Check() expected error when Redis fails")
+	}
+	if !d.Allowed {
+		t.Error("Check() should not deny on Redis errors")
+	}
+}
+
+func TestManager_Check_RedisErrorFailClosed(t *testing.T) {
+	redisClient, mock := testutil.NewTestRedisClient()
+	defer func() { _ = redisClient.Close() }()
+	mock.SetShouldFail(true)
+
+	m := NewManager(redisClient, []Rule{{Name: "r", Limit: 1, Window: time.Hour}})
+	m.SetFailurePolicy(ratelimit.FailClosed)
+	d, err := m.Check(context.Background(), Target{Channel: "sms"})
+	if err == nil {
+		t.Error("Check() expected error when Redis fails")
+	}
+	if d.Allowed || d.Rule != "r" {
+		t.Errorf("Check() = %+v, want denied by rule r", d)
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// localPruneInterval is how often expired local entries are swept
+const localPruneInterval = time.Minute
+
+// LocalLimiter is an in-process fixed-window limiter used while Redis is unavailable.
+// Counts are per process, so in a multi-instance deployment the effective limit is
+// roughly limit × instances; it only needs to keep abuse bounded during an outage.
+type LocalLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*localWindow
+	cooldowns map[string]time.Time
+	lastPrune time.Time
+}
+
+type localWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+// NewLocalLimiter creates an empty in-process limiter
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{
+		windows:   make(map[string]*localWindow),
+		cooldowns: make(map[string]time.Time),
+		lastPrune: time.Now(),
+	}
+}
+
+// CheckLimit counts one request against key and reports whether it is within limit for the window.
+// Returns (allowed, remaining, resetTime) like the Redis-backed limiter.
+func (l *LocalLimiter) CheckLimit(key string, limit int, window time.Duration) (bool, int, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &localWindow{resetAt: now.Add(window)}
+		l.windows[key] = w
+	}
+	if w.count >= limit {
+		return false, 0, w.resetAt
+	}
+	w.count++
+	return true, limit - w.count, w.resetAt
+}
+
+// CheckCooldown reports whether key is outside its cooldown and, if so, starts a new one.
+// Returns (allowed, resetTime).
+func (l *LocalLimiter) CheckCooldown(key string, cooldown time.Duration) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.pruneLocked(now)
+
+	if until, ok := l.cooldowns[key]; ok && now.Before(until) {
+		return false, until
+	}
+	until := now.Add(cooldown)
+	l.cooldowns[key] = until
+	return true, until
+}
+
+// pruneLocked drops expired entries at most once per localPruneInterval; callers hold l.mu
+func (l *LocalLimiter) pruneLocked(now time.Time) {
+	if now.Sub(l.lastPrune) < localPruneInterval {
+		return
+	}
+	l.lastPrune = now
+	for k, w := range l.windows {
+		if !now.Before(w.resetAt) {
+			delete(l.windows, k)
+		}
+	}
+	for k, until := range l.cooldowns {
+		if !now.Before(until) {
+			delete(l.cooldowns, k)
+		}
+	}
+}
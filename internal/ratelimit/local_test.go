@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter_CheckLimit(t *testing.T) {
+	l := NewLocalLimiter()
+
+	for i := 0; i < 3; i++ {
+		allowed, remaining, _ := l.CheckLimit("k", 3, time.Minute)
+		if !allowed || remaining != 2-i {
+			t.Fatalf("CheckLimit() #%d = %v, %d; want allowed with %d remaining", i+1, allowed, remaining, 2-i)
+		}
+	}
+	if allowed, _, _ := l.CheckLimit("k", 3, time.Minute); allowed {
+		t.Error("CheckLimit() should deny over the limit")
+	}
+	if allowed, _, _ := l.CheckLimit("other", 3, time.Minute); !allowed {
+		t.Error("CheckLimit() keys should be independent")
+	}
+}
+
+func TestLocalLimiter_WindowResets(t *testing.T) {
+	l := NewLocalLimiter()
+
+	l.CheckLimit("k", 1, 10*time.Millisecond)
+	if allowed, _, _ := l.CheckLimit("k", 1, 10*time.Millisecond); allowed {
+		t.Fatal("CheckLimit() should deny within the window")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if allowed, _, _ := l.CheckLimit("k", 1, 10*time.Millisecond); !allowed {
+		t.Error("CheckLimit() should allow after the window resets")
+	}
+}
+
+func TestLocalLimiter_CheckCooldown(t *testing.T) {
+	l := NewLocalLimiter()
+
+	allowed, until := l.CheckCooldown("k", time.Minute)
+	if !allowed || time.Until(until) <= 0 {
+		t.Fatalf("CheckCooldown() first = %v, %v; want allowed", allowed, until)
+	}
+	if allowed, _ = l.CheckCooldown("k", time.Minute); allowed {
+		t.Error("CheckCooldown() should deny within the cooldown")
+	}
+}
+
+func TestLocalLimiter_Prune(t *testing.T) {
+	l := NewLocalLimiter()
+	l.CheckLimit("k", 1, time.Millisecond)
+	l.CheckCooldown("c", time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+	l.mu.Lock()
+	l.pruneLocked(time.Now().Add(localPruneInterval))
+	n := len(l.windows) + len(l.cooldowns)
+	l.mu.Unlock()
+	if n != 0 {
+		t.Errorf("pruneLocked() left %d entries, want 0", n)
+	}
+}
@@ -2,6 +2,9 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -10,16 +13,126 @@ import (
 	"github.com/soulteary/herald/internal/metrics"
 )
 
+// resendCountPrefix is the Redis key prefix for progressive cooldown step counters
+const resendCountPrefix = "otp:resend:count:"
+
+// FailurePolicy decides the outcome of a rate limit check when Redis is unavailable
+type FailurePolicy string
+
+const (
+	// FailOpen allows the request
+	FailOpen FailurePolicy = "open"
+	// FailClosed denies the request
+	FailClosed FailurePolicy = "closed"
+	// FailLocal applies the same limit with an in-process limiter
+	FailLocal FailurePolicy = "local"
+)
+
+// Rate limit scopes that carry a failure policy
+const (
+	ScopeUser        = "user"
+	ScopeIP          = "ip"
+	ScopeDestination = "destination"
+	ScopeCountry     = "country"
+	ScopeCooldown    = "cooldown"
+	ScopeQuota       = "quota"
+	ScopeCaptcha     = "captcha"
+	ScopeRecovery    = "recovery"
+	ScopeTOTP        = "totp"
+)
+
+// ParseFailurePolicy parses "open", "closed" or "local" (case-insensitive)
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch p := FailurePolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case FailOpen, FailClosed, FailLocal:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid failure policy %q (want open, closed or local)", s)
+}
+
+// DegradedCheckLimit decides a limit check for scope without Redis, according to policy,
+// and records the decision in metrics. Returns (allowed, remaining, resetTime).
+func DegradedCheckLimit(local *LocalLimiter, policy FailurePolicy, scope, key string, limit int, window time.Duration) (bool, int, time.Time) {
+	var (
+		allowed   bool
+		remaining int
+		resetTime time.Time
+	)
+	switch policy {
+	case FailOpen:
+		allowed = true
+	case FailLocal:
+		allowed, remaining, resetTime = local.CheckLimit(scope+":"+key, limit, window)
+	default:
+		policy = FailClosed
+	}
+	metrics.RecordDegradedDecision(scope, string(policy), decisionLabel(allowed))
+	return allowed, remaining, resetTime
+}
+
+// decisionLabel returns the metric label for a degraded decision
+func decisionLabel(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
 // Manager handles rate limiting operations
 type Manager struct {
-	limiter *rediskitratelimit.RateLimiter
+	limiter  *rediskitratelimit.RateLimiter
+	client   *redis.Client
+	local    *LocalLimiter
+	policies map[string]FailurePolicy
 }
 
-// NewManager creates a new rate limit manager
+// NewManager creates a new rate limit manager.
+// All scopes fail closed until SetFailurePolicies is called.
 func NewManager(redisClient *redis.Client) *Manager {
 	return &Manager{
-		limiter: rediskitratelimit.NewRateLimiter(redisClient),
+		limiter:  rediskitratelimit.NewRateLimiter(redisClient),
+		client:   redisClient,
+		local:    NewLocalLimiter(),
+		policies: map[string]FailurePolicy{},
+	}
+}
+
+// SetFailurePolicies sets the failure policy per scope; scopes not listed fail closed
+func (m *Manager) SetFailurePolicies(policies map[string]FailurePolicy) {
+	m.policies = make(map[string]FailurePolicy, len(policies))
+	for scope, p := range policies {
+		m.policies[scope] = p
+	}
+}
+
+// FailurePolicy returns the failure policy for scope
+func (m *Manager) FailurePolicy(scope string) FailurePolicy {
+	if p, ok := m.policies[scope]; ok {
+		return p
+	}
+	return FailClosed
+}
+
+// degradedLimit applies the scope's failure policy after a Redis error
+func (m *Manager) degradedLimit(scope, key string, limit int, window time.Duration) (bool, int, time.Time) {
+	return DegradedCheckLimit(m.local, m.FailurePolicy(scope), scope, key, limit, window)
+}
+
+// degradedCooldown applies the cooldown scope's failure policy after a Redis error
+func (m *Manager) degradedCooldown(key string, cooldown time.Duration) (bool, time.Time) {
+	policy := m.FailurePolicy(ScopeCooldown)
+	allowed := false
+	resetTime := time.Now().Add(cooldown)
+	switch policy {
+	case FailOpen:
+		allowed = true
+	case FailLocal:
+		allowed, resetTime = m.local.CheckCooldown(key, cooldown)
+	default:
+		policy = FailClosed
 	}
+	metrics.RecordDegradedDecision(ScopeCooldown, string(policy), decisionLabel(allowed))
+	return allowed, resetTime
 }
 
 // CheckRateLimit checks if a request should be rate limited
@@ -35,50 +148,156 @@ func (m *Manager) CheckRateLimit(ctx context.Context, key string, limit int, win
 	return allowed, remaining, resetTime, err
 }
 
-// CheckUserRateLimit checks rate limit for a user
+// CheckScopedRateLimit checks the rate limit for key within scope; the Redis key is "<scope>:<key>".
+// On Redis errors the scope's failure policy decides; the error is still returned.
+func (m *Manager) CheckScopedRateLimit(ctx context.Context, scope, key string, limit int, window time.Duration) (bool, int, time.Time, error) {
+	start := time.Now()
+	allowed, remaining, resetTime, err := m.limiter.CheckLimit(ctx, scope+":"+key, limit, window)
+	if err != nil {
+		metrics.RecordRedisFailure("ratelimit_"+scope, time.Since(start))
+		allowed, remaining, resetTime = m.degradedLimit(scope, key, limit, window)
+	} else {
+		metrics.RecordRedisSuccess("ratelimit_"+scope, time.Since(start))
+	}
+	return allowed, remaining, resetTime, err
+}
+
+// CheckUserRateLimit checks rate limit for a user.
+// On Redis errors the user scope's failure policy decides; the error is still returned.
 func (m *Manager) CheckUserRateLimit(ctx context.Context, userID string, limit int, window time.Duration) (bool, int, time.Time, error) {
 	start := time.Now()
 	allowed, remaining, resetTime, err := m.limiter.CheckUserLimit(ctx, userID, limit, window)
 	if err != nil {
 		metrics.RecordRedisFailure("ratelimit_user", time.Since(start))
+		allowed, remaining, resetTime = m.degradedLimit(ScopeUser, userID, limit, window)
 	} else {
 		metrics.RecordRedisSuccess("ratelimit_user", time.Since(start))
 	}
 	return allowed, remaining, resetTime, err
 }
 
-// CheckIPRateLimit checks rate limit for an IP address
+// CheckIPRateLimit checks rate limit for an IP address.
+// On Redis errors the ip scope's failure policy decides; the error is still returned.
 func (m *Manager) CheckIPRateLimit(ctx context.Context, ip string, limit int, window time.Duration) (bool, int, time.Time, error) {
 	start := time.Now()
 	allowed, remaining, resetTime, err := m.limiter.CheckIPLimit(ctx, ip, limit, window)
 	if err != nil {
 		metrics.RecordRedisFailure("ratelimit_ip", time.Since(start))
+		allowed, remaining, resetTime = m.degradedLimit(ScopeIP, ip, limit, window)
 	} else {
 		metrics.RecordRedisSuccess("ratelimit_ip", time.Since(start))
 	}
 	return allowed, remaining, resetTime, err
 }
 
-// CheckDestinationRateLimit checks rate limit for a destination (phone/email)
+// CheckDestinationRateLimit checks rate limit for a destination (phone/email).
+// On Redis errors the destination scope's failure policy decides; the error is still returned.
 func (m *Manager) CheckDestinationRateLimit(ctx context.Context, destination string, limit int, window time.Duration) (bool, int, time.Time, error) {
 	start := time.Now()
 	allowed, remaining, resetTime, err := m.limiter.CheckDestinationLimit(ctx, destination, limit, window)
 	if err != nil {
 		metrics.RecordRedisFailure("ratelimit_dest", time.Since(start))
+		allowed, remaining, resetTime = m.degradedLimit(ScopeDestination, destination, limit, window)
 	} else {
 		metrics.RecordRedisSuccess("ratelimit_dest", time.Since(start))
 	}
 	return allowed, remaining, resetTime, err
 }
 
-// CheckResendCooldown checks if resend is allowed (cooldown period)
+// CheckCountryRateLimit checks the aggregate rate limit for a destination country.
+// On Redis errors the country scope's failure policy decides; the error is still returned.
+func (m *Manager) CheckCountryRateLimit(ctx context.Context, country string, limit int, window time.Duration) (bool, int, time.Time, error) {
+	start := time.Now()
+	allowed, remaining, resetTime, err := m.limiter.CheckLimit(ctx, "country:"+country, limit, window)
+	if err != nil {
+		metrics.RecordRedisFailure("ratelimit_country", time.Since(start))
+		allowed, remaining, resetTime = m.degradedLimit(ScopeCountry, country, limit, window)
+	} else {
+		metrics.RecordRedisSuccess("ratelimit_country", time.Since(start))
+	}
+	return allowed, remaining, resetTime, err
+}
+
+// CheckResendCooldown checks if resend is allowed (cooldown period).
+// On Redis errors the cooldown scope's failure policy decides; the error is still returned.
 func (m *Manager) CheckResendCooldown(ctx context.Context, key string, cooldown time.Duration) (bool, time.Time, error) {
 	start := time.Now()
 	allowed, resetTime, err := m.limiter.CheckCooldown(ctx, key, cooldown)
 	if err != nil {
 		metrics.RecordRedisFailure("cooldown", time.Since(start))
+		allowed, resetTime = m.degradedCooldown(key, cooldown)
 	} else {
 		metrics.RecordRedisSuccess("cooldown", time.Since(start))
 	}
 	return allowed, resetTime, err
 }
+
+// CheckProgressiveCooldown checks if resend is allowed using a cooldown that grows with each send.
+// steps lists the cooldown applied after the 1st, 2nd, ... send; the last step repeats.
+// The step counter expires after window without sends, or when ResetProgressiveCooldown is called.
+// Returns (allowed, cooldown, error): when allowed, cooldown is the wait now applied before the next
+// resend; when denied, it is the time remaining on the current cooldown.
+// When Redis is unavailable the first step is applied under the cooldown scope's failure policy.
+func (m *Manager) CheckProgressiveCooldown(ctx context.Context, key string, steps []time.Duration, window time.Duration) (bool, time.Duration, error) {
+	if len(steps) == 0 {
+		return false, 0, errors.New("cooldown steps must not be empty")
+	}
+
+	start := time.Now()
+	sent, err := m.client.Get(ctx, resendCountPrefix+key).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		metrics.RecordRedisFailure("cooldown_step", time.Since(start))
+		allowed, resetTime := m.degradedCooldown(key, steps[0])
+		if !allowed {
+			return false, time.Until(resetTime), err
+		}
+		return true, steps[0], err
+	}
+	metrics.RecordRedisSuccess("cooldown_step", time.Since(start))
+
+	step := sent
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+	cooldown := steps[step]
+
+	allowed, resetTime, err := m.CheckResendCooldown(ctx, key, cooldown)
+	if !allowed {
+		return false, time.Until(resetTime), err
+	}
+	if err != nil {
+		// Allowed by the failure policy; the step counter cannot be updated either
+		return true, cooldown, err
+	}
+
+	start = time.Now()
+	if err := m.client.Incr(ctx, resendCountPrefix+key).Err(); err != nil {
+		metrics.RecordRedisFailure("cooldown_step", time.Since(start))
+		return true, cooldown, err
+	}
+	if window < cooldown {
+		window = cooldown
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+	if err := m.client.Expire(ctx, resendCountPrefix+key, window).Err(); err != nil {
+		metrics.RecordRedisFailure("cooldown_step", time.Since(start))
+		return true, cooldown, err
+	}
+	metrics.RecordRedisSuccess("cooldown_step", time.Since(start))
+	return true, cooldown, nil
+}
+
+// ResetProgressiveCooldown clears the cooldown and step counter for key,
+// so the next send starts again from the first step.
+func (m *Manager) ResetProgressiveCooldown(ctx context.Context, key string) error {
+	start := time.Now()
+	err := m.client.Del(ctx, resendCountPrefix+key, rediskitratelimit.DefaultCooldownPrefix+key).Err()
+	if err != nil {
+		metrics.RecordRedisFailure("cooldown_step", time.Since(start))
+	} else {
+		metrics.RecordRedisSuccess("cooldown_step", time.Since(start))
+	}
+	return err
+}
@@ -233,6 +233,39 @@ func TestManager_CheckDestinationRateLimit(t *testing.T) {
 	}
 }
 
+func TestManager_CheckCountryRateLimit(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() {
+		if err := redisClient.Close(); err != nil {
+			t.Errorf("failed to close redis client: %v", err)
+		}
+	}()
+
+	manager := NewManager(redisClient)
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		allowed, _, _, err := manager.CheckCountryRateLimit(ctx, "NG", 2, time.Hour)
+		if err != nil {
+			t.Fatalf("CheckCountryRateLimit() error = %v", err)
+		}
+		if !allowed {
+			t.Fatalf("CheckCountryRateLimit() request %d should be allowed", i+1)
+		}
+	}
+
+	allowed, _, _, _ := manager.CheckCountryRateLimit(ctx, "NG", 2, time.Hour)
+	if allowed {
+		t.Error("CheckCountryRateLimit() should deny requests over the limit")
+	}
+
+	// Other countries have their own counter
+	allowed, _, _, _ = manager.CheckCountryRateLimit(ctx, "CN", 2, time.Hour)
+	if !allowed {
+		t.Error("CheckCountryRateLimit() should count countries separately")
+	}
+}
+
 func TestManager_CheckResendCooldown_FirstTime(t *testing.T) {
 	redisClient := testRedisClient(t)
 	defer func() {
@@ -333,3 +366,158 @@ func TestManager_CheckResendCooldown_RedisError(t *testing.T) {
 		t.Error("CheckResendCooldown() should not allow when Redis fails")
 	}
 }
+
+func TestManager_CheckProgressiveCooldown_Grows(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() {
+		if err := redisClient.Close(); err != nil {
+			t.Errorf("failed to close redis client: %v", err)
+		}
+	}()
+
+	manager := NewManager(redisClient)
+	ctx := context.Background()
+	key := "user123:+8613800138000"
+	steps := []time.Duration{50 * time.Millisecond, 200 * time.Millisecond}
+
+	allowed, cooldown, err := manager.CheckProgressiveCooldown(ctx, key, steps, time.Hour)
+	if err != nil {
+		t.Fatalf("CheckProgressiveCooldown() error = %v", err)
+	}
+	if !allowed || cooldown != steps[0] {
+		t.Fatalf("first send: allowed=%v cooldown=%v, want true %v", allowed, cooldown, steps[0])
+	}
+
+	// Within the first cooldown
+	allowed, remaining, err := manager.CheckProgressiveCooldown(ctx, key, steps, time.Hour)
+	if err != nil {
+		t.Fatalf("CheckProgressiveCooldown() error = %v", err)
+	}
+	if allowed {
+		t.Fatal("CheckProgressiveCooldown() should not allow within cooldown")
+	}
+	if remaining <= 0 || remaining > steps[0] {
+		t.Errorf("remaining = %v, want within (0, %v]", remaining, steps[0])
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	// Second send uses the next step
+	allowed, cooldown, err = manager.CheckProgressiveCooldown(ctx, key, steps, time.Hour)
+	if err != nil {
+		t.Fatalf("CheckProgressiveCooldown() error = %v", err)
+	}
+	if !allowed || cooldown != steps[1] {
+		t.Fatalf("second send: allowed=%v cooldown=%v, want true %v", allowed, cooldown, steps[1])
+	}
+
+	// Reset starts again from the first step
+	if err := manager.ResetProgressiveCooldown(ctx, key); err != nil {
+		t.Fatalf("ResetProgressiveCooldown() error = %v", err)
+	}
+	allowed, cooldown, err = manager.CheckProgressiveCooldown(ctx, key, steps, time.Hour)
+	if err != nil {
+		t.Fatalf("CheckProgressiveCooldown() error = %v", err)
+	}
+	if !allowed || cooldown != steps[0] {
+		t.Errorf("after reset: allowed=%v cooldown=%v, want true %v", allowed, cooldown, steps[0])
+	}
+}
+
+func TestManager_CheckProgressiveCooldown_EmptySteps(t *testing.T) {
+	redisClient := testRedisClient(t)
+	defer func() { _ = redisClient.Close() }()
+
+	manager := NewManager(redisClient)
+	allowed, _, err := manager.CheckProgressiveCooldown(context.Background(), "k", nil, time.Hour)
+	if err == nil {
+		t.Error("CheckProgressiveCooldown() with no steps should return error")
+	}
+	if allowed {
+		t.Error("CheckProgressiveCooldown() should not allow with no steps")
+	}
+}
+
+func TestManager_CheckProgressiveCooldown_RedisError(t *testing.T) {
+	redisClient := testRedisClient(t)
+	_ = redisClient.Close()
+
+	manager := NewManager(redisClient)
+	allowed, _, err := manager.CheckProgressiveCooldown(context.Background(), "user:dest", []time.Duration{time.Minute}, time.Hour)
+	if err == nil {
+		t.Error("CheckProgressiveCooldown() with closed client should return error")
+	}
+	if allowed {
+		t.Error("CheckProgressiveCooldown() should not allow when Redis fails")
+	}
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	for _, s := range []string{"open", "CLOSED", " local "} {
+		if _, err := ParseFailurePolicy(s); err != nil {
+			t.Errorf("ParseFailurePolicy(%q) error = %v", s, err)
+		}
+	}
+	if _, err := ParseFailurePolicy("maybe"); err == nil {
+		t.Error("ParseFailurePolicy(\"maybe\") expected error")
+	}
+}
+
+func TestManager_FailurePolicies_RedisError(t *testing.T) {
+	redisClient := testRedisClient(t)
+	_ = redisClient.Close()
+
+	manager := NewManager(redisClient)
+	manager.SetFailurePolicies(map[string]FailurePolicy{
+		ScopeUser:     FailOpen,
+		ScopeIP:       FailLocal,
+		ScopeCooldown: FailLocal,
+	})
+	ctx := context.Background()
+
+	// open: always allowed, error still reported
+	allowed, _, _, err := manager.CheckUserRateLimit(ctx, "user1", 1, time.Hour)
+	if err == nil || !allowed {
+		t.Errorf("CheckUserRateLimit() fail-open = %v, %v; want allowed with error", allowed, err)
+	}
+
+	// local: the in-process limiter enforces the same limit
+	for i := 0; i < 2; i++ {
+		allowed, _, _, _ = manager.CheckIPRateLimit(ctx, "192.0.2.1", 2, time.Minute)
+		if !allowed {
+			t.Fatalf("CheckIPRateLimit() fail-local #%d should be allowed", i+1)
+		}
+	}
+	if allowed, _, _, _ = manager.CheckIPRateLimit(ctx, "192.0.2.1", 2, time.Minute); allowed {
+		t.Error("CheckIPRateLimit() fail-local should deny over the limit")
+	}
+
+	// unlisted scopes fail closed
+	if allowed, _, _, _ = manager.CheckDestinationRateLimit(ctx, "a@example.com", 10, time.Hour); allowed {
+		t.Error("CheckDestinationRateLimit() should fail closed by default")
+	}
+	if allowed, _, _, _ = manager.CheckScopedRateLimit(ctx, ScopeCaptcha, "ip:192.0.2.1", 10, time.Hour); allowed {
+		t.Error("CheckScopedRateLimit() should fail closed by default")
+	}
+	if allowed, _, _, _ = manager.CheckScopedRateLimit(ctx, ScopeRecovery, "u1", 5, time.Hour); allowed {
+		t.Error("CheckScopedRateLimit(recovery) should fail closed by default")
+	}
+	if allowed, _, _, _ = manager.CheckScopedRateLimit(ctx, ScopeTOTP, "subject:u1", 5, time.Hour); allowed {
+		t.Error("CheckScopedRateLimit(totp) should fail closed by default")
+	}
+
+	// progressive cooldown falls back to the first step locally
+	allowed, next, _ := manager.CheckProgressiveCooldown(ctx, "user:dest", []time.Duration{30 * time.Second, time.Minute}, time.Hour)
+	if !allowed || next != 30*time.Second {
+		t.Errorf("CheckProgressiveCooldown() fail-local = %v, %v; want allowed with 30s", allowed, next)
+	}
+	if allowed, _, _ = manager.CheckProgressiveCooldown(ctx, "user:dest", []time.Duration{30 * time.Second}, time.Hour); allowed {
+		t.Error("CheckProgressiveCooldown() fail-local should deny within the cooldown")
+	}
+
+	// scoped limits follow their own scope's policy
+	manager.SetFailurePolicies(map[string]FailurePolicy{ScopeCaptcha: FailOpen})
+	if allowed, _, _, err = manager.CheckScopedRateLimit(ctx, ScopeCaptcha, "ip:192.0.2.1", 10, time.Hour); err == nil || !allowed {
+		t.Errorf("CheckScopedRateLimit() fail-open = %v, %v; want allowed with error", allowed, err)
+	}
+}
@@ -0,0 +1,266 @@
+// Package recovery manages one-time recovery (backup) codes natively, without herald-totp.
+// Each user has one set of codes; only Argon2id hashes are stored in Redis. Each code also has
+// a short lookup tag (a truncated HMAC-SHA256 under a per-set random key), so a verification
+// runs Argon2id only for the code whose tag matches rather than for every code in the set. A
+// code is consumed by claiming its slot with SET NX, so concurrent uses of the same code
+// cannot both succeed. Generating a new set invalidates the previous one, including claims
+// racing with it.
+package recovery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	secure "github.com/soulteary/secure-kit"
+)
+
+// Code format: CodeLength characters from codeAlphabet, shown as two dash-separated groups
+const (
+	CodeLength   = 10
+	codeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz" // No 0/o, 1/l/i
+)
+
+// lookupTagLength is the length of lookup tags in hex characters. With 16 bits a wrong code
+// reaches Argon2id for a given slot once in 65536 tries, and a tag reveals little of the code.
+const lookupTagLength = 4
+
+// Redis key prefixes
+const (
+	setKeyPrefix  = "otp:recovery:set:"
+	usedKeyPrefix = "otp:recovery:used:"
+)
+
+var (
+	// ErrNotFound is returned when the user has no recovery codes
+	ErrNotFound = errors.New("no recovery codes")
+	// ErrInvalidCode is returned for wrong or already used codes
+	ErrInvalidCode = errors.New("invalid recovery code")
+)
+
+// Config configures a Manager
+type Config struct {
+	Count        int    // Codes per set
+	Argon2Time   uint32 // Argon2id iterations
+	Argon2Memory uint32 // Argon2id memory in KiB
+}
+
+// Status describes the current set of a user
+type Status struct {
+	Total     int
+	Remaining int
+	CreatedAt time.Time
+}
+
+// set is the stored form of a user's codes
+type set struct {
+	ID        string   `json:"id"`
+	Hashes    []string `json:"hashes"`
+	LookupKey string   `json:"lookup_key"` // hex HMAC key of the lookup tags
+	Lookups   []string `json:"lookups"`    // Lookup tag per code, same order as Hashes
+	CreatedAt int64    `json:"created_at"`
+}
+
+// Manager generates, counts and consumes recovery codes
+type Manager struct {
+	redis  *redis.Client
+	hasher *secure.Argon2Hasher
+	count  int
+}
+
+// NewManager creates a manager
+func NewManager(redisClient *redis.Client, cfg Config) *Manager {
+	return &Manager{
+		redis: redisClient,
+		hasher: secure.NewArgon2Hasher(
+			secure.WithArgon2Time(cfg.Argon2Time),
+			secure.WithArgon2Memory(cfg.Argon2Memory),
+			secure.WithArgon2Threads(1),
+		),
+		count: cfg.Count,
+	}
+}
+
+// Generate creates a new set of codes for userID, invalidating the previous set.
+// The plaintext codes are returned once and never stored.
+func (m *Manager) Generate(ctx context.Context, userID string) ([]string, error) {
+	id, err := secure.RandomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	lookupKey, err := secure.RandomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	s := set{ID: id, LookupKey: lookupKey, Lookups: make([]string, m.count), CreatedAt: time.Now().Unix()}
+	codes := make([]string, m.count)
+	hashes := make([]string, m.count)
+	for i := range codes {
+		raw, err := secure.RandomString(CodeLength, codeAlphabet)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := m.hasher.HashWithParams(raw)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:CodeLength/2] + "-" + raw[CodeLength/2:]
+		hashes[i] = hash
+		s.Lookups[i] = lookupTag(lookupKey, raw)
+	}
+	s.Hashes = hashes
+
+	old, err := m.load(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.redis.Set(ctx, setKeyPrefix+userID, data, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+
+	// The old set is unreachable now; drop its used markers
+	if old != nil {
+		keys := make([]string, len(old.Hashes))
+		for i := range old.Hashes {
+			keys[i] = usedKey(old.ID, i)
+		}
+		_ = m.redis.Del(ctx, keys...).Err()
+	}
+	return codes, nil
+}
+
+// Status returns the current set of userID, or ErrNotFound
+func (m *Manager) Status(ctx context.Context, userID string) (*Status, error) {
+	s, err := m.load(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	remaining := 0
+	for i := range s.Hashes {
+		used, err := m.used(ctx, s.ID, i)
+		if err != nil {
+			return nil, err
+		}
+		if !used {
+			remaining++
+		}
+	}
+	return &Status{Total: len(s.Hashes), Remaining: remaining, CreatedAt: time.Unix(s.CreatedAt, 0)}, nil
+}
+
+// Consume checks code against the unused codes of userID and marks the match as used.
+// It returns the number of codes left. Dashes, spaces and case are ignored.
+func (m *Manager) Consume(ctx context.Context, userID, code string) (int, error) {
+	code = NormalizeCode(code)
+	if len(code) != CodeLength {
+		return 0, ErrInvalidCode
+	}
+	s, err := m.load(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	tag := lookupTag(s.LookupKey, code)
+	for i, hash := range s.Hashes {
+		if i >= len(s.Lookups) || s.Lookups[i] != tag {
+			continue
+		}
+		used, err := m.used(ctx, s.ID, i)
+		if err != nil {
+			return 0, err
+		}
+		if used || !m.hasher.Verify(hash, code) {
+			continue
+		}
+		if err := m.claim(ctx, userID, s, i); err != nil {
+			return 0, err
+		}
+		status, err := m.Status(ctx, userID)
+		if err != nil {
+			return 0, err
+		}
+		return status.Remaining, nil
+	}
+	return 0, ErrInvalidCode
+}
+
+// claim marks code index of set s as used. The claim only counts while s is still the user's
+// current set: a set regenerated between loading and claiming invalidates it.
+func (m *Manager) claim(ctx context.Context, userID string, s *set, index int) error {
+	key := usedKey(s.ID, index)
+	err := m.redis.SetArgs(ctx, key, time.Now().Unix(), redis.SetArgs{Mode: "NX"}).Err()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidCode // Used concurrently
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark recovery code used: %w", err)
+	}
+
+	current, err := m.load(ctx, userID)
+	if err == nil && current.ID == s.ID {
+		return nil
+	}
+	// Regenerated (or unreadable): drop the marker, which may outlive the set's cleanup
+	_ = m.redis.Del(ctx, key).Err()
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+// NormalizeCode lowercases code and strips dashes and spaces
+func NormalizeCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+func (m *Manager) load(ctx context.Context, userID string) (*set, error) {
+	data, err := m.redis.Get(ctx, setKeyPrefix+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recovery codes: %w", err)
+	}
+	var s set
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (m *Manager) used(ctx context.Context, setID string, index int) (bool, error) {
+	n, err := m.redis.Exists(ctx, usedKey(setID, index)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read recovery code state: %w", err)
+	}
+	return n > 0, nil
+}
+
+// lookupTag returns the lookup tag of the normalized code under the set's lookup key
+func lookupTag(key, code string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))[:lookupTagLength]
+}
+
+func usedKey(setID string, index int) string {
+	return usedKeyPrefix + setID + ":" + strconv.Itoa(index)
+}
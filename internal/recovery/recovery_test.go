@@ -0,0 +1,136 @@
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+// testConfig keeps Argon2 cheap so tests stay fast
+var testConfig = Config{Count: 3, Argon2Time: 1, Argon2Memory: 64}
+
+func TestManager_ConsumeOnce(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	m := NewManager(client, testConfig)
+	ctx := context.Background()
+
+	if _, err := m.Consume(ctx, "u1", "abcde-fghjk"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Consume() without codes error = %v, want ErrNotFound", err)
+	}
+
+	codes, err := m.Generate(ctx, "u1")
+	if err != nil || len(codes) != 3 {
+		t.Fatalf("Generate() = %v, %v", codes, err)
+	}
+	if len(codes[0]) != CodeLength+1 || codes[0][5] != '-' {
+		t.Errorf("code %q, want xxxxx-xxxxx", codes[0])
+	}
+
+	// Case, spaces and dashes are ignored
+	remaining, err := m.Consume(ctx, "u1", " "+strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))+" ")
+	if err != nil || remaining != 2 {
+		t.Fatalf("Consume() = %d, %v; want 2, nil", remaining, err)
+	}
+	if _, err := m.Consume(ctx, "u1", codes[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Consume(used code) error = %v, want ErrInvalidCode", err)
+	}
+	if _, err := m.Consume(ctx, "u1", "22222-22222"); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Consume(wrong code) error = %v, want ErrInvalidCode", err)
+	}
+	if _, err := m.Consume(ctx, "u2", codes[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Consume(other user) error = %v, want ErrNotFound", err)
+	}
+
+	status, err := m.Status(ctx, "u1")
+	if err != nil || status.Total != 3 || status.Remaining != 2 {
+		t.Errorf("Status() = %+v, %v; want 2 of 3", status, err)
+	}
+}
+
+func TestManager_ConsumeUsesLookupTag(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	m := NewManager(client, testConfig)
+	ctx := context.Background()
+
+	codes, err := m.Generate(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.load(ctx, "u1")
+	if err != nil || len(s.Lookups) != len(s.Hashes) {
+		t.Fatalf("load() = %+v, %v", s, err)
+	}
+	if s.Lookups[0] != lookupTag(s.LookupKey, NormalizeCode(codes[0])) {
+		t.Errorf("Lookups[0] = %q, want the tag of %q", s.Lookups[0], codes[0])
+	}
+
+	// Only the slot with a matching tag is checked with Argon2id
+	s.Lookups[0] = "zzzz"
+	data, _ := json.Marshal(s)
+	if err := client.Set(ctx, setKeyPrefix+"u1", data, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Consume(ctx, "u1", codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Consume(code with another tag) error = %v, want ErrInvalidCode", err)
+	}
+	if remaining, err := m.Consume(ctx, "u1", codes[1]); err != nil || remaining != 2 {
+		t.Errorf("Consume() = %d, %v; want 2, nil", remaining, err)
+	}
+}
+
+func TestManager_RegenerateInvalidatesOld(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	m := NewManager(client, testConfig)
+	ctx := context.Background()
+
+	old, _ := m.Generate(ctx, "u1")
+	_, _ = m.Consume(ctx, "u1", old[0])
+	codes, err := m.Generate(ctx, "u1")
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if _, err := m.Consume(ctx, "u1", old[1]); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Consume(old code) error = %v, want ErrInvalidCode", err)
+	}
+	if status, _ := m.Status(ctx, "u1"); status.Remaining != 3 {
+		t.Errorf("Status() after regenerate = %+v, want 3 remaining", status)
+	}
+	if _, err := m.Consume(ctx, "u1", codes[2]); err != nil {
+		t.Errorf("Consume(new code) error = %v", err)
+	}
+}
+
+func TestManager_ClaimDuringRegenerate(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	m := NewManager(client, testConfig)
+	ctx := context.Background()
+
+	// A consume that loaded the set before a regeneration must not claim against it
+	_, _ = m.Generate(ctx, "u1")
+	stale, err := m.load(ctx, "u1")
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	_, _ = m.Generate(ctx, "u1")
+
+	if err := m.claim(ctx, "u1", stale, 0); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("claim(stale set) error = %v, want ErrInvalidCode", err)
+	}
+	if used, _ := m.used(ctx, stale.ID, 0); used {
+		t.Error("claim(stale set) left a used marker")
+	}
+
+	current, _ := m.load(ctx, "u1")
+	if err := m.claim(ctx, "u1", current, 0); err != nil {
+		t.Errorf("claim(current set) error = %v", err)
+	}
+}
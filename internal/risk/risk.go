@@ -0,0 +1,176 @@
+// Package risk scores challenge creation requests.
+// Pluggable signals (IP velocity, new device, new destination, IP/phone country mismatch,
+// recent verification failures) each contribute points; the total is mapped to an action
+// through configurable thresholds.
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/metrics"
+)
+
+// keyPrefix is the Redis key prefix for risk state
+const keyPrefix = "otp:risk:"
+
+// Action is the outcome of a risk evaluation, in increasing order of severity
+type Action string
+
+const (
+	ActionAllow   Action = "allow"
+	ActionCaptcha Action = "captcha"
+	ActionStepUp  Action = "step_up" // require a stronger channel
+	ActionBlock   Action = "block"
+)
+
+// Input describes a challenge creation request
+type Input struct {
+	UserID      string `json:"user_id"`
+	Channel     string `json:"channel"`
+	Destination string `json:"destination"`
+	Purpose     string `json:"purpose"`
+	ClientIP    string `json:"client_ip"`
+	UA          string `json:"ua"`
+}
+
+// Signal contributes points to the risk score
+type Signal interface {
+	// Name is reported as the reason when the signal fires
+	Name() string
+	// Score returns the points for the input; 0 means the signal did not fire
+	Score(ctx context.Context, in Input) (int, error)
+}
+
+// Learner is implemented by signals that learn from successfully verified challenges
+// (e.g. remembering a device or destination as known)
+type Learner interface {
+	Learn(ctx context.Context, in Input) error
+}
+
+// FailureRecorder is implemented by signals that track verification failures
+type FailureRecorder interface {
+	RecordFailure(ctx context.Context, userID string) error
+}
+
+// Thresholds map scores to actions; a threshold of 0 disables that action
+type Thresholds struct {
+	Captcha int
+	StepUp  int
+	Block   int
+}
+
+// Decision is the result of a risk evaluation
+type Decision struct {
+	Score   int      `json:"score"`
+	Action  Action   `json:"action"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Engine evaluates signals and learns from verified challenges
+type Engine struct {
+	client     *redis.Client
+	signals    []Signal
+	thresholds Thresholds
+}
+
+// NewEngine creates a risk engine
+func NewEngine(redisClient *redis.Client, thresholds Thresholds, signals ...Signal) *Engine {
+	return &Engine{
+		client:     redisClient,
+		signals:    signals,
+		thresholds: thresholds,
+	}
+}
+
+// Evaluate scores the input. Signals that fail are skipped; the first error is returned
+// alongside the decision.
+func (e *Engine) Evaluate(ctx context.Context, in Input) (Decision, error) {
+	var (
+		decision Decision
+		firstErr error
+	)
+	for _, s := range e.signals {
+		points, err := s.Score(ctx, in)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("risk signal %s: %w", s.Name(), err)
+			}
+			continue
+		}
+		if points > 0 {
+			decision.Score += points
+			decision.Reasons = append(decision.Reasons, s.Name())
+		}
+	}
+	decision.Action = e.action(decision.Score)
+	metrics.RecordRiskDecision(string(decision.Action))
+	return decision, firstErr
+}
+
+// action maps a score to the most severe action whose threshold it reaches
+func (e *Engine) action(score int) Action {
+	switch {
+	case e.thresholds.Block > 0 && score >= e.thresholds.Block:
+		return ActionBlock
+	case e.thresholds.StepUp > 0 && score >= e.thresholds.StepUp:
+		return ActionStepUp
+	case e.thresholds.Captcha > 0 && score >= e.thresholds.Captcha:
+		return ActionCaptcha
+	}
+	return ActionAllow
+}
+
+// Remember stores the input of a created challenge so Confirm can learn from it once verified
+func (e *Engine) Remember(ctx context.Context, challengeID string, in Input, ttl time.Duration) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return e.client.Set(ctx, keyPrefix+"ch:"+challengeID, data, ttl).Err()
+}
+
+// Confirm lets learning signals record the remembered input of a verified challenge
+func (e *Engine) Confirm(ctx context.Context, challengeID string) error {
+	key := keyPrefix + "ch:" + challengeID
+	data, err := e.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_ = e.client.Del(ctx, key).Err()
+
+	var in Input
+	if err := json.Unmarshal(data, &in); err != nil {
+		return fmt.Errorf("failed to decode risk input: %w", err)
+	}
+	var firstErr error
+	for _, s := range e.signals {
+		if l, ok := s.(Learner); ok {
+			if err := l.Learn(ctx, in); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("risk signal %s: %w", s.Name(), err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// RecordFailure notifies signals tracking verification failures
+func (e *Engine) RecordFailure(ctx context.Context, userID string) error {
+	var firstErr error
+	for _, s := range e.signals {
+		if r, ok := s.(FailureRecorder); ok {
+			if err := r.RecordFailure(ctx, userID); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("risk signal %s: %w", s.Name(), err)
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,219 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+type fixedSignal struct {
+	name   string
+	points int
+	err    error
+}
+
+func (s fixedSignal) Name() string { return s.name }
+
+func (s fixedSignal) Score(context.Context, Input) (int, error) { return s.points, s.err }
+
+type countryResolver string
+
+func (r countryResolver) CountryForIP(string) string { return string(r) }
+
+func TestEngine_Evaluate(t *testing.T) {
+	thresholds := Thresholds{Captcha: 30, StepUp: 50, Block: 80}
+
+	tests := []struct {
+		name    string
+		signals []Signal
+		want    Action
+		reasons []string
+	}{
+		{"no signals", nil, ActionAllow, nil},
+		{"below captcha", []Signal{fixedSignal{name: "a", points: 29}}, ActionAllow, []string{"a"}},
+		{"captcha", []Signal{fixedSignal{name: "a", points: 15}, fixedSignal{name: "b", points: 15}}, ActionCaptcha, []string{"a", "b"}},
+		{"step up", []Signal{fixedSignal{name: "a", points: 50}, fixedSignal{name: "b"}}, ActionStepUp, []string{"a"}},
+		{"block", []Signal{fixedSignal{name: "a", points: 90}}, ActionBlock, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := NewEngine(nil, thresholds, tt.signals...).Evaluate(t.Context(), Input{})
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if decision.Action != tt.want {
+				t.Errorf("Action = %q, want %q (score %d)", decision.Action, tt.want, decision.Score)
+			}
+			if !reflect.DeepEqual(decision.Reasons, tt.reasons) {
+				t.Errorf("Reasons = %v, want %v", decision.Reasons, tt.reasons)
+			}
+		})
+	}
+}
+
+func TestEngine_EvaluateSignalError(t *testing.T) {
+	engine := NewEngine(nil, Thresholds{Captcha: 10},
+		fixedSignal{name: "broken", points: 100, err: errors.New("boom")},
+		fixedSignal{name: "ok", points: 10},
+	)
+	decision, err := engine.Evaluate(t.Context(), Input{})
+	if err == nil {
+		t.Error("Evaluate() should report the failing signal")
+	}
+	if decision.Score != 10 || decision.Action != ActionCaptcha {
+		t.Errorf("decision = %+v, want score 10 from the working signal", decision)
+	}
+}
+
+func TestEngine_DisabledThresholds(t *testing.T) {
+	decision, _ := NewEngine(nil, Thresholds{}, fixedSignal{name: "a", points: 1000}).Evaluate(t.Context(), Input{})
+	if decision.Action != ActionAllow {
+		t.Errorf("Action = %q, want allow when all thresholds are 0", decision.Action)
+	}
+}
+
+func TestEngine_ConfirmLearnsDeviceAndDestination(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+
+	engine := NewEngine(client, Thresholds{Captcha: 1},
+		&NewDevice{Client: client, Points: 15},
+		&DestinationAge{Client: client, MinAge: 0, Points: 15},
+	)
+	in := Input{UserID: "user1", Destination: "user1@example.com", UA: "Mozilla/5.0"}
+
+	decision, err := engine.Evaluate(t.Context(), in)
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if !reflect.DeepEqual(decision.Reasons, []string{SignalNewDevice, SignalNewDestination}) {
+		t.Errorf("first request reasons = %v, want new_device and new_destination", decision.Reasons)
+	}
+
+	if err := engine.Remember(t.Context(), "ch1", in, time.Minute); err != nil {
+		t.Fatalf("Remember() error = %v", err)
+	}
+	if err := engine.Confirm(t.Context(), "ch1"); err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+
+	decision, _ = engine.Evaluate(t.Context(), in)
+	if decision.Score != 0 || decision.Action != ActionAllow {
+		t.Errorf("after verification decision = %+v, want allow", decision)
+	}
+
+	// Another user on the same device is still new
+	other := in
+	other.UserID = "user2"
+	decision, _ = engine.Evaluate(t.Context(), other)
+	if decision.Score != 30 {
+		t.Errorf("other user score = %d, want 30", decision.Score)
+	}
+
+	// Confirming an unknown challenge is a no-op
+	if err := engine.Confirm(t.Context(), "missing"); err != nil {
+		t.Errorf("Confirm(missing) error = %v", err)
+	}
+}
+
+func TestDestinationAge_MinAge(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+
+	s := &DestinationAge{Client: client, MinAge: time.Hour, Points: 15}
+	in := Input{UserID: "user1", Destination: "+8613800138000"}
+	if err := s.Learn(t.Context(), in); err != nil {
+		t.Fatalf("Learn() error = %v", err)
+	}
+	if points, _ := s.Score(t.Context(), in); points != 15 {
+		t.Errorf("Score() for recently verified destination = %d, want 15", points)
+	}
+}
+
+func TestIPVelocity(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+
+	s := &IPVelocity{Client: client, Limit: 2, Window: time.Minute, Points: 30}
+	in := Input{ClientIP: "203.0.113.5"}
+	for i := 1; i <= 3; i++ {
+		points, err := s.Score(t.Context(), in)
+		if err != nil {
+			t.Fatalf("Score() error = %v", err)
+		}
+		want := 0
+		if i > 2 {
+			want = 30
+		}
+		if points != want {
+			t.Errorf("request %d: Score() = %d, want %d", i, points, want)
+		}
+	}
+}
+
+func TestRecentFailures(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+
+	s := &RecentFailures{Client: client, Threshold: 2, Window: time.Minute, Points: 30}
+	engine := NewEngine(client, Thresholds{Block: 30}, s)
+	in := Input{UserID: "user1"}
+
+	for i := 0; i < 2; i++ {
+		if decision, _ := engine.Evaluate(t.Context(), in); decision.Action != ActionAllow {
+			t.Fatalf("after %d failures Action = %q, want allow", i, decision.Action)
+		}
+		if err := engine.RecordFailure(t.Context(), "user1"); err != nil {
+			t.Fatalf("RecordFailure() error = %v", err)
+		}
+	}
+	decision, _ := engine.Evaluate(t.Context(), in)
+	if decision.Action != ActionBlock || !reflect.DeepEqual(decision.Reasons, []string{SignalRecentFailures}) {
+		t.Errorf("after threshold decision = %+v, want block for recent_failures", decision)
+	}
+}
+
+func TestCountryMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		ips         countryResolver
+		destination string
+		want        int
+	}{
+		{"match", "CN", "+8613800138000", 0},
+		{"mismatch", "US", "+8613800138000", 25},
+		{"unknown ip country", "", "+8613800138000", 0},
+		{"email destination", "US", "user@example.com", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &CountryMismatch{IPs: tt.ips, Points: 25}
+			if got, _ := s.Score(t.Context(), Input{Destination: tt.destination, ClientIP: "192.0.2.1"}); got != tt.want {
+				t.Errorf("Score() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultSignals_ZeroWeightDisables(t *testing.T) {
+	signals := DefaultSignals(nil, SignalConfig{Weights: map[string]int{SignalCountryMismatch: 0, SignalNewDevice: 40}})
+	names := make(map[string]bool)
+	for _, s := range signals {
+		names[s.Name()] = true
+	}
+	if names[SignalCountryMismatch] {
+		t.Error("country_mismatch with weight 0 should be disabled")
+	}
+	if len(signals) != len(DefaultWeights)-1 {
+		t.Errorf("len(signals) = %d, want %d", len(signals), len(DefaultWeights)-1)
+	}
+	for _, s := range signals {
+		if d, ok := s.(*NewDevice); ok && d.Points != 40 {
+			t.Errorf("new_device points = %d, want override 40", d.Points)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package risk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/geo"
+)
+
+// Signal names (reported as decision reasons)
+const (
+	SignalIPVelocity      = "ip_velocity"
+	SignalNewDevice       = "new_device"
+	SignalNewDestination  = "new_destination"
+	SignalCountryMismatch = "country_mismatch"
+	SignalRecentFailures  = "recent_failures"
+)
+
+// knownTTL is how long a verified device or destination is remembered
+const knownTTL = 365 * 24 * time.Hour
+
+// hashKey shortens user-supplied values (UA, destination) for use in Redis keys
+func hashKey(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Fingerprint derives a device fingerprint from a User-Agent string
+func Fingerprint(ua string) string {
+	return hashKey(strings.ToLower(strings.TrimSpace(ua)))
+}
+
+// incrWindow increments a counter, starting its expiry window on first use
+func incrWindow(ctx context.Context, client *redis.Client, key string, window time.Duration) (int64, error) {
+	n, err := client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 1 {
+		if err := client.Expire(ctx, key, window).Err(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// IPVelocity fires when an IP creates more than Limit challenges within Window
+type IPVelocity struct {
+	Client *redis.Client
+	Limit  int
+	Window time.Duration
+	Points int
+}
+
+// Name returns the signal name
+func (s *IPVelocity) Name() string { return SignalIPVelocity }
+
+// Score counts this request and scores when the IP is over its limit
+func (s *IPVelocity) Score(ctx context.Context, in Input) (int, error) {
+	if in.ClientIP == "" {
+		return 0, nil
+	}
+	n, err := incrWindow(ctx, s.Client, keyPrefix+"ipvel:"+in.ClientIP, s.Window)
+	if err != nil {
+		return 0, err
+	}
+	if int(n) > s.Limit {
+		return s.Points, nil
+	}
+	return 0, nil
+}
+
+// NewDevice fires when the user has never verified a challenge from this User-Agent
+type NewDevice struct {
+	Client *redis.Client
+	Points int
+}
+
+// Name returns the signal name
+func (s *NewDevice) Name() string { return SignalNewDevice }
+
+func (s *NewDevice) key(in Input) string {
+	return keyPrefix + "dev:" + in.UserID + ":" + Fingerprint(in.UA)
+}
+
+// Score checks whether the device fingerprint is known; requests without a UA are not scored
+func (s *NewDevice) Score(ctx context.Context, in Input) (int, error) {
+	if in.UA == "" {
+		return 0, nil
+	}
+	n, err := s.Client.Exists(ctx, s.key(in)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return s.Points, nil
+	}
+	return 0, nil
+}
+
+// Learn remembers the device after a successful verification
+func (s *NewDevice) Learn(ctx context.Context, in Input) error {
+	if in.UA == "" {
+		return nil
+	}
+	return s.Client.Set(ctx, s.key(in), "1", knownTTL).Err()
+}
+
+// DestinationAge fires when the destination was never verified by the user, or was first
+// verified less than MinAge ago
+type DestinationAge struct {
+	Client *redis.Client
+	MinAge time.Duration
+	Points int
+}
+
+// Name returns the signal name
+func (s *DestinationAge) Name() string { return SignalNewDestination }
+
+func (s *DestinationAge) key(in Input) string {
+	return keyPrefix + "dest:" + in.UserID + ":" + hashKey(in.Destination)
+}
+
+// Score checks when the destination was first verified
+func (s *DestinationAge) Score(ctx context.Context, in Input) (int, error) {
+	firstSeen, err := s.Client.Get(ctx, s.key(in)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return s.Points, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if time.Since(time.Unix(firstSeen, 0)) < s.MinAge {
+		return s.Points, nil
+	}
+	return 0, nil
+}
+
+// Learn records the first verification time of the destination
+func (s *DestinationAge) Learn(ctx context.Context, in Input) error {
+	return s.Client.SetNX(ctx, s.key(in), time.Now().Unix(), knownTTL).Err()
+}
+
+// CountryMismatch fires when a phone destination's country differs from the client IP's country.
+// It does not fire when either country is unknown.
+type CountryMismatch struct {
+	IPs    geo.IPResolver
+	Points int
+}
+
+// Name returns the signal name
+func (s *CountryMismatch) Name() string { return SignalCountryMismatch }
+
+// Score compares the phone prefix country with the IP country
+func (s *CountryMismatch) Score(_ context.Context, in Input) (int, error) {
+	phoneCountry := geo.CountryForPhone(in.Destination)
+	if phoneCountry == "" || s.IPs == nil {
+		return 0, nil
+	}
+	ipCountry := s.IPs.CountryForIP(in.ClientIP)
+	if ipCountry == "" || strings.EqualFold(ipCountry, phoneCountry) {
+		return 0, nil
+	}
+	return s.Points, nil
+}
+
+// RecentFailures fires when the user has at least Threshold verification failures within Window
+type RecentFailures struct {
+	Client    *redis.Client
+	Threshold int
+	Window    time.Duration
+	Points    int
+}
+
+// Name returns the signal name
+func (s *RecentFailures) Name() string { return SignalRecentFailures }
+
+func (s *RecentFailures) key(userID string) string {
+	return keyPrefix + "fail:" + userID
+}
+
+// Score reads the user's recent failure count
+func (s *RecentFailures) Score(ctx context.Context, in Input) (int, error) {
+	n, err := s.Client.Get(ctx, s.key(in.UserID)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n >= s.Threshold {
+		return s.Points, nil
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a verification failure for the user
+func (s *RecentFailures) RecordFailure(ctx context.Context, userID string) error {
+	_, err := incrWindow(ctx, s.Client, s.key(userID), s.Window)
+	return err
+}
+
+// DefaultWeights are the points each built-in signal contributes unless overridden
+var DefaultWeights = map[string]int{
+	SignalIPVelocity:      30,
+	SignalNewDevice:       15,
+	SignalNewDestination:  15,
+	SignalCountryMismatch: 25,
+	SignalRecentFailures:  30,
+}
+
+// SignalConfig configures the built-in signals
+type SignalConfig struct {
+	// Weights overrides DefaultWeights per signal name; a weight of 0 disables the signal
+	Weights           map[string]int
+	IPVelocityLimit   int
+	IPVelocityWindow  time.Duration
+	DestinationMinAge time.Duration
+	FailureThreshold  int
+	FailureWindow     time.Duration
+	IPs               geo.IPResolver
+}
+
+// DefaultSignals builds the built-in signals with a non-zero weight
+func DefaultSignals(redisClient *redis.Client, cfg SignalConfig) []Signal {
+	weight := func(name string) int {
+		if w, ok := cfg.Weights[name]; ok {
+			return w
+		}
+		return DefaultWeights[name]
+	}
+
+	all := []Signal{
+		&IPVelocity{Client: redisClient, Limit: cfg.IPVelocityLimit, Window: cfg.IPVelocityWindow, Points: weight(SignalIPVelocity)},
+		&NewDevice{Client: redisClient, Points: weight(SignalNewDevice)},
+		&DestinationAge{Client: redisClient, MinAge: cfg.DestinationMinAge, Points: weight(SignalNewDestination)},
+		&CountryMismatch{IPs: cfg.IPs, Points: weight(SignalCountryMismatch)},
+		&RecentFailures{Client: redisClient, Threshold: cfg.FailureThreshold, Window: cfg.FailureWindow, Points: weight(SignalRecentFailures)},
+	}
+	signals := make([]Signal, 0, len(all))
+	for _, s := range all {
+		if weight(s.Name()) > 0 {
+			signals = append(signals, s)
+		}
+	}
+	return signals
+}
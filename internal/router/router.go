@@ -123,8 +123,45 @@ func NewRouterWithClientAndHandlers(redisClient *redis.Client, log *logger.Logge
 	otp.Post("/challenges", authHandler, h.CreateChallenge)
 	otp.Post("/verifications", authHandler, h.VerifyChallenge)
 	otp.Post("/challenges/:id/revoke", authHandler, h.RevokeChallenge)
-
-	// TOTP proxy routes (forward to herald-totp when HERALD_TOTP_ENABLED and HERALD_TOTP_BASE_URL are set)
+	otp.Get("/challenges/:id", authHandler, h.GetChallenge)
+	otp.Get("/challenges/:id/events", authHandler, h.ChallengeEvents)
+
+	// Push approvals are called by the user's device and authenticated by its signed assertion
+	otp.Post("/challenges/:id/approve", h.ApproveChallenge)
+	otp.Post("/challenges/:id/deny", h.DenyChallenge)
+
+	// Proof-of-work puzzles for the captcha gate (CAPTCHA_PROVIDER=pow)
+	api.Post("/captcha/puzzles", authHandler, h.IssueCaptchaPuzzle)
+
+	// User lock routes (escalating lockouts, administrative unlock)
+	users := api.Group("/users")
+	users.Get("/:id/lock", authHandler, h.GetUserLock)
+	users.Post("/:id/unlock", authHandler, h.UnlockUser)
+	users.Get("/:id/factors", authHandler, h.GetUserFactors)
+	users.Post("/:id/push-devices", authHandler, h.RegisterPushDevice)
+	users.Post("/:id/push-devices/:device_id/revoke", authHandler, h.RevokePushDevice)
+
+	// Native recovery codes
+	recoveryCodes := api.Group("/recovery")
+	recoveryCodes.Post("/codes", authHandler, h.GenerateRecoveryCodes)
+	recoveryCodes.Get("/codes", authHandler, h.GetRecoveryCodes)
+	recoveryCodes.Post("/verify", authHandler, h.VerifyRecoveryCode)
+
+	// Step-up policy evaluation
+	api.Post("/policy/evaluate", authHandler, h.PolicyEvaluate)
+
+	// Message templates: list loaded files, preview without sending
+	api.Get("/templates", authHandler, h.ListTemplates)
+	api.Post("/templates/preview", authHandler, h.PreviewTemplate)
+
+	// WebAuthn (passkeys / security keys)
+	webauthnRoutes := api.Group("/webauthn")
+	webauthnRoutes.Post("/register/start", authHandler, h.WebAuthnRegisterStart)
+	webauthnRoutes.Post("/register/finish", authHandler, h.WebAuthnRegisterFinish)
+	webauthnRoutes.Post("/assert/start", authHandler, h.WebAuthnAssertStart)
+	webauthnRoutes.Post("/assert/finish", authHandler, h.WebAuthnAssertFinish)
+
+	// TOTP routes (HERALD_TOTP_ENABLED): forwarded to herald-totp, or served natively with HERALD_TOTP_MODE=native
 	totp := api.Group("/totp")
 	totp.Get("/status", authHandler, h.TOTPStatus)
 	totp.Post("/verify", authHandler, h.TOTPVerify)
@@ -0,0 +1,117 @@
+// Package routing selects the SMS provider by destination country.
+// Each route sends through its own HTTP provider (same API as SMS_API_BASE_URL);
+// countries without a route use the default SMS provider.
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	provider "github.com/soulteary/provider-kit"
+)
+
+// defaultTimeout applies to routes without a timeout
+const defaultTimeout = 10 * time.Second
+
+// Route sends SMS for a set of countries through one provider
+type Route struct {
+	// Countries are ISO 3166-1 alpha-2 codes (e.g. "CN", "NG")
+	Countries []string
+	Provider  string
+	BaseURL   string
+	APIKey    string
+	Timeout   time.Duration
+}
+
+// routeJSON is the JSON representation of a Route (timeout as a duration string)
+type routeJSON struct {
+	Countries []string `json:"countries"`
+	Provider  string   `json:"provider"`
+	BaseURL   string   `json:"base_url"`
+	APIKey    string   `json:"api_key"`
+	Timeout   string   `json:"timeout"`
+}
+
+// ParseRoutes parses routes from a JSON array, e.g.
+// [{"countries":["CN","HK"],"provider":"aliyun","base_url":"http://sms-aliyun:8080","api_key":"..."}]
+func ParseRoutes(data string) ([]Route, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var raw []routeJSON
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse SMS routes JSON: %w", err)
+	}
+
+	routes := make([]Route, 0, len(raw))
+	for i, r := range raw {
+		if len(r.Countries) == 0 {
+			return nil, fmt.Errorf("sms route %d: countries required", i)
+		}
+		if r.Provider == "" || r.BaseURL == "" {
+			return nil, fmt.Errorf("sms route %d: provider and base_url required", i)
+		}
+		timeout := defaultTimeout
+		if r.Timeout != "" {
+			d, err := time.ParseDuration(r.Timeout)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("sms route %d: invalid timeout %q", i, r.Timeout)
+			}
+			timeout = d
+		}
+		countries := make([]string, len(r.Countries))
+		for j, c := range r.Countries {
+			countries[j] = strings.ToUpper(strings.TrimSpace(c))
+		}
+		routes = append(routes, Route{
+			Countries: countries,
+			Provider:  r.Provider,
+			BaseURL:   r.BaseURL,
+			APIKey:    r.APIKey,
+			Timeout:   timeout,
+		})
+	}
+	return routes, nil
+}
+
+// Router maps countries to SMS providers
+type Router struct {
+	byCountry map[string]provider.Provider
+}
+
+// NewRouter creates an HTTP provider per route. A country listed in several routes uses the first.
+func NewRouter(routes []Route) (*Router, error) {
+	r := &Router{byCountry: make(map[string]provider.Provider)}
+	for _, route := range routes {
+		p, err := provider.NewHTTPProvider(&provider.HTTPConfig{
+			BaseURL:      route.BaseURL,
+			SendEndpoint: "/v1/send",
+			APIKey:       route.APIKey,
+			APIKeyHeader: "X-API-Key",
+			Timeout:      route.Timeout,
+			ChannelType:  provider.ChannelSMS,
+			ProviderName: route.Provider,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("sms route %s: %w", route.Provider, err)
+		}
+		for _, country := range route.Countries {
+			if _, exists := r.byCountry[country]; !exists {
+				r.byCountry[country] = p
+			}
+		}
+	}
+	return r, nil
+}
+
+// Provider returns the provider routed for country, if any
+func (r *Router) Provider(country string) (provider.Provider, bool) {
+	if r == nil || country == "" {
+		return nil, false
+	}
+	p, ok := r.byCountry[strings.ToUpper(country)]
+	return p, ok
+}
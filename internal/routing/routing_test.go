@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(`[
+		{"countries":["cn","HK"],"provider":"aliyun","base_url":"http://sms-aliyun:8080","api_key":"k","timeout":"3s"},
+		{"countries":["NG"],"provider":"termii","base_url":"http://sms-termii:8080"}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseRoutes() error = %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("len(routes) = %d, want 2", len(routes))
+	}
+	if routes[0].Countries[0] != "CN" || routes[0].Timeout != 3*time.Second {
+		t.Errorf("routes[0] = %+v, want uppercased countries and 3s timeout", routes[0])
+	}
+	if routes[1].Timeout != defaultTimeout {
+		t.Errorf("routes[1].Timeout = %v, want default %v", routes[1].Timeout, defaultTimeout)
+	}
+
+	if routes, err := ParseRoutes("  "); err != nil || routes != nil {
+		t.Errorf("ParseRoutes(empty) = %v, %v; want nil, nil", routes, err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`[{"provider":"aliyun","base_url":"http://x"}]`,
+		`[{"countries":["CN"],"base_url":"http://x"}]`,
+		`[{"countries":["CN"],"provider":"aliyun"}]`,
+		`[{"countries":["CN"],"provider":"aliyun","base_url":"http://x","timeout":"soon"}]`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseRoutes(data); err == nil {
+			t.Errorf("ParseRoutes(%s) should fail", data)
+		}
+	}
+}
+
+func TestRouter_Provider(t *testing.T) {
+	router, err := NewRouter([]Route{
+		{Countries: []string{"CN", "HK"}, Provider: "aliyun", BaseURL: "http://sms-aliyun:8080"},
+		{Countries: []string{"HK", "NG"}, Provider: "termii", BaseURL: "http://sms-termii:8080"},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter() error = %v", err)
+	}
+
+	tests := map[string]string{"CN": "aliyun", "hk": "aliyun", "NG": "termii", "US": "", "": ""}
+	for country, want := range tests {
+		p, ok := router.Provider(country)
+		got := ""
+		if ok {
+			got = p.Name()
+		}
+		if got != want {
+			t.Errorf("Provider(%q) = %q, want %q", country, got, want)
+		}
+	}
+
+	var nilRouter *Router
+	if _, ok := nilRouter.Provider("CN"); ok {
+		t.Error("nil Router should not route")
+	}
+}
@@ -0,0 +1,250 @@
+package template
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Many email clients drop <style> elements, so rules from them are copied into the style
+// attribute of the elements they match. Only simple selectors are inlined (tag, .class, #id and
+// combinations such as td.code); other rules and at-rules such as @media stay in <style>.
+
+var (
+	cssComment     = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	simpleSelector = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9]*|\*)?((?:[.#][A-Za-z_-][A-Za-z0-9_-]*)*)$`)
+	selectorPart   = regexp.MustCompile(`[.#][A-Za-z_-][A-Za-z0-9_-]*`)
+)
+
+// cssRule is an inlinable rule with a single simple selector
+type cssRule struct {
+	tag         string // "" matches any element
+	id          string
+	classes     []string
+	decls       string
+	specificity int
+	order       int
+}
+
+// InlineCSS moves the rules of <style> elements into matching elements' style attributes.
+// Declarations already in a style attribute win over inlined ones.
+func InlineCSS(doc string) (string, error) {
+	if !strings.Contains(strings.ToLower(doc), "<style") {
+		return doc, nil
+	}
+	root, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		return "", err
+	}
+
+	var rules []cssRule
+	var styles []*html.Node
+	forEachElement(root, func(n *html.Node) {
+		if n.Data == "style" {
+			styles = append(styles, n)
+		}
+	})
+	for _, n := range styles {
+		var css strings.Builder
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		inlined, kept := parseCSS(css.String(), len(rules))
+		rules = append(rules, inlined...)
+		for n.FirstChild != nil {
+			n.RemoveChild(n.FirstChild)
+		}
+		if kept == "" {
+			n.Parent.RemoveChild(n)
+		} else {
+			n.AppendChild(&html.Node{Type: html.TextNode, Data: kept})
+		}
+	}
+	if len(rules) == 0 {
+		return doc, nil
+	}
+
+	forEachElement(root, func(n *html.Node) {
+		var matched []cssRule
+		for _, r := range rules {
+			if r.matches(n) {
+				matched = append(matched, r)
+			}
+		}
+		if len(matched) == 0 {
+			return
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if matched[i].specificity != matched[j].specificity {
+				return matched[i].specificity < matched[j].specificity
+			}
+			return matched[i].order < matched[j].order
+		})
+		decls := make([]string, 0, len(matched)+1)
+		for _, r := range matched {
+			decls = append(decls, r.decls)
+		}
+		idx := -1
+		for i, a := range n.Attr {
+			if a.Key == "style" {
+				idx = i
+				if own := normalizeDecls(a.Val); own != "" {
+					decls = append(decls, own)
+				}
+			}
+		}
+		style := strings.Join(decls, "; ")
+		if idx >= 0 {
+			n.Attr[idx].Val = style
+		} else {
+			n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+		}
+	})
+
+	var out strings.Builder
+	if err := html.Render(&out, root); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// parseCSS splits a stylesheet into inlinable rules (numbered from order) and the CSS to keep
+func parseCSS(css string, order int) (rules []cssRule, kept string) {
+	css = cssComment.ReplaceAllString(css, "")
+	var keep strings.Builder
+	for i := 0; i < len(css); {
+		rest := strings.TrimLeft(css[i:], " \t\r\n")
+		i = len(css) - len(rest)
+		if rest == "" {
+			break
+		}
+		open := strings.IndexByte(rest, '{')
+		if rest[0] == '@' {
+			// At-rules are kept as is: statements up to ';', blocks up to their closing brace
+			if semi := strings.IndexByte(rest, ';'); semi >= 0 && (open < 0 || semi < open) {
+				keep.WriteString(rest[:semi+1] + "\n")
+				i += semi + 1
+				continue
+			}
+			end := matchingBrace(rest, open)
+			keep.WriteString(rest[:end] + "\n")
+			i += end
+			continue
+		}
+		if open < 0 {
+			break
+		}
+		closing := strings.IndexByte(rest[open:], '}')
+		if closing < 0 {
+			break
+		}
+		closing += open
+		decls := normalizeDecls(rest[open+1 : closing])
+		for _, sel := range strings.Split(rest[:open], ",") {
+			sel = strings.TrimSpace(sel)
+			if r, ok := parseSelector(sel); ok && decls != "" {
+				r.decls = decls
+				r.order = order
+				order++
+				rules = append(rules, r)
+			} else if sel != "" {
+				keep.WriteString(sel + " { " + decls + " }\n")
+			}
+		}
+		i += closing + 1
+	}
+	return rules, strings.TrimSpace(keep.String())
+}
+
+// matchingBrace returns the index just past the brace closing the block opened at open
+func matchingBrace(s string, open int) int {
+	if open < 0 {
+		return len(s)
+	}
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// parseSelector parses a simple selector such as p, .code, #main or td.code
+func parseSelector(sel string) (cssRule, bool) {
+	m := simpleSelector.FindStringSubmatch(sel)
+	if m == nil || sel == "" {
+		return cssRule{}, false
+	}
+	r := cssRule{tag: strings.ToLower(m[1])}
+	if r.tag == "*" {
+		r.tag = ""
+	}
+	if r.tag != "" {
+		r.specificity = 1
+	}
+	for _, part := range selectorPart.FindAllString(m[2], -1) {
+		if part[0] == '#' {
+			r.id = part[1:]
+			r.specificity += 100
+		} else {
+			r.classes = append(r.classes, part[1:])
+			r.specificity += 10
+		}
+	}
+	return r, true
+}
+
+func (r cssRule) matches(n *html.Node) bool {
+	if r.tag != "" && n.Data != r.tag {
+		return false
+	}
+	if r.id != "" && attr(n, "id") != r.id {
+		return false
+	}
+	if len(r.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, want := range r.classes {
+			found := false
+			for _, c := range classes {
+				if c == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// normalizeDecls trims a declaration block to "a: b; c: d"
+func normalizeDecls(s string) string {
+	var decls []string
+	for _, d := range strings.Split(s, ";") {
+		if d = strings.TrimSpace(d); d != "" {
+			decls = append(decls, d)
+		}
+	}
+	return strings.Join(decls, "; ")
+}
+
+// forEachElement calls fn for every element below n, in document order
+func forEachElement(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		forEachElement(c, fn)
+	}
+}
@@ -0,0 +1,56 @@
+package template
+
+import "strings"
+
+// uaMatch maps a User-Agent token to a display name; the first match wins
+type uaMatch struct {
+	token, name string
+}
+
+// Order matters: Edge and Opera UAs also contain "Chrome/", Chrome's contains "Safari/"
+var (
+	uaBrowsers = []uaMatch{
+		{"Edg", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	}
+	uaSystems = []uaMatch{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Mac OS X", "macOS"},
+		{"Macintosh", "macOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// Device describes the browser and OS of a User-Agent for templates, e.g. "Chrome on macOS".
+// It returns whichever of the two it recognizes, or "" for unknown agents.
+func (m *Manager) Device(locale, ua string) string {
+	browser := matchUA(ua, uaBrowsers)
+	os := matchUA(ua, uaSystems)
+	switch {
+	case browser != "" && os != "":
+		format := m.translate(m.parseLanguage(locale), "device.browser_on_os", "{browser} on {os}")
+		return strings.NewReplacer("{browser}", browser, "{os}", os).Replace(format)
+	case browser != "":
+		return browser
+	default:
+		return os
+	}
+}
+
+func matchUA(ua string, matches []uaMatch) string {
+	for _, m := range matches {
+		if strings.Contains(ua, m.token) {
+			return m.name
+		}
+	}
+	return ""
+}
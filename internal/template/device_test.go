@@ -0,0 +1,22 @@
+package template
+
+import "testing"
+
+func TestManager_Device(t *testing.T) {
+	m := NewManager("")
+	tests := []struct {
+		locale, ua, want string
+	}{
+		{"en", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", "Edge on Windows"},
+		{"en", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0 Mobile/15E148 Safari/604.1", "Chrome on iOS"},
+		{"en", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Firefox on Linux"},
+		{"zh-CN", "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36", "Android 上的 Chrome"},
+		{"en", "Herald-CLI/1.0 (Windows)", "Windows"},
+		{"en", "curl/8.4.0", ""},
+	}
+	for _, tt := range tests {
+		if got := m.Device(tt.locale, tt.ua); got != tt.want {
+			t.Errorf("Device(%s, %q) = %q, want %q", tt.locale, tt.ua, got, tt.want)
+		}
+	}
+}
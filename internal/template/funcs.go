@@ -0,0 +1,99 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	i18n "github.com/soulteary/i18n-kit"
+)
+
+// funcs returns the helper functions available in templates for locale:
+//
+//	{{upper .AppName}}, {{lower .Purpose}}
+//	{{duration .ExpiresIn}}  -> "5 minutes" / "5分钟" (seconds, or a time.Duration)
+//	{{date .RequestedAt}}    -> "January 2, 2006" / "2006年1月2日"
+//	{{datetime .RequestedAt}} -> date with time and zone
+func (m *Manager) funcs(locale string) map[string]any {
+	lang := m.parseLanguage(locale)
+	return map[string]any{
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"duration": func(v any) string {
+			return m.formatDuration(lang, v)
+		},
+		"date": func(v any) string {
+			return formatTime(v, m.translate(lang, "date.layout", "January 2, 2006"))
+		},
+		"datetime": func(v any) string {
+			return formatTime(v, m.translate(lang, "datetime.layout", "January 2, 2006 15:04 MST"))
+		},
+	}
+}
+
+// translate returns the translation of key, or fallback when no locale file defines it
+func (m *Manager) translate(lang i18n.Language, key, fallback string) string {
+	if s := m.bundle.GetTranslation(lang, key); s != key {
+		return s
+	}
+	return fallback
+}
+
+// formatDuration spells out a duration in hours, minutes and seconds, e.g. "1 hour 30 minutes"
+func (m *Manager) formatDuration(lang i18n.Language, v any) string {
+	var d time.Duration
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	default:
+		return fmt.Sprint(v)
+	}
+	d = d.Round(time.Second)
+
+	units := []struct {
+		n              int64
+		one, many, def string
+	}{
+		{int64(d / time.Hour), "duration.hour", "duration.hours", "{n} hours"},
+		{int64(d % time.Hour / time.Minute), "duration.minute", "duration.minutes", "{n} minutes"},
+		{int64(d % time.Minute / time.Second), "duration.second", "duration.seconds", "{n} seconds"},
+	}
+	var parts []string
+	for _, u := range units {
+		if u.n == 0 {
+			continue
+		}
+		format := m.translate(lang, u.many, u.def)
+		if u.n == 1 {
+			format = m.translate(lang, u.one, strings.TrimSuffix(format, "s"))
+		}
+		parts = append(parts, strings.ReplaceAll(format, "{n}", fmt.Sprint(u.n)))
+	}
+	if len(parts) == 0 {
+		return strings.ReplaceAll(m.translate(lang, "duration.seconds", "{n} seconds"), "{n}", "0")
+	}
+	return strings.Join(parts, m.translate(lang, "duration.separator", " "))
+}
+
+// formatTime formats a time.Time or Unix seconds with layout
+func formatTime(v any, layout string) string {
+	var t time.Time
+	switch v := v.(type) {
+	case time.Time:
+		t = v
+	case int64:
+		t = time.Unix(v, 0).UTC()
+	case int:
+		t = time.Unix(int64(v), 0).UTC()
+	default:
+		return fmt.Sprint(v)
+	}
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,59 @@
+package template
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_formatDuration(t *testing.T) {
+	m := NewManager("")
+	tests := []struct {
+		locale string
+		v      any
+		want   string
+	}{
+		{"en", 300, "5 minutes"},
+		{"en", 60, "1 minute"},
+		{"en", 90 * time.Second, "1 minute 30 seconds"},
+		{"en", int64(3600), "1 hour"},
+		{"en", 0, "0 seconds"},
+		{"zh-CN", 5400, "1小时30分钟"},
+		{"en", "soon", "soon"},
+	}
+	for _, tt := range tests {
+		if got := m.formatDuration(m.parseLanguage(tt.locale), tt.v); got != tt.want {
+			t.Errorf("formatDuration(%s, %v) = %q, want %q", tt.locale, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestManager_TemplateFuncsAndData(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"en/sms/login.txt": `{{upper .AppName}}: {{.Code}} for {{.UserDisplayName}}, valid {{duration .ExpiresIn}}. ` +
+			`Requested {{date .RequestedAt}} from {{.Device}} in {{.Location}}. Plan: {{.Vars.plan}}{{.Vars.missing}}`,
+		"zh-CN/email/login.html": `{{define "subject"}}{{.AppName}} 验证码{{end}}<p>{{datetime .RequestedAt}} {{duration .ExpiresIn}}</p>`,
+	})
+	m := NewManager(dir)
+	data := TemplateData{
+		Code:            "123456",
+		ExpiresIn:       600,
+		AppName:         "Acme",
+		UserDisplayName: "Alice",
+		Location:        "DE",
+		Device:          m.Device("en", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"),
+		RequestedAt:     time.Date(2026, 3, 14, 9, 30, 0, 0, time.UTC),
+		Vars:            map[string]string{"plan": "Pro"},
+	}
+
+	body, err := m.RenderSMS("en", "login", data)
+	want := "ACME: 123456 for Alice, valid 10 minutes. Requested March 14, 2026 from Safari on macOS in DE. Plan: Pro"
+	if err != nil || body != want {
+		t.Errorf("RenderSMS() = %q, %v, want %q", body, err, want)
+	}
+
+	email, err := m.RenderEmailParts("zh-CN", "login", data)
+	if err != nil || email.Subject != "Acme 验证码" || !strings.Contains(email.HTML, "2026年3月14日 09:30 UTC 10分钟") {
+		t.Errorf("RenderEmailParts(zh-CN) = %+v, %v", email, err)
+	}
+}
@@ -0,0 +1,187 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Email is a rendered email. HTML is empty when there is no HTML template for the purpose.
+type Email struct {
+	Subject string
+	Text    string // Plaintext part, generated from HTML when there is no .txt template
+	HTML    string
+}
+
+// parseHTML parses an HTML email template at path on top of the shared layouts and partials
+func parseHTML(shared *htmltemplate.Template, key, path string, funcs map[string]any) (*htmltemplate.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	base := htmltemplate.New(key)
+	if shared != nil {
+		if base, err = shared.Clone(); err != nil {
+			return nil, err
+		}
+		base = base.New(key)
+	}
+	return base.Option("missingkey=zero").Funcs(funcs).Parse(string(content))
+}
+
+// renderHTMLEmail renders the HTML template for key, inlines its CSS and derives the subject
+// from the template's "subject" block when it defines one
+func renderHTMLEmail(tmpl *htmltemplate.Template, data TemplateData) (subject, body string, err error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	body, err = InlineCSS(buf.String())
+	if err != nil {
+		return "", "", err
+	}
+	if t := tmpl.Lookup("subject"); t != nil {
+		var sb strings.Builder
+		if err := t.Execute(&sb, data); err != nil {
+			return "", "", err
+		}
+		subject = strings.TrimSpace(html.UnescapeString(sb.String()))
+	}
+	return subject, body, nil
+}
+
+// renderTextEmail renders a .txt email template: the first line is the subject, the rest the body
+func (m *Manager) renderTextEmail(key string, data TemplateData) (subject, body string, ok bool) {
+	tmpl, found := m.textTemplate(key)
+	if !found {
+		return "", "", false
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", "", false
+	}
+	content := buf.String()
+	lines := strings.SplitN(content, "\n", 2)
+	if len(lines) >= 2 {
+		return lines[0], lines[1], true
+	}
+	return "Verification Code", content, true
+}
+
+// HTMLToText converts an HTML email to its plaintext alternative: block elements start new
+// lines, links keep their URL and head, style and script content is dropped
+func HTMLToText(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			writeText(&b, n.Data)
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "head", "style", "script", "title":
+				return
+			case "br":
+				b.WriteString("\n")
+				return
+			case "hr":
+				b.WriteString("\n----------\n")
+				return
+			case "li":
+				b.WriteString("\n- ")
+			case "td", "th":
+				if n.PrevSibling != nil {
+					b.WriteString(" ")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.Data {
+		case "a":
+			if href := attr(n, "href"); href != "" && !strings.HasPrefix(href, "#") && href != textContent(n) {
+				fmt.Fprintf(&b, " (%s)", strings.TrimPrefix(href, "mailto:"))
+			}
+		case "p", "div", "table", "h1", "h2", "h3", "h4", "h5", "h6", "ul", "ol", "blockquote", "section", "header", "footer":
+			b.WriteString("\n\n")
+		case "tr":
+			b.WriteString("\n")
+		}
+	}
+	walk(doc)
+	return tidyText(b.String()), nil
+}
+
+// writeText appends text with HTML whitespace collapsed
+func writeText(b *strings.Builder, s string) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			b.WriteString(" ")
+		}
+		return
+	}
+	if s[0] == ' ' || s[0] == '\n' || s[0] == '\t' || s[0] == '\r' {
+		b.WriteString(" ")
+	}
+	b.WriteString(strings.Join(fields, " "))
+	if last := s[len(s)-1]; last == ' ' || last == '\n' || last == '\t' || last == '\r' {
+		b.WriteString(" ")
+	}
+}
+
+// tidyText trims every line and keeps at most one blank line between paragraphs
+func tidyText(s string) string {
+	var out []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var buf bytes.Buffer
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(buf.String())
+}
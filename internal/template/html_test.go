@@ -0,0 +1,153 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplates writes files (path relative to the returned directory -> content)
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	return dir
+}
+
+const testLayout = `{{define "layout"}}<!DOCTYPE html>
+<html><head><style>
+p { margin: 0 0 12px }
+.code { font-size: 24px; font-weight: bold }
+@media (max-width: 600px) { .code { font-size: 20px } }
+</style></head>
+<body>{{template "content" .}}{{template "footer" .}}</body></html>{{end}}`
+
+func TestManager_RenderEmailParts_HTML(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"_layouts/base.html":    testLayout,
+		"_partials/footer.html": `{{define "footer"}}<p>Need help? <a href="https://example.com/help">Contact support</a></p>{{end}}`,
+		"en/email/login.html": `{{define "subject"}}Sign in to Acme & Co{{end}}` +
+			`{{define "content"}}<p>Your code for {{.Purpose}}:</p><p class="code" style="color: #333">{{.Code}}</p>{{end}}` +
+			`{{template "layout" .}}`,
+		"en/email/reset.html": `{{define "content"}}<p>Reset code: {{.Code}}</p>{{end}}{{template "layout" .}}`,
+		"en/email/reset.txt":  "Reset your password\nUse {{.Code}} to reset your password.",
+	})
+	m := NewManager(dir)
+
+	email, err := m.RenderEmailParts("en", "login", TemplateData{Code: "123456", Purpose: "<script>", ExpiresIn: 300})
+	if err != nil {
+		t.Fatalf("RenderEmailParts() error = %v", err)
+	}
+	if email.Subject != "Sign in to Acme & Co" {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+	if strings.Contains(email.HTML, "<script>") || !strings.Contains(email.HTML, "&lt;script&gt;") {
+		t.Errorf("HTML not escaped: %s", email.HTML)
+	}
+	if !strings.Contains(email.HTML, `<p class="code" style="margin: 0 0 12px; font-size: 24px; font-weight: bold; color: #333">123456</p>`) {
+		t.Errorf("CSS not inlined: %s", email.HTML)
+	}
+	if !strings.Contains(email.HTML, "@media (max-width: 600px)") || strings.Contains(email.HTML, ".code { font-size: 24px") {
+		t.Errorf("<style> should keep only the @media rule: %s", email.HTML)
+	}
+	wantText := "Your code for <script>:\n\n123456\n\nNeed help? Contact support (https://example.com/help)"
+	if email.Text != wantText {
+		t.Errorf("Text = %q, want %q", email.Text, wantText)
+	}
+
+	// A .txt template provides the plaintext part and, without a subject block, the subject
+	email, err = m.RenderEmailParts("en", "reset", TemplateData{Code: "654321"})
+	if err != nil {
+		t.Fatalf("RenderEmailParts() error = %v", err)
+	}
+	if email.Subject != "Reset your password" || email.Text != "Use 654321 to reset your password." || !strings.Contains(email.HTML, "Reset code: 654321") {
+		t.Errorf("RenderEmailParts(reset) = %+v", email)
+	}
+
+	// RenderEmail keeps returning the plaintext part
+	subject, body, err := m.RenderEmail("en", "login", TemplateData{Code: "123456"})
+	if err != nil || subject != "Sign in to Acme & Co" || !strings.Contains(body, "123456") || strings.Contains(body, "<p") {
+		t.Errorf("RenderEmail() = %q, %q, %v", subject, body, err)
+	}
+
+	// No HTML template: plaintext only
+	email, _ = m.RenderEmailParts("en", "bind", TemplateData{Code: "111111", ExpiresIn: 300})
+	if email.HTML != "" || !strings.Contains(email.Text, "111111") {
+		t.Errorf("RenderEmailParts(bind) = %+v", email)
+	}
+}
+
+func TestManager_LoadTemplates_SkipsSharedDirs(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"_partials/email/login.html": `{{define "footer"}}footer{{end}}`,
+		"en/email/login.txt":         "Subject\nBody {{.Code}}",
+	})
+	m := NewManager(dir)
+	if len(m.loaded.Load().html) != 0 {
+		t.Errorf("html templates = %v, want none", m.loaded.Load().html)
+	}
+	if _, ok := m.loaded.Load().templates["en:email:login"]; !ok {
+		t.Error("en:email:login not loaded")
+	}
+}
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "no style element",
+			in:   `<p class="a">x</p>`,
+			want: `<p class="a">x</p>`,
+		},
+		{
+			name: "specificity and inline precedence",
+			in:   `<html><head><style>#m { color: red } p.a { color: blue } p { color: green; margin: 0 }</style></head><body><p id="m" class="a" style="margin: 4px">x</p></body></html>`,
+			want: `<html><head></head><body><p id="m" class="a" style="color: green; margin: 0; color: blue; color: red; margin: 4px">x</p></body></html>`,
+		},
+		{
+			name: "complex selectors stay in style",
+			in:   `<html><head><style>/* c */ td a, .b { color: red } a:hover { color: blue }</style></head><body><span class="b">x</span></body></html>`,
+			want: `<html><head><style>td a { color: red }
+a:hover { color: blue }</style></head><body><span class="b" style="color: red">x</span></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InlineCSS(tt.in)
+			if err != nil {
+				t.Fatalf("InlineCSS() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("InlineCSS() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	in := `<html><head><title>T</title><style>p{}</style></head><body>
+<h1>Hello   there</h1>
+<p>Line one<br>line two</p>
+<ul><li>First</li><li>Second</li></ul>
+<table><tr><td>Code</td><td><b>123456</b></td></tr></table>
+<p><a href="https://example.com">https://example.com</a> <a href="mailto:help@example.com">Email us</a></p>
+</body></html>`
+	want := "Hello there\n\nLine one\nline two\n\n- First\n- Second\n\nCode 123456\n\nhttps://example.com Email us (help@example.com)"
+	got, err := HTMLToText(in)
+	if err != nil {
+		t.Fatalf("HTMLToText() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("HTMLToText() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,324 @@
+package template
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/soulteary/herald/internal/metrics"
+)
+
+// Template formats
+const (
+	FormatText = "text"
+	FormatHTML = "html"
+)
+
+// Directories under the template directory whose .html files (layouts and partials) are parsed
+// into every HTML email template, so purposes share one layout
+var sharedHTMLDirs = []string{"_layouts", "_partials"}
+
+// sampleUA is the User-Agent behind SampleData's Device
+const sampleUA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// TemplateInfo is a loaded template file
+type TemplateInfo struct {
+	Key    string `json:"key"`    // locale:channel:purpose
+	Format string `json:"format"` // "text" or "html"
+	Path   string `json:"path"`   // Relative to the template directory
+}
+
+// TemplateError is a template file that failed to parse or to render sample data
+type TemplateError struct {
+	Path   string `json:"path"`
+	Key    string `json:"key,omitempty"`
+	Format string `json:"format,omitempty"`
+	Error  string `json:"error"`
+	// Previous is true when the last valid version of the template stays in use
+	Previous bool `json:"previous,omitempty"`
+}
+
+// Report is the result of the last template load
+type Report struct {
+	Templates []TemplateInfo  `json:"templates"`
+	Invalid   []TemplateError `json:"invalid"`
+	LoadedAt  int64           `json:"loaded_at"`
+}
+
+// Watch checks the template directory for changes every interval in the background and swaps in
+// the reloaded templates; the returned function stops it. An interval of 0 disables reloading.
+func (m *Manager) Watch(interval time.Duration) (stop func()) {
+	if interval <= 0 || m.dir == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, _ = m.Reload()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Report returns the result of the last template load
+func (m *Manager) Report() Report {
+	return m.loaded.Load().report
+}
+
+// Reload reloads the templates when a file in the template directory was added, removed or
+// modified; it reports whether templates were reloaded
+func (m *Manager) Reload() (bool, error) {
+	if m.dir == "" {
+		return false, nil
+	}
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	fingerprint, err := m.dirFingerprint()
+	if err != nil {
+		return false, err
+	}
+	if fingerprint == m.loaded.Load().fingerprint {
+		return false, nil
+	}
+	m.loadTemplates()
+	return true, nil
+}
+
+// textTemplate returns the text template for key
+func (m *Manager) textTemplate(key string) (*template.Template, bool) {
+	tmpl, ok := m.loaded.Load().templates[key]
+	return tmpl, ok
+}
+
+// htmlTemplate returns the HTML email template for key
+func (m *Manager) htmlTemplate(key string) (*htmltemplate.Template, bool) {
+	tmpl, ok := m.loaded.Load().html[key]
+	return tmpl, ok
+}
+
+// Lookup returns the first of keys with a loaded template, or "" when they all use built-in text
+func (m *Manager) Lookup(keys ...string) string {
+	for _, key := range keys {
+		if _, ok := m.textTemplate(key); ok {
+			return key
+		}
+		if _, ok := m.htmlTemplate(key); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// Check renders the templates loaded for key with data and returns the first error. Rendering
+// itself falls back to built-in text on errors; Check shows what went wrong.
+func (m *Manager) Check(key string, data TemplateData) error {
+	text, _ := m.textTemplate(key)
+	html, _ := m.htmlTemplate(key)
+	return checkTemplates(text, html, data)
+}
+
+func checkTemplates(text *template.Template, html *htmltemplate.Template, data TemplateData) error {
+	if text != nil {
+		if err := text.Execute(io.Discard, data); err != nil {
+			return err
+		}
+	}
+	if html != nil {
+		if _, _, err := renderHTMLEmail(html, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SampleData returns example data for previews and for validating templates when they are loaded
+func (m *Manager) SampleData(locale string) TemplateData {
+	return TemplateData{
+		Code:            "123456",
+		ExpiresIn:       300,
+		Purpose:         "login",
+		Locale:          locale,
+		SpokenCode:      m.SpokenCode(locale, "123456"),
+		AppName:         "Herald",
+		SupportURL:      "https://example.com/support",
+		UserDisplayName: "Alice",
+		Destination:     "al***@example.com",
+		ClientIP:        "203.0.113.10",
+		Location:        "US",
+		Device:          m.Device(locale, sampleUA),
+		RequestedAt:     time.Now().UTC(),
+		Vars:            map[string]string{},
+	}
+}
+
+// loadTemplates loads templates from the template directory; callers hold reloadMu. A template
+// that fails to parse or to render sample data is reported; its previously loaded version, if
+// any, stays in use.
+func (m *Manager) loadTemplates() {
+	if m.dir == "" {
+		// Use built-in templates
+		return
+	}
+	fingerprint, _ := m.dirFingerprint()
+	texts, htmls, report := m.parseDir()
+
+	previous := m.loaded.Load()
+	for i, e := range report.Invalid {
+		switch {
+		case e.Format == FormatText && previous.templates[e.Key] != nil && texts[e.Key] == nil:
+			texts[e.Key] = previous.templates[e.Key]
+		case e.Format == FormatHTML && previous.html[e.Key] != nil && htmls[e.Key] == nil:
+			htmls[e.Key] = previous.html[e.Key]
+		default:
+			continue
+		}
+		report.Invalid[i].Previous = true
+	}
+	m.loaded.Store(&templateSet{templates: texts, html: htmls, report: report, fingerprint: fingerprint})
+
+	metrics.SetTemplates(len(report.Templates), len(report.Invalid))
+}
+
+// parseDir parses every template file
+// Expected structure: templates/{locale}/{channel}/{purpose}.txt
+// Example: templates/zh-CN/email/login.txt
+// HTML emails: templates/{locale}/email/{purpose}.html, sharing templates/_layouts and _partials
+func (m *Manager) parseDir() (map[string]*template.Template, map[string]*htmltemplate.Template, Report) {
+	texts := make(map[string]*template.Template)
+	htmls := make(map[string]*htmltemplate.Template)
+	report := Report{Templates: []TemplateInfo{}, Invalid: []TemplateError{}, LoadedAt: time.Now().Unix()}
+	invalid := func(path, key, format string, err error) {
+		report.Invalid = append(report.Invalid, TemplateError{Path: path, Key: key, Format: format, Error: err.Error()})
+	}
+
+	shared := m.parseShared(invalid)
+	_ = filepath.Walk(m.dir, func(path string, info os.FileInfo, err error) error {
+		relPath, _ := filepath.Rel(m.dir, path)
+		relPath = filepath.ToSlash(relPath)
+		if err != nil {
+			invalid(relPath, "", "", err)
+			return nil
+		}
+		if path != m.dir && strings.HasPrefix(info.Name(), ".") {
+			// Hidden files and directories (editor swap files, .git)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if path != m.dir && strings.HasPrefix(info.Name(), "_") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Parse file path: {locale}/{channel}/{purpose}.txt
+		parts := strings.Split(relPath, "/")
+		if len(parts) != 3 {
+			invalid(relPath, "", "", fmt.Errorf("unexpected location, want {locale}/{channel}/{purpose}.txt"))
+			return nil
+		}
+		locale := parts[0]
+		channel := parts[1]
+		purpose := strings.TrimSuffix(parts[2], filepath.Ext(parts[2]))
+		key := fmt.Sprintf("%s:%s:%s", locale, channel, purpose)
+		sample := m.SampleData(locale)
+
+		if channel == "email" && filepath.Ext(path) == ".html" {
+			tmpl, err := parseHTML(shared, key, path, m.funcs(locale))
+			if err == nil {
+				err = checkTemplates(nil, tmpl, sample)
+			}
+			if err != nil {
+				invalid(relPath, key, FormatHTML, err)
+				return nil
+			}
+			htmls[key] = tmpl
+			report.Templates = append(report.Templates, TemplateInfo{Key: key, Format: FormatHTML, Path: relPath})
+			return nil
+		}
+
+		// missingkey=zero: template_vars the caller did not send render as ""
+		tmpl, err := template.New(filepath.Base(path)).Option("missingkey=zero").Funcs(m.funcs(locale)).ParseFiles(path)
+		if err == nil {
+			err = checkTemplates(tmpl, nil, sample)
+		}
+		if err != nil {
+			invalid(relPath, key, FormatText, err)
+			return nil
+		}
+		texts[key] = tmpl
+		report.Templates = append(report.Templates, TemplateInfo{Key: key, Format: FormatText, Path: relPath})
+		return nil
+	})
+
+	sort.Slice(report.Templates, func(i, j int) bool {
+		a, b := report.Templates[i], report.Templates[j]
+		return a.Key < b.Key || (a.Key == b.Key && a.Format < b.Format)
+	})
+	return texts, htmls, report
+}
+
+// parseShared parses the shared layouts and partials, reporting files that fail to parse.
+// A nil result means there are none.
+func (m *Manager) parseShared(invalid func(path, key, format string, err error)) *htmltemplate.Template {
+	var files []string
+	for _, dir := range sharedHTMLDirs {
+		matches, _ := filepath.Glob(filepath.Join(m.dir, dir, "*.html"))
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	// Locale-specific helpers replace these when a purpose template is parsed
+	shared := htmltemplate.New("_shared").Funcs(m.funcs(""))
+	for _, file := range files {
+		if _, err := shared.ParseFiles(file); err != nil {
+			relPath, _ := filepath.Rel(m.dir, file)
+			invalid(filepath.ToSlash(relPath), "", FormatHTML, err)
+		}
+	}
+	return shared
+}
+
+// dirFingerprint hashes the path, size and modification time of every file in the template directory
+func (m *Manager) dirFingerprint() (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(m.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
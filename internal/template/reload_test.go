@@ -0,0 +1,158 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_Report(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"en/sms/login.txt":    "Code {{.Code}}",
+		"en/email/login.html": `{{define "subject"}}Sign in{{end}}<p>{{.Code}}</p>`,
+		"en/sms/reset.txt":    "Code {{.Code",
+		"en/sms/bind.txt":     "Code {{.Code.Missing}}",
+		"en/login.txt":        "misplaced",
+		"en/sms/.login.swp":   "ignored",
+	})
+	m := NewManager(dir)
+	report := m.Report()
+
+	var keys []string
+	for _, info := range report.Templates {
+		keys = append(keys, info.Key+"/"+info.Format)
+	}
+	if got, want := strings.Join(keys, ","), "en:email:login/html,en:sms:login/text"; got != want {
+		t.Errorf("Templates = %s, want %s", got, want)
+	}
+
+	invalid := make(map[string]TemplateError)
+	for _, e := range report.Invalid {
+		invalid[e.Path] = e
+	}
+	if len(invalid) != 3 {
+		t.Fatalf("Invalid = %+v, want 3 entries", report.Invalid)
+	}
+	for _, path := range []string{"en/sms/reset.txt", "en/sms/bind.txt", "en/login.txt"} {
+		if e, ok := invalid[path]; !ok || e.Error == "" || e.Previous {
+			t.Errorf("Invalid[%s] = %+v", path, e)
+		}
+	}
+	if report.LoadedAt == 0 {
+		t.Error("LoadedAt not set")
+	}
+
+	// A template that fails to render sample data falls back to built-in text
+	body, _ := m.RenderSMS("en", "bind", m.SampleData("en"))
+	if strings.Contains(body, "Missing") || !strings.Contains(body, "123456") {
+		t.Errorf("RenderSMS(bind) = %q, want built-in text", body)
+	}
+}
+
+func TestManager_Reload(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"en/sms/login.txt": "Code {{.Code}}",
+	})
+	path := filepath.Join(dir, "en", "sms", "login.txt")
+	m := NewManager(dir)
+
+	if reloaded, err := m.Reload(); err != nil || reloaded {
+		t.Fatalf("Reload() unchanged = %v, %v; want false, nil", reloaded, err)
+	}
+
+	// A broken edit keeps the last valid version
+	writeFile(t, path, "Broken {{.Code")
+	if reloaded, err := m.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() = %v, %v; want true, nil", reloaded, err)
+	}
+	report := m.Report()
+	if len(report.Invalid) != 1 || !report.Invalid[0].Previous {
+		t.Errorf("Invalid = %+v, want one entry using the previous version", report.Invalid)
+	}
+	if body, _ := m.RenderSMS("en", "login", TemplateData{Code: "111"}); body != "Code 111" {
+		t.Errorf("RenderSMS() = %q, want previous template", body)
+	}
+
+	// A fixed edit is picked up
+	writeFile(t, path, "New {{.Code}}")
+	if reloaded, _ := m.Reload(); !reloaded {
+		t.Fatal("Reload() = false, want true")
+	}
+	if body, _ := m.RenderSMS("en", "login", TemplateData{Code: "111"}); body != "New 111" {
+		t.Errorf("RenderSMS() = %q, want %q", body, "New 111")
+	}
+	if len(m.Report().Invalid) != 0 {
+		t.Errorf("Invalid = %+v, want none", m.Report().Invalid)
+	}
+}
+
+func TestManager_ReloadInterval(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"en/sms/login.txt": "Code {{.Code}}",
+	})
+	m := NewManager(dir)
+	stop := m.Watch(time.Millisecond)
+	defer stop()
+
+	writeFile(t, filepath.Join(dir, "en", "sms", "login.txt"), "Updated {{.Code}}")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		body, _ := m.RenderSMS("en", "login", TemplateData{Code: "1"})
+		if body == "Updated 1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("RenderSMS() = %q, want reloaded template", body)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Stopped watchers leave the loaded set alone
+	stop()
+	time.Sleep(5 * time.Millisecond)
+	writeFile(t, filepath.Join(dir, "en", "sms", "login.txt"), "Again {{.Code}}")
+	time.Sleep(10 * time.Millisecond)
+	if body, _ := m.RenderSMS("en", "login", TemplateData{Code: "1"}); body != "Updated 1" {
+		t.Errorf("RenderSMS() after stop = %q, want %q", body, "Updated 1")
+	}
+}
+
+func TestManager_LookupAndCheck(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"en/sms/login.txt":  "Code {{.Code}}",
+		"en/push/login.txt": "Approve {{index .Vars \"app\"}}",
+	})
+	m := NewManager(dir)
+
+	if got := m.Lookup("en:sms:reset", "en:sms:login"); got != "en:sms:login" {
+		t.Errorf("Lookup() = %q, want en:sms:login", got)
+	}
+	if got := m.Lookup("en:email:login"); got != "" {
+		t.Errorf("Lookup() = %q, want \"\"", got)
+	}
+	if err := m.Check("en:sms:login", m.SampleData("en")); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	if err := m.Check("en:push:login", TemplateData{}); err != nil {
+		t.Errorf("Check() nil Vars error = %v", err)
+	}
+}
+
+// writeFile replaces a template file, moving its modification time forward so the change is
+// detected on filesystems with coarse timestamps
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	mtime := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+}
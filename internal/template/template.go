@@ -2,10 +2,13 @@ package template
 
 import (
 	"fmt"
-	"os"
+	htmltemplate "html/template"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
+	"time"
 
 	i18n "github.com/soulteary/i18n-kit"
 	"github.com/soulteary/provider-kit"
@@ -17,14 +20,38 @@ type TemplateData struct {
 	ExpiresIn int // seconds
 	Purpose   string
 	Locale    string
+	// SpokenCode is Code with its digits separated for text-to-speech (voice channel only)
+	SpokenCode string
+
+	AppName         string    // TEMPLATE_APP_NAME
+	SupportURL      string    // TEMPLATE_SUPPORT_URL
+	UserDisplayName string    // Caller-supplied display_name
+	Destination     string    // Masked destination, e.g. "al***@example.com"
+	ClientIP        string    // IP of the end user who requested the code
+	Location        string    // Country of ClientIP (ISO code); empty without GEOIP_DB_PATH
+	Device          string    // Browser and OS from the User-Agent, e.g. "Chrome on macOS"
+	RequestedAt     time.Time // When the code was requested (UTC)
+	// Vars are the caller's template_vars allowed for this template (TEMPLATE_VARS_ALLOWLIST)
+	Vars map[string]string
 }
 
 // Manager handles template loading and rendering
 type Manager struct {
-	templates map[string]*template.Template // key: "locale:channel:purpose"
 	dir       string
 	bundle    *i18n.Bundle
 	formatter *i18n.Formatter
+
+	// loaded is swapped as a whole on reload, so rendering never takes a lock
+	loaded   atomic.Pointer[templateSet]
+	reloadMu sync.Mutex // Serializes loads
+}
+
+// templateSet is one load of the template directory
+type templateSet struct {
+	templates   map[string]*template.Template     // key: "locale:channel:purpose"
+	html        map[string]*htmltemplate.Template // HTML email templates, key: "locale:email:purpose"
+	report      Report
+	fingerprint string
 }
 
 // NewManager creates a new template manager
@@ -32,13 +59,19 @@ func NewManager(templateDir string) *Manager {
 	bundle := i18n.NewBundle(i18n.LangEN)
 
 	m := &Manager{
-		templates: make(map[string]*template.Template),
 		dir:       templateDir,
 		bundle:    bundle,
 		formatter: i18n.NewFormatter(bundle),
 	}
+	m.loaded.Store(&templateSet{
+		templates: make(map[string]*template.Template),
+		html:      make(map[string]*htmltemplate.Template),
+		report:    Report{Templates: []TemplateInfo{}, Invalid: []TemplateError{}},
+	})
 	m.loadTranslations()
+	m.reloadMu.Lock()
 	m.loadTemplates()
+	m.reloadMu.Unlock()
 	return m
 }
 
@@ -71,6 +104,20 @@ func (m *Manager) loadBuiltInTranslations() {
 		"email.body_with_purpose": "Your {purpose} verification code is: {code}\n\nThis code will expire in {minutes} minutes.",
 		"sms.body":                "Your verification code is: {code}. Valid for {minutes} minutes.",
 		"sms.body_with_purpose":   "Your {purpose} verification code is: {code}. Valid for {minutes} minutes.",
+		"voice.separator":         ", ",
+		"voice.body":              "Your verification code is: {code}. Once again, your code is: {code}.",
+		"voice.body_with_purpose": "Your {purpose} verification code is: {code}. Once again, your code is: {code}.",
+		"push.body":               "Approve your {purpose} request by entering the number shown on your screen.",
+		"duration.hour":           "1 hour",
+		"duration.hours":          "{n} hours",
+		"duration.minute":         "1 minute",
+		"duration.minutes":        "{n} minutes",
+		"duration.second":         "1 second",
+		"duration.seconds":        "{n} seconds",
+		"duration.separator":      " ",
+		"date.layout":             "January 2, 2006",
+		"datetime.layout":         "January 2, 2006 15:04 MST",
+		"device.browser_on_os":    "{browser} on {os}",
 	})
 
 	// Chinese translations
@@ -84,53 +131,32 @@ func (m *Manager) loadBuiltInTranslations() {
 		"email.body_with_purpose": "您的{purpose}验证码是： {code} \n\n此验证码将在 {minutes} 分钟后过期。",
 		"sms.body":                "您的验证码是： {code} ，{minutes}分钟内有效。",
 		"sms.body_with_purpose":   "您的{purpose}验证码是： {code} ，{minutes}分钟内有效。",
-	})
-}
-
-// loadTemplates loads templates from the template directory
-func (m *Manager) loadTemplates() {
-	if m.dir == "" {
-		// Use built-in templates
-		return
-	}
-
-	// Load templates from directory
-	// Expected structure: templates/{locale}/{channel}/{purpose}.txt
-	// Example: templates/zh-CN/email/login.txt
-	_ = filepath.Walk(m.dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
-		if info.IsDir() {
-			return nil
-		}
-
-		// Parse file path: {locale}/{channel}/{purpose}.txt
-		relPath, _ := filepath.Rel(m.dir, path)
-		parts := strings.Split(relPath, string(filepath.Separator))
-		if len(parts) != 3 {
-			return nil
-		}
-
-		locale := parts[0]
-		channel := parts[1]
-		purpose := strings.TrimSuffix(parts[2], filepath.Ext(parts[2]))
-
-		key := fmt.Sprintf("%s:%s:%s", locale, channel, purpose)
-		tmpl, err := template.ParseFiles(path)
-		if err == nil {
-			m.templates[key] = tmpl
-		}
-
-		return nil
+		"voice.separator":         "，",
+		"voice.body":              "您的验证码是：{code}。重复一遍，您的验证码是：{code}。",
+		"voice.body_with_purpose": "您的{purpose}验证码是：{code}。重复一遍，您的验证码是：{code}。",
+		"push.body":               "请输入屏幕上显示的数字，批准您的{purpose}请求。",
+		"duration.hour":           "1小时",
+		"duration.hours":          "{n}小时",
+		"duration.minute":         "1分钟",
+		"duration.minutes":        "{n}分钟",
+		"duration.second":         "1秒",
+		"duration.seconds":        "{n}秒",
+		"duration.separator":      "",
+		"date.layout":             "2006年1月2日",
+		"datetime.layout":         "2006年1月2日 15:04 MST",
+		"device.browser_on_os":    "{os} 上的 {browser}",
 	})
 }
 
 // Render renders a template with the given data
 func (m *Manager) Render(locale, channel, purpose string, data TemplateData) (string, error) {
+	if channel == "voice" && data.SpokenCode == "" {
+		data.SpokenCode = m.SpokenCode(locale, data.Code)
+	}
+
 	// Try to find template: locale:channel:purpose
 	key := fmt.Sprintf("%s:%s:%s", locale, channel, purpose)
-	if tmpl, ok := m.templates[key]; ok {
+	if tmpl, ok := m.textTemplate(key); ok {
 		var buf strings.Builder
 		if err := tmpl.Execute(&buf, data); err == nil {
 			return buf.String(), nil
@@ -139,7 +165,7 @@ func (m *Manager) Render(locale, channel, purpose string, data TemplateData) (st
 
 	// Fallback to locale:channel:*
 	key = fmt.Sprintf("%s:%s:*", locale, channel)
-	if tmpl, ok := m.templates[key]; ok {
+	if tmpl, ok := m.textTemplate(key); ok {
 		var buf strings.Builder
 		if err := tmpl.Execute(&buf, data); err == nil {
 			return buf.String(), nil
@@ -150,34 +176,50 @@ func (m *Manager) Render(locale, channel, purpose string, data TemplateData) (st
 	return m.renderBuiltIn(locale, channel, purpose, data)
 }
 
-// RenderEmail renders an email template and returns subject and body
+// RenderEmail renders an email template and returns subject and plaintext body
 func (m *Manager) RenderEmail(locale, purpose string, data TemplateData) (subject, body string, err error) {
-	// Try to find template: locale:email:purpose
+	email, err := m.RenderEmailParts(locale, purpose, data)
+	return email.Subject, email.Text, err
+}
+
+// RenderEmailParts renders an email with its HTML part when there is a {purpose}.html template.
+// The subject comes from the HTML template's "subject" block, else from the first line of the
+// .txt template; the plaintext part is the .txt template, else generated from the HTML.
+func (m *Manager) RenderEmailParts(locale, purpose string, data TemplateData) (Email, error) {
 	key := fmt.Sprintf("%s:email:%s", locale, purpose)
-	if tmpl, ok := m.templates[key]; ok {
-		var buf strings.Builder
-		if err := tmpl.Execute(&buf, data); err == nil {
-			// For email, we expect the template to contain both subject and body
-			// For simplicity, we'll use the full content as body and extract subject if possible
-			content := buf.String()
-			lines := strings.SplitN(content, "\n", 2)
-			if len(lines) >= 2 {
-				return lines[0], lines[1], nil
+	textSubject, text, hasText := m.renderTextEmail(key, data)
+
+	if tmpl, ok := m.htmlTemplate(key); ok {
+		if subject, body, err := renderHTMLEmail(tmpl, data); err == nil {
+			if !hasText {
+				if text, err = HTMLToText(body); err != nil {
+					text = ""
+				}
+			}
+			if subject == "" {
+				subject = textSubject
+			}
+			if subject == "" {
+				subject, _ = m.renderEmailBuiltIn(locale, purpose, data)
 			}
-			return "Verification Code", content, nil
+			return Email{Subject: subject, Text: text, HTML: body}, nil
 		}
 	}
 
+	if hasText {
+		return Email{Subject: textSubject, Text: text}, nil
+	}
+
 	// Fallback to built-in templates
-	subject, body = m.renderEmailBuiltIn(locale, purpose, data)
-	return subject, body, nil
+	subject, body := m.renderEmailBuiltIn(locale, purpose, data)
+	return Email{Subject: subject, Text: body}, nil
 }
 
 // RenderSMS renders an SMS template and returns the message body
 func (m *Manager) RenderSMS(locale, purpose string, data TemplateData) (body string, err error) {
 	// Try to find template: locale:sms:purpose
 	key := fmt.Sprintf("%s:sms:%s", locale, purpose)
-	if tmpl, ok := m.templates[key]; ok {
+	if tmpl, ok := m.textTemplate(key); ok {
 		var buf strings.Builder
 		if err := tmpl.Execute(&buf, data); err == nil {
 			return buf.String(), nil
@@ -189,6 +231,37 @@ func (m *Manager) RenderSMS(locale, purpose string, data TemplateData) (body str
 	return body, nil
 }
 
+// RenderVoice renders the text read out by a voice call: the code's digits are spaced out
+// (see SpokenCode) and the code is repeated twice
+func (m *Manager) RenderVoice(locale, purpose string, data TemplateData) (body string, err error) {
+	if data.SpokenCode == "" {
+		data.SpokenCode = m.SpokenCode(locale, data.Code)
+	}
+
+	// Try to find template: locale:voice:purpose
+	key := fmt.Sprintf("%s:voice:%s", locale, purpose)
+	if tmpl, ok := m.textTemplate(key); ok {
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err == nil {
+			return buf.String(), nil
+		}
+	}
+
+	// Fallback to built-in templates
+	return m.renderVoiceBuiltIn(locale, purpose, data), nil
+}
+
+// SpokenCode separates the characters of code with the locale's pause separator
+// ("123456" -> "1, 2, 3, 4, 5, 6") so text-to-speech reads digits one by one
+func (m *Manager) SpokenCode(locale, code string) string {
+	sep := m.bundle.GetTranslation(m.parseLanguage(locale), "voice.separator")
+	if sep == "voice.separator" {
+		sep = ", "
+	}
+	chars := strings.Split(code, "")
+	return strings.Join(chars, sep)
+}
+
 // renderBuiltIn renders built-in templates
 func (m *Manager) renderBuiltIn(locale, channel, purpose string, data TemplateData) (string, error) {
 	switch channel {
@@ -198,6 +271,10 @@ func (m *Manager) renderBuiltIn(locale, channel, purpose string, data TemplateDa
 	case "sms", "dingtalk":
 		// DingTalk uses same body style as SMS (plain text); herald-dingtalk receives body or params.code
 		return m.renderSMSBuiltIn(locale, purpose, data), nil
+	case "voice":
+		return m.renderVoiceBuiltIn(locale, purpose, data), nil
+	case "push":
+		return m.renderPushBuiltIn(locale, purpose), nil
 	default:
 		return "", fmt.Errorf("unsupported channel: %s", channel)
 	}
@@ -247,6 +324,32 @@ func (m *Manager) renderSMSBuiltIn(locale, purpose string, data TemplateData) st
 	return m.formatter.Format(lang, "sms.body_with_purpose", params)
 }
 
+// renderVoiceBuiltIn renders built-in voice call text
+func (m *Manager) renderVoiceBuiltIn(locale, purpose string, data TemplateData) string {
+	lang := m.parseLanguage(locale)
+	params := map[string]interface{}{
+		"code": data.SpokenCode,
+	}
+	if purpose == "" || purpose == "login" {
+		return m.formatter.Format(lang, "voice.body", params)
+	}
+	params["purpose"] = m.bundle.GetTranslation(lang, "purpose."+purpose)
+	return m.formatter.Format(lang, "voice.body_with_purpose", params)
+}
+
+// renderPushBuiltIn renders the built-in push notification text. It never contains the code:
+// the user types the number shown by the verifier.
+func (m *Manager) renderPushBuiltIn(locale, purpose string) string {
+	lang := m.parseLanguage(locale)
+	if purpose == "" {
+		purpose = "login"
+	}
+	params := map[string]interface{}{
+		"purpose": m.bundle.GetTranslation(lang, "purpose."+purpose),
+	}
+	return m.formatter.Format(lang, "push.body", params)
+}
+
 // parseLanguage parses a locale string to i18n.Language
 func (m *Manager) parseLanguage(locale string) i18n.Language {
 	lang, ok := i18n.ParseLanguage(locale)
@@ -3,6 +3,7 @@ package template
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +16,7 @@ func TestNewManager(t *testing.T) {
 	if manager.dir != "" {
 		t.Errorf("NewManager() dir = %v, want empty string", manager.dir)
 	}
-	if manager.templates == nil {
+	if manager.loaded.Load().templates == nil {
 		t.Error("NewManager() templates map is nil")
 	}
 
@@ -529,3 +530,67 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestManager_RenderVoice(t *testing.T) {
+	manager := NewManager("")
+	data := TemplateData{Code: "123456", ExpiresIn: 300}
+
+	body, err := manager.RenderVoice("en", "login", data)
+	if err != nil {
+		t.Fatalf("RenderVoice() error = %v", err)
+	}
+	want := "Your verification code is: 1, 2, 3, 4, 5, 6. Once again, your code is: 1, 2, 3, 4, 5, 6."
+	if body != want {
+		t.Errorf("RenderVoice(en) = %q, want %q", body, want)
+	}
+
+	body, _ = manager.RenderVoice("zh-CN", "reset", data)
+	if !strings.Contains(body, "重置密码") || strings.Count(body, "1，2，3，4，5，6") != 2 {
+		t.Errorf("RenderVoice(zh-CN, reset) = %q, want purpose and the spaced code twice", body)
+	}
+
+	// Render dispatches the voice channel to the same built-in text
+	if got, _ := manager.Render("en", "voice", "login", data); got != want {
+		t.Errorf("Render(voice) = %q, want %q", got, want)
+	}
+}
+
+func TestManager_RenderVoice_TemplateFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	voiceDir := filepath.Join(tmpDir, "en", "voice")
+	if err := os.MkdirAll(voiceDir, 0o755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(voiceDir, "login.txt"), []byte("Code {{.SpokenCode}}. Again, {{.SpokenCode}}."), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	manager := NewManager(tmpDir)
+	body, err := manager.RenderVoice("en", "login", TemplateData{Code: "42"})
+	if err != nil {
+		t.Fatalf("RenderVoice() error = %v", err)
+	}
+	if body != "Code 4, 2. Again, 4, 2." {
+		t.Errorf("RenderVoice() = %q", body)
+	}
+}
+
+func TestManager_Render_Push(t *testing.T) {
+	m := NewManager("")
+
+	body, err := m.Render("en", "push", "stepup", TemplateData{Code: "42"})
+	if err != nil {
+		t.Fatalf("Render(push) error = %v", err)
+	}
+	if body != "Approve your step-up authentication request by entering the number shown on your screen." {
+		t.Errorf("Render(push) = %q", body)
+	}
+	if strings.Contains(body, "42") {
+		t.Error("push text must not contain the number")
+	}
+
+	body, _ = m.Render("zh-CN", "push", "", TemplateData{})
+	if !strings.Contains(body, "登录") {
+		t.Errorf("Render(push, zh) = %q, want login purpose", body)
+	}
+}
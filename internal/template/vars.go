@@ -0,0 +1,75 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits on caller-supplied template_vars
+const (
+	MaxVars        = 20
+	MaxVarValueLen = 256
+)
+
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// VarsAllowlist lists the template_vars each template may use, keyed by "channel:purpose";
+// either part may be "*". Vars allowed by no matching entry are dropped.
+type VarsAllowlist map[string][]string
+
+// ParseVarsAllowlist parses an allowlist from a JSON object, e.g.
+// {"email:login":["product","cta_url"],"*:*":["brand"]}
+func ParseVarsAllowlist(data string) (VarsAllowlist, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var allowlist VarsAllowlist
+	if err := json.Unmarshal([]byte(data), &allowlist); err != nil {
+		return nil, fmt.Errorf("failed to parse template vars allowlist JSON: %w", err)
+	}
+	for key, names := range allowlist {
+		if channel, purpose, ok := strings.Cut(key, ":"); !ok || channel == "" || purpose == "" {
+			return nil, fmt.Errorf("template vars allowlist: key %q must be channel:purpose", key)
+		}
+		for _, name := range names {
+			if !varName.MatchString(name) {
+				return nil, fmt.Errorf("template vars allowlist %s: invalid var name %q", key, name)
+			}
+		}
+	}
+	return allowlist, nil
+}
+
+// ValidateVars checks the size of caller-supplied template_vars
+func ValidateVars(vars map[string]string) error {
+	if len(vars) > MaxVars {
+		return fmt.Errorf("at most %d template vars are allowed", MaxVars)
+	}
+	for name, value := range vars {
+		if !varName.MatchString(name) {
+			return fmt.Errorf("invalid template var name %q", name)
+		}
+		if len(value) > MaxVarValueLen {
+			return fmt.Errorf("template var %s exceeds %d bytes", name, MaxVarValueLen)
+		}
+	}
+	return nil
+}
+
+// Filter returns the vars the template for channel and purpose may use
+func (a VarsAllowlist) Filter(channel, purpose string, vars map[string]string) map[string]string {
+	if len(a) == 0 || len(vars) == 0 {
+		return nil
+	}
+	allowed := make(map[string]string)
+	for _, key := range []string{channel + ":" + purpose, channel + ":*", "*:" + purpose, "*:*"} {
+		for _, name := range a[key] {
+			if value, ok := vars[name]; ok {
+				allowed[name] = value
+			}
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,64 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVarsAllowlist(t *testing.T) {
+	a, err := ParseVarsAllowlist(`{"email:login":["product","cta_url"],"*:*":["brand"]}`)
+	if err != nil {
+		t.Fatalf("ParseVarsAllowlist() error = %v", err)
+	}
+	if len(a) != 2 {
+		t.Errorf("ParseVarsAllowlist() = %v", a)
+	}
+	if a, err := ParseVarsAllowlist(" "); err != nil || a != nil {
+		t.Errorf("ParseVarsAllowlist(empty) = %v, %v", a, err)
+	}
+	for _, s := range []string{`[]`, `{"email":["a"]}`, `{"email:":["a"]}`, `{"email:login":["bad-name"]}`} {
+		if _, err := ParseVarsAllowlist(s); err == nil {
+			t.Errorf("ParseVarsAllowlist(%s) error = nil", s)
+		}
+	}
+}
+
+func TestVarsAllowlist_Filter(t *testing.T) {
+	a := VarsAllowlist{
+		"email:login": {"product"},
+		"email:*":     {"cta_url"},
+		"*:reset":     {"reason"},
+		"*:*":         {"brand"},
+	}
+	vars := map[string]string{"product": "Acme", "cta_url": "https://acme.test", "reason": "expired", "brand": "acme", "secret": "x"}
+
+	if got, want := a.Filter("email", "login", vars), map[string]string{"product": "Acme", "cta_url": "https://acme.test", "brand": "acme"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter(email, login) = %v, want %v", got, want)
+	}
+	if got, want := a.Filter("sms", "reset", vars), map[string]string{"reason": "expired", "brand": "acme"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Filter(sms, reset) = %v, want %v", got, want)
+	}
+	if got := VarsAllowlist(nil).Filter("email", "login", vars); got != nil {
+		t.Errorf("Filter() without allowlist = %v, want nil", got)
+	}
+}
+
+func TestValidateVars(t *testing.T) {
+	if err := ValidateVars(map[string]string{"product": "Acme"}); err != nil {
+		t.Errorf("ValidateVars() error = %v", err)
+	}
+	tooMany := make(map[string]string)
+	for i := 0; i <= MaxVars; i++ {
+		tooMany["v"+strings.Repeat("x", i)] = "1"
+	}
+	for _, vars := range []map[string]string{
+		tooMany,
+		{"bad-name": "1"},
+		{"long": strings.Repeat("x", MaxVarValueLen+1)},
+	} {
+		if err := ValidateVars(vars); err == nil {
+			t.Errorf("ValidateVars(%d vars) error = nil", len(vars))
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package totp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/soulteary/herald-totp/pkg/heraldtotp"
+	"github.com/soulteary/tracing-kit"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/soulteary/herald/internal/metrics"
+)
+
+// ErrCircuitOpen is returned without calling herald-totp while the circuit breaker is open
+var ErrCircuitOpen = errors.New("herald-totp circuit open")
+
+// ProxyError is a failed herald-totp call
+type ProxyError struct {
+	Op     string // Operation: status, verify, enroll_start, enroll_confirm, revoke
+	Status int    // HTTP status returned by herald-totp; 0 when there was no usable response
+	Reason string // herald-totp reason code, when the response had one
+	Err    error
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("herald-totp %s: %v", e.Op, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// Rejected reports whether herald-totp answered with a client error (4xx), e.g. a wrong code.
+// Other failures mean herald-totp is unreachable or failing.
+func (e *ProxyError) Rejected() bool {
+	return e.Status >= 400 && e.Status < 500
+}
+
+// ProxyConfig configures a Proxy
+type ProxyConfig struct {
+	MaxRetries       int           // Extra attempts for idempotent calls (status)
+	RetryDelay       time.Duration // Delay before the first retry, doubled for each further one
+	BreakerThreshold int           // Consecutive failures that open the circuit; 0 disables the breaker
+	BreakerCooldown  time.Duration // How long the circuit stays open before a trial call
+}
+
+// Proxy forwards TOTP operations to herald-totp with retries, a circuit breaker, metrics and
+// tracing. Only status is retried: verify, enroll and revoke change state in herald-totp.
+// Failures are *ProxyError (or ErrCircuitOpen), so callers can keep herald-totp's reason codes.
+type Proxy struct {
+	client  *heraldtotp.Client
+	cfg     ProxyConfig
+	breaker *breaker
+}
+
+// NewProxy wraps a herald-totp client
+func NewProxy(client *heraldtotp.Client, cfg ProxyConfig) *Proxy {
+	return &Proxy{
+		client:  client,
+		cfg:     cfg,
+		breaker: &breaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+	}
+}
+
+// Status forwards GET /v1/status, retrying failures that are not rejections
+func (p *Proxy) Status(ctx context.Context, subject string) (*heraldtotp.StatusResponse, error) {
+	var resp *heraldtotp.StatusResponse
+	err := p.call(ctx, "status", p.cfg.MaxRetries, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.Status(ctx, subject)
+		return err
+	})
+	return resp, err
+}
+
+// Verify forwards POST /v1/verify. As with the client, a failed verification returns both
+// the response (with herald-totp's reason) and an error.
+func (p *Proxy) Verify(ctx context.Context, req *heraldtotp.VerifyRequest) (*heraldtotp.VerifyResponse, error) {
+	var resp *heraldtotp.VerifyResponse
+	err := p.call(ctx, "verify", 0, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.Verify(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// EnrollStart forwards POST /v1/enroll/start
+func (p *Proxy) EnrollStart(ctx context.Context, req *heraldtotp.EnrollStartRequest) (*heraldtotp.EnrollStartResponse, error) {
+	var resp *heraldtotp.EnrollStartResponse
+	err := p.call(ctx, "enroll_start", 0, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.EnrollStart(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// EnrollConfirm forwards POST /v1/enroll/confirm
+func (p *Proxy) EnrollConfirm(ctx context.Context, req *heraldtotp.EnrollConfirmRequest) (*heraldtotp.EnrollConfirmResponse, error) {
+	var resp *heraldtotp.EnrollConfirmResponse
+	err := p.call(ctx, "enroll_confirm", 0, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.EnrollConfirm(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Revoke forwards POST /v1/revoke
+func (p *Proxy) Revoke(ctx context.Context, subject string) (*heraldtotp.RevokeResponse, error) {
+	var resp *heraldtotp.RevokeResponse
+	err := p.call(ctx, "revoke", 0, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.Revoke(ctx, subject)
+		return err
+	})
+	return resp, err
+}
+
+// call runs fn in a span, through the breaker, with up to retries extra attempts
+func (p *Proxy) call(ctx context.Context, op string, retries int, fn func(context.Context) error) error {
+	start := time.Now()
+	ctx, span := tracing.StartSpan(ctx, "totp.proxy."+op)
+	defer span.End()
+	span.SetAttributes(attribute.String("totp.operation", op))
+
+	delay := p.cfg.RetryDelay
+	var err error
+	attempt := 0
+	for {
+		attempt++
+		if !p.breaker.allow(time.Now()) {
+			err = ErrCircuitOpen
+			break
+		}
+		err = proxyError(op, fn(ctx))
+		var pe *ProxyError
+		if err == nil || (errors.As(err, &pe) && pe.Rejected()) {
+			// A rejection is a healthy answer
+			p.breaker.success()
+			break
+		}
+		p.breaker.failure(time.Now())
+		if attempt > retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	metrics.SetTOTPCircuitOpen(p.breaker.isOpen(time.Now()))
+	span.SetAttributes(attribute.Int("totp.attempts", attempt))
+
+	result := "success"
+	var pe *ProxyError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrCircuitOpen):
+		result = "circuit_open"
+	case errors.As(err, &pe) && pe.Rejected():
+		result = "rejected"
+		span.SetAttributes(attribute.Int("http.status_code", pe.Status), attribute.String("totp.reason", pe.Reason))
+	default:
+		result = "error"
+		tracing.RecordError(span, err)
+	}
+	metrics.RecordTOTPRequest(op, result, time.Since(start))
+	return err
+}
+
+// clientErrorPattern matches the errors heraldtotp.Client returns for non-200 responses,
+// e.g. `verify returned 401: {"ok":false,"reason":"invalid"}`
+var clientErrorPattern = regexp.MustCompile(`(?s) returned (\d{3}): (.*)$`)
+
+// proxyError turns a client error into a *ProxyError carrying the HTTP status and reason
+func proxyError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	pe := &ProxyError{Op: op, Err: err}
+	if m := clientErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		pe.Status, _ = strconv.Atoi(m[1])
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if json.Unmarshal([]byte(m[2]), &body) == nil {
+			pe.Reason = body.Reason
+		}
+	}
+	return pe
+}
+
+// breaker is a consecutive-failure circuit breaker. Once open, it lets a single trial call
+// through after the cooldown; the circuit closes when that call succeeds.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if now.Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure(now time.Time) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+func (b *breaker) isOpen(now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && now.Before(b.openUntil)
+}
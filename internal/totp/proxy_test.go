@@ -0,0 +1,129 @@
+package totp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald-totp/pkg/heraldtotp"
+)
+
+// fakeTOTP serves herald-totp responses: status fails with 500 failures times before
+// succeeding; verify rejects every code
+func fakeTOTP(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/status":
+			if n <= failures {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"ok":false,"reason":"internal_error"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"subject":"u1","totp_enabled":true}`))
+		case "/v1/verify":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"ok":false,"reason":"invalid"}`))
+		case "/v1/revoke":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"ok":false,"reason":"rate_limited"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newTestProxy(t *testing.T, url string, cfg ProxyConfig) *Proxy {
+	t.Helper()
+	client, err := heraldtotp.NewClient(heraldtotp.DefaultOptions().WithBaseURL(url).WithTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProxy(client, cfg)
+}
+
+func TestProxy_StatusRetries(t *testing.T) {
+	srv, calls := fakeTOTP(t, 2)
+	p := newTestProxy(t, srv.URL, ProxyConfig{MaxRetries: 2, RetryDelay: time.Millisecond})
+
+	resp, err := p.Status(context.Background(), "u1")
+	if err != nil || !resp.TotpEnabled {
+		t.Fatalf("Status() = %+v, %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("calls = %d, want 3", calls.Load())
+	}
+}
+
+func TestProxy_ReasonPreservedWithoutRetry(t *testing.T) {
+	srv, calls := fakeTOTP(t, 0)
+	p := newTestProxy(t, srv.URL, ProxyConfig{MaxRetries: 2, RetryDelay: time.Millisecond})
+
+	resp, err := p.Verify(context.Background(), &heraldtotp.VerifyRequest{Subject: "u1", Code: "123456"})
+	var pe *ProxyError
+	if !errors.As(err, &pe) || !pe.Rejected() || pe.Status != http.StatusUnauthorized || pe.Reason != "invalid" {
+		t.Fatalf("Verify() error = %#v", err)
+	}
+	if resp == nil || resp.Reason != "invalid" {
+		t.Errorf("Verify() response = %+v", resp)
+	}
+	if _, err := p.Revoke(context.Background(), "u1"); !errors.As(err, &pe) || pe.Status != http.StatusTooManyRequests || pe.Reason != "rate_limited" {
+		t.Errorf("Revoke() error = %#v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2 (no retries)", calls.Load())
+	}
+}
+
+func TestProxy_CircuitBreaker(t *testing.T) {
+	srv, calls := fakeTOTP(t, 3)
+	p := newTestProxy(t, srv.URL, ProxyConfig{BreakerThreshold: 2, BreakerCooldown: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		var pe *ProxyError
+		if _, err := p.Status(ctx, "u1"); !errors.As(err, &pe) || pe.Rejected() || pe.Status != http.StatusInternalServerError {
+			t.Fatalf("Status() #%d error = %v", i, err)
+		}
+	}
+	if _, err := p.Status(ctx, "u1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Status() with open circuit error = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2", calls.Load())
+	}
+
+	// After the cooldown a single trial call goes through; a failed trial reopens the circuit
+	p.breaker.openUntil = time.Now()
+	if _, err := p.Status(ctx, "u1"); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("trial call rejected")
+	}
+	if _, err := p.Status(ctx, "u1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Status() after failed trial error = %v, want ErrCircuitOpen", err)
+	}
+	p.breaker.openUntil = time.Now()
+	if resp, err := p.Status(ctx, "u1"); err != nil || !resp.TotpEnabled {
+		t.Fatalf("Status() after recovery = %+v, %v", resp, err)
+	}
+	if p.breaker.isOpen(time.Now()) {
+		t.Error("circuit still open after a successful trial")
+	}
+}
+
+func TestProxyError_Unreachable(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:1", ProxyConfig{})
+	_, err := p.EnrollStart(context.Background(), &heraldtotp.EnrollStartRequest{Subject: "u1"})
+	var pe *ProxyError
+	if !errors.As(err, &pe) || pe.Status != 0 || pe.Rejected() {
+		t.Errorf("EnrollStart() error = %#v", err)
+	}
+}
@@ -0,0 +1,389 @@
+// Package totp provides Herald's TOTP backends: Engine, an embedded TOTP (RFC 6238)
+// implementation, and Proxy, which forwards to herald-totp. Both have the method set and
+// request/response types of the herald-totp client, so the /v1/totp routes behave the same
+// with either backend.
+//
+// Engine secrets are encrypted with AES-256-GCM (the subject is the additional data, so a secret
+// cannot be moved to another subject) and stored in Redis. Codes are HMAC-SHA1, accepted
+// within a drift window of Skew steps; a step that was already used, or is older than the
+// last used one, is rejected as a replay.
+package totp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/soulteary/herald-totp/pkg/heraldtotp"
+	secure "github.com/soulteary/secure-kit"
+)
+
+// Verification failure reasons (the same codes herald-totp returns)
+const (
+	ReasonInvalid = "invalid" // Wrong code, or subject not enrolled
+	ReasonReplay  = "replay"  // Code for a step that was already used
+)
+
+// SecretSize is the length of generated secrets in bytes (160 bits, as recommended by RFC 4226)
+const SecretSize = 20
+
+// Redis key prefixes
+const (
+	credKeyPrefix   = "otp:totp:cred:"
+	enrollKeyPrefix = "otp:totp:enroll:"
+	stepKeyPrefix   = "otp:totp:step:"
+	lastKeyPrefix   = "otp:totp:last:"
+)
+
+var (
+	// ErrInvalidCode is returned for a wrong code or a subject without TOTP
+	ErrInvalidCode = errors.New("invalid totp code")
+	// ErrReplay is returned when the code's time step was already used
+	ErrReplay = errors.New("totp code already used")
+	// ErrEnrollmentNotFound is returned for an unknown or expired enroll_id
+	ErrEnrollmentNotFound = errors.New("enrollment not found or expired")
+)
+
+// Config configures an Engine
+type Config struct {
+	Issuer    string        // Shown by authenticator apps
+	Key       []byte        // AES-256 key encrypting secrets (32 bytes)
+	Digits    int           // Code length: 6 or 8
+	Period    time.Duration // Time step
+	Skew      int           // Steps accepted before and after the current one
+	EnrollTTL time.Duration // How long an enrollment can be confirmed
+}
+
+// credential is the stored form of an enrolled secret. It is written only on enrollment; the
+// last used step is kept under its own key so that verifications never rewrite the secret.
+type credential struct {
+	Secret    string `json:"secret"` // base64(nonce || AES-GCM ciphertext)
+	CreatedAt int64  `json:"created_at"`
+}
+
+// enrollment is a started, not yet confirmed enrollment
+type enrollment struct {
+	Subject string `json:"subject"`
+	Secret  string `json:"secret"`
+}
+
+// Engine enrolls subjects and verifies their codes
+type Engine struct {
+	redis *redis.Client
+	aead  cipher.AEAD
+	cfg   Config
+}
+
+// New creates an engine; the key must be 32 bytes
+func New(redisClient *redis.Client, cfg Config) (*Engine, error) {
+	if len(cfg.Key) != 32 {
+		return nil, fmt.Errorf("totp: encryption key must be 32 bytes, got %d", len(cfg.Key))
+	}
+	if cfg.Digits != 6 && cfg.Digits != 8 {
+		return nil, fmt.Errorf("totp: digits must be 6 or 8, got %d", cfg.Digits)
+	}
+	if cfg.Period < time.Second {
+		return nil, fmt.Errorf("totp: invalid period %v", cfg.Period)
+	}
+	if cfg.Skew < 0 {
+		cfg.Skew = 0
+	}
+	block, err := aes.NewCipher(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{redis: redisClient, aead: aead, cfg: cfg}, nil
+}
+
+// ParseKey decodes an encryption key given as 64 hex characters or base64 of 32 bytes
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := hex.DecodeString(s); err == nil && len(b) == 32 {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && len(b) == 32 {
+			return b, nil
+		}
+	}
+	return nil, errors.New("totp: encryption key must be 32 bytes, hex or base64 encoded")
+}
+
+// Status reports whether subject has TOTP enabled
+func (e *Engine) Status(ctx context.Context, subject string) (*heraldtotp.StatusResponse, error) {
+	cred, err := e.load(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &heraldtotp.StatusResponse{Subject: subject, TotpEnabled: cred != nil}, nil
+}
+
+// Verify checks a code for the subject. Like the herald-totp client, failed verifications
+// return both a response with the reason and an error.
+func (e *Engine) Verify(ctx context.Context, req *heraldtotp.VerifyRequest) (*heraldtotp.VerifyResponse, error) {
+	cred, err := e.load(ctx, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return &heraldtotp.VerifyResponse{OK: false, Reason: ReasonInvalid}, ErrInvalidCode
+	}
+	secret, err := e.decrypt(req.Subject, cred.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := e.match(secret, req.Code, time.Now())
+	if !ok {
+		return &heraldtotp.VerifyResponse{OK: false, Reason: ReasonInvalid}, ErrInvalidCode
+	}
+	last, err := e.lastStep(ctx, req.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if step <= last {
+		return &heraldtotp.VerifyResponse{OK: false, Reason: ReasonReplay}, ErrReplay
+	}
+	// Claim the step so that concurrent requests with the same code cannot both succeed
+	err = e.redis.SetArgs(ctx, stepKey(req.Subject, step), 1, redis.SetArgs{Mode: "NX", TTL: e.windowTTL()}).Err()
+	if errors.Is(err, redis.Nil) {
+		return &heraldtotp.VerifyResponse{OK: false, Reason: ReasonReplay}, ErrReplay
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := e.setLastStep(ctx, req.Subject, step); err != nil {
+		return nil, err
+	}
+	return &heraldtotp.VerifyResponse{OK: true}, nil
+}
+
+// EnrollStart generates a secret and returns it with its otpauth:// URI. The subject is
+// enrolled only once EnrollConfirm receives a valid code; until then an existing secret
+// keeps working.
+func (e *Engine) EnrollStart(ctx context.Context, req *heraldtotp.EnrollStartRequest) (*heraldtotp.EnrollStartResponse, error) {
+	secret, err := secure.RandomBytes(SecretSize)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := e.encrypt(req.Subject, secret)
+	if err != nil {
+		return nil, err
+	}
+	id, err := secure.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(enrollment{Subject: req.Subject, Secret: sealed})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.redis.Set(ctx, enrollKeyPrefix+id, data, e.cfg.EnrollTTL).Err(); err != nil {
+		return nil, err
+	}
+	label := req.Label
+	if label == "" {
+		label = req.Subject
+	}
+	secretBase32 := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+	return &heraldtotp.EnrollStartResponse{
+		EnrollID:     id,
+		SecretBase32: secretBase32,
+		OtpauthURI:   e.otpauthURI(label, secretBase32),
+	}, nil
+}
+
+// EnrollConfirm enables TOTP for the enrollment's subject when code is valid, replacing any
+// previous secret. Backup codes are not generated; see the recovery codes endpoints.
+func (e *Engine) EnrollConfirm(ctx context.Context, req *heraldtotp.EnrollConfirmRequest) (*heraldtotp.EnrollConfirmResponse, error) {
+	key := enrollKeyPrefix + req.EnrollID
+	data, err := e.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrEnrollmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var en enrollment
+	if err := json.Unmarshal(data, &en); err != nil {
+		return nil, fmt.Errorf("totp: corrupt enrollment: %w", err)
+	}
+	secret, err := e.decrypt(en.Subject, en.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := e.match(secret, req.Code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+	// Consume the enrollment before saving it; only the request whose delete removed the key
+	// may enable TOTP, so an enroll_id cannot be confirmed twice
+	n, err := e.redis.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrEnrollmentNotFound
+	}
+	cred := &credential{Secret: en.Secret, CreatedAt: time.Now().Unix()}
+	if err := e.save(ctx, en.Subject, cred); err != nil {
+		return nil, err
+	}
+	// The confirmation code counts as used
+	if err := e.setLastStep(ctx, en.Subject, step); err != nil {
+		return nil, err
+	}
+	return &heraldtotp.EnrollConfirmResponse{Subject: en.Subject, TotpEnabled: true}, nil
+}
+
+// Revoke removes the subject's secret
+func (e *Engine) Revoke(ctx context.Context, subject string) (*heraldtotp.RevokeResponse, error) {
+	if err := e.redis.Del(ctx, credKeyPrefix+subject, lastKeyPrefix+subject).Err(); err != nil {
+		return nil, err
+	}
+	return &heraldtotp.RevokeResponse{OK: true, Subject: subject}, nil
+}
+
+// Code returns the code for secret at time t (RFC 6238 with HMAC-SHA1)
+func (e *Engine) Code(secret []byte, t time.Time) string {
+	return hotp(secret, e.step(t), e.cfg.Digits)
+}
+
+func (e *Engine) step(t time.Time) int64 {
+	return t.Unix() / int64(e.cfg.Period/time.Second)
+}
+
+// match returns the step within the drift window whose code equals code
+func (e *Engine) match(secret []byte, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != e.cfg.Digits {
+		return 0, false
+	}
+	current := e.step(now)
+	// Later steps first, so the most recent matching step is recorded
+	for i := e.cfg.Skew; i >= -e.cfg.Skew; i-- {
+		step := current + int64(i)
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, step, e.cfg.Digits)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func (e *Engine) otpauthURI(label, secretBase32 string) string {
+	q := url.Values{}
+	q.Set("secret", secretBase32)
+	q.Set("issuer", e.cfg.Issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(e.cfg.Digits))
+	q.Set("period", strconv.Itoa(int(e.cfg.Period/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + e.cfg.Issuer + ":" + label,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+func (e *Engine) encrypt(subject string, secret []byte) (string, error) {
+	nonce, err := secure.RandomBytes(e.aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(e.aead.Seal(nonce, nonce, secret, []byte(subject))), nil
+}
+
+func (e *Engine) decrypt(subject, sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < e.aead.NonceSize() {
+		return nil, errors.New("totp: corrupt secret")
+	}
+	nonce, ciphertext := raw[:e.aead.NonceSize()], raw[e.aead.NonceSize():]
+	secret, err := e.aead.Open(nil, nonce, ciphertext, []byte(subject))
+	if err != nil {
+		return nil, errors.New("totp: secret decryption failed")
+	}
+	return secret, nil
+}
+
+func (e *Engine) load(ctx context.Context, subject string) (*credential, error) {
+	data, err := e.redis.Get(ctx, credKeyPrefix+subject).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cred credential
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return nil, fmt.Errorf("totp: corrupt credential: %w", err)
+	}
+	return &cred, nil
+}
+
+func (e *Engine) save(ctx context.Context, subject string, cred *credential) error {
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	return e.redis.Set(ctx, credKeyPrefix+subject, data, 0).Err()
+}
+
+// lastStep returns the last step used by subject, or 0 when none was used within the drift window
+func (e *Engine) lastStep(ctx context.Context, subject string) (int64, error) {
+	last, err := e.redis.Get(ctx, lastKeyPrefix+subject).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return last, err
+}
+
+// setLastStep records step as the subject's last used step. Steps older than the drift window
+// can no longer match a code, so the key expires with the window.
+func (e *Engine) setLastStep(ctx context.Context, subject string, step int64) error {
+	return e.redis.Set(ctx, lastKeyPrefix+subject, step, e.windowTTL()).Err()
+}
+
+// windowTTL is how long a used step stays relevant: the drift window plus one step of margin
+func (e *Engine) windowTTL() time.Duration {
+	return time.Duration(2*e.cfg.Skew+2) * e.cfg.Period
+}
+
+func stepKey(subject string, step int64) string {
+	return stepKeyPrefix + subject + ":" + strconv.FormatInt(step, 10)
+}
+
+// hotp computes an RFC 4226 HOTP value
+func hotp(secret []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
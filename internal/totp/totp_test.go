@@ -0,0 +1,245 @@
+package totp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soulteary/herald-totp/pkg/heraldtotp"
+
+	"github.com/soulteary/herald/internal/testutil"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, 32)
+
+func testConfig() Config {
+	return Config{Issuer: "Herald", Key: testKey, Digits: 6, Period: 30 * time.Second, Skew: 1, EnrollTTL: time.Minute}
+}
+
+func TestEngine_Code_RFC6238(t *testing.T) {
+	cfg := testConfig()
+	cfg.Digits = 8
+	e, err := New(nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	} {
+		if got := e.Code(secret, time.Unix(unix, 0)); got != want {
+			t.Errorf("Code(%d) = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	for _, mutate := range []func(*Config){
+		func(c *Config) { c.Key = testKey[:16] },
+		func(c *Config) { c.Digits = 7 },
+		func(c *Config) { c.Period = 0 },
+	} {
+		cfg := testConfig()
+		mutate(&cfg)
+		if _, err := New(nil, cfg); err == nil {
+			t.Errorf("New(%+v) error = nil", cfg)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	hexKey := hex.EncodeToString(testKey)
+	if k, err := ParseKey(hexKey); err != nil || !bytes.Equal(k, testKey) {
+		t.Errorf("ParseKey(hex) = %x, %v", k, err)
+	}
+	if k, err := ParseKey("QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="); err != nil || !bytes.Equal(k, testKey) {
+		t.Errorf("ParseKey(base64) = %x, %v", k, err)
+	}
+	for _, s := range []string{"", "short", hexKey[:32]} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) error = nil", s)
+		}
+	}
+}
+
+// enroll runs enroll/start and enroll/confirm and returns the secret
+func enroll(t *testing.T, e *Engine, subject string) []byte {
+	t.Helper()
+	ctx := context.Background()
+	start, err := e.EnrollStart(ctx, &heraldtotp.EnrollStartRequest{Subject: subject, Label: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("EnrollStart() error = %v", err)
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(start.SecretBase32)
+	if err != nil || len(secret) != SecretSize {
+		t.Fatalf("secret %q: %v", start.SecretBase32, err)
+	}
+	if _, err := e.EnrollConfirm(ctx, &heraldtotp.EnrollConfirmRequest{EnrollID: start.EnrollID, Code: "abcdef"}); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("EnrollConfirm(wrong code) error = %v", err)
+	}
+	// Confirm with the previous step's code: its step is recorded as used
+	confirmed, err := e.EnrollConfirm(ctx, &heraldtotp.EnrollConfirmRequest{EnrollID: start.EnrollID, Code: e.Code(secret, time.Now().Add(-e.cfg.Period))})
+	if err != nil || !confirmed.TotpEnabled || confirmed.Subject != subject {
+		t.Fatalf("EnrollConfirm() = %+v, %v", confirmed, err)
+	}
+	if _, err := e.EnrollConfirm(ctx, &heraldtotp.EnrollConfirmRequest{EnrollID: start.EnrollID, Code: e.Code(secret, time.Now())}); !errors.Is(err, ErrEnrollmentNotFound) {
+		t.Errorf("EnrollConfirm(again) error = %v, want ErrEnrollmentNotFound", err)
+	}
+	return secret
+}
+
+func TestEngine_EnrollAndVerify(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	e, err := New(client, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if st, err := e.Status(ctx, "u1"); err != nil || st.TotpEnabled {
+		t.Fatalf("Status() before enrollment = %+v, %v", st, err)
+	}
+	if resp, err := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: "123456"}); !errors.Is(err, ErrInvalidCode) || resp.Reason != ReasonInvalid {
+		t.Errorf("Verify() before enrollment = %+v, %v", resp, err)
+	}
+
+	secret := enroll(t, e, "u1")
+	if st, err := e.Status(ctx, "u1"); err != nil || !st.TotpEnabled {
+		t.Fatalf("Status() after enrollment = %+v, %v", st, err)
+	}
+
+	// Outside the drift window
+	if resp, _ := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: e.Code(secret, time.Now().Add(-3*e.cfg.Period))}); resp.OK || resp.Reason != ReasonInvalid {
+		t.Errorf("Verify(old code) = %+v", resp)
+	}
+	// The step used to confirm the enrollment cannot be reused
+	if resp, err := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: e.Code(secret, time.Now().Add(-e.cfg.Period))}); !errors.Is(err, ErrReplay) || resp.Reason != ReasonReplay {
+		t.Errorf("Verify(confirmation code) = %+v, %v", resp, err)
+	}
+	// One step of drift ahead is accepted, then everything up to it is a replay
+	next := e.Code(secret, time.Now().Add(e.cfg.Period))
+	if resp, err := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: next}); err != nil || !resp.OK {
+		t.Fatalf("Verify(next step) = %+v, %v", resp, err)
+	}
+	for _, code := range []string{next, e.Code(secret, time.Now())} {
+		if resp, _ := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: code}); resp.OK || resp.Reason != ReasonReplay {
+			t.Errorf("Verify(%s) after next step = %+v, want replay", code, resp)
+		}
+	}
+
+	if resp, err := e.Revoke(ctx, "u1"); err != nil || !resp.OK {
+		t.Fatalf("Revoke() = %+v, %v", resp, err)
+	}
+	if st, _ := e.Status(ctx, "u1"); st.TotpEnabled {
+		t.Error("Status() after revoke: still enabled")
+	}
+}
+
+func TestEngine_EnrollConfirmConcurrent(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	e, err := New(client, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	start, err := e.EnrollStart(ctx, &heraldtotp.EnrollStartRequest{Subject: "u1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(start.SecretBase32)
+	code := e.Code(secret, time.Now())
+
+	var confirmed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := e.EnrollConfirm(ctx, &heraldtotp.EnrollConfirmRequest{EnrollID: start.EnrollID, Code: code}); err == nil {
+				confirmed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := confirmed.Load(); n != 1 {
+		t.Errorf("EnrollConfirm succeeded %d times, want 1", n)
+	}
+}
+
+func TestEngine_VerifyDoesNotRewriteCredential(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	e, err := New(client, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	secret := enroll(t, e, "u1")
+	before, err := client.Get(ctx, credKeyPrefix+"u1").Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u1", Code: e.Code(secret, time.Now())}); err != nil || !resp.OK {
+		t.Fatalf("Verify() = %+v, %v", resp, err)
+	}
+	after, err := client.Get(ctx, credKeyPrefix+"u1").Bytes()
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("credential rewritten by Verify: %s -> %s (%v)", before, after, err)
+	}
+}
+
+func TestEngine_SecretBoundToSubject(t *testing.T) {
+	client, _ := testutil.NewTestRedisClient()
+	defer func() { _ = client.Close() }()
+	e, err := New(client, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	secret := enroll(t, e, "u1")
+
+	raw, err := client.Get(ctx, credKeyPrefix+"u1").Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret))) {
+		t.Error("secret stored in plain text")
+	}
+	// A credential copied to another subject does not decrypt
+	if err := client.Set(ctx, credKeyPrefix+"u2", raw, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Verify(ctx, &heraldtotp.VerifyRequest{Subject: "u2", Code: e.Code(secret, time.Now())}); err == nil || errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify(copied credential) error = %v, want decryption failure", err)
+	}
+}
+
+func TestEngine_OtpauthURI(t *testing.T) {
+	e, err := New(nil, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(e.otpauthURI("alice@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Herald:alice@example.com" ||
+		q.Get("secret") != "JBSWY3DPEHPK3PXP" || q.Get("issuer") != "Herald" || q.Get("digits") != "6" || q.Get("period") != "30" {
+		t.Errorf("otpauthURI() = %s", u)
+	}
+}
@@ -0,0 +1,755 @@
+// Package webauthn implements WebAuthn (passkey / security key) registration and assertion
+// ceremonies as a second factor. Challenges (sessions) and credentials live in Redis.
+// Options and responses use the JSON serialization of WebAuthn Level 3
+// (PublicKeyCredential.toJSON / parseCreationOptionsFromJSON), binary fields base64url.
+//
+// Attestation is not verified: registration requests attestation "none" and any statement
+// the authenticator still sends is ignored, so credentials prove possession of a key but
+// not the authenticator model.
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	secure "github.com/soulteary/secure-kit"
+
+	"github.com/soulteary/herald/internal/lock"
+)
+
+// Failure reasons (also the API reason codes)
+const (
+	ReasonInvalidSession       = "invalid_session"
+	ReasonInvalidCredential    = "invalid_credential"
+	ReasonUnsupportedAlgorithm = "unsupported_algorithm"
+	ReasonChallengeMismatch    = "challenge_mismatch"
+	ReasonOriginMismatch       = "origin_mismatch"
+	ReasonRPIDMismatch         = "rp_id_mismatch"
+	ReasonUserNotPresent       = "user_not_present"
+	ReasonUserNotVerified      = "user_not_verified"
+	ReasonInvalidSignature     = "invalid_signature"
+	ReasonSignCount            = "sign_count_invalid"
+	ReasonCredentialNotFound   = "credential_not_found"
+	ReasonCredentialExists     = "credential_exists"
+	ReasonNoCredentials        = "no_credentials"
+)
+
+// Error is a ceremony failure with an API reason code
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "webauthn: " + e.Reason
+}
+
+func errReason(reason string) error {
+	return &Error{Reason: reason}
+}
+
+// ReasonOf returns the reason code of a ceremony failure, or "" for other errors
+func ReasonOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Reason
+	}
+	return ""
+}
+
+// User verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// Authenticator data flags
+const (
+	flagUP = 0x01 // User present
+	flagUV = 0x04 // User verified
+	flagBE = 0x08 // Backup eligible
+	flagBS = 0x10 // Backed up
+	flagAT = 0x40 // Attested credential data included
+)
+
+// Redis key prefixes
+const (
+	sessionKeyPrefix = "otp:webauthn:session:"
+	credKeyPrefix    = "otp:webauthn:cred:"
+	credsKeyPrefix   = "otp:webauthn:creds:"
+	handleKeyPrefix  = "otp:webauthn:handle:"
+	credLockPrefix   = "otp:webauthn:credlock:"
+	credsLockPrefix  = "otp:webauthn:credslock:"
+)
+
+// lockWait bounds how long a credential or credential list update waits for a concurrent one
+const lockWait = 2 * time.Second
+
+// Session types
+const (
+	sessionRegister = "register"
+	sessionAssert   = "assert"
+)
+
+// Config configures the relying party
+type Config struct {
+	RPID             string   // e.g. "example.com"
+	RPName           string   // Shown by the authenticator
+	Origins          []string // Allowed clientData origins, e.g. "https://login.example.com"
+	Timeout          time.Duration
+	UserVerification string // required, preferred or discouraged
+}
+
+// RelyingParty is PublicKeyCredentialRpEntity
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is PublicKeyCredentialUserEntityJSON
+type UserEntity struct {
+	ID          string `json:"id"` // User handle, base64url
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is PublicKeyCredentialParameters
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor is PublicKeyCredentialDescriptorJSON
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection is AuthenticatorSelectionCriteria
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptionsJSON
+type CreationOptions struct {
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptionsJSON
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse is AuthenticatorAttestationResponseJSON
+type AttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// RegistrationResponse is RegistrationResponseJSON (PublicKeyCredential.toJSON after create)
+type RegistrationResponse struct {
+	ID       string              `json:"id"`
+	RawID    string              `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse is AuthenticatorAssertionResponseJSON
+type AssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// AuthenticationResponse is AuthenticationResponseJSON (PublicKeyCredential.toJSON after get)
+type AuthenticationResponse struct {
+	ID       string            `json:"id"`
+	RawID    string            `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// Credential is a registered credential
+type Credential struct {
+	ID             string   `json:"id"` // base64url credential ID
+	UserID         string   `json:"user_id"`
+	Name           string   `json:"name,omitempty"`
+	PublicKey      []byte   `json:"public_key"` // COSE_Key
+	Algorithm      int64    `json:"alg"`
+	SignCount      uint32   `json:"sign_count"`
+	AAGUID         string   `json:"aaguid"` // hex
+	Transports     []string `json:"transports,omitempty"`
+	BackupEligible bool     `json:"backup_eligible"`
+	BackedUp       bool     `json:"backed_up"`
+	CreatedAt      int64    `json:"created_at"`
+	LastUsedAt     int64    `json:"last_used_at,omitempty"`
+}
+
+// session is a pending ceremony
+type session struct {
+	Type             string `json:"type"`
+	Challenge        string `json:"challenge"`
+	UserID           string `json:"user_id,omitempty"`
+	Name             string `json:"name,omitempty"` // Register: credential name
+	UserVerification string `json:"user_verification"`
+}
+
+// clientData is CollectedClientData
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the parsed authenticator data
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte // COSE_Key
+}
+
+// Manager runs ceremonies and stores credentials
+type Manager struct {
+	redis  *redis.Client
+	locker *lock.Locker
+	cfg    Config
+}
+
+// NewManager creates a manager
+func NewManager(redisClient *redis.Client, cfg Config) *Manager {
+	if cfg.RPName == "" {
+		cfg.RPName = cfg.RPID
+	}
+	if cfg.UserVerification == "" {
+		cfg.UserVerification = UserVerificationPreferred
+	}
+	return &Manager{redis: redisClient, locker: lock.NewLocker(redisClient), cfg: cfg}
+}
+
+// BeginRegistration starts registering a new credential for userID.
+// name labels the credential (e.g. "YubiKey"); userName and displayName are shown by the authenticator.
+func (m *Manager) BeginRegistration(ctx context.Context, userID, userName, displayName, name string) (string, *CreationOptions, error) {
+	handle, err := m.userHandle(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	creds, err := m.Credentials(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if userName == "" {
+		userName = userID
+	}
+	if displayName == "" {
+		displayName = userName
+	}
+
+	sessionID, challenge, err := m.startSession(ctx, session{
+		Type:             sessionRegister,
+		UserID:           userID,
+		Name:             name,
+		UserVerification: m.cfg.UserVerification,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+	return sessionID, &CreationOptions{
+		RP:                 RelyingParty{ID: m.cfg.RPID, Name: m.cfg.RPName},
+		User:               UserEntity{ID: handle, Name: userName, DisplayName: displayName},
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            m.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(creds),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: m.cfg.UserVerification,
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// FinishRegistration verifies the authenticator response and stores the new credential
+func (m *Manager) FinishRegistration(ctx context.Context, sessionID string, resp *RegistrationResponse) (*Credential, error) {
+	s, err := m.takeSession(ctx, sessionID, sessionRegister)
+	if err != nil {
+		return nil, err
+	}
+	rawID, err := credentialID(resp.ID, resp.RawID, resp.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataJSON, err := decodeB64URL(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	if err := m.checkClientData(clientDataJSON, "webauthn.create", s.Challenge); err != nil {
+		return nil, err
+	}
+
+	attObj, err := decodeB64URL(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	v, _, err := decodeCBOR(attObj)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	att, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	rawAuthData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkAuthenticatorData(ad, s.UserVerification); err != nil {
+		return nil, err
+	}
+	if ad.flags&flagAT == 0 || !bytes.Equal(ad.credentialID, rawID) {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	key, err := parseCOSEKey(ad.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cred := &Credential{
+		ID:             base64.RawURLEncoding.EncodeToString(rawID),
+		UserID:         s.UserID,
+		Name:           s.Name,
+		PublicKey:      ad.publicKey,
+		Algorithm:      key.alg,
+		SignCount:      ad.signCount,
+		AAGUID:         hex.EncodeToString(ad.aaguid),
+		Transports:     resp.Response.Transports,
+		BackupEligible: ad.flags&flagBE != 0,
+		BackedUp:       ad.flags&flagBS != 0,
+		CreatedAt:      time.Now().Unix(),
+	}
+	data, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	// Credential IDs are global: a credential belongs to one user only
+	err = m.redis.SetArgs(ctx, credKeyPrefix+cred.ID, data, redis.SetArgs{Mode: "NX"}).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil, errReason(ReasonCredentialExists)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store credential: %w", err)
+	}
+	// Concurrent registrations of the same user must not drop each other's ID from the list
+	err = m.withLock(ctx, credsLockPrefix+s.UserID, func() error {
+		ids, err := m.credentialIDs(ctx, s.UserID)
+		if err != nil {
+			return err
+		}
+		return m.setJSON(ctx, credsKeyPrefix+s.UserID, append(ids, cred.ID), 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// BeginLogin starts an assertion. With a userID, only that user's credentials are allowed;
+// without one, any discoverable credential (passkey) may answer and identifies the user.
+func (m *Manager) BeginLogin(ctx context.Context, userID string) (string, *RequestOptions, error) {
+	allow := []CredentialDescriptor{}
+	if userID != "" {
+		creds, err := m.Credentials(ctx, userID)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(creds) == 0 {
+			return "", nil, errReason(ReasonNoCredentials)
+		}
+		allow = descriptors(creds)
+	}
+
+	sessionID, challenge, err := m.startSession(ctx, session{
+		Type:             sessionAssert,
+		UserID:           userID,
+		UserVerification: m.cfg.UserVerification,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return sessionID, &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          m.cfg.Timeout.Milliseconds(),
+		RPID:             m.cfg.RPID,
+		AllowCredentials: allow,
+		UserVerification: m.cfg.UserVerification,
+	}, nil
+}
+
+// FinishLogin verifies an assertion and returns the credential used (with its owner)
+func (m *Manager) FinishLogin(ctx context.Context, sessionID string, resp *AuthenticationResponse) (*Credential, error) {
+	s, err := m.takeSession(ctx, sessionID, sessionAssert)
+	if err != nil {
+		return nil, err
+	}
+	rawID, err := credentialID(resp.ID, resp.RawID, resp.Type)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := m.credential(ctx, base64.RawURLEncoding.EncodeToString(rawID))
+	if err != nil {
+		return nil, err
+	}
+	if s.UserID != "" && cred.UserID != s.UserID {
+		return nil, errReason(ReasonCredentialNotFound)
+	}
+	// The user handle, when sent (always for discoverable credentials), must be the owner's
+	if resp.Response.UserHandle != "" || s.UserID == "" {
+		handle, err := m.userHandle(ctx, cred.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(strings.TrimRight(resp.Response.UserHandle, "=")), []byte(handle)) != 1 {
+			return nil, errReason(ReasonCredentialNotFound)
+		}
+	}
+
+	clientDataJSON, err := decodeB64URL(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	if err := m.checkClientData(clientDataJSON, "webauthn.get", s.Challenge); err != nil {
+		return nil, err
+	}
+	rawAuthData, err := decodeB64URL(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkAuthenticatorData(ad, s.UserVerification); err != nil {
+		return nil, err
+	}
+
+	sig, err := decodeB64URL(resp.Response.Signature)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	key, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	if !key.verify(append(rawAuthData, clientDataHash[:]...), sig) {
+		return nil, errReason(ReasonInvalidSignature)
+	}
+
+	// Compare and set the counter under the credential's lock, against the stored value: of
+	// concurrent assertions with the same counter only one is accepted
+	err = m.withLock(ctx, credLockPrefix+cred.ID, func() error {
+		current, err := m.credential(ctx, cred.ID)
+		if err != nil {
+			return err
+		}
+		// A counter that does not increase suggests a cloned authenticator
+		if (ad.signCount != 0 || current.SignCount != 0) && ad.signCount <= current.SignCount {
+			return errReason(ReasonSignCount)
+		}
+		current.SignCount = ad.signCount
+		current.BackedUp = ad.flags&flagBS != 0
+		current.LastUsedAt = time.Now().Unix()
+		cred = current
+		return m.setJSON(ctx, credKeyPrefix+cred.ID, cred, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// Credentials returns the credentials of userID
+func (m *Manager) Credentials(ctx context.Context, userID string) ([]Credential, error) {
+	ids, err := m.credentialIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	creds := make([]Credential, 0, len(ids))
+	for _, id := range ids {
+		cred, err := m.credential(ctx, id)
+		if ReasonOf(err) == ReasonCredentialNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, *cred)
+	}
+	return creds, nil
+}
+
+func (m *Manager) checkClientData(raw []byte, typ, challenge string) error {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return errReason(ReasonInvalidCredential)
+	}
+	if cd.Type != typ {
+		return errReason(ReasonInvalidCredential)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return errReason(ReasonChallengeMismatch)
+	}
+	if cd.CrossOrigin || !slices.Contains(m.cfg.Origins, cd.Origin) {
+		return errReason(ReasonOriginMismatch)
+	}
+	return nil
+}
+
+func (m *Manager) checkAuthenticatorData(ad *authenticatorData, userVerification string) error {
+	rpIDHash := sha256.Sum256([]byte(m.cfg.RPID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return errReason(ReasonRPIDMismatch)
+	}
+	if ad.flags&flagUP == 0 {
+		return errReason(ReasonUserNotPresent)
+	}
+	if userVerification == UserVerificationRequired && ad.flags&flagUV == 0 {
+		return errReason(ReasonUserNotVerified)
+	}
+	return nil
+}
+
+// parseAuthenticatorData parses authenticator data (WebAuthn §6.1)
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAT == 0 {
+		return ad, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad.aaguid = rest[:16]
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	// The COSE key is followed by extensions (if ED is set): its length is what the decoder consumed
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+func (m *Manager) startSession(ctx context.Context, s session) (string, string, error) {
+	id, err := secure.RandomHex(16)
+	if err != nil {
+		return "", "", err
+	}
+	challenge, err := secure.RandomBytes(32)
+	if err != nil {
+		return "", "", err
+	}
+	s.Challenge = base64.RawURLEncoding.EncodeToString(challenge)
+	id = "wa_" + id
+	if err := m.setJSON(ctx, sessionKeyPrefix+id, s, m.cfg.Timeout); err != nil {
+		return "", "", err
+	}
+	return id, s.Challenge, nil
+}
+
+// takeSession loads and deletes a session: each challenge can be answered once
+func (m *Manager) takeSession(ctx context.Context, id, typ string) (*session, error) {
+	if id == "" {
+		return nil, errReason(ReasonInvalidSession)
+	}
+	var s session
+	if err := m.getJSON(ctx, sessionKeyPrefix+id, &s); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errReason(ReasonInvalidSession)
+		}
+		return nil, err
+	}
+	n, err := m.redis.Del(ctx, sessionKeyPrefix+id).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete webauthn session: %w", err)
+	}
+	if n == 0 || s.Type != typ {
+		return nil, errReason(ReasonInvalidSession)
+	}
+	return &s, nil
+}
+
+// userHandle returns the random user handle of userID, creating it on first use.
+// Authenticators store it with discoverable credentials, so it must not reveal the user ID.
+func (m *Manager) userHandle(ctx context.Context, userID string) (string, error) {
+	handle, err := m.redis.Get(ctx, handleKeyPrefix+userID).Result()
+	if err == nil {
+		return handle, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("failed to read user handle: %w", err)
+	}
+	b, err := secure.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	handle = base64.RawURLEncoding.EncodeToString(b)
+	err = m.redis.SetArgs(ctx, handleKeyPrefix+userID, handle, redis.SetArgs{Mode: "NX"}).Err()
+	if errors.Is(err, redis.Nil) {
+		return m.redis.Get(ctx, handleKeyPrefix+userID).Result() // Created concurrently
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to store user handle: %w", err)
+	}
+	return handle, nil
+}
+
+func (m *Manager) credential(ctx context.Context, id string) (*Credential, error) {
+	var cred Credential
+	if err := m.getJSON(ctx, credKeyPrefix+id, &cred); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errReason(ReasonCredentialNotFound)
+		}
+		return nil, err
+	}
+	return &cred, nil
+}
+
+// withLock runs update while holding the lock key, waiting up to lockWait for it
+func (m *Manager) withLock(ctx context.Context, key string, update func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, lockWait)
+	defer cancel()
+	for {
+		ok, err := m.locker.Lock(key)
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", key, err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to lock %s: %w", key, ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer func() { _ = m.locker.Unlock(key) }()
+	return update()
+}
+
+func (m *Manager) credentialIDs(ctx context.Context, userID string) ([]string, error) {
+	var ids []string
+	if err := m.getJSON(ctx, credsKeyPrefix+userID, &ids); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (m *Manager) setJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := m.redis.Set(ctx, key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// getJSON returns redis.Nil for missing keys
+func (m *Manager) getJSON(ctx context.Context, key string, v interface{}) error {
+	data, err := m.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return err
+		}
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return json.Unmarshal(data, v)
+}
+
+func descriptors(creds []Credential) []CredentialDescriptor {
+	out := make([]CredentialDescriptor, len(creds))
+	for i, c := range creds {
+		out[i] = CredentialDescriptor{Type: "public-key", ID: c.ID, Transports: c.Transports}
+	}
+	return out
+}
+
+// credentialID decodes rawId (falling back to id) and checks both agree
+func credentialID(id, rawID, typ string) ([]byte, error) {
+	if typ != "public-key" {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	if rawID == "" {
+		rawID = id
+	}
+	raw, err := decodeB64URL(rawID)
+	if err != nil || len(raw) == 0 {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	if id != "" && strings.TrimRight(id, "=") != base64.RawURLEncoding.EncodeToString(raw) {
+		return nil, errReason(ReasonInvalidCredential)
+	}
+	return raw, nil
+}
+
+// decodeB64URL decodes base64url with or without padding
+func decodeB64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,307 @@
+package webauthn
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/soulteary/herald/internal/testutil"
+	"github.com/soulteary/herald/internal/webauthn/webauthntest"
+)
+
+const testOrigin = "https://login.example.com"
+
+func testManager(t *testing.T, uv string) (*Manager, *redis.Client) {
+	t.Helper()
+	client, _ := testutil.NewTestRedisClient()
+	t.Cleanup(func() { _ = client.Close() })
+	return NewManager(client, Config{
+		RPID:             "example.com",
+		RPName:           "Example",
+		Origins:          []string{testOrigin},
+		Timeout:          time.Minute,
+		UserVerification: uv,
+	}), client
+}
+
+// register runs a full registration of auth for userID
+func register(t *testing.T, m *Manager, auth *webauthntest.Authenticator, userID string) (*Credential, error) {
+	t.Helper()
+	ctx := context.Background()
+	sessionID, opts, err := m.BeginRegistration(ctx, userID, "", "", "key")
+	if err != nil {
+		t.Fatalf("BeginRegistration() error = %v", err)
+	}
+	var resp RegistrationResponse
+	answer(t, opts, auth.Register, &resp)
+	return m.FinishRegistration(ctx, sessionID, &resp)
+}
+
+// login runs a full assertion of auth, for userID or (if empty) as a discoverable credential
+func login(t *testing.T, m *Manager, auth *webauthntest.Authenticator, userID string) (*Credential, error) {
+	t.Helper()
+	ctx := context.Background()
+	sessionID, opts, err := m.BeginLogin(ctx, userID)
+	if err != nil {
+		t.Fatalf("BeginLogin() error = %v", err)
+	}
+	var resp AuthenticationResponse
+	answer(t, opts, auth.Assert, &resp)
+	return m.FinishLogin(ctx, sessionID, &resp)
+}
+
+func answer(t *testing.T, opts interface{}, authenticator func([]byte) ([]byte, error), resp interface{}) {
+	t.Helper()
+	raw, _ := json.Marshal(opts)
+	out, err := authenticator(raw)
+	if err != nil {
+		t.Fatalf("authenticator error = %v", err)
+	}
+	if err := json.Unmarshal(out, resp); err != nil {
+		t.Fatalf("authenticator response: %v", err)
+	}
+}
+
+func TestManager_RegisterAndLogin(t *testing.T) {
+	m, _ := testManager(t, UserVerificationPreferred)
+	ctx := context.Background()
+	auth := webauthntest.New(testOrigin)
+
+	if _, _, err := m.BeginLogin(ctx, "u1"); ReasonOf(err) != ReasonNoCredentials {
+		t.Fatalf("BeginLogin() without credentials error = %v, want %s", err, ReasonNoCredentials)
+	}
+
+	cred, err := register(t, m, auth, "u1")
+	if err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+	if cred.UserID != "u1" || cred.Algorithm != AlgES256 || cred.Name != "key" {
+		t.Errorf("credential = %+v", cred)
+	}
+
+	// Registering the same authenticator again is excluded
+	_, opts, _ := m.BeginRegistration(ctx, "u1", "", "", "")
+	if len(opts.ExcludeCredentials) != 1 || opts.ExcludeCredentials[0].ID != cred.ID {
+		t.Errorf("ExcludeCredentials = %+v", opts.ExcludeCredentials)
+	}
+	dup := *auth
+	if _, err := register(t, m, &dup, "u2"); ReasonOf(err) != ReasonCredentialExists {
+		t.Errorf("re-register error = %v, want %s", err, ReasonCredentialExists)
+	}
+
+	got, err := login(t, m, auth, "u1")
+	if err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if got.UserID != "u1" || got.SignCount != 1 {
+		t.Errorf("FinishLogin() = %+v", got)
+	}
+
+	// Discoverable: no user ID, the credential identifies the user
+	got, err = login(t, m, auth, "")
+	if err != nil || got.UserID != "u1" {
+		t.Fatalf("discoverable FinishLogin() = %+v, %v", got, err)
+	}
+
+	// Another user's credentials are not allowed
+	other := webauthntest.New(testOrigin)
+	if _, err := register(t, m, other, "u2"); err != nil {
+		t.Fatalf("FinishRegistration(u2) error = %v", err)
+	}
+	if _, err := login(t, m, other, "u1"); ReasonOf(err) != ReasonCredentialNotFound {
+		t.Errorf("FinishLogin(other user's key) error = %v, want %s", err, ReasonCredentialNotFound)
+	}
+
+	creds, err := m.Credentials(ctx, "u1")
+	if err != nil || len(creds) != 1 {
+		t.Errorf("Credentials() = %d, %v; want 1", len(creds), err)
+	}
+}
+
+func TestManager_Concurrent(t *testing.T) {
+	m, _ := testManager(t, UserVerificationPreferred)
+	ctx := context.Background()
+
+	// Concurrent registrations of one user keep every credential ID
+	const n = 20
+	sessions := make([]string, n)
+	responses := make([]RegistrationResponse, n)
+	auths := make([]*webauthntest.Authenticator, n)
+	for i := range n {
+		auths[i] = webauthntest.New(testOrigin)
+		sessionID, opts, err := m.BeginRegistration(ctx, "u1", "", "", "key")
+		if err != nil {
+			t.Fatalf("BeginRegistration() error = %v", err)
+		}
+		sessions[i] = sessionID
+		answer(t, opts, auths[i].Register, &responses[i])
+	}
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.FinishRegistration(ctx, sessions[i], &responses[i]); err != nil {
+				t.Errorf("FinishRegistration() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if creds, err := m.Credentials(ctx, "u1"); err != nil || len(creds) != n {
+		t.Fatalf("Credentials() = %d, %v; want %d", len(creds), err, n)
+	}
+
+	// Concurrent assertions with the same sign count: only one is accepted
+	loginSessions := make([]string, n)
+	assertions := make([]AuthenticationResponse, n)
+	for i := range n {
+		sessionID, opts, err := m.BeginLogin(ctx, "u1")
+		if err != nil {
+			t.Fatalf("BeginLogin() error = %v", err)
+		}
+		loginSessions[i] = sessionID
+		clone := *auths[0]
+		answer(t, opts, clone.Assert, &assertions[i])
+	}
+	var accepted atomic.Int32
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.FinishLogin(ctx, loginSessions[i], &assertions[i])
+			switch {
+			case err == nil:
+				accepted.Add(1)
+			case ReasonOf(err) != ReasonSignCount:
+				t.Errorf("FinishLogin() error = %v, want %s", err, ReasonSignCount)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := accepted.Load(); got != 1 {
+		t.Errorf("FinishLogin() accepted %d assertions with the same sign count, want 1", got)
+	}
+}
+
+func TestManager_SessionIsSingleUse(t *testing.T) {
+	m, _ := testManager(t, UserVerificationPreferred)
+	ctx := context.Background()
+	auth := webauthntest.New(testOrigin)
+	if _, err := register(t, m, auth, "u1"); err != nil {
+		t.Fatalf("FinishRegistration() error = %v", err)
+	}
+
+	sessionID, opts, _ := m.BeginLogin(ctx, "u1")
+	var resp AuthenticationResponse
+	answer(t, opts, auth.Assert, &resp)
+	if _, err := m.FinishLogin(ctx, sessionID, &resp); err != nil {
+		t.Fatalf("FinishLogin() error = %v", err)
+	}
+	if _, err := m.FinishLogin(ctx, sessionID, &resp); ReasonOf(err) != ReasonInvalidSession {
+		t.Errorf("replayed FinishLogin() error = %v, want %s", err, ReasonInvalidSession)
+	}
+
+	// A registration session cannot finish an assertion
+	regSession, _, _ := m.BeginRegistration(ctx, "u1", "", "", "")
+	if _, err := m.FinishLogin(ctx, regSession, &resp); ReasonOf(err) != ReasonInvalidSession {
+		t.Errorf("FinishLogin(register session) error = %v, want %s", err, ReasonInvalidSession)
+	}
+}
+
+func TestManager_Rejections(t *testing.T) {
+	tests := []struct {
+		name   string
+		uv     string
+		mutate func(a *webauthntest.Authenticator)
+		want   string
+	}{
+		{"wrong origin", UserVerificationPreferred, func(a *webauthntest.Authenticator) { a.Origin = "https://evil.example" }, ReasonOriginMismatch},
+		{"user not present", UserVerificationPreferred, func(a *webauthntest.Authenticator) { a.Flags = 0 }, ReasonUserNotPresent},
+		{"user not verified", UserVerificationRequired, func(a *webauthntest.Authenticator) { a.Flags = 0x01 }, ReasonUserNotVerified},
+		{"cloned counter", UserVerificationPreferred, func(a *webauthntest.Authenticator) { a.SignCount = 0 }, ReasonSignCount},
+		{"wrong key", UserVerificationPreferred, func(a *webauthntest.Authenticator) {
+			a.Key = webauthntest.New(testOrigin).Key
+		}, ReasonInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := testManager(t, tt.uv)
+			auth := webauthntest.New(testOrigin)
+			if _, err := register(t, m, auth, "u1"); err != nil {
+				t.Fatalf("FinishRegistration() error = %v", err)
+			}
+			if _, err := login(t, m, auth, "u1"); err != nil {
+				t.Fatalf("FinishLogin() error = %v", err)
+			}
+			tt.mutate(auth)
+			if _, err := login(t, m, auth, "u1"); ReasonOf(err) != tt.want {
+				t.Errorf("FinishLogin() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_RegisterWrongRPID(t *testing.T) {
+	m, _ := testManager(t, UserVerificationPreferred)
+	ctx := context.Background()
+	sessionID, opts, _ := m.BeginRegistration(ctx, "u1", "", "", "")
+	opts.RP.ID = "evil.example"
+	var resp RegistrationResponse
+	answer(t, opts, webauthntest.New(testOrigin).Register, &resp)
+	if _, err := m.FinishRegistration(ctx, sessionID, &resp); ReasonOf(err) != ReasonRPIDMismatch {
+		t.Errorf("FinishRegistration() error = %v, want %s", err, ReasonRPIDMismatch)
+	}
+}
+
+func TestParseCOSEKey_Ed25519(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	// {1: 1 (OKP), 3: -8 (EdDSA), -1: 6 (Ed25519), -2: x}
+	data := append([]byte{0xa4, 0x01, 0x01, 0x03, 0x27, 0x20, 0x06, 0x21, 0x58, 0x20}, pub...)
+	key, err := parseCOSEKey(data)
+	if err != nil {
+		t.Fatalf("parseCOSEKey() error = %v", err)
+	}
+	msg := []byte("signed data")
+	if !key.verify(msg, ed25519.Sign(priv, msg)) {
+		t.Error("verify() = false for a valid signature")
+	}
+	if key.verify([]byte("other"), ed25519.Sign(priv, msg)) {
+		t.Error("verify() = true for a different message")
+	}
+
+	// ES384 is not supported
+	if _, err := parseCOSEKey([]byte{0xa2, 0x01, 0x02, 0x03, 0x38, 0x22}); ReasonOf(err) != ReasonUnsupportedAlgorithm {
+		t.Errorf("parseCOSEKey(ES384) error = %v, want %s", err, ReasonUnsupportedAlgorithm)
+	}
+}
+
+func TestDecodeCBOR_Malformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x5f},                         // Indefinite byte string
+		{0x59, 0x01},                   // Truncated length
+		{0x44, 0x01},                   // Truncated byte string
+		{0xa2, 0x01, 0x01},             // Missing map entry
+		{0xa2, 0x01, 0x01, 0x01, 0x02}, // Duplicate key
+		{0xa1, 0x40, 0x01},             // Byte string key
+	} {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("decodeCBOR(%x) error = nil", data)
+		}
+	}
+
+	v, rest, err := decodeCBOR([]byte{0x82, 0x20, 0x63, 'a', 'b', 'c', 0xf5})
+	if err != nil || len(rest) != 1 {
+		t.Fatalf("decodeCBOR() = %v, %x, %v", v, rest, err)
+	}
+	if arr := v.([]interface{}); arr[0] != int64(-1) || arr[1] != "abc" {
+		t.Errorf("decodeCBOR() = %v", v)
+	}
+}
@@ -0,0 +1,191 @@
+// Package webauthntest provides a software authenticator for testing WebAuthn ceremonies.
+// It takes WebAuthn options JSON and returns the credential JSON a browser would send
+// (PublicKeyCredential.toJSON), signing with an ES256 (P-256) key and attestation "none".
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+)
+
+// Authenticator holds one credential
+type Authenticator struct {
+	Origin       string
+	CredentialID []byte
+	UserHandle   string // Set by Register, sent in assertions
+	SignCount    uint32
+	Flags        byte // Authenticator data flags, UP|UV by default
+	Key          *ecdsa.PrivateKey
+}
+
+// New creates an authenticator for origin with a fresh key and credential ID
+func New(origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &Authenticator{Origin: origin, CredentialID: id, Flags: 0x01 | 0x04, Key: key}
+}
+
+// Register answers PublicKeyCredentialCreationOptionsJSON with RegistrationResponseJSON
+func (a *Authenticator) Register(options []byte) ([]byte, error) {
+	var opts struct {
+		RP        struct{ ID string } `json:"rp"`
+		User      struct{ ID string } `json:"user"`
+		Challenge string              `json:"challenge"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+	a.UserHandle = opts.User.ID
+
+	pub, err := a.Key.PublicKey.Bytes() // 0x04 || x || y
+	if err != nil {
+		return nil, err
+	}
+	x, y := pub[1:33], pub[33:]
+	coseKey := encodeMap(map[int64]interface{}{1: int64(2), 3: int64(-7), -1: int64(1), -2: x, -3: y}) // EC2, ES256, P-256
+
+	authData := a.authData(opts.RP.ID, 0x40)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.CredentialID)))
+	authData = append(authData, a.CredentialID...)
+	authData = append(authData, coseKey...)
+
+	var attObj []byte
+	attObj = append(attObj, 0xa3) // Map of 3, keys in canonical order
+	attObj = append(attObj, encode("fmt")...)
+	attObj = append(attObj, encode("none")...)
+	attObj = append(attObj, encode("attStmt")...)
+	attObj = append(attObj, 0xa0)
+	attObj = append(attObj, encode("authData")...)
+	attObj = append(attObj, encode(authData)...)
+
+	id := b64(a.CredentialID)
+	return json.Marshal(map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(a.clientData("webauthn.create", opts.Challenge)),
+			"attestationObject": b64(attObj),
+			"transports":        []string{"usb"},
+		},
+	})
+}
+
+// Assert answers PublicKeyCredentialRequestOptionsJSON with AuthenticationResponseJSON,
+// incrementing the signature counter
+func (a *Authenticator) Assert(options []byte) ([]byte, error) {
+	var opts struct {
+		RPID      string `json:"rpId"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+	a.SignCount++
+	authData := a.authData(opts.RPID, 0)
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), hash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	id := b64(a.CredentialID)
+	return json.Marshal(map[string]interface{}{
+		"id":    id,
+		"rawId": id,
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        a.UserHandle,
+		},
+	})
+}
+
+func (a *Authenticator) authData(rpID string, extraFlags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, a.Flags|extraFlags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+func (a *Authenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// encode encodes int64, []byte and string as CBOR
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	default:
+		panic("webauthntest: unsupported CBOR type")
+	}
+}
+
+// encodeMap encodes a COSE key map in CTAP2 canonical order
+func encodeMap(m map[int64]interface{}) []byte {
+	keys := make([]int64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ki, kj := encode(keys[i]), encode(keys[j])
+		if len(ki) != len(kj) {
+			return len(ki) < len(kj)
+		}
+		return string(ki) < string(kj)
+	})
+	out := head(5, uint64(len(m)))
+	for _, k := range keys {
+		out = append(out, encode(k)...)
+		out = append(out, encode(m[k])...)
+	}
+	return out
+}
+
+func head(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	default:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	}
+}
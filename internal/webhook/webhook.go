@@ -0,0 +1,228 @@
+// Package webhook implements the webhook channel: the code is POSTed as signed JSON to an
+// endpoint registered in config (e.g. an in-app push service). The challenge destination is
+// the endpoint ID, so callers cannot make Herald post to arbitrary URLs.
+//
+// Requests are signed like event webhooks (see package events): X-Timestamp, X-Service and
+// X-Signature, an HMAC-SHA256 over "timestamp:herald:body" with the endpoint secret.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	provider "github.com/soulteary/provider-kit"
+
+	"github.com/soulteary/herald/internal/events"
+)
+
+// Channel is the webhook channel
+const Channel provider.Channel = "webhook"
+
+// PayloadType is the type of the delivered payload
+const PayloadType = "otp_code"
+
+// Message params read into the payload
+const (
+	ParamUserID    = "user_id"
+	ParamPurpose   = "purpose"
+	ParamExpiresIn = "expires_in"
+)
+
+// defaultTimeout applies per delivery attempt when no timeout is configured
+const defaultTimeout = 5 * time.Second
+
+// endpointID matches endpoint IDs (also the challenge destination)
+var endpointID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Endpoint is a registered delivery URL
+type Endpoint struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Payload is the JSON body POSTed to an endpoint
+type Payload struct {
+	Type        string `json:"type"`
+	Endpoint    string `json:"endpoint"`
+	ChallengeID string `json:"challenge_id"`
+	UserID      string `json:"user_id"`
+	Code        string `json:"code"`
+	Body        string `json:"body,omitempty"`
+	Locale      string `json:"locale,omitempty"`
+	Purpose     string `json:"purpose,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// ParseEndpoints parses endpoints from a JSON array, e.g.
+// [{"id":"inapp","url":"https://push.internal/herald","secret":"..."}]
+func ParseEndpoints(data string) ([]Endpoint, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var endpoints []Endpoint
+	if err := json.Unmarshal([]byte(data), &endpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook endpoints JSON: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, e := range endpoints {
+		if !endpointID.MatchString(e.ID) {
+			return nil, fmt.Errorf("webhook endpoint %d: invalid id %q", i, e.ID)
+		}
+		if seen[e.ID] {
+			return nil, fmt.Errorf("webhook endpoint %d: duplicate id %q", i, e.ID)
+		}
+		if !strings.HasPrefix(e.URL, "http://") && !strings.HasPrefix(e.URL, "https://") {
+			return nil, fmt.Errorf("webhook endpoint %s: url must be http(s)", e.ID)
+		}
+		if e.Secret == "" {
+			return nil, fmt.Errorf("webhook endpoint %s: secret required", e.ID)
+		}
+		seen[e.ID] = true
+	}
+	return endpoints, nil
+}
+
+// Provider delivers codes to registered endpoints. Each Send is a single attempt; use WithRetry
+// for retries.
+type Provider struct {
+	endpoints map[string]Endpoint
+	client    *http.Client
+}
+
+// New creates a provider for endpoints; timeout applies per attempt
+func New(endpoints []Endpoint, timeout time.Duration) *Provider {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	p := &Provider{
+		endpoints: make(map[string]Endpoint, len(endpoints)),
+		client:    &http.Client{Timeout: timeout},
+	}
+	for _, e := range endpoints {
+		p.endpoints[e.ID] = e
+	}
+	return p
+}
+
+// WithRetry wraps p so failed deliveries (network errors, 5xx, 429) are retried up to
+// maxRetries times with exponential backoff starting at retryDelay
+func (p *Provider) WithRetry(maxRetries int, retryDelay time.Duration) provider.Provider {
+	return provider.NewRetryProvider(p, &provider.RetryConfig{
+		MaxRetries:        maxRetries,
+		RetryDelay:        retryDelay,
+		MaxRetryDelay:     5 * time.Second,
+		BackoffMultiplier: 2.0,
+		RetryableReasons:  provider.DefaultRetryConfig().RetryableReasons,
+	})
+}
+
+// Has reports whether id is a registered endpoint
+func (p *Provider) Has(id string) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.endpoints[id]
+	return ok
+}
+
+// Send POSTs the signed payload to the endpoint named by msg.To
+func (p *Provider) Send(ctx context.Context, msg *provider.Message) (*provider.SendResult, error) {
+	endpoint, ok := p.endpoints[msg.To]
+	if !ok {
+		return p.fail(provider.NewProviderError(provider.ReasonInvalidDestination, "unknown webhook endpoint "+msg.To))
+	}
+
+	expiresIn, _ := strconv.Atoi(msg.Params[ParamExpiresIn])
+	body, err := json.Marshal(Payload{
+		Type:        PayloadType,
+		Endpoint:    endpoint.ID,
+		ChallengeID: msg.IdempotencyKey,
+		UserID:      msg.Params[ParamUserID],
+		Code:        msg.Code,
+		Body:        msg.Body,
+		Locale:      msg.Locale,
+		Purpose:     msg.Params[ParamPurpose],
+		ExpiresIn:   expiresIn,
+		Timestamp:   time.Now().Unix(),
+	})
+	if err != nil {
+		return p.fail(provider.ErrSendFailed("failed to marshal payload", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return p.fail(provider.ErrInvalidConfig("invalid webhook url").WithError(err))
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Timestamp", timestamp)
+	req.Header.Set("X-Service", events.ServiceName)
+	req.Header.Set("X-Signature", events.Sign(endpoint.Secret, timestamp, body))
+	if msg.IdempotencyKey != "" {
+		// Retries of one delivery share the key so the endpoint can drop duplicates
+		req.Header.Set("Idempotency-Key", msg.IdempotencyKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return p.fail(provider.ErrProviderDown("webhook request failed", err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return p.fail(provider.NewProviderError(provider.ReasonRateLimited, "webhook endpoint rate limited"))
+	case resp.StatusCode >= 500:
+		return p.fail(provider.ErrProviderDown(fmt.Sprintf("webhook endpoint returned status %d", resp.StatusCode), nil))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return p.fail(provider.NewProviderError(provider.ReasonUnauthorized, "webhook endpoint rejected the signature"))
+	default:
+		return p.fail(provider.ErrSendFailed(fmt.Sprintf("webhook endpoint returned status %d", resp.StatusCode), nil))
+	}
+
+	// The endpoint may return {"message_id": "..."}; otherwise the challenge ID identifies the delivery
+	messageID := msg.IdempotencyKey
+	var result struct {
+		MessageID string `json:"message_id"`
+	}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && json.Unmarshal(data, &result) == nil && result.MessageID != "" {
+		messageID = result.MessageID
+	}
+	return provider.NewSuccessResult(p.Name(), Channel, messageID), nil
+}
+
+func (p *Provider) fail(err *provider.ProviderError) (*provider.SendResult, error) {
+	err = err.WithProvider(p.Name(), Channel)
+	return provider.NewFailureResult(p.Name(), Channel, err), err
+}
+
+// Channel returns the webhook channel
+func (p *Provider) Channel() provider.Channel {
+	return Channel
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return "webhook"
+}
+
+// Validate checks that at least one endpoint is registered
+func (p *Provider) Validate() error {
+	if len(p.endpoints) == 0 {
+		return provider.ErrInvalidConfig("no webhook endpoints registered")
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	provider "github.com/soulteary/provider-kit"
+
+	"github.com/soulteary/herald/internal/events"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints(`[{"id":"inapp","url":"https://push.internal/herald","secret":"s"}]`)
+	if err != nil || len(endpoints) != 1 || endpoints[0].ID != "inapp" {
+		t.Fatalf("ParseEndpoints() = %+v, %v", endpoints, err)
+	}
+	if endpoints, err := ParseEndpoints(""); err != nil || endpoints != nil {
+		t.Errorf("ParseEndpoints(empty) = %v, %v; want nil, nil", endpoints, err)
+	}
+
+	for _, data := range []string{
+		`not json`,
+		`[{"id":"","url":"https://x","secret":"s"}]`,
+		`[{"id":"a b","url":"https://x","secret":"s"}]`,
+		`[{"id":"a","url":"ftp://x","secret":"s"}]`,
+		`[{"id":"a","url":"https://x"}]`,
+		`[{"id":"a","url":"https://x","secret":"s"},{"id":"a","url":"https://y","secret":"s"}]`,
+	} {
+		if _, err := ParseEndpoints(data); err == nil {
+			t.Errorf("ParseEndpoints(%s) should fail", data)
+		}
+	}
+}
+
+func newMessage(to string) *provider.Message {
+	return provider.NewMessage(to).
+		WithCode("123456").
+		WithBody("Your code is 123456").
+		WithLocale("en").
+		WithIdempotencyKey("ch_1").
+		WithParam(ParamUserID, "u_123").
+		WithParam(ParamPurpose, "login").
+		WithParam(ParamExpiresIn, "300")
+}
+
+func TestProvider_Send_Signed(t *testing.T) {
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if want := events.Sign("secret", r.Header.Get("X-Timestamp"), body); r.Header.Get("X-Signature") != want {
+			t.Errorf("X-Signature = %q, want %q", r.Header.Get("X-Signature"), want)
+		}
+		if r.Header.Get("Idempotency-Key") != "ch_1" {
+			t.Errorf("Idempotency-Key = %q, want ch_1", r.Header.Get("Idempotency-Key"))
+		}
+		var p Payload
+		_ = json.Unmarshal(body, &p)
+		received <- p
+		_, _ = w.Write([]byte(`{"message_id":"push-42"}`))
+	}))
+	defer server.Close()
+
+	p := New([]Endpoint{{ID: "inapp", URL: server.URL, Secret: "secret"}}, time.Second)
+	result, err := p.Send(context.Background(), newMessage("inapp"))
+	if err != nil || !result.OK {
+		t.Fatalf("Send() = %+v, %v", result, err)
+	}
+	if result.MessageID != "push-42" {
+		t.Errorf("MessageID = %q, want push-42", result.MessageID)
+	}
+
+	got := <-received
+	want := Payload{Type: PayloadType, Endpoint: "inapp", ChallengeID: "ch_1", UserID: "u_123", Code: "123456", Body: "Your code is 123456",
+		Locale: "en", Purpose: "login", ExpiresIn: 300, Timestamp: got.Timestamp}
+	if got != want {
+		t.Errorf("payload = %+v, want %+v", got, want)
+	}
+}
+
+func TestProvider_Send_UnknownEndpoint(t *testing.T) {
+	p := New([]Endpoint{{ID: "inapp", URL: "http://127.0.0.1:1", Secret: "secret"}}, time.Second)
+	if p.Has("other") || !p.Has("inapp") {
+		t.Error("Has() mismatch")
+	}
+	_, err := p.Send(context.Background(), newMessage("other"))
+	if reason, _ := provider.GetErrorReason(err); reason != provider.ReasonInvalidDestination {
+		t.Errorf("Send(unknown) reason = %q, want %q", reason, provider.ReasonInvalidDestination)
+	}
+}
+
+func TestProvider_WithRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := New([]Endpoint{{ID: "inapp", URL: server.URL, Secret: "secret"}}, time.Second).WithRetry(3, time.Millisecond)
+	result, err := p.Send(context.Background(), newMessage("inapp"))
+	if err != nil || !result.OK {
+		t.Fatalf("Send() = %+v, %v", result, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("attempts = %d, want 3", calls.Load())
+	}
+	if result.MessageID != "ch_1" {
+		t.Errorf("MessageID = %q, want challenge ID", result.MessageID)
+	}
+}
+
+func TestProvider_WithRetry_ClientErrorNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	p := New([]Endpoint{{ID: "inapp", URL: server.URL, Secret: "secret"}}, time.Second).WithRetry(3, time.Millisecond)
+	result, err := p.Send(context.Background(), newMessage("inapp"))
+	if err == nil || result.OK {
+		t.Fatalf("Send() = %+v, %v; want failure", result, err)
+	}
+	if reason, _ := provider.GetErrorReason(err); reason != provider.ReasonUnauthorized {
+		t.Errorf("reason = %q, want %q", reason, provider.ReasonUnauthorized)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", calls.Load())
+	}
+}
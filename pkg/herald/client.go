@@ -186,6 +186,8 @@ type CreateChallengeRequest struct {
 	Locale      string `json:"locale"`
 	ClientIP    string `json:"client_ip"`
 	UA          string `json:"ua"`
+	// CaptchaToken is a captcha response or "{puzzle_id}:{nonce}" proof-of-work solution, when required
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 // CreateChallengeResponse represents the response from creating a challenge